@@ -0,0 +1,460 @@
+// Package batch runs many text-to-image jobs against a Draw Things server.
+//
+// Jobs are read from JSONL or CSV files, executed with bounded concurrency,
+// and their outcomes appended to a JSONL manifest. Failed jobs do not stop
+// the batch, and jobs recorded as succeeded in the manifest are skipped when
+// the batch is run again.
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/drawthings_go"
+	"github.com/drawthings_go/internal/fsutil"
+	"github.com/drawthings_go/prompt"
+	"github.com/drawthings_go/styles"
+)
+
+// DefaultOutputTemplate names output files after the job ID, adding the image
+// index for responses that contain more than one image.
+const DefaultOutputTemplate = "{{.ID}}{{if .Image}}_{{.Image}}{{end}}.png"
+
+// Generator generates images from text prompts. *drawthings.Client satisfies it.
+type Generator interface {
+	GenerateImage(ctx context.Context, req *drawthings.TextToImageRequest) (*drawthings.TextToImageResponse, error)
+}
+
+// TemplateData is passed to the output filename template.
+type TemplateData struct {
+	// ID is the job ID.
+	ID string
+	// Index is the 1-based position of the job in the batch.
+	Index int
+	// Image is the 0-based index of the image within the response.
+	Image int
+	// Seed is the seed sent to the server.
+	Seed int
+	// Prompt is a filename-safe slug of the prompt.
+	Prompt string
+}
+
+// Runner executes batches of jobs.
+type Runner struct {
+	generator      Generator
+	concurrency    int
+	outputDir      string
+	outputTemplate string
+	manifestPath   string
+	defaults       drawthings.TextToImageRequest
+	force          bool
+	onResult       func(Result)
+	renderer       *prompt.Renderer
+	promptTemplate string
+	templateSeed   int64
+	styles         []styles.Style
+}
+
+// Option is a function that configures a Runner.
+type Option func(*Runner)
+
+// WithConcurrency sets the number of jobs run at the same time (default 1).
+func WithConcurrency(n int) Option {
+	return func(r *Runner) {
+		r.concurrency = n
+	}
+}
+
+// WithOutputDir sets the directory output files are written to.
+func WithOutputDir(dir string) Option {
+	return func(r *Runner) {
+		r.outputDir = dir
+	}
+}
+
+// WithOutputTemplate sets the text/template used to name output files.
+// See TemplateData for the available fields.
+func WithOutputTemplate(tmpl string) Option {
+	return func(r *Runner) {
+		r.outputTemplate = tmpl
+	}
+}
+
+// WithManifest sets the path of the results manifest. Without a manifest,
+// results are only reported to the caller and reruns cannot skip jobs.
+func WithManifest(path string) Option {
+	return func(r *Runner) {
+		r.manifestPath = path
+	}
+}
+
+// WithDefaults sets request parameters used for fields a job leaves unset.
+func WithDefaults(defaults drawthings.TextToImageRequest) Option {
+	return func(r *Runner) {
+		r.defaults = defaults
+	}
+}
+
+// WithStyles applies style presets, in order, to the request of every job
+// after its prompt template is expanded. Style parameters take precedence
+// over those set with WithDefaults, but not over those set by a job.
+func WithStyles(s ...styles.Style) Option {
+	return func(r *Runner) {
+		r.styles = s
+	}
+}
+
+// WithForce runs every job, even those already recorded as succeeded.
+func WithForce(force bool) Option {
+	return func(r *Runner) {
+		r.force = force
+	}
+}
+
+// WithResultHandler sets a function called after each job finishes or is
+// skipped. It may be called from several goroutines at once.
+func WithResultHandler(fn func(Result)) Option {
+	return func(r *Runner) {
+		r.onResult = fn
+	}
+}
+
+// WithPromptRenderer expands the prompt of every job as a prompt template
+// (see package prompt) rendered by r, with the job's Vars added to those of
+// r. Each job makes its random choices with a seed derived from its ID and
+// the template seed, so rerunning a batch reproduces its prompts.
+func WithPromptRenderer(r *prompt.Renderer) Option {
+	return func(run *Runner) {
+		run.renderer = r
+	}
+}
+
+// WithPromptTemplate sets the prompt template used for jobs that have no
+// prompt of their own, and expands job prompts as WithPromptRenderer does.
+// Without WithPromptRenderer, templates are rendered without wildcards.
+func WithPromptTemplate(text string) Option {
+	return func(r *Runner) {
+		r.promptTemplate = text
+	}
+}
+
+// WithTemplateSeed sets the seed mixed into every job's prompt template
+// choices (default 0). Changing it picks a different set of variants.
+func WithTemplateSeed(seed int64) Option {
+	return func(r *Runner) {
+		r.templateSeed = seed
+	}
+}
+
+// NewRunner creates a batch runner that generates images with gen.
+func NewRunner(gen Generator, opts ...Option) *Runner {
+	r := &Runner{
+		generator:      gen,
+		concurrency:    1,
+		outputTemplate: DefaultOutputTemplate,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.concurrency < 1 {
+		r.concurrency = 1
+	}
+	if r.promptTemplate != "" && r.renderer == nil {
+		r.renderer = prompt.NewRenderer()
+	}
+
+	return r
+}
+
+// Summary describes the outcome of a batch run.
+type Summary struct {
+	Total     int
+	Succeeded int
+	Failed    int
+	Skipped   int
+	// Results holds one result per job, in job order.
+	Results []Result
+}
+
+// Run executes jobs and returns a summary. Individual job failures are
+// reported in the summary rather than as an error; Run only fails if the
+// manifest or output template cannot be used, or if ctx is cancelled.
+func (r *Runner) Run(ctx context.Context, jobs []Job) (*Summary, error) {
+	tmpl, err := template.New("output").Option("missingkey=error").Parse(r.outputTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output template: %w", err)
+	}
+	if r.promptTemplate != "" {
+		if _, err := prompt.Parse(r.promptTemplate); err != nil {
+			return nil, fmt.Errorf("invalid prompt template: %w", err)
+		}
+	}
+
+	previous := map[string]Result{}
+	var m *manifest
+	if r.manifestPath != "" {
+		if previous, err = readManifest(r.manifestPath); err != nil {
+			return nil, err
+		}
+		if m, err = openManifest(r.manifestPath); err != nil {
+			return nil, err
+		}
+		defer m.close()
+	}
+
+	summary := &Summary{
+		Total:   len(jobs),
+		Results: make([]Result, len(jobs)),
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		writeErr error
+		indexes  = make(chan int)
+	)
+
+	record := func(i int, res Result) {
+		if m != nil && res.Status != StatusSkipped {
+			if err := m.append(res); err != nil {
+				mu.Lock()
+				if writeErr == nil {
+					writeErr = err
+				}
+				mu.Unlock()
+			}
+		}
+
+		mu.Lock()
+		summary.Results[i] = res
+		switch res.Status {
+		case StatusSucceeded:
+			summary.Succeeded++
+		case StatusFailed:
+			summary.Failed++
+		case StatusSkipped:
+			summary.Skipped++
+		}
+		mu.Unlock()
+
+		if r.onResult != nil {
+			r.onResult(res)
+		}
+	}
+
+	for w := 0; w < r.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				record(i, r.runJob(ctx, tmpl, i, jobs[i]))
+			}
+		}()
+	}
+
+dispatch:
+	for i, job := range jobs {
+		if prev, ok := previous[job.ID]; ok && !r.force && completed(prev) {
+			prev.Status = StatusSkipped
+			record(i, prev)
+			continue
+		}
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if writeErr != nil {
+		return summary, writeErr
+	}
+	if err := ctx.Err(); err != nil {
+		return summary, err
+	}
+	return summary, nil
+}
+
+// completed reports whether a previous result succeeded and its outputs still exist.
+func completed(prev Result) bool {
+	if prev.Status != StatusSucceeded || len(prev.Outputs) == 0 {
+		return false
+	}
+	for _, path := range prev.Outputs {
+		if _, err := os.Stat(path); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// runJob generates and saves the images for a single job.
+func (r *Runner) runJob(ctx context.Context, tmpl *template.Template, index int, job Job) Result {
+	req := job.TextToImageRequest
+	applyDefaults(&req, &r.defaults)
+
+	res := Result{
+		ID:      job.ID,
+		Started: time.Now(),
+	}
+	fail := func(err error) Result {
+		res.Status = StatusFailed
+		res.Err = err
+		res.Error = err.Error()
+		res.ErrorType = drawthings.ErrorType(err)
+		res.Seed = req.Seed
+		res.Duration = time.Since(res.Started).Round(time.Millisecond).String()
+		return res
+	}
+
+	if r.renderer != nil {
+		expanded, err := r.expandPrompt(job)
+		if err != nil {
+			return fail(err)
+		}
+		job.Prompt = expanded
+		req.Prompt = expanded
+		res.Prompt = expanded
+	}
+	if len(r.styles) > 0 {
+		// Style parameters only yield to those the job sets itself.
+		styled := job.TextToImageRequest
+		styled.Prompt, styled.NegativePrompt = req.Prompt, req.NegativePrompt
+		styles.Apply(&styled, r.styles...)
+		applyDefaults(&styled, &r.defaults)
+		req = styled
+		res.Prompt = req.Prompt
+	}
+
+	if drawthings.PriorityFromContext(ctx) == drawthings.PriorityNormal {
+		// Let interactive requests on a shared client go first.
+		ctx = drawthings.WithPriority(ctx, drawthings.PriorityBatch)
+	}
+	resp, err := r.generator.GenerateImage(ctx, &req)
+	if err != nil {
+		return fail(err)
+	}
+	res.Seed = req.Seed
+
+	for i, encoded := range resp.Images {
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return fail(drawthings.NewDecodeError("failed to decode base64 image data", err))
+		}
+
+		path, err := r.outputPath(tmpl, index, i, job, req.Seed)
+		if err != nil {
+			return fail(err)
+		}
+		if err := fsutil.WriteFile(path, data); err != nil {
+			return fail(drawthings.NewStorageError("failed to write image file", err))
+		}
+		res.Outputs = append(res.Outputs, path)
+	}
+
+	res.Status = StatusSucceeded
+	res.Duration = time.Since(res.Started).Round(time.Millisecond).String()
+	return res
+}
+
+// expandPrompt renders the prompt template of job.
+func (r *Runner) expandPrompt(job Job) (string, error) {
+	text := job.Prompt
+	if text == "" {
+		text = r.promptTemplate
+	}
+	h := fnv.New64a()
+	h.Write([]byte(job.ID))
+	seed := r.templateSeed ^ int64(h.Sum64())
+
+	expanded, err := r.renderer.Expand(text, seed, job.Vars)
+	if err != nil {
+		return "", drawthings.NewValidationError("prompt", fmt.Sprintf("cannot expand prompt template: %v", err))
+	}
+	return expanded, nil
+}
+
+// outputPath returns the file path for the image-th image of a job.
+func (r *Runner) outputPath(tmpl *template.Template, index, image int, job Job, seed int) (string, error) {
+	var name string
+	if job.Output != "" {
+		name = job.Output
+		if image > 0 {
+			ext := filepath.Ext(name)
+			name = fmt.Sprintf("%s_%d%s", strings.TrimSuffix(name, ext), image, ext)
+		}
+	} else {
+		var buf bytes.Buffer
+		err := tmpl.Execute(&buf, TemplateData{
+			ID:     job.ID,
+			Index:  index + 1,
+			Image:  image,
+			Seed:   seed,
+			Prompt: slug(job.Prompt),
+		})
+		if err != nil {
+			return "", drawthings.NewStorageError("failed to render output template", err)
+		}
+		name = buf.String()
+	}
+
+	if filepath.IsAbs(name) {
+		return name, nil
+	}
+	return filepath.Join(r.outputDir, name), nil
+}
+
+// applyDefaults copies fields from defaults into req where req leaves them unset.
+func applyDefaults(req, defaults *drawthings.TextToImageRequest) {
+	if req.NegativePrompt == "" {
+		req.NegativePrompt = defaults.NegativePrompt
+	}
+	if req.Steps == 0 {
+		req.Steps = defaults.Steps
+	}
+	if req.GuidanceScale == 0 {
+		req.GuidanceScale = defaults.GuidanceScale
+	}
+	if req.Width == 0 {
+		req.Width = defaults.Width
+	}
+	if req.Height == 0 {
+		req.Height = defaults.Height
+	}
+	if req.Seed == 0 {
+		req.Seed = defaults.Seed
+	}
+}
+
+// slug converts a prompt into a short filename-safe string.
+func slug(prompt string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(prompt) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+		if b.Len() >= 40 {
+			break
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
@@ -0,0 +1,292 @@
+package batch
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/drawthings_go"
+	"github.com/drawthings_go/prompt"
+	"github.com/drawthings_go/styles"
+)
+
+// fakeGenerator returns one image per request whose bytes are the prompt,
+// and fails requests whose prompt starts with "fail".
+type fakeGenerator struct {
+	mu       sync.Mutex
+	requests []drawthings.TextToImageRequest
+	inFlight int32
+	maxSeen  int32
+	delay    time.Duration
+}
+
+func (g *fakeGenerator) GenerateImage(ctx context.Context, req *drawthings.TextToImageRequest) (*drawthings.TextToImageResponse, error) {
+	n := atomic.AddInt32(&g.inFlight, 1)
+	defer atomic.AddInt32(&g.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(&g.maxSeen)
+		if n <= max || atomic.CompareAndSwapInt32(&g.maxSeen, max, n) {
+			break
+		}
+	}
+	time.Sleep(g.delay)
+
+	req.SetDefaults()
+	g.mu.Lock()
+	g.requests = append(g.requests, *req)
+	g.mu.Unlock()
+
+	if strings.HasPrefix(req.Prompt, "fail") {
+		return nil, drawthings.NewNetworkError("connection refused", nil)
+	}
+	return &drawthings.TextToImageResponse{
+		Images: []string{base64.StdEncoding.EncodeToString([]byte(req.Prompt))},
+	}, nil
+}
+
+func TestRunner_Run(t *testing.T) {
+	dir := t.TempDir()
+	gen := &fakeGenerator{}
+	runner := NewRunner(gen,
+		WithOutputDir(dir),
+		WithManifest(filepath.Join(dir, "manifest.jsonl")),
+		WithDefaults(drawthings.TextToImageRequest{Steps: 8, Seed: 7}),
+	)
+
+	jobs := []Job{
+		{ID: "a", TextToImageRequest: drawthings.TextToImageRequest{Prompt: "first"}},
+		{ID: "b", TextToImageRequest: drawthings.TextToImageRequest{Prompt: "fail please"}},
+		{ID: "c", Output: "custom.png", TextToImageRequest: drawthings.TextToImageRequest{Prompt: "third", Steps: 30}},
+	}
+
+	summary, err := runner.Run(context.Background(), jobs)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if summary.Succeeded != 2 || summary.Failed != 1 || summary.Skipped != 0 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "a.png"))
+	if err != nil || string(data) != "first" {
+		t.Errorf("a.png = %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "custom.png")); err != nil {
+		t.Errorf("custom output missing: %v", err)
+	}
+
+	failed := summary.Results[1]
+	if failed.Status != StatusFailed || failed.ErrorType != "network" {
+		t.Errorf("unexpected failed result: %+v", failed)
+	}
+	if summary.Results[0].Seed != 7 {
+		t.Errorf("seed: got %d, want default 7", summary.Results[0].Seed)
+	}
+
+	for _, req := range gen.requests {
+		switch req.Prompt {
+		case "first":
+			if req.Steps != 8 {
+				t.Errorf("default steps not applied: %d", req.Steps)
+			}
+		case "third":
+			if req.Steps != 30 {
+				t.Errorf("job steps overridden: %d", req.Steps)
+			}
+		}
+	}
+}
+
+func TestRunner_RerunSkipsCompleted(t *testing.T) {
+	dir := t.TempDir()
+	manifestPath := filepath.Join(dir, "manifest.jsonl")
+	jobs := []Job{
+		{ID: "a", TextToImageRequest: drawthings.TextToImageRequest{Prompt: "first"}},
+		{ID: "b", TextToImageRequest: drawthings.TextToImageRequest{Prompt: "fail"}},
+	}
+
+	if _, err := NewRunner(&fakeGenerator{}, WithOutputDir(dir), WithManifest(manifestPath)).Run(context.Background(), jobs); err != nil {
+		t.Fatalf("first Run() error = %v", err)
+	}
+
+	gen := &fakeGenerator{}
+	summary, err := NewRunner(gen, WithOutputDir(dir), WithManifest(manifestPath)).Run(context.Background(), jobs)
+	if err != nil {
+		t.Fatalf("second Run() error = %v", err)
+	}
+	if summary.Skipped != 1 || summary.Failed != 1 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+	if len(gen.requests) != 1 || gen.requests[0].Prompt != "fail" {
+		t.Errorf("expected only the failed job to rerun, got %+v", gen.requests)
+	}
+
+	// Removing an output forces the job to run again.
+	if err := os.Remove(filepath.Join(dir, "a.png")); err != nil {
+		t.Fatal(err)
+	}
+	gen = &fakeGenerator{}
+	summary, err = NewRunner(gen, WithOutputDir(dir), WithManifest(manifestPath)).Run(context.Background(), jobs)
+	if err != nil {
+		t.Fatalf("third Run() error = %v", err)
+	}
+	if summary.Skipped != 0 || len(gen.requests) != 2 {
+		t.Errorf("expected both jobs to rerun, got %+v", summary)
+	}
+}
+
+func TestRunner_Concurrency(t *testing.T) {
+	gen := &fakeGenerator{delay: 20 * time.Millisecond}
+	var jobs []Job
+	for i := 0; i < 8; i++ {
+		jobs = append(jobs, Job{ID: defaultID(i + 1), TextToImageRequest: drawthings.TextToImageRequest{Prompt: "x"}})
+	}
+
+	var results int32
+	runner := NewRunner(gen,
+		WithOutputDir(t.TempDir()),
+		WithConcurrency(3),
+		WithResultHandler(func(Result) { atomic.AddInt32(&results, 1) }),
+	)
+	if _, err := runner.Run(context.Background(), jobs); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := atomic.LoadInt32(&gen.maxSeen); got != 3 {
+		t.Errorf("max concurrent requests: got %d, want 3", got)
+	}
+	if results != 8 {
+		t.Errorf("result handler called %d times, want 8", results)
+	}
+}
+
+func TestRunner_OutputTemplate(t *testing.T) {
+	dir := t.TempDir()
+	runner := NewRunner(&fakeGenerator{},
+		WithOutputDir(dir),
+		WithOutputTemplate("{{.Index}}-{{.Prompt}}-{{.Seed}}.png"),
+	)
+	jobs := []Job{{ID: "a", TextToImageRequest: drawthings.TextToImageRequest{Prompt: "A Red Fox!", Seed: 5}}}
+
+	summary, err := runner.Run(context.Background(), jobs)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	want := filepath.Join(dir, "1-a-red-fox-5.png")
+	if got := summary.Results[0].Outputs; len(got) != 1 || got[0] != want {
+		t.Errorf("outputs: got %v, want [%s]", got, want)
+	}
+
+	if _, err := NewRunner(&fakeGenerator{}, WithOutputTemplate("{{.Nope")).Run(context.Background(), jobs); err == nil {
+		t.Error("expected error for invalid template")
+	}
+}
+
+func TestRunner_PromptTemplate(t *testing.T) {
+	dir := t.TempDir()
+	run := func() *Summary {
+		t.Helper()
+		runner := NewRunner(&fakeGenerator{},
+			WithOutputDir(dir),
+			WithOutputTemplate("{{.ID}}-{{.Prompt}}.png"),
+			WithPromptRenderer(prompt.NewRenderer(prompt.WithVars(map[string]string{"product": "mug"}))),
+			WithPromptTemplate("a {color} {product} on {marble|wood|glass}"),
+			WithForce(true),
+		)
+		jobs := []Job{
+			{ID: "a", Vars: map[string]string{"color": "red"}},
+			{ID: "b", Vars: map[string]string{"color": "blue", "product": "lamp"}},
+			{ID: "c", TextToImageRequest: drawthings.TextToImageRequest{Prompt: "{small|large} {product}"}},
+			{ID: "d"},
+		}
+		summary, err := runner.Run(context.Background(), jobs)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		return summary
+	}
+
+	first := run()
+	if first.Succeeded != 3 || first.Failed != 1 {
+		t.Fatalf("unexpected summary: %+v", first)
+	}
+	for i, prefix := range []string{"a red mug on ", "a blue lamp on ", ""} {
+		res := first.Results[i]
+		if !strings.HasPrefix(res.Prompt, prefix) || strings.ContainsAny(res.Prompt, "{}") {
+			t.Errorf("job %s: prompt %q", res.ID, res.Prompt)
+		}
+		data, _ := os.ReadFile(res.Outputs[0])
+		if string(data) != res.Prompt {
+			t.Errorf("job %s: sent %q, recorded %q", res.ID, data, res.Prompt)
+		}
+	}
+	if got := first.Results[2].Prompt; got != "small mug" && got != "large mug" {
+		t.Errorf("job c: prompt %q", got)
+	}
+	// Job d leaves {color} undefined.
+	if res := first.Results[3]; res.ErrorType != drawthings.ErrorTypeValidation || !strings.Contains(res.Error, "{color}") {
+		t.Errorf("job d: %+v", res)
+	}
+
+	// Rerunning the batch picks the same variants.
+	second := run()
+	for i := range first.Results {
+		if first.Results[i].Prompt != second.Results[i].Prompt {
+			t.Errorf("job %s: %q, then %q", first.Results[i].ID, first.Results[i].Prompt, second.Results[i].Prompt)
+		}
+	}
+
+	if _, err := NewRunner(&fakeGenerator{}, WithPromptTemplate("{oops")).Run(context.Background(), nil); err == nil {
+		t.Error("expected error for invalid prompt template")
+	}
+}
+
+func TestRunner_Styles(t *testing.T) {
+	gen := &fakeGenerator{}
+	runner := NewRunner(gen,
+		WithOutputDir(t.TempDir()),
+		WithDefaults(drawthings.TextToImageRequest{NegativePrompt: "blurry", Steps: 20, GuidanceScale: 4}),
+		WithStyles(
+			styles.Style{Prompt: "still of {prompt}", NegativePrompt: "cartoon", Steps: 30},
+			styles.Style{Prompt: "film grain", GuidanceScale: 6},
+		),
+	)
+	jobs := []Job{
+		{ID: "a", TextToImageRequest: drawthings.TextToImageRequest{Prompt: "a fox"}},
+		{ID: "b", TextToImageRequest: drawthings.TextToImageRequest{Prompt: "a cat", Steps: 12}},
+	}
+	summary, err := runner.Run(context.Background(), jobs)
+	if err != nil || summary.Succeeded != 2 {
+		t.Fatalf("Run() = %+v, %v", summary, err)
+	}
+	if got := summary.Results[0].Prompt; got != "still of a fox, film grain" {
+		t.Errorf("recorded prompt %q", got)
+	}
+	want := map[string]drawthings.TextToImageRequest{
+		"still of a fox, film grain": {Steps: 30},
+		"still of a cat, film grain": {Steps: 12},
+	}
+	for _, req := range gen.requests {
+		w, ok := want[req.Prompt]
+		if !ok || req.Steps != w.Steps || req.GuidanceScale != 6 || req.NegativePrompt != "blurry, cartoon" {
+			t.Errorf("unexpected request %+v", req)
+		}
+	}
+}
+
+func TestRunner_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	jobs := []Job{{ID: "a", TextToImageRequest: drawthings.TextToImageRequest{Prompt: "x"}}}
+	gen := &fakeGenerator{}
+	_, err := NewRunner(gen, WithOutputDir(t.TempDir())).Run(ctx, jobs)
+	if err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
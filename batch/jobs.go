@@ -0,0 +1,192 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/drawthings_go"
+)
+
+// Job is a single generation request in a batch.
+type Job struct {
+	// ID identifies the job in the manifest and output file names.
+	// Jobs without an ID are numbered by their position in the job file.
+	ID string `json:"id,omitempty"`
+
+	// Output is an optional output path that overrides the runner's filename template.
+	Output string `json:"output,omitempty"`
+
+	// Vars sets prompt template variables for this job, overriding those of
+	// the runner's prompt renderer.
+	Vars map[string]string `json:"vars,omitempty"`
+
+	drawthings.TextToImageRequest
+}
+
+// ReadFile reads jobs from a JSONL or CSV file, chosen by the file extension.
+func ReadFile(path string) ([]Job, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job file: %w", err)
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return ReadCSV(f)
+	}
+	return ReadJSONL(f)
+}
+
+// ReadJSONL reads one JSON-encoded job per line. Blank lines and lines
+// starting with '#' are ignored.
+func ReadJSONL(r io.Reader) ([]Job, error) {
+	var jobs []Job
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 || text[0] == '#' {
+			continue
+		}
+
+		var job Job
+		dec := json.NewDecoder(bytes.NewReader(text))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&job); err != nil {
+			return nil, fmt.Errorf("line %d: failed to parse job: %w", line, err)
+		}
+		if job.ID == "" {
+			job.ID = defaultID(len(jobs) + 1)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read job file: %w", err)
+	}
+	return jobs, checkIDs(jobs)
+}
+
+// ReadCSV reads jobs from CSV. The first row is a header naming the columns,
+// using the same names as the JSON fields (prompt, negative_prompt, steps,
+// guidance_scale, width, height, seed, id, output). A column named
+// vars.<name> sets the prompt template variable name. Empty cells are left
+// unset.
+func ReadCSV(r io.Reader) ([]Job, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if len(name) > len(varsColumn) && strings.EqualFold(name[:len(varsColumn)], varsColumn) {
+			// Variable names keep their case.
+			header[i] = varsColumn + name[len(varsColumn):]
+			continue
+		}
+		name = strings.ToLower(name)
+		if _, ok := csvSetters[name]; !ok {
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+		header[i] = name
+	}
+
+	var jobs []Job
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+
+		var job Job
+		for i, value := range record {
+			if value == "" {
+				continue
+			}
+			if name, ok := strings.CutPrefix(header[i], varsColumn); ok {
+				if job.Vars == nil {
+					job.Vars = make(map[string]string)
+				}
+				job.Vars[name] = value
+				continue
+			}
+			if err := csvSetters[header[i]](&job, value); err != nil {
+				return nil, fmt.Errorf("line %d: column %q: %w", line, header[i], err)
+			}
+		}
+		if job.ID == "" {
+			job.ID = defaultID(len(jobs) + 1)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, checkIDs(jobs)
+}
+
+// varsColumn prefixes the names of CSV columns holding template variables.
+const varsColumn = "vars."
+
+// csvSetters assigns a CSV cell to the corresponding job field.
+var csvSetters = map[string]func(*Job, string) error{
+	"id":              func(j *Job, v string) error { j.ID = v; return nil },
+	"output":          func(j *Job, v string) error { j.Output = v; return nil },
+	"prompt":          func(j *Job, v string) error { j.Prompt = v; return nil },
+	"negative_prompt": func(j *Job, v string) error { j.NegativePrompt = v; return nil },
+	"steps":           func(j *Job, v string) error { return setInt(&j.Steps, v) },
+	"width":           func(j *Job, v string) error { return setInt(&j.Width, v) },
+	"height":          func(j *Job, v string) error { return setInt(&j.Height, v) },
+	"seed":            func(j *Job, v string) error { return setInt(&j.Seed, v) },
+	"guidance_scale": func(j *Job, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		j.GuidanceScale = f
+		return nil
+	},
+}
+
+func setInt(dst *int, v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return err
+	}
+	*dst = n
+	return nil
+}
+
+// defaultID returns the ID assigned to the n-th job (1-based) when none is given.
+func defaultID(n int) string {
+	return fmt.Sprintf("%04d", n)
+}
+
+// checkIDs reports duplicate job IDs, which would make resuming ambiguous.
+func checkIDs(jobs []Job) error {
+	seen := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		if seen[job.ID] {
+			return fmt.Errorf("duplicate job id %q", job.ID)
+		}
+		seen[job.ID] = true
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package batch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadJSONL(t *testing.T) {
+	input := `{"id": "cat", "prompt": "a cat", "steps": 30}
+# comment
+
+{"prompt": "a dog", "width": 768, "output": "dog.png"}
+`
+	jobs, err := ReadJSONL(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ReadJSONL() error = %v", err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("expected 2 jobs, got %d", len(jobs))
+	}
+	if jobs[0].ID != "cat" || jobs[0].Prompt != "a cat" || jobs[0].Steps != 30 {
+		t.Errorf("unexpected first job: %+v", jobs[0])
+	}
+	if jobs[1].ID != "0002" || jobs[1].Width != 768 || jobs[1].Output != "dog.png" {
+		t.Errorf("unexpected second job: %+v", jobs[1])
+	}
+}
+
+func TestReadJSONL_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"malformed", `{"prompt": }`},
+		{"unknown field", `{"prompt": "x", "stepz": 3}`},
+		{"duplicate id", "{\"id\": \"a\", \"prompt\": \"x\"}\n{\"id\": \"a\", \"prompt\": \"y\"}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadJSONL(strings.NewReader(tt.input)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	input := `id,prompt,steps,guidance_scale,seed
+a,"a cat, sitting",25,6.5,42
+,a dog,,,
+`
+	jobs, err := ReadCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ReadCSV() error = %v", err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("expected 2 jobs, got %d", len(jobs))
+	}
+	want := jobs[0]
+	if want.ID != "a" || want.Prompt != "a cat, sitting" || want.Steps != 25 || want.GuidanceScale != 6.5 || want.Seed != 42 {
+		t.Errorf("unexpected first job: %+v", want)
+	}
+	if jobs[1].ID != "0002" || jobs[1].Steps != 0 {
+		t.Errorf("unexpected second job: %+v", jobs[1])
+	}
+}
+
+func TestReadCSV_Vars(t *testing.T) {
+	input := "id,vars.Color,VARS.product\na,deep red,mug\nb,,\n"
+	jobs, err := ReadCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ReadCSV() error = %v", err)
+	}
+	if got := jobs[0].Vars; len(got) != 2 || got["Color"] != "deep red" || got["product"] != "mug" {
+		t.Errorf("unexpected vars: %v", got)
+	}
+	if jobs[1].Vars != nil {
+		t.Errorf("empty cells set vars: %v", jobs[1].Vars)
+	}
+}
+
+func TestReadCSV_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"unknown column", "prompt,colour\na,b\n"},
+		{"bad number", "prompt,steps\na,many\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadCSV(strings.NewReader(tt.input)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "jobs.csv")
+	if err := os.WriteFile(csvPath, []byte("prompt\na cat\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jsonlPath := filepath.Join(dir, "jobs.jsonl")
+	if err := os.WriteFile(jsonlPath, []byte(`{"prompt": "a cat"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{csvPath, jsonlPath} {
+		jobs, err := ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile(%s) error = %v", path, err)
+		}
+		if len(jobs) != 1 || jobs[0].Prompt != "a cat" {
+			t.Errorf("ReadFile(%s) = %+v", path, jobs)
+		}
+	}
+
+	if _, err := ReadFile(filepath.Join(dir, "missing.jsonl")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
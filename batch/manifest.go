@@ -0,0 +1,108 @@
+package batch
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Job outcomes recorded in the manifest.
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+)
+
+// Result is the outcome of a single job. The manifest file stores one Result
+// per line.
+type Result struct {
+	ID      string   `json:"id"`
+	Status  string   `json:"status"`
+	Outputs []string `json:"outputs,omitempty"`
+	Seed    int      `json:"seed"`
+	// Prompt is the prompt sent to the server, if it was expanded from a
+	// prompt template or changed by styles.
+	Prompt    string    `json:"prompt,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	ErrorType string    `json:"error_type,omitempty"`
+	Started   time.Time `json:"started"`
+	Duration  string    `json:"duration"`
+
+	// Err is the error that failed the job, if any. It is not persisted.
+	Err error `json:"-"`
+}
+
+// manifest is an append-only JSONL log of job results. Later entries for the
+// same job ID supersede earlier ones.
+type manifest struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// readManifest returns the latest result recorded for each job ID. A missing
+// manifest yields an empty map.
+func readManifest(path string) (map[string]Result, error) {
+	results := make(map[string]Result)
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return results, nil
+		}
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var r Result
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// A torn final line from an interrupted run is not fatal.
+			continue
+		}
+		results[r.ID] = r
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return results, nil
+}
+
+// openManifest opens the manifest at path for appending.
+func openManifest(path string) (*manifest, error) {
+	if dir := filepath.Dir(path); dir != "." && dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create manifest directory: %w", err)
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	return &manifest{file: f}, nil
+}
+
+// append writes a result to the manifest.
+func (m *manifest) append(r Result) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest entry: %w", err)
+	}
+	data = append(data, '\n')
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.file.Write(data); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+func (m *manifest) close() error {
+	return m.file.Close()
+}
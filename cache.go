@@ -0,0 +1,94 @@
+package drawthings
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// optionsPath is the endpoint that reports the server's settings, including
+// the loaded model.
+const optionsPath = "/sdapi/v1/options"
+
+// Cache outcomes recorded in the AttrCache span attribute.
+const (
+	cacheHit    = "hit"
+	cacheMiss   = "miss"
+	cacheBypass = "bypass"
+)
+
+// ResultCache stores responses by request key. *cache.Cache implements it.
+type ResultCache interface {
+	Get(key string) (*TextToImageResponse, bool)
+	Put(key string, resp *TextToImageResponse) error
+}
+
+// WithCache returns cached responses for requests identical to earlier ones.
+// Requests are keyed by their parameters after SetDefaults and by the model
+// the server has loaded, which is checked before every cached request.
+// Requests with a random seed (-1) are never cached, and neither are
+// requests to servers that do not report their model.
+func WithCache(rc ResultCache) Option {
+	return func(c *Client) {
+		c.cache = rc
+	}
+}
+
+type noCacheKey struct{}
+
+// WithoutCache returns a context whose requests bypass the cache set with
+// WithCache, neither reading nor storing responses. Use it for requests whose
+// seed was picked at random by the caller, which are not worth keeping.
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// cacheDisabled reports whether ctx was created by WithoutCache.
+func cacheDisabled(ctx context.Context) bool {
+	disabled, _ := ctx.Value(noCacheKey{}).(bool)
+	return disabled
+}
+
+// cacheKey returns the cache key for req, or "" if req must not be cached.
+func (c *Client) cacheKey(ctx context.Context, req *TextToImageRequest) string {
+	if c.cache == nil || req.Seed < 0 || cacheDisabled(ctx) {
+		return ""
+	}
+	model, err := c.model(ctx)
+	if err != nil || model == "" {
+		if c.logger != nil {
+			c.logger.Logf("not caching: cannot determine the server's model: %v", err)
+		}
+		return ""
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return ""
+	}
+	h := sha256.New()
+	h.Write([]byte("drawthings-cache-v1\n" + model + "\n"))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// model returns the name of the model loaded on the server.
+func (c *Client) model(ctx context.Context) (string, error) {
+	resp, err := c.httpClient.Get(ctx, c.baseURL+optionsPath)
+	if err != nil {
+		return "", NewNetworkError("failed to query server options", err)
+	}
+
+	var options map[string]interface{}
+	if err := c.httpClient.DecodeJSONResponse(resp, &options); err != nil {
+		return "", NewDecodeError("failed to decode server options", err)
+	}
+	// A1111 reports the checkpoint; Draw Things reports its model file.
+	for _, key := range []string{"sd_model_checkpoint", "model"} {
+		if model, ok := options[key].(string); ok && model != "" {
+			return model, nil
+		}
+	}
+	return "", nil
+}
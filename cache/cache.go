@@ -0,0 +1,306 @@
+// Package cache stores generated images on disk, keyed by request, so that
+// identical fixed-seed requests are not rendered twice.
+//
+// A Cache is passed to drawthings.WithCache, which computes the keys:
+//
+//	c, err := cache.Open(dir, cache.WithMaxSize(2<<30), cache.WithMaxAge(30*24*time.Hour))
+//	client := drawthings.NewClient(drawthings.WithCache(c))
+//
+// Each entry is a directory of PNG files named after the key. Entries not
+// used for longer than the maximum age are removed, and the least recently
+// used entries are removed while the cache is larger than its maximum size.
+package cache
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drawthings_go"
+)
+
+// tmpPrefix marks entries that are still being written.
+const tmpPrefix = ".tmp-"
+
+// Cache is an on-disk image cache. It is safe for concurrent use, and
+// several processes may share a directory.
+type Cache struct {
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+	now     func() time.Time
+
+	mu        sync.Mutex
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+// Option is a function that configures a Cache.
+type Option func(*Cache)
+
+// WithMaxSize evicts the least recently used entries while the cache is
+// larger than n bytes. Zero, the default, means no limit.
+func WithMaxSize(n int64) Option {
+	return func(c *Cache) {
+		c.maxSize = n
+	}
+}
+
+// WithMaxAge evicts entries that have not been used for d. Zero, the
+// default, means entries do not expire.
+func WithMaxAge(d time.Duration) Option {
+	return func(c *Cache) {
+		c.maxAge = d
+	}
+}
+
+// Open opens the cache in dir, creating the directory if needed, and evicts
+// expired entries.
+func Open(dir string, opts ...Option) (*Cache, error) {
+	c := &Cache{dir: dir, now: time.Now}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, drawthings.NewStorageError("failed to create cache directory", err)
+	}
+	if err := c.Prune(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Dir returns the cache directory.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Get returns the cached response for key, if there is one.
+func (c *Cache) Get(key string) (*drawthings.TextToImageResponse, bool) {
+	path := filepath.Join(c.dir, key)
+	resp, err := c.read(path)
+	if err != nil {
+		c.count(&c.misses)
+		return nil, false
+	}
+	// Record the use for eviction.
+	now := c.now()
+	os.Chtimes(path, now, now)
+	c.count(&c.hits)
+	return resp, true
+}
+
+// read loads the entry at path, unless it is missing or expired.
+func (c *Cache) read(path string) (*drawthings.TextToImageResponse, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if c.maxAge > 0 && c.now().Sub(info.ModTime()) > c.maxAge {
+		c.remove(path)
+		return nil, os.ErrNotExist
+	}
+
+	files, err := filepath.Glob(filepath.Join(path, "*.png"))
+	if err != nil || len(files) == 0 {
+		return nil, os.ErrNotExist
+	}
+	sort.Slice(files, func(i, j int) bool { return imageIndex(files[i]) < imageIndex(files[j]) })
+
+	resp := &drawthings.TextToImageResponse{}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		resp.Images = append(resp.Images, base64.StdEncoding.EncodeToString(data))
+	}
+	return resp, nil
+}
+
+// imageIndex returns the index encoded in an image file name.
+func imageIndex(path string) int {
+	var i int
+	fmt.Sscanf(filepath.Base(path), "%d.png", &i)
+	return i
+}
+
+// Put stores resp under key, replacing any existing entry, then evicts
+// entries if the cache is over its size limit.
+func (c *Cache) Put(key string, resp *drawthings.TextToImageResponse) error {
+	tmp, err := os.MkdirTemp(c.dir, tmpPrefix)
+	if err != nil {
+		return drawthings.NewStorageError("failed to write cache entry", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for i, encoded := range resp.Images {
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return drawthings.NewDecodeError("failed to decode base64 image data", err)
+		}
+		if err := os.WriteFile(filepath.Join(tmp, fmt.Sprintf("%d.png", i)), data, 0644); err != nil {
+			return drawthings.NewStorageError("failed to write cache entry", err)
+		}
+	}
+
+	path := filepath.Join(c.dir, key)
+	os.RemoveAll(path)
+	if err := os.Rename(tmp, path); err != nil {
+		return drawthings.NewStorageError("failed to write cache entry", err)
+	}
+	now := c.now()
+	os.Chtimes(path, now, now)
+	if c.maxSize > 0 {
+		return c.Prune()
+	}
+	return nil
+}
+
+// entry describes a cache entry on disk.
+type entry struct {
+	path  string
+	size  int64
+	used  time.Time
+	files int
+}
+
+// entries lists the complete entries in the cache.
+func (c *Cache) entries() ([]entry, error) {
+	dirs, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, drawthings.NewStorageError("failed to read cache directory", err)
+	}
+	var entries []entry
+	for _, d := range dirs {
+		if !d.IsDir() || strings.HasPrefix(d.Name(), tmpPrefix) {
+			continue
+		}
+		info, err := d.Info()
+		if err != nil {
+			continue
+		}
+		e := entry{path: filepath.Join(c.dir, d.Name()), used: info.ModTime()}
+		files, _ := os.ReadDir(e.path)
+		for _, f := range files {
+			if fi, err := f.Info(); err == nil {
+				e.size += fi.Size()
+				e.files++
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Prune evicts expired entries, then the least recently used entries until
+// the cache fits its size limit.
+func (c *Cache) Prune() error {
+	entries, err := c.entries()
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].used.After(entries[j].used) })
+
+	var total int64
+	now := c.now()
+	for _, e := range entries {
+		expired := c.maxAge > 0 && now.Sub(e.used) > c.maxAge
+		if expired || c.maxSize > 0 && total+e.size > c.maxSize {
+			c.remove(e.path)
+			continue
+		}
+		total += e.size
+	}
+	return nil
+}
+
+// remove deletes an entry and counts the eviction.
+func (c *Cache) remove(path string) {
+	if err := os.RemoveAll(path); err == nil {
+		c.count(&c.evictions)
+	}
+}
+
+// Clear removes every entry.
+func (c *Cache) Clear() error {
+	dirs, err := os.ReadDir(c.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return drawthings.NewStorageError("failed to read cache directory", err)
+	}
+	for _, d := range dirs {
+		if d.IsDir() {
+			if err := os.RemoveAll(filepath.Join(c.dir, d.Name())); err != nil {
+				return drawthings.NewStorageError("failed to clear cache", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Stats describes the cache. Entries, Images, Bytes, Oldest and Newest are
+// read from disk; Hits, Misses and Evictions count this Cache's activity
+// since it was opened.
+type Stats struct {
+	Entries   int       `json:"entries"`
+	Images    int       `json:"images"`
+	Bytes     int64     `json:"bytes"`
+	Oldest    time.Time `json:"oldest,omitempty"`
+	Newest    time.Time `json:"newest,omitempty"`
+	MaxSize   int64     `json:"max_size,omitempty"`
+	MaxAge    string    `json:"max_age,omitempty"`
+	Hits      int64     `json:"hits"`
+	Misses    int64     `json:"misses"`
+	Evictions int64     `json:"evictions"`
+}
+
+// HitRate returns the fraction of lookups that were hits.
+func (s Stats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// Stats returns the current cache statistics.
+func (c *Cache) Stats() (Stats, error) {
+	entries, err := c.entries()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	c.mu.Lock()
+	s := Stats{MaxSize: c.maxSize, Hits: c.hits, Misses: c.misses, Evictions: c.evictions}
+	c.mu.Unlock()
+	if c.maxAge > 0 {
+		s.MaxAge = c.maxAge.String()
+	}
+	for _, e := range entries {
+		s.Entries++
+		s.Images += e.files
+		s.Bytes += e.size
+		if s.Oldest.IsZero() || e.used.Before(s.Oldest) {
+			s.Oldest = e.used
+		}
+		if e.used.After(s.Newest) {
+			s.Newest = e.used
+		}
+	}
+	return s, nil
+}
+
+func (c *Cache) count(n *int64) {
+	c.mu.Lock()
+	*n++
+	c.mu.Unlock()
+}
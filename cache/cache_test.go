@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/drawthings_go"
+	"github.com/drawthings_go/drawthingstest"
+)
+
+func response(payloads ...string) *drawthings.TextToImageResponse {
+	resp := &drawthings.TextToImageResponse{}
+	for _, p := range payloads {
+		resp.Images = append(resp.Images, base64.StdEncoding.EncodeToString([]byte(p)))
+	}
+	return resp
+}
+
+func TestCache_PutGet(t *testing.T) {
+	c, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := c.Get("missing"); ok {
+		t.Fatal("expected a miss")
+	}
+	var images []string
+	for i := 0; i < 12; i++ {
+		images = append(images, string(rune('a'+i)))
+	}
+	if err := c.Put("key", response(images...)); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := c.Get("key")
+	if !ok || len(got.Images) != len(images) {
+		t.Fatalf("unexpected entry: %v %v", got, ok)
+	}
+	for i, encoded := range got.Images {
+		if data, _ := base64.StdEncoding.DecodeString(encoded); string(data) != images[i] {
+			t.Errorf("image %d = %q, want %q", i, data, images[i])
+		}
+	}
+
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != 1 || stats.Images != 12 || stats.Bytes != 12 || stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	if err := c.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("key"); ok {
+		t.Error("entry survived Clear")
+	}
+}
+
+func TestCache_EvictsBySize(t *testing.T) {
+	c, err := Open(t.TempDir(), WithMaxSize(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	c.Put("a", response("aaaa"))
+	now = now.Add(time.Second)
+	c.Put("b", response("bbbb"))
+	now = now.Add(time.Second)
+	// Using "a" makes "b" the least recently used entry.
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("expected a hit")
+	}
+	now = now.Add(time.Second)
+	c.Put("c", response("cccc"))
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("entry %s was evicted", key)
+		}
+	}
+}
+
+func TestCache_EvictsByAge(t *testing.T) {
+	dir := t.TempDir()
+	c, err := Open(dir, WithMaxAge(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put("old", response("x"))
+	c.Put("new", response("y"))
+	stale := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(filepath.Join(dir, "old"), stale, stale)
+
+	if _, ok := c.Get("old"); ok {
+		t.Error("expired entry was returned")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old")); !os.IsNotExist(err) {
+		t.Error("expired entry was not removed")
+	}
+
+	// Opening the cache prunes expired entries too.
+	os.Chtimes(filepath.Join(dir, "new"), stale, stale)
+	c, err = Open(dir, WithMaxAge(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats, _ := c.Stats(); stats.Entries != 0 || stats.Evictions != 1 {
+		t.Errorf("unexpected stats after reopening: %+v", stats)
+	}
+}
+
+func TestCache_WithClient(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+
+	c, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := drawthings.NewClient(drawthings.WithBaseURL(server.URL), drawthings.WithCache(c))
+
+	for i := 0; i < 3; i++ {
+		req := &drawthings.TextToImageRequest{Prompt: "a lighthouse", Seed: 7, Width: 64, Height: 64}
+		resp, err := client.GenerateImage(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := base64.StdEncoding.DecodeString(resp.Images[0])
+		if string(data) != string(drawthingstest.Image("a lighthouse", 7, 64, 64)) {
+			t.Fatalf("request %d returned the wrong image", i)
+		}
+	}
+	if n := len(server.RequestsTo(drawthingstest.PathTxt2Img)); n != 1 {
+		t.Errorf("expected 1 render, got %d", n)
+	}
+	if stats, _ := c.Stats(); stats.Hits != 2 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
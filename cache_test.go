@@ -0,0 +1,123 @@
+package drawthings
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/drawthings_go/drawthingstest"
+)
+
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string]*TextToImageResponse
+}
+
+func (m *memoryCache) Get(key string) (*TextToImageResponse, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	resp, ok := m.entries[key]
+	return resp, ok
+}
+
+func (m *memoryCache) Put(key string, resp *TextToImageResponse) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = resp
+	return nil
+}
+
+func TestWithCache(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+
+	rec := NewSpanRecorder()
+	cache := &memoryCache{entries: map[string]*TextToImageResponse{}}
+	client := NewClient(WithBaseURL(server.URL), WithCache(cache), WithTracer(rec))
+	ctx := context.Background()
+	generate := func(req TextToImageRequest) *TextToImageResponse {
+		t.Helper()
+		resp, err := client.GenerateImage(ctx, &req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	renders := func() int {
+		return len(server.RequestsTo(drawthingstest.PathTxt2Img))
+	}
+
+	first := generate(TextToImageRequest{Prompt: "fox", Seed: 42})
+	// Defaults are applied before hashing, so spelling them out hits too.
+	second := generate(TextToImageRequest{Prompt: "fox", Seed: 42, Steps: 20, Width: 512, Height: 512})
+	if renders() != 1 {
+		t.Fatalf("expected 1 render, got %d", renders())
+	}
+	if first.Images[0] != second.Images[0] {
+		t.Error("cached response differs from the original")
+	}
+
+	generate(TextToImageRequest{Prompt: "fox", Seed: 43})
+	generate(TextToImageRequest{Prompt: "fox"})
+	generate(TextToImageRequest{Prompt: "fox"})
+	if renders() != 4 {
+		t.Errorf("different seeds and random seeds must render: got %d renders, want 4", renders())
+	}
+
+	// Switching models invalidates the cache.
+	server.SetModel("other.ckpt")
+	generate(TextToImageRequest{Prompt: "fox", Seed: 42})
+	if renders() != 5 {
+		t.Errorf("expected a render after the model changed, got %d renders", renders())
+	}
+
+	// Servers that do not report a model are not cached.
+	server.SetModel("")
+	generate(TextToImageRequest{Prompt: "fox", Seed: 42})
+	generate(TextToImageRequest{Prompt: "fox", Seed: 42})
+	if renders() != 7 {
+		t.Errorf("expected requests to bypass the cache, got %d renders", renders())
+	}
+
+	var outcomes []interface{}
+	for _, s := range rec.Spans() {
+		outcomes = append(outcomes, s.Attributes[AttrCache])
+	}
+	want := []interface{}{"miss", "hit", "miss", "bypass", "bypass", "miss", "bypass", "bypass"}
+	if len(outcomes) != len(want) {
+		t.Fatalf("cache attributes = %v, want %v", outcomes, want)
+	}
+	for i := range want {
+		if outcomes[i] != want[i] {
+			t.Errorf("cache attributes = %v, want %v", outcomes, want)
+			break
+		}
+	}
+}
+
+func TestWithoutCache(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+
+	cache := &memoryCache{entries: map[string]*TextToImageResponse{}}
+	client := NewClient(WithBaseURL(server.URL), WithCache(cache))
+	req := TextToImageRequest{Prompt: "fox", Seed: 42}
+
+	for i := 0; i < 2; i++ {
+		r := req
+		if _, err := client.GenerateImage(WithoutCache(context.Background()), &r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(server.RequestsTo(drawthingstest.PathTxt2Img)); n != 2 || len(cache.entries) != 0 {
+		t.Errorf("WithoutCache: %d renders and %d cache entries, want 2 and 0", n, len(cache.entries))
+	}
+
+	r := req
+	if _, err := client.GenerateImage(context.Background(), &r); err != nil {
+		t.Fatal(err)
+	}
+	if len(cache.entries) != 1 {
+		t.Errorf("a plain context stored %d cache entries, want 1", len(cache.entries))
+	}
+}
@@ -0,0 +1,447 @@
+// Package cassette records Draw Things API traffic and replays it offline.
+//
+// A Recorder is an http.RoundTripper. In ModeRecord it forwards requests to
+// the real server and saves each request/response pair to a cassette
+// directory; in ModeReplay it answers requests from the cassette without any
+// network access and fails requests it has no recording for:
+//
+//	rec, err := cassette.New("testdata/txt2img", cassette.ModeReplay,
+//		cassette.WithIgnoredFields("seed"))
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	client := drawthings.NewClient(drawthings.WithTransport(rec))
+//
+// Cassettes are stored as an interactions.json file. With
+// WithExternalImages, base64 images in responses are written as separate
+// image files next to it, which keeps the JSON small and the images viewable.
+package cassette
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Mode selects whether a Recorder records or replays.
+type Mode int
+
+const (
+	// ModeReplay serves responses from the cassette and never contacts the server.
+	ModeReplay Mode = iota
+	// ModeRecord forwards requests to the server and records them,
+	// replacing any existing cassette contents.
+	ModeRecord
+)
+
+// String returns the name of the mode.
+func (m Mode) String() string {
+	switch m {
+	case ModeReplay:
+		return "replay"
+	case ModeRecord:
+		return "record"
+	default:
+		return fmt.Sprintf("Mode(%d)", int(m))
+	}
+}
+
+// ParseMode parses "record" or "replay", e.g. from an environment variable.
+func ParseMode(s string) (Mode, error) {
+	switch strings.ToLower(s) {
+	case "replay", "":
+		return ModeReplay, nil
+	case "record":
+		return ModeRecord, nil
+	default:
+		return 0, fmt.Errorf("invalid cassette mode %q (want record or replay)", s)
+	}
+}
+
+// ErrNoMatch is returned in replay mode for requests the cassette has no
+// recording for.
+var ErrNoMatch = errors.New("cassette: no recorded interaction matches request")
+
+// interactionsFile is the name of the cassette index inside the directory.
+const interactionsFile = "interactions.json"
+
+// Interaction is a recorded request/response pair.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the recorded part of a request.
+type RecordedRequest struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	// Text holds the body instead of Body when it is not JSON.
+	Text string `json:"text,omitempty"`
+}
+
+// RecordedResponse is the recorded part of a response.
+type RecordedResponse struct {
+	StatusCode int                 `json:"status_code"`
+	Header     map[string][]string `json:"header,omitempty"`
+	Body       json.RawMessage     `json:"body,omitempty"`
+	// Text holds the body instead of Body when it is not JSON.
+	Text string `json:"text,omitempty"`
+	// ImageFiles lists the images moved out of Body, relative to the
+	// cassette directory, in the order of Body's "images" array.
+	ImageFiles []string `json:"image_files,omitempty"`
+}
+
+// Recorder is an http.RoundTripper that records or replays interactions.
+type Recorder struct {
+	dir            string
+	mode           Mode
+	transport      http.RoundTripper
+	ignored        []string
+	externalImages bool
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// Option is a function that configures a Recorder.
+type Option func(*Recorder)
+
+// WithTransport sets the transport used to reach the server in record mode.
+// The default is http.DefaultTransport.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(r *Recorder) {
+		r.transport = transport
+	}
+}
+
+// WithIgnoredFields excludes top-level JSON request fields, such as "seed",
+// when matching requests against the cassette.
+func WithIgnoredFields(fields ...string) Option {
+	return func(r *Recorder) {
+		r.ignored = append(r.ignored, fields...)
+	}
+}
+
+// WithExternalImages stores base64 images from responses as separate files
+// in the cassette directory instead of inline in interactions.json.
+func WithExternalImages(enabled bool) Option {
+	return func(r *Recorder) {
+		r.externalImages = enabled
+	}
+}
+
+// New creates a Recorder for the cassette in dir. In replay mode the
+// cassette must already exist.
+func New(dir string, mode Mode, opts ...Option) (*Recorder, error) {
+	r := &Recorder{
+		dir:       dir,
+		mode:      mode,
+		transport: http.DefaultTransport,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	switch mode {
+	case ModeReplay:
+		if err := r.load(); err != nil {
+			return nil, err
+		}
+	case ModeRecord:
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create cassette directory: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid cassette mode %v", mode)
+	}
+	return r, nil
+}
+
+// Mode returns the mode of the recorder.
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Interactions returns the interactions in the cassette.
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Interaction(nil), r.interactions...)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cassette: failed to read request body: %w", err)
+		}
+	}
+
+	if r.mode == ModeReplay {
+		return r.replay(req, body)
+	}
+	return r.record(req, body)
+}
+
+// record forwards req to the server and appends the interaction to the cassette.
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	out.ContentLength = int64(len(body))
+
+	resp, err := r.transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	interaction := Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			Path:   req.URL.RequestURI(),
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     recordedHeader(resp.Header),
+		},
+	}
+	interaction.Request.Body, interaction.Request.Text = splitBody(body)
+	interaction.Response.Body, interaction.Response.Text = splitBody(respBody)
+	if r.externalImages {
+		if err := r.externalize(&interaction.Response, len(r.interactions)); err != nil {
+			return nil, err
+		}
+	}
+	r.interactions = append(r.interactions, interaction)
+	if err := r.save(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// replay answers req from the first unused matching interaction, falling
+// back to the last match so repeated requests keep working.
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	key := r.matchKey(req.Method, req.URL.RequestURI(), body)
+
+	r.mu.Lock()
+	found, last := -1, -1
+	for i, in := range r.interactions {
+		if r.matchKey(in.Request.Method, in.Request.Path, joinBody(in.Request.Body, in.Request.Text)) != key {
+			continue
+		}
+		if !r.used[i] {
+			found = i
+			break
+		}
+		last = i
+	}
+	if found < 0 {
+		found = last
+	}
+	if found >= 0 {
+		r.used[found] = true
+	}
+	r.mu.Unlock()
+
+	if found < 0 {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoMatch, req.Method, req.URL.RequestURI())
+	}
+
+	recorded := r.interactions[found].Response
+	respBody, err := r.responseBody(recorded)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	for k, v := range recorded.Header {
+		header[k] = append([]string(nil), v...)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(respBody)),
+		ContentLength: int64(len(respBody)),
+		Request:       req,
+	}, nil
+}
+
+// matchKey returns the string requests are matched on: method, path and the
+// canonical JSON body without ignored fields.
+func (r *Recorder) matchKey(method, path string, body []byte) string {
+	canonical := string(body)
+	var fields map[string]interface{}
+	if len(body) > 0 && json.Unmarshal(body, &fields) == nil {
+		for _, name := range r.ignored {
+			delete(fields, name)
+		}
+		// Maps marshal with sorted keys, so formatting differences don't matter.
+		if data, err := json.Marshal(fields); err == nil {
+			canonical = string(data)
+		}
+	}
+	return method + " " + path + "\n" + canonical
+}
+
+// externalize moves the images of a JSON response body into files.
+func (r *Recorder) externalize(resp *RecordedResponse, index int) error {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(resp.Body, &fields) != nil {
+		return nil
+	}
+	var images []string
+	if json.Unmarshal(fields["images"], &images) != nil || len(images) == 0 {
+		return nil
+	}
+
+	for i, encoded := range images {
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			// Not an image we can store; leave the body untouched.
+			return nil
+		}
+		name := fmt.Sprintf("%04d_%d%s", index, i, imageExt(data))
+		if err := os.WriteFile(filepath.Join(r.dir, name), data, 0644); err != nil {
+			return fmt.Errorf("cassette: failed to write image: %w", err)
+		}
+		resp.ImageFiles = append(resp.ImageFiles, name)
+		images[i] = ""
+	}
+
+	data, err := json.Marshal(images)
+	if err != nil {
+		return err
+	}
+	fields["images"] = data
+	if resp.Body, err = json.Marshal(fields); err != nil {
+		return err
+	}
+	return nil
+}
+
+// responseBody rebuilds a recorded response body, inlining external images.
+func (r *Recorder) responseBody(resp RecordedResponse) ([]byte, error) {
+	body := joinBody(resp.Body, resp.Text)
+	if len(resp.ImageFiles) == 0 {
+		return body, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("cassette: invalid recorded body: %w", err)
+	}
+	images := make([]string, len(resp.ImageFiles))
+	for i, name := range resp.ImageFiles {
+		data, err := os.ReadFile(filepath.Join(r.dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("cassette: failed to read image: %w", err)
+		}
+		images[i] = base64.StdEncoding.EncodeToString(data)
+	}
+	data, err := json.Marshal(images)
+	if err != nil {
+		return nil, err
+	}
+	fields["images"] = data
+	return json.Marshal(fields)
+}
+
+// load reads the cassette for replay.
+func (r *Recorder) load() error {
+	data, err := os.ReadFile(filepath.Join(r.dir, interactionsFile))
+	if err != nil {
+		return fmt.Errorf("failed to read cassette: %w", err)
+	}
+	if err := json.Unmarshal(data, &r.interactions); err != nil {
+		return fmt.Errorf("failed to parse cassette: %w", err)
+	}
+	r.used = make([]bool, len(r.interactions))
+	return nil
+}
+
+// save writes the cassette atomically. The caller must hold r.mu.
+func (r *Recorder) save() error {
+	data, err := json.MarshalIndent(r.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(r.dir, interactionsFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("cassette: failed to write cassette: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("cassette: failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// splitBody returns body as raw JSON, or as text if it is not valid JSON.
+func splitBody(body []byte) (json.RawMessage, string) {
+	if len(body) == 0 {
+		return nil, ""
+	}
+	if json.Valid(body) {
+		return json.RawMessage(body), ""
+	}
+	return nil, string(body)
+}
+
+// joinBody is the inverse of splitBody.
+func joinBody(raw json.RawMessage, text string) []byte {
+	if raw != nil {
+		return []byte(raw)
+	}
+	return []byte(text)
+}
+
+// recordedHeader keeps the response headers worth replaying.
+func recordedHeader(h http.Header) map[string][]string {
+	kept := map[string][]string{}
+	for _, name := range []string{"Content-Type"} {
+		if v := h.Values(name); len(v) > 0 {
+			kept[name] = v
+		}
+	}
+	return kept
+}
+
+// imageExt returns a file extension for image data.
+func imageExt(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	case "image/webp":
+		return ".webp"
+	default:
+		return ".bin"
+	}
+}
@@ -0,0 +1,147 @@
+package cassette_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drawthings_go"
+	"github.com/drawthings_go/cassette"
+	"github.com/drawthings_go/drawthingstest"
+)
+
+func generate(t *testing.T, rec *cassette.Recorder, baseURL string, seed int) ([]byte, error) {
+	t.Helper()
+	client := drawthings.NewClient(drawthings.WithBaseURL(baseURL), drawthings.WithTransport(rec))
+	resp, err := client.GenerateImage(context.Background(), &drawthings.TextToImageRequest{
+		Prompt: "a lighthouse",
+		Width:  64,
+		Height: 64,
+		Seed:   seed,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Images[0])
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	server := drawthingstest.NewServer()
+	baseURL := server.URL
+
+	rec, err := cassette.New(dir, cassette.ModeRecord, cassette.WithExternalImages(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := generate(t, rec, baseURL, 1)
+	if err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	server.Close()
+
+	// The image is stored as a file, not inline.
+	interactions := rec.Interactions()
+	if len(interactions) != 1 || len(interactions[0].Response.ImageFiles) != 1 {
+		t.Fatalf("unexpected interactions: %+v", interactions)
+	}
+	stored, err := os.ReadFile(filepath.Join(dir, interactions[0].Response.ImageFiles[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored, recorded) {
+		t.Error("stored image differs from the recorded response")
+	}
+	index, _ := os.ReadFile(filepath.Join(dir, "interactions.json"))
+	if bytes.Contains(index, []byte(base64.StdEncoding.EncodeToString(recorded)[:32])) {
+		t.Error("interactions.json should not contain inline image data")
+	}
+
+	// Replay works with the server gone.
+	rec, err = cassette.New(dir, cassette.ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := generate(t, rec, baseURL, 1)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if !bytes.Equal(replayed, recorded) {
+		t.Error("replayed image differs from the recorded one")
+	}
+
+	// A different seed does not match...
+	_, err = generate(t, rec, baseURL, 2)
+	if !errors.Is(err, cassette.ErrNoMatch) {
+		t.Errorf("expected ErrNoMatch, got %v", err)
+	}
+	if !drawthings.IsNetworkError(err) {
+		t.Errorf("expected the client to report a NetworkError, got %T", err)
+	}
+
+	// ...unless the seed is ignored.
+	rec, err = cassette.New(dir, cassette.ModeReplay, cassette.WithIgnoredFields("seed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := generate(t, rec, baseURL, 2); err != nil {
+		t.Errorf("replay ignoring seed: %v", err)
+	}
+}
+
+func TestReplaySequence(t *testing.T) {
+	dir := t.TempDir()
+	server := drawthingstest.NewServer()
+	defer server.Close()
+	server.QueueFailure(drawthingstest.StatusFailure(http.StatusServiceUnavailable))
+
+	rec, err := cassette.New(dir, cassette.ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := generate(t, rec, server.URL, 1); !drawthings.IsAPIError(err) {
+		t.Fatalf("expected APIError while recording, got %v", err)
+	}
+	if _, err := generate(t, rec, server.URL, 1); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	// Identical requests replay in recorded order, then repeat the last match.
+	rec, err = cassette.New(dir, cassette.ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := generate(t, rec, server.URL, 1); !drawthings.IsAPIError(err) {
+		t.Errorf("first replay: expected APIError, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := generate(t, rec, server.URL, 1); err != nil {
+			t.Errorf("replay %d: %v", i+2, err)
+		}
+	}
+	if n := len(server.Requests()); n != 2 {
+		t.Errorf("replay should not reach the server: %d requests", n)
+	}
+}
+
+func TestNew_MissingCassette(t *testing.T) {
+	if _, err := cassette.New(filepath.Join(t.TempDir(), "missing"), cassette.ModeReplay); err == nil {
+		t.Error("expected error for missing cassette in replay mode")
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for in, want := range map[string]cassette.Mode{"": cassette.ModeReplay, "replay": cassette.ModeReplay, "RECORD": cassette.ModeRecord} {
+		if got, err := cassette.ParseMode(in); err != nil || got != want {
+			t.Errorf("ParseMode(%q) = %v, %v", in, got, err)
+		}
+	}
+	if _, err := cassette.ParseMode("bogus"); err == nil {
+		t.Error("expected error for invalid mode")
+	}
+}
@@ -1,9 +1,11 @@
 package drawthings
 
 import (
+	"net/http"
 	"time"
 
 	httpclient "github.com/drawthings_go/internal/http"
+	"github.com/drawthings_go/prompt"
 )
 
 const (
@@ -24,6 +26,16 @@ type Client struct {
 	httpClient *httpclient.Client
 	timeout    time.Duration
 	logger     Logger
+	transport  http.RoundTripper
+	limiter    *limiter
+	metrics    MetricsRecorder
+	tracer     Tracer
+	cache      ResultCache
+	flights    *flightGroup
+	strict     bool
+	tokenizer  *prompt.Tokenizer
+	tokenLimit int
+	warn       func(error)
 }
 
 // Option is a function that configures a Client.
@@ -36,11 +48,10 @@ func WithBaseURL(baseURL string) Option {
 	}
 }
 
-// WithTimeout sets the HTTP client timeout.
+// WithTimeout sets the HTTP client timeout. Zero means no timeout.
 func WithTimeout(timeout time.Duration) Option {
 	return func(c *Client) {
 		c.timeout = timeout
-		c.httpClient = httpclient.NewClient(timeout, c.logger)
 	}
 }
 
@@ -48,11 +59,80 @@ func WithTimeout(timeout time.Duration) Option {
 func WithLogger(logger Logger) Option {
 	return func(c *Client) {
 		c.logger = logger
-		timeout := c.timeout
-		if timeout == 0 {
-			timeout = DefaultTimeout
+	}
+}
+
+// WithTransport sets the http.RoundTripper used to send requests, such as a
+// cassette.Recorder for recorded tests. The default is http.DefaultTransport.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		c.transport = transport
+	}
+}
+
+// WithMaxConcurrency limits the number of requests the client sends at the
+// same time. Draw Things renders one image at a time, so further requests
+// only pile up connections that time out; with a limit they wait in the
+// client instead. Waiting requests are served by priority (see WithPriority),
+// then in arrival order, and give up when their context ends. Time spent
+// waiting does not count against the HTTP timeout. Zero means no limit.
+func WithMaxConcurrency(n int) Option {
+	return func(c *Client) {
+		if n > 0 {
+			c.limiter = newLimiter(n)
+		} else {
+			c.limiter = nil
 		}
-		c.httpClient = httpclient.NewClient(timeout, logger)
+	}
+}
+
+// WithStrictValidation checks requests with ValidateStrict instead of
+// Validate before sending them, so prompts with malformed weighting syntax
+// fail with a ValidationError instead of being misread by the server.
+func WithStrictValidation(strict bool) Option {
+	return func(c *Client) {
+		c.strict = strict
+	}
+}
+
+// WithTokenLimit counts the CLIP tokens of prompts with tok before sending
+// them. A prompt or negative prompt with more than limit tokens, which the
+// server truncates or encodes in several chunks, causes a warning (see
+// WithWarningHandler), or fails with a ValidationError under
+// WithStrictValidation. A limit of zero or less means prompt.ChunkSize.
+func WithTokenLimit(tok *prompt.Tokenizer, limit int) Option {
+	return func(c *Client) {
+		c.tokenizer = tok
+		c.tokenLimit = limit
+	}
+}
+
+// WithWarningHandler sets a function that receives problems with requests
+// that do not stop them from being sent, such as prompts over the token
+// limit. By default they are logged as warnings with the client's logger.
+func WithWarningHandler(h func(error)) Option {
+	return func(c *Client) {
+		c.warn = h
+	}
+}
+
+// MetricsRecorder receives measurements from a Client. *metrics.Collector
+// implements it.
+type MetricsRecorder interface {
+	// ObserveRequest records an HTTP request to the server. Outcome is "ok"
+	// or the error type of a failed request.
+	ObserveRequest(endpoint, outcome string, duration time.Duration, bytes int64)
+	// ObserveRetry records a request sent again after a failure.
+	ObserveRetry(source string)
+	// ObserveQueueWait records time spent waiting before a request was sent.
+	ObserveQueueWait(queue string, wait time.Duration)
+}
+
+// WithMetrics records request counts, latencies, bytes received, retries
+// and time spent waiting for a concurrency slot to m.
+func WithMetrics(m MetricsRecorder) Option {
+	return func(c *Client) {
+		c.metrics = m
 	}
 }
 
@@ -62,16 +142,31 @@ func NewClient(opts ...Option) *Client {
 		baseURL: DefaultBaseURL,
 		timeout: DefaultTimeout,
 		logger:  nil,
+		tracer:  NopTracer{},
 	}
 
 	for _, opt := range opts {
 		opt(c)
 	}
 
-	// Initialize HTTP client if not already set
-	if c.httpClient == nil {
-		c.httpClient = httpclient.NewClient(c.timeout, c.logger)
+	if c.tracer == nil {
+		c.tracer = NopTracer{}
+	}
+	if c.warn == nil {
+		c.warn = func(err error) {
+			if c.logger != nil {
+				c.logger.Logf("warning: %v", err)
+			}
+		}
 	}
+	var httpOpts []httpclient.Option
+	if c.transport != nil {
+		httpOpts = append(httpOpts, httpclient.WithTransport(c.transport))
+	}
+	if c.metrics != nil {
+		httpOpts = append(httpOpts, httpclient.WithObserver(c.metrics))
+	}
+	c.httpClient = httpclient.NewClient(c.timeout, c.logger, httpOpts...)
 
 	return c
 }
@@ -86,3 +181,11 @@ func (c *Client) BaseURL() string {
 	return c.baseURL
 }
 
+// LimiterStats returns statistics about requests waiting for a slot. It
+// returns a zero value if the client has no concurrency limit.
+func (c *Client) LimiterStats() LimiterStats {
+	if c.limiter == nil {
+		return LimiterStats{}
+	}
+	return c.limiter.snapshot()
+}
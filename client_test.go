@@ -1,8 +1,15 @@
 package drawthings
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/drawthings_go/drawthingstest"
 )
 
 func TestNewClient(t *testing.T) {
@@ -39,6 +46,11 @@ func TestWithTimeout(t *testing.T) {
 	if client.timeout != customTimeout {
 		t.Errorf("Timeout: got %v, want %v", client.timeout, customTimeout)
 	}
+
+	// Zero disables the timeout, for renders that take a long time.
+	if client := NewClient(WithTimeout(0), WithLogger(nopLogger{})); client.timeout != 0 {
+		t.Errorf("WithTimeout(0): got %v, want no timeout", client.timeout)
+	}
 }
 
 func TestBaseURL(t *testing.T) {
@@ -64,3 +76,94 @@ func TestClientOptions(t *testing.T) {
 	}
 }
 
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestWithTransport(t *testing.T) {
+	var calls int
+	transport := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		calls++
+		return nil, errors.New("transport called")
+	})
+
+	// The transport and logger must survive options applied afterwards.
+	client := NewClient(WithTransport(transport), WithLogger(nopLogger{}), WithTimeout(time.Second))
+	if client.logger == nil {
+		t.Error("logger was dropped")
+	}
+	_, err := client.GenerateImage(context.Background(), &TextToImageRequest{Prompt: "test"})
+	if calls != 1 {
+		t.Errorf("transport calls: got %d, want 1 (err: %v)", calls, err)
+	}
+	if !IsNetworkError(err) {
+		t.Errorf("expected NetworkError, got %T: %v", err, err)
+	}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Logf(string, ...interface{}) {}
+
+type testRecorder struct {
+	mu       sync.Mutex
+	requests []string
+	bytes    int64
+	retries  map[string]int
+	waits    map[string]int
+}
+
+func (r *testRecorder) ObserveRequest(endpoint, outcome string, duration time.Duration, bytes int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, endpoint+" "+outcome)
+	r.bytes += bytes
+}
+
+func (r *testRecorder) ObserveRetry(source string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.retries[source]++
+}
+
+func (r *testRecorder) ObserveQueueWait(queue string, wait time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.waits[queue]++
+}
+
+func TestWithMetrics(t *testing.T) {
+	failing := drawthingstest.NewServer()
+	defer failing.Close()
+	failing.SetFailure(drawthingstest.StatusFailure(http.StatusServiceUnavailable))
+	healthy := drawthingstest.NewServer()
+	defer healthy.Close()
+
+	rec := &testRecorder{retries: map[string]int{}, waits: map[string]int{}}
+	pool, err := NewPool([]*Client{
+		NewClient(WithBaseURL(failing.URL), WithMetrics(rec)),
+		NewClient(WithBaseURL(healthy.URL), WithMetrics(rec), WithMaxConcurrency(1)),
+	}, WithStrategy(RoundRobin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	if _, err := pool.GenerateImage(context.Background(), &TextToImageRequest{Prompt: "fox"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"/sdapi/v1/txt2img api", "/sdapi/v1/txt2img ok"}
+	if fmt.Sprint(rec.requests) != fmt.Sprint(want) {
+		t.Errorf("requests = %q, want %q", rec.requests, want)
+	}
+	if rec.bytes == 0 {
+		t.Error("expected response bytes to be recorded")
+	}
+	if rec.retries["pool"] != 1 {
+		t.Errorf("expected 1 pool retry, got %v", rec.retries)
+	}
+	if rec.waits["client"] != 1 {
+		t.Errorf("expected 1 limiter wait, got %v", rec.waits)
+	}
+}
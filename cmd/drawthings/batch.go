@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/drawthings_go/batch"
+	"github.com/drawthings_go/styles"
+)
+
+// runBatch implements the "batch" command.
+func runBatch(a *app, args []string) error {
+	fs := a.newFlagSet("batch")
+	var (
+		params    requestOptions
+		templates templateOptions
+	)
+	params.register(fs)
+	templates.register(fs)
+	var (
+		concurrency    = fs.Int("concurrency", 1, "Number of jobs to run at the same time")
+		outputDir      = fs.String("output-dir", ".", "Directory for generated images")
+		outputTemplate = fs.String("output-template", batch.DefaultOutputTemplate, "Go template for output file names (fields: .ID .Index .Image .Seed .Prompt)")
+		manifestPath   = fs.String("manifest", "", "Path of the results manifest (default: <output-dir>/manifest.jsonl)")
+		force          = fs.Bool("force", false, "Run every job, even those already completed in the manifest")
+		count          = fs.Int("count", 1, "With -prompt-template and no job file, number of prompts to generate")
+	)
+	defaultUsage := fs.Usage
+	fs.Usage = func() {
+		defaultUsage()
+		fmt.Fprintf(a.stderr, "\nThe job file holds one JSON request per line (.jsonl) or a CSV table with a\n")
+		fmt.Fprintf(a.stderr, "header row (.csv). Request parameter flags apply to jobs that leave them unset.\n")
+		fmt.Fprintf(a.stderr, "\nWith -prompt-template or -vars, prompts are templates: {name} is a variable\n")
+		fmt.Fprintf(a.stderr, "(set with -vars or per job in \"vars\" or vars.<name> CSV columns), {a|b|c}\n")
+		fmt.Fprintf(a.stderr, "picks an alternative and __name__ a line of <wildcard-dir>/name.txt. Choices\n")
+		fmt.Fprintf(a.stderr, "depend on the job ID and -template-seed, so reruns give the same prompts.\n")
+		fmt.Fprintf(a.stderr, "\nExamples:\n")
+		fmt.Fprintf(a.stderr, "  drawthings batch -concurrency 2 -output-dir out jobs.jsonl\n")
+		fmt.Fprintf(a.stderr, "  drawthings batch -steps 30 -output-template '{{.Index}}-{{.Prompt}}.png' jobs.csv\n")
+		fmt.Fprintf(a.stderr, "  drawthings batch -prompt-template 'a {color} mug on a {marble|oak} table' -vars color={red|blue} -count 8\n")
+	}
+
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 || fs.NArg() == 0 && templates.promptTemplate == "" {
+		fs.Usage()
+		return usageErrorf("exactly one job file is required")
+	}
+	if *count < 1 {
+		return usageErrorf("-count must be at least 1")
+	}
+	renderer, err := templates.renderer()
+	if err != nil {
+		return err
+	}
+
+	var jobs []batch.Job
+	if fs.NArg() == 1 {
+		if jobs, err = batch.ReadFile(fs.Arg(0)); err != nil {
+			return err
+		}
+	} else {
+		for i := 1; i <= *count; i++ {
+			jobs = append(jobs, batch.Job{ID: fmt.Sprintf("%04d", i)})
+		}
+	}
+
+	if *manifestPath == "" {
+		*manifestPath = filepath.Join(*outputDir, "manifest.jsonl")
+	}
+
+	chosen, err := a.styles(&params)
+	if err != nil {
+		return err
+	}
+	defaults := params.request("")
+	if len(chosen) > 0 {
+		// Parameters left at their defaults yield to the styles. Those set
+		// by flags are applied as a last style, so they override the
+		// styles but not the jobs.
+		a.unsetDefaults(defaults)
+		chosen = append(chosen, styles.Style{
+			Name:          "flags",
+			Steps:         defaults.Steps,
+			GuidanceScale: defaults.GuidanceScale,
+			Width:         defaults.Width,
+			Height:        defaults.Height,
+		})
+	}
+
+	var (
+		mu   sync.Mutex
+		done int
+	)
+	opts := []batch.Option{
+		batch.WithConcurrency(*concurrency),
+		batch.WithOutputDir(*outputDir),
+		batch.WithOutputTemplate(*outputTemplate),
+		batch.WithManifest(*manifestPath),
+		batch.WithDefaults(*defaults),
+		batch.WithStyles(chosen...),
+		batch.WithForce(*force),
+		batch.WithResultHandler(func(res batch.Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			done++
+			switch res.Status {
+			case batch.StatusFailed:
+				a.printf("[%d/%d] failed    %s: %s\n", done, len(jobs), res.ID, res.Error)
+			default:
+				a.printf("[%d/%d] %-9s %s -> %v\n", done, len(jobs), res.Status, res.ID, res.Outputs)
+				if res.Prompt != "" {
+					a.printf("          prompt: %s\n", res.Prompt)
+				}
+			}
+		}),
+	}
+	if templates.enabled() {
+		opts = append(opts,
+			batch.WithPromptRenderer(renderer),
+			batch.WithPromptTemplate(templates.promptTemplate),
+			batch.WithTemplateSeed(templates.templateSeed),
+		)
+	}
+	runner := batch.NewRunner(a.newClient(), opts...)
+
+	summary, err := runner.Run(a.context(), jobs)
+	if summary != nil {
+		a.setResult(batchResult{
+			Total:     summary.Total,
+			Succeeded: summary.Succeeded,
+			Failed:    summary.Failed,
+			Skipped:   summary.Skipped,
+			Manifest:  *manifestPath,
+			Jobs:      summary.Results,
+		})
+		a.printf("Batch finished: %d succeeded, %d failed, %d skipped (manifest: %s)\n",
+			summary.Succeeded, summary.Failed, summary.Skipped, *manifestPath)
+	}
+	if err != nil {
+		return err
+	}
+	if summary.Failed > 0 {
+		return fmt.Errorf("%d of %d jobs failed", summary.Failed, summary.Total)
+	}
+	return nil
+}
+
+// batchResult is the JSON result of the batch command.
+type batchResult struct {
+	Total     int            `json:"total"`
+	Succeeded int            `json:"succeeded"`
+	Failed    int            `json:"failed"`
+	Skipped   int            `json:"skipped"`
+	Manifest  string         `json:"manifest"`
+	Jobs      []batch.Result `json:"jobs"`
+}
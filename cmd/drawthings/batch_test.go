@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drawthings_go/drawthingstest"
+)
+
+func TestBatch_PromptTemplate(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+	dir := t.TempDir()
+	wildcards := filepath.Join(dir, "wildcards")
+	if err := os.MkdirAll(wildcards, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(wildcards, "surface.txt"), []byte("marble\noak\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	a := newApp(strings.NewReader(""), &stdout, &stderr)
+	a.getenv = func(string) string { return "" }
+	code := a.execute([]string{"batch", "-output-format", "json", "-base-url", server.URL,
+		"-width", "64", "-height", "64", "-output-dir", filepath.Join(dir, "out"),
+		"-prompt-template", "a {color} {product} on __surface__", "-vars", "color={red|blue},product=mug",
+		"-wildcard-dir", wildcards, "-count", "3"})
+	if code != exitOK {
+		t.Fatalf("exit code %d, stderr: %s", code, stderr.String())
+	}
+
+	var doc struct {
+		Result batchResult `json:"result"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON output %q: %v", stdout.String(), err)
+	}
+	if doc.Result.Succeeded != 3 {
+		t.Fatalf("unexpected result: %+v", doc.Result)
+	}
+	requests := server.RequestsTo(drawthingstest.PathTxt2Img)
+	for i, job := range doc.Result.Jobs {
+		if !strings.HasPrefix(job.Prompt, "a red mug on ") && !strings.HasPrefix(job.Prompt, "a blue mug on ") ||
+			!strings.HasSuffix(job.Prompt, " marble") && !strings.HasSuffix(job.Prompt, " oak") {
+			t.Errorf("job %s: unexpected prompt %q", job.ID, job.Prompt)
+		}
+		var sent struct {
+			Prompt string `json:"prompt"`
+		}
+		requests[i].Decode(&sent)
+		if sent.Prompt != job.Prompt {
+			t.Errorf("sent prompt %q, recorded %q", sent.Prompt, job.Prompt)
+		}
+	}
+
+	a = newApp(strings.NewReader(""), &stdout, &stderr)
+	a.getenv = func(string) string { return "" }
+	if code := a.execute([]string{"batch", "-prompt-template", "a fox", "-vars", "oops"}); code != exitUsage {
+		t.Errorf("invalid -vars: exit code %d, want %d", code, exitUsage)
+	}
+}
+
+func TestGenerateAndREPL_PromptTemplate(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+	dir := t.TempDir()
+	wildcards := filepath.Join(dir, "wildcards")
+	if err := os.MkdirAll(wildcards, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(wildcards, "surface.txt"), []byte("marble\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(stdin string, args ...string) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		a := newApp(strings.NewReader(stdin), &stdout, &stderr)
+		a.getenv = func(string) string { return "" }
+		if code := a.execute(append([]string{"-base-url", server.URL}, args...)); code != exitOK {
+			t.Fatalf("%v: exit code %d, stderr: %s", args, code, stderr.String())
+		}
+	}
+	run("", "generate", "-output", filepath.Join(dir, "a.png"),
+		"-prompt-template", "a {color} {product} on __surface__", "-vars", "color=red,product=mug",
+		"-wildcard-dir", wildcards)
+	run("", "generate", "-output", filepath.Join(dir, "b.png"),
+		"-prompt", "a {red|red} fox", "-vars", "unused=x")
+	run("prompt a {color} fox\nset vars color=blue\ngo\nquit\n", "repl", "-output-dir", dir)
+
+	var prompts []string
+	for _, r := range server.RequestsTo(drawthingstest.PathTxt2Img) {
+		var sent struct {
+			Prompt string `json:"prompt"`
+		}
+		r.Decode(&sent)
+		prompts = append(prompts, sent.Prompt)
+	}
+	want := []string{"a red mug on marble", "a red fox", "a blue fox"}
+	if strings.Join(prompts, "|") != strings.Join(want, "|") {
+		t.Errorf("sent prompts %q, want %q", prompts, want)
+	}
+
+	// Without template flags, prompts are sent as given.
+	run("", "generate", "-output", filepath.Join(dir, "c.png"), "-prompt", "a {red|blue} fox")
+	last := server.RequestsTo(drawthingstest.PathTxt2Img)
+	var sent struct {
+		Prompt string `json:"prompt"`
+	}
+	last[len(last)-1].Decode(&sent)
+	if sent.Prompt != "a {red|blue} fox" {
+		t.Errorf("prompt without template flags = %q", sent.Prompt)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/drawthings_go/cache"
+)
+
+// defaultCacheDir returns the default location of the result cache.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "drawthings-cache")
+	}
+	return filepath.Join(dir, "drawthings", "results")
+}
+
+// openCache opens the result cache configured by the global options.
+func (a *app) openCache() (*cache.Cache, error) {
+	return cache.Open(a.globals.cacheDir,
+		cache.WithMaxSize(a.globals.cacheMaxMB<<20),
+		cache.WithMaxAge(a.globals.cacheMaxAge),
+	)
+}
+
+// cacheResult is the JSON result of the cache command.
+type cacheResult struct {
+	Dir     string      `json:"dir"`
+	Cleared bool        `json:"cleared,omitempty"`
+	Stats   cache.Stats `json:"stats"`
+}
+
+// runCache implements the "cache" command.
+func runCache(a *app, args []string) error {
+	if len(args) == 0 || (args[0] != "stats" && args[0] != "clear") {
+		fmt.Fprintf(a.stderr, "Usage: drawthings cache <stats|clear> [options]\n\n")
+		fmt.Fprintf(a.stderr, "Manage the result cache used with -cache.\n\n")
+		fmt.Fprintf(a.stderr, "  stats    Show the size and age of the cache\n")
+		fmt.Fprintf(a.stderr, "  clear    Remove every cached image\n")
+		if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+			return flag.ErrHelp
+		}
+		return usageErrorf("expected stats or clear")
+	}
+	name := args[0]
+
+	fs := a.newFlagSet("cache")
+	defaultUsage := fs.Usage
+	fs.Usage = func() {
+		defaultUsage()
+		fmt.Fprintf(a.stderr, "\nThe cache location and limits are set with the global -cache-* options.\n")
+	}
+	if err := a.parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return usageErrorf("cache %s takes no arguments", name)
+	}
+
+	c, err := a.openCache()
+	if err != nil {
+		return err
+	}
+	result := cacheResult{Dir: c.Dir()}
+	if name == "clear" {
+		if err := c.Clear(); err != nil {
+			return err
+		}
+		result.Cleared = true
+	}
+	if result.Stats, err = c.Stats(); err != nil {
+		return err
+	}
+	a.setResult(result)
+
+	if result.Cleared {
+		a.printf("Cleared %s\n", result.Dir)
+		return nil
+	}
+	s := result.Stats
+	a.printf("Directory:  %s\n", result.Dir)
+	a.printf("Entries:    %d (%d images)\n", s.Entries, s.Images)
+	a.printf("Size:       %s", formatBytes(s.Bytes))
+	if s.MaxSize > 0 {
+		a.printf(" of %s", formatBytes(s.MaxSize))
+	}
+	a.printf("\n")
+	if s.Entries > 0 {
+		a.printf("Last used:  %s to %s\n", s.Oldest.Format(time.DateTime), s.Newest.Format(time.DateTime))
+	}
+	if s.MaxAge != "" {
+		a.printf("Expires:    after %s unused\n", s.MaxAge)
+	}
+	if s.Evictions > 0 {
+		a.printf("Evicted:    %d expired entries\n", s.Evictions)
+	}
+	return nil
+}
+
+// formatBytes formats n in binary units.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drawthings_go/drawthingstest"
+)
+
+func TestCache_Command(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+
+	run := func(args ...string) string {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		a := newApp(strings.NewReader(""), &stdout, &stderr)
+		a.getenv = func(name string) string {
+			if name == "DRAWTHINGS_CACHE_DIR" {
+				return cacheDir
+			}
+			return ""
+		}
+		if code := a.execute(args); code != exitOK {
+			t.Fatalf("%v: exit code %d:\n%s", args, code, stderr.String())
+		}
+		return stdout.String()
+	}
+	stats := func(args ...string) cacheResult {
+		t.Helper()
+		out := run(append([]string{"cache"}, append(args, "-output-format", "json")...)...)
+		var doc struct {
+			Result cacheResult `json:"result"`
+		}
+		if err := json.Unmarshal([]byte(out), &doc); err != nil {
+			t.Fatalf("invalid JSON output: %v\n%s", err, out)
+		}
+		return doc.Result
+	}
+
+	for i, output := range []string{"a.png", "b.png"} {
+		run("generate", "-cache", "-base-url", server.URL, "-prompt", "fox", "-seed", "5",
+			"-width", "64", "-height", "64", "-output", filepath.Join(dir, output))
+		if n := len(server.RequestsTo(drawthingstest.PathTxt2Img)); n != 1 {
+			t.Fatalf("after generation %d: %d renders, want 1", i+1, n)
+		}
+	}
+
+	// A seed picked at random by the CLI is not cached.
+	run("generate", "-cache", "-base-url", server.URL, "-prompt", "fox",
+		"-width", "64", "-height", "64", "-output", filepath.Join(dir, "random.png"))
+	if n := len(server.RequestsTo(drawthingstest.PathTxt2Img)); n != 2 {
+		t.Fatalf("after a random-seed generation: %d renders, want 2", n)
+	}
+
+	got := stats("stats")
+	if got.Dir != cacheDir || got.Stats.Entries != 1 || got.Stats.Images != 1 || got.Stats.Bytes == 0 {
+		t.Errorf("unexpected stats: %+v", got)
+	}
+	if got := stats("clear"); !got.Cleared || got.Stats.Entries != 0 {
+		t.Errorf("unexpected result of clear: %+v", got)
+	}
+
+	out := run("cache", "stats")
+	if !strings.Contains(out, "Entries:    0 (0 images)") {
+		t.Errorf("unexpected text output:\n%s", out)
+	}
+}
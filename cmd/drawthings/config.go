@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Configuration precedence, from highest to lowest:
+//
+//	command-line flags > DRAWTHINGS_* environment variables > profile > defaults
+//
+// Profiles are stored in a JSON config file. Each profile maps flag names to
+// values, so any flag of any command can be given a per-profile default:
+//
+//	{
+//	  "profile": "studio",
+//	  "profiles": {
+//	    "studio": {"base-url": "http://studio.local:7860", "timeout": "10m"},
+//	    "poster": {"width": 768, "height": 1024, "steps": 40}
+//	  }
+//	}
+
+const (
+	// envPrefix is prepended to upper-cased flag names to form environment variable names.
+	envPrefix = "DRAWTHINGS_"
+	// envConfig overrides the config file location.
+	envConfig = envPrefix + "CONFIG"
+	// envProfile selects the active profile.
+	envProfile = envPrefix + "PROFILE"
+	// defaultProfileName is used when no profile is selected explicitly.
+	defaultProfileName = "default"
+)
+
+// Value sources reported by "config show".
+const (
+	sourceDefault = "default"
+	sourceProfile = "profile"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+// unconfigurableFlags are never read from the environment or a profile.
+var unconfigurableFlags = map[string]bool{
+	"config":  true,
+	"profile": true,
+	"version": true,
+	"help":    true,
+}
+
+// config is the on-disk CLI configuration file.
+type config struct {
+	// Profile is the name of the profile used when none is selected.
+	Profile string `json:"profile,omitempty"`
+	// Profiles maps profile names to flag values.
+	Profiles map[string]map[string]json.RawMessage `json:"profiles,omitempty"`
+}
+
+// defaultConfigPath returns the default location of the config file.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "drawthings", "config.json")
+}
+
+// loadConfig reads the config file at path. A missing file yields an empty
+// config unless required is set.
+func loadConfig(path string, required bool) (*config, error) {
+	cfg := &config{}
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !required {
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// configValue converts a JSON profile value to its flag string form.
+func configValue(raw json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", err
+	}
+	switch v.(type) {
+	case float64, bool:
+		return string(bytes.TrimSpace(raw)), nil
+	case []interface{}:
+		// Lists are joined with commas, matching list-valued flags.
+		var list []string
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return "", fmt.Errorf("lists must contain strings")
+		}
+		return strings.Join(list, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value %s", raw)
+	}
+}
+
+// envName returns the environment variable consulted for a flag.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// configPath returns the config file location and whether it was chosen explicitly.
+func (a *app) configPath() (string, bool) {
+	if a.globals.configPath != "" {
+		return a.globals.configPath, true
+	}
+	if p := a.getenv(envConfig); p != "" {
+		return p, true
+	}
+	return defaultConfigPath(), false
+}
+
+// loadProfile loads the config file and selects the active profile.
+func (a *app) loadProfile() error {
+	if a.cfg != nil {
+		return nil
+	}
+
+	path, explicit := a.configPath()
+	cfg, err := loadConfig(path, explicit)
+	if err != nil {
+		return err
+	}
+
+	name := a.globals.profile
+	if name == "" {
+		name = a.getenv(envProfile)
+	}
+	if name == "" {
+		name = cfg.Profile
+	}
+	if name != "" {
+		if _, ok := cfg.Profiles[name]; !ok {
+			return fmt.Errorf("profile %q not found in %s", name, path)
+		}
+	} else if _, ok := cfg.Profiles[defaultProfileName]; ok {
+		name = defaultProfileName
+	}
+
+	a.cfg = cfg
+	a.profileName = name
+	return nil
+}
+
+// parseFlags parses args into fs and fills every flag that was not given on
+// the command line from the environment or the active profile.
+func (a *app) parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return &usageError{msg: err.Error()}
+	}
+	fs.Visit(func(f *flag.Flag) {
+		a.explicit[f.Name] = true
+	})
+
+	if err := a.loadProfile(); err != nil {
+		return err
+	}
+	profile := a.cfg.Profiles[a.profileName]
+
+	var setErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		if setErr != nil || unconfigurableFlags[f.Name] {
+			return
+		}
+		if a.explicit[f.Name] {
+			a.sources[f.Name] = sourceFlag
+			return
+		}
+		if v, ok := a.lookupEnv(envName(f.Name)); ok {
+			if err := fs.Set(f.Name, v); err != nil {
+				setErr = fmt.Errorf("invalid value %q for %s: %v", v, envName(f.Name), err)
+				return
+			}
+			a.sources[f.Name] = sourceEnv
+			return
+		}
+		if raw, ok := profile[f.Name]; ok {
+			v, err := configValue(raw)
+			if err == nil {
+				err = fs.Set(f.Name, v)
+			}
+			if err != nil {
+				setErr = fmt.Errorf("invalid value for %q in profile %q: %v", f.Name, a.profileName, err)
+				return
+			}
+			a.sources[f.Name] = sourceProfile
+			return
+		}
+		a.sources[f.Name] = sourceDefault
+	})
+	if setErr != nil {
+		return setErr
+	}
+
+	if f := a.globals.outputFormat; f != formatText && f != formatJSON {
+		return usageErrorf("invalid output format %q: must be %q or %q", f, formatText, formatJSON)
+	}
+	return nil
+}
+
+// lookupEnv returns the value of a non-empty environment variable.
+func (a *app) lookupEnv(key string) (string, bool) {
+	v := a.getenv(key)
+	return v, v != ""
+}
+
+// runConfig implements the "config" command.
+func runConfig(a *app, args []string) error {
+	fs := a.newFlagSet("config")
+	var opts generateOptions
+	opts.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(a.stderr, "Usage: drawthings config show [options]\n\n")
+		fmt.Fprintf(a.stderr, "Print the effective value and source of every setting.\n")
+		fmt.Fprintf(a.stderr, "Precedence: flags > %s* environment variables > profile > defaults.\n\n", envPrefix)
+		fmt.Fprintf(a.stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if len(args) == 0 || args[0] != "show" {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		fs.Usage()
+		return usageErrorf("expected \"show\"")
+	}
+	if err := a.parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+
+	path, _ := a.configPath()
+	_, statErr := os.Stat(path)
+
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if !unconfigurableFlags[f.Name] {
+			names = append(names, f.Name)
+		}
+	})
+	sort.Strings(names)
+
+	result := configResult{
+		ConfigFile:  path,
+		ConfigFound: statErr == nil,
+		Profile:     a.profileName,
+		Settings:    make(map[string]configSetting, len(names)),
+	}
+	for _, name := range names {
+		result.Settings[name] = configSetting{
+			Value:  fs.Lookup(name).Value.String(),
+			Source: a.sources[name],
+		}
+	}
+	a.setResult(result)
+
+	if !result.ConfigFound {
+		path += " (not found)"
+	}
+	profile := a.profileName
+	if profile == "" {
+		profile = "(none)"
+	}
+	a.printf("config file: %s\n", path)
+	a.printf("profile: %s\n", profile)
+	for _, name := range names {
+		setting := result.Settings[name]
+		a.printf("%-16s = %-32s (%s)\n", name, setting.Value, setting.Source)
+	}
+	return nil
+}
+
+// configResult is the JSON result of "config show".
+type configResult struct {
+	ConfigFile  string                   `json:"config_file"`
+	ConfigFound bool                     `json:"config_found"`
+	Profile     string                   `json:"profile,omitempty"`
+	Settings    map[string]configSetting `json:"settings"`
+}
+
+// configSetting is the effective value of a flag and where it came from.
+type configSetting struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
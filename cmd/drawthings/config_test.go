@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return path
+}
+
+func newTestApp(env map[string]string) (*app, *bytes.Buffer) {
+	var stdout bytes.Buffer
+	a := newApp(strings.NewReader(""), &stdout, &bytes.Buffer{})
+	a.getenv = func(key string) string { return env[key] }
+	return a, &stdout
+}
+
+func TestParseFlags_Precedence(t *testing.T) {
+	path := writeConfig(t, `{
+		"profile": "studio",
+		"profiles": {
+			"studio": {"base-url": "http://studio:7860", "steps": 30, "width": 768, "height": 1024}
+		}
+	}`)
+
+	a, _ := newTestApp(map[string]string{
+		envConfig:          path,
+		"DRAWTHINGS_STEPS": "40",
+		"DRAWTHINGS_WIDTH": "640",
+	})
+
+	fs := a.newFlagSet("generate")
+	var opts generateOptions
+	opts.register(fs)
+	if err := a.parseFlags(fs, []string{"-width", "512"}); err != nil {
+		t.Fatalf("parseFlags() error = %v", err)
+	}
+
+	if opts.width != 512 {
+		t.Errorf("width: got %d, want 512 (flag)", opts.width)
+	}
+	if opts.steps != 40 {
+		t.Errorf("steps: got %d, want 40 (env)", opts.steps)
+	}
+	if opts.height != 1024 {
+		t.Errorf("height: got %d, want 1024 (profile)", opts.height)
+	}
+	if a.globals.baseURL != "http://studio:7860" {
+		t.Errorf("base-url: got %q, want profile value", a.globals.baseURL)
+	}
+	if opts.guidanceScale != 4.0 {
+		t.Errorf("guidance-scale: got %v, want default 4.0", opts.guidanceScale)
+	}
+
+	wantSources := map[string]string{
+		"width":          sourceFlag,
+		"steps":          sourceEnv,
+		"height":         sourceProfile,
+		"guidance-scale": sourceDefault,
+	}
+	for name, want := range wantSources {
+		if got := a.sources[name]; got != want {
+			t.Errorf("source of %s: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestParseFlags_ProfileSelection(t *testing.T) {
+	path := writeConfig(t, `{
+		"profiles": {
+			"default": {"steps": 25},
+			"fast": {"steps": 8}
+		}
+	}`)
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want int
+	}{
+		{"default profile", map[string]string{envConfig: path}, nil, 25},
+		{"env profile", map[string]string{envConfig: path, envProfile: "fast"}, nil, 8},
+		{"flag profile", map[string]string{envConfig: path, envProfile: "default"}, []string{"-profile", "fast"}, 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := newTestApp(tt.env)
+			fs := a.newFlagSet("generate")
+			var opts generateOptions
+			opts.register(fs)
+			if err := a.parseFlags(fs, tt.args); err != nil {
+				t.Fatalf("parseFlags() error = %v", err)
+			}
+			if opts.steps != tt.want {
+				t.Errorf("steps: got %d, want %d", opts.steps, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFlags_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		env    map[string]string
+	}{
+		{"unknown profile", `{"profiles": {}}`, map[string]string{envProfile: "missing"}},
+		{"invalid profile value", `{"profiles": {"default": {"steps": "many"}}}`, nil},
+		{"invalid env value", `{}`, map[string]string{"DRAWTHINGS_STEPS": "many"}},
+		{"malformed file", `{"profiles": [}`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{envConfig: writeConfig(t, tt.config)}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+			a, _ := newTestApp(env)
+			fs := a.newFlagSet("generate")
+			var opts generateOptions
+			opts.register(fs)
+			if err := a.parseFlags(fs, nil); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestRunConfigShow(t *testing.T) {
+	path := writeConfig(t, `{"profiles": {"default": {"base-url": "http://studio:7860"}}}`)
+	a, stdout := newTestApp(nil)
+
+	if err := a.run([]string{"-config", path, "config", "show", "-steps", "12"}); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	out := stdout.String()
+	for _, want := range []string{
+		"profile: default",
+		"http://studio:7860",
+		"(profile)",
+		"(flag)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/drawthings_go"
+)
+
+// Outcomes of a doctor check.
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+// doctorCheck is the outcome of one diagnostic.
+type doctorCheck struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Message    string `json:"message"`
+	Fix        string `json:"fix,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// doctorResult is the JSON result of the doctor command.
+type doctorResult struct {
+	BaseURL string        `json:"base_url"`
+	Checks  []doctorCheck `json:"checks"`
+}
+
+// Fixes suggested by doctor.
+const (
+	fixBaseURL = "Set -base-url to the address shown in Draw Things' API server settings, e.g. http://127.0.0.1:7860."
+	fixDNS     = "Check the host name in -base-url, or use the server's IP address. Use 127.0.0.1 if Draw Things runs on this machine."
+	fixRefused = "Start Draw Things and enable its API server (Settings > API Server, HTTP protocol). " +
+		"If it is running, make sure the port in -base-url matches the one shown there."
+	fixTimeout = "The host did not answer. Check that it is online and that a firewall allows incoming connections to Draw Things on this port."
+	fixNotAPI  = "Another program answered on this port. Point -base-url at the port of Draw Things' API server, " +
+		"and make sure the server uses the HTTP protocol rather than gRPC."
+	fixRender = "Check that a model is loaded in Draw Things and that it can generate an image from the app itself."
+	fixSlow   = "The test render did not finish within -timeout. Increase -timeout, or wait for the server to finish other work."
+)
+
+// doctor runs diagnostics against the configured server. Each check
+// stores what later checks need.
+type doctor struct {
+	a       *app
+	timeout time.Duration
+	url     *url.URL
+	client  *drawthings.Client
+}
+
+// doctorStep is a single named diagnostic.
+type doctorStep struct {
+	name string
+	run  func() (status, message, fix string, err error)
+}
+
+// runDoctor implements the "doctor" command.
+func runDoctor(a *app, args []string) error {
+	fs := a.newFlagSet("doctor")
+	var (
+		probeTimeout = fs.Duration("probe-timeout", 5*time.Second, "Time limit for each network check")
+		skipRender   = fs.Bool("skip-render", false, "Skip the test render")
+	)
+	defaultUsage := fs.Usage
+	fs.Usage = func() {
+		defaultUsage()
+		fmt.Fprintf(a.stderr, "\nChecks run in order: url, dns, tcp, api, render. A failed check\n")
+		fmt.Fprintf(a.stderr, "skips the ones after it and prints a suggested fix.\n")
+	}
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return usageErrorf("doctor takes no arguments")
+	}
+
+	d := &doctor{a: a, timeout: *probeTimeout, client: a.newClient()}
+	steps := []doctorStep{
+		{"url", d.checkURL},
+		{"dns", d.checkDNS},
+		{"tcp", d.checkTCP},
+		{"api", d.checkAPI},
+		{"render", d.checkRender},
+	}
+
+	result := doctorResult{BaseURL: a.globals.baseURL}
+	a.setResult(&result)
+	a.printf("Checking %s\n\n", a.globals.baseURL)
+
+	var (
+		failed   string
+		firstErr error
+	)
+	for _, step := range steps {
+		check := doctorCheck{Name: step.name}
+		switch {
+		case failed != "":
+			check.Status, check.Message = checkSkip, "skipped because "+failed+" failed"
+		case step.name == "render" && *skipRender:
+			check.Status, check.Message = checkSkip, "skipped with -skip-render"
+		default:
+			started := time.Now()
+			var err error
+			check.Status, check.Message, check.Fix, err = step.run()
+			check.DurationMS = time.Since(started).Milliseconds()
+			if check.Status == checkFail {
+				failed, firstErr = step.name, err
+			}
+		}
+		result.Checks = append(result.Checks, check)
+
+		a.printf("  %-4s  %-7s %s\n", check.Status, check.Name, check.Message)
+		if check.Fix != "" {
+			a.printf("                fix: %s\n", check.Fix)
+		}
+	}
+
+	if failed != "" {
+		a.printf("\nThe %s check failed.\n", failed)
+		return firstErr
+	}
+	a.printf("\nAll checks passed.\n")
+	return nil
+}
+
+// probeContext returns a context for one network check.
+func (d *doctor) probeContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(d.a.context(), d.timeout)
+}
+
+// checkURL validates the base URL.
+func (d *doctor) checkURL() (string, string, string, error) {
+	u, err := url.Parse(d.a.globals.baseURL)
+	if err == nil && (u.Scheme != "http" && u.Scheme != "https" || u.Host == "") {
+		err = errors.New("expected an http:// or https:// URL with a host")
+	}
+	if err != nil {
+		return checkFail, "invalid base URL: " + err.Error(), fixBaseURL, usageErrorf("invalid base URL %q: %v", d.a.globals.baseURL, err)
+	}
+	d.url = u
+	if u.Port() == "" {
+		return checkWarn, fmt.Sprintf("no port given, so %s uses the %s default", u.Hostname(), u.Scheme),
+			"Draw Things listens on port 7860 unless configured otherwise; add it to -base-url.", nil
+	}
+	return checkPass, u.String(), "", nil
+}
+
+// checkDNS resolves the host name.
+func (d *doctor) checkDNS() (string, string, string, error) {
+	host := d.url.Hostname()
+	if net.ParseIP(host) != nil {
+		return checkPass, host + " is an IP address", "", nil
+	}
+
+	ctx, cancel := d.probeContext()
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return checkFail, fmt.Sprintf("cannot resolve %s", host), fixDNS,
+			drawthings.NewNetworkError("cannot resolve host "+host, err)
+	}
+	return checkPass, fmt.Sprintf("%s resolves to %s", host, strings.Join(addrs, ", ")), "", nil
+}
+
+// checkTCP connects to the server's port.
+func (d *doctor) checkTCP() (string, string, string, error) {
+	port := d.url.Port()
+	if port == "" {
+		port = d.url.Scheme
+	}
+	addr := net.JoinHostPort(d.url.Hostname(), port)
+
+	ctx, cancel := d.probeContext()
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		netErr := drawthings.NewNetworkError("cannot connect to "+addr, err)
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return checkFail, "connection refused on " + addr, fixRefused, netErr
+		}
+		return checkFail, fmt.Sprintf("cannot connect to %s: %v", addr, err), fixTimeout, netErr
+	}
+	conn.Close()
+	return checkPass, "connected to " + addr, "", nil
+}
+
+// checkAPI checks that the port is served by a Stable Diffusion API.
+func (d *doctor) checkAPI() (string, string, string, error) {
+	ctx, cancel := d.probeContext()
+	defer cancel()
+	h, err := d.client.Health(ctx)
+	switch h.Status {
+	case drawthings.HealthOK:
+		return checkPass, fmt.Sprintf("%s (%s)", h.Message, h.Latency.Round(time.Millisecond)), "", nil
+	case drawthings.HealthBusy:
+		return checkWarn, h.Message, "New requests wait until the current job finishes.", nil
+	case drawthings.HealthNotAPI:
+		return checkFail, h.Message, fixNotAPI, err
+	case drawthings.HealthRefused:
+		return checkFail, h.Message, fixRefused, err
+	default:
+		return checkFail, h.Message, fixTimeout, err
+	}
+}
+
+// checkRender generates a tiny image.
+func (d *doctor) checkRender() (string, string, string, error) {
+	req := &drawthings.TextToImageRequest{
+		Prompt: "a red circle",
+		Steps:  1,
+		Width:  64,
+		Height: 64,
+		Seed:   1,
+	}
+	started := time.Now()
+	resp, err := d.client.GenerateImage(d.a.context(), req)
+	if err != nil {
+		fix := fixRender
+		if drawthings.IsNetworkError(err) {
+			fix = fixSlow
+		}
+		return checkFail, "test render failed: " + err.Error(), fix, err
+	}
+	return checkPass, fmt.Sprintf("rendered %d image(s) at %dx%d in %s", len(resp.Images), req.Width, req.Height,
+		time.Since(started).Round(time.Millisecond)), "", nil
+}
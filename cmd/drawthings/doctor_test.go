@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/drawthings_go/drawthingstest"
+)
+
+func runDoctorTest(t *testing.T, args ...string) (doctorResult, int, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	a := newApp(strings.NewReader(""), &stdout, &stderr)
+	a.getenv = func(string) string { return "" }
+
+	code := a.execute(append([]string{"doctor", "-output-format", "json"}, args...))
+	var doc struct {
+		Result doctorResult `json:"result"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, stdout.String())
+	}
+	return doc.Result, code, stderr.String()
+}
+
+func checkStatuses(result doctorResult) string {
+	var statuses []string
+	for _, c := range result.Checks {
+		statuses = append(statuses, c.Name+"="+c.Status)
+	}
+	return strings.Join(statuses, " ")
+}
+
+func TestDoctor(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+
+	result, code, stderr := runDoctorTest(t, "-base-url", server.URL)
+	if code != exitOK {
+		t.Fatalf("exit code %d:\n%s", code, stderr)
+	}
+	if got, want := checkStatuses(result), "url=pass dns=pass tcp=pass api=pass render=pass"; got != want {
+		t.Errorf("checks = %s, want %s", got, want)
+	}
+	if len(server.RequestsTo(drawthingstest.PathTxt2Img)) != 1 {
+		t.Error("expected one test render")
+	}
+	if !strings.Contains(stderr, "All checks passed.") {
+		t.Errorf("missing summary:\n%s", stderr)
+	}
+}
+
+func TestDoctor_Failures(t *testing.T) {
+	notAPI := httptest.NewServer(http.NotFoundHandler())
+	defer notAPI.Close()
+
+	broken := drawthingstest.NewServer()
+	defer broken.Close()
+	broken.SetFailure(drawthingstest.StatusFailure(http.StatusInternalServerError))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := "http://" + l.Addr().String()
+	l.Close()
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		want     string
+		wantFix  string
+	}{
+		{
+			name:     "invalid url",
+			args:     []string{"-base-url", "127.0.0.1:7860"},
+			wantCode: exitUsage,
+			want:     "url=fail dns=skip tcp=skip api=skip render=skip",
+			wantFix:  "-base-url",
+		},
+		{
+			name:     "refused",
+			args:     []string{"-base-url", closed},
+			wantCode: exitNetwork,
+			want:     "url=pass dns=pass tcp=fail api=skip render=skip",
+			wantFix:  "API server",
+		},
+		{
+			name:     "not api",
+			args:     []string{"-base-url", notAPI.URL},
+			wantCode: exitAPI,
+			want:     "url=pass dns=pass tcp=pass api=fail render=skip",
+			wantFix:  "Another program",
+		},
+		{
+			name:     "render fails",
+			args:     []string{"-base-url", broken.URL},
+			wantCode: exitAPI,
+			want:     "url=pass dns=pass tcp=pass api=pass render=fail",
+			wantFix:  "model is loaded",
+		},
+		{
+			name:     "skip render",
+			args:     []string{"-base-url", broken.URL, "-skip-render"},
+			wantCode: exitOK,
+			want:     "url=pass dns=pass tcp=pass api=pass render=skip",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, code, stderr := runDoctorTest(t, tt.args...)
+			if code != tt.wantCode {
+				t.Errorf("exit code %d, want %d:\n%s", code, tt.wantCode, stderr)
+			}
+			if got := checkStatuses(result); got != tt.want {
+				t.Errorf("checks = %s, want %s", got, tt.want)
+			}
+			var fixes []string
+			for _, c := range result.Checks {
+				fixes = append(fixes, c.Fix)
+			}
+			if !strings.Contains(strings.Join(fixes, "\n"), tt.wantFix) {
+				t.Errorf("fixes %q do not mention %q", fixes, tt.wantFix)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/drawthings_go"
+)
+
+// requestOptions holds the optional text-to-image parameter flags.
+type requestOptions struct {
+	negativePrompt string
+	steps          int
+	guidanceScale  float64
+	width          int
+	height         int
+	seed           int
+	style          string
+	styleFile      string
+}
+
+// register adds the parameter flags to fs.
+func (o *requestOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.negativePrompt, "negative-prompt", "", "Descriptions of elements to exclude from the image")
+	fs.IntVar(&o.steps, "steps", 20, "Number of inference steps (1-150, default: 20)")
+	fs.Float64Var(&o.guidanceScale, "guidance-scale", 4.0, "Controls adherence to the prompt (1.0-20.0, default: 4.0)")
+	fs.IntVar(&o.width, "width", 512, "Width of the generated image in pixels (default: 512)")
+	fs.IntVar(&o.height, "height", 512, "Height of the generated image in pixels (default: 512)")
+	fs.IntVar(&o.seed, "seed", -1, "Random seed for image generation (-1 for random, default: -1)")
+	fs.StringVar(&o.style, "style", "", "Comma-separated style presets to apply in order, such as cinematic,film-grain")
+	fs.StringVar(&o.styleFile, "style-file", "", "Style file or directory (default: styles.json, styles.csv and styles/ next to the config file)")
+}
+
+// request builds an API request for prompt using the parameter flags.
+func (o *requestOptions) request(prompt string) *drawthings.TextToImageRequest {
+	return &drawthings.TextToImageRequest{
+		Prompt:         prompt,
+		NegativePrompt: o.negativePrompt,
+		Steps:          o.steps,
+		GuidanceScale:  o.guidanceScale,
+		Width:          o.width,
+		Height:         o.height,
+		Seed:           o.seed,
+	}
+}
+
+// generateOptions holds the flags of the generate command.
+type generateOptions struct {
+	requestOptions
+	templateOptions
+	prompt             string
+	promptFile         string
+	negativePromptFile string
+	output             string
+	tar                bool
+}
+
+// register adds the generate flags to fs.
+func (o *generateOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.prompt, "prompt", "", "Textual description of the desired image (required; \"-\" reads stdin)")
+	fs.StringVar(&o.promptFile, "prompt-file", "", "Read the prompt from a file (\"-\" for stdin)")
+	fs.StringVar(&o.negativePromptFile, "negative-prompt-file", "", "Read the negative prompt from a file (\"-\" for stdin)")
+	o.requestOptions.register(fs)
+	o.templateOptions.register(fs)
+	fs.StringVar(&o.output, "output", "output.png", "Output file path for the generated image (\"-\" writes to stdout)")
+	fs.BoolVar(&o.tar, "tar", false, "With -output -, always write a tar stream, even for a single image")
+}
+
+// runGenerate implements the "generate" command, which is also the default
+// when drawthings is invoked with flags only.
+func runGenerate(a *app, args []string) error {
+	fs := a.newFlagSet("generate")
+	var opts generateOptions
+	opts.register(fs)
+	defaultUsage := fs.Usage
+	fs.Usage = func() {
+		defaultUsage()
+		fmt.Fprintf(a.stderr, "\nExamples:\n")
+		fmt.Fprintf(a.stderr, "  drawthings generate -prompt \"a beautiful sunset\"\n")
+		fmt.Fprintf(a.stderr, "  drawthings generate -prompt \"a cat\" -steps 30 -width 768 -height 768 -output cat.png\n")
+		fmt.Fprintf(a.stderr, "  drawthings -prompt \"landscape\" -seed 42 -guidance-scale 7.0\n")
+		fmt.Fprintf(a.stderr, "  echo \"a red fox\" | drawthings generate -prompt - -output - | magick - -resize 50%% fox.jpg\n")
+		fmt.Fprintf(a.stderr, "  drawthings generate -prompt-template \"a {red|blue} mug on __surfaces__\" -template-seed 7\n")
+	}
+
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if a.globals.showVersion {
+		return runVersion(a, nil)
+	}
+
+	if err := a.resolvePrompts(&opts); err != nil {
+		return err
+	}
+	if opts.prompt == "" && opts.promptTemplate == "" {
+		fs.Usage()
+		return usageErrorf("prompt is required")
+	}
+	text, err := opts.expand(opts.prompt)
+	if err != nil {
+		return err
+	}
+	toStdout := opts.output == stdioName
+	if toStdout {
+		if a.globals.outputFormat == formatJSON {
+			return usageErrorf("-output - cannot be combined with -output-format json")
+		}
+		// Keep stdout clean for the image stream.
+		a.stdoutBusy = true
+	}
+
+	req, err := a.styledRequest(&opts.requestOptions, text)
+	if err != nil {
+		return err
+	}
+	return a.generate(req, opts.output, opts.tar)
+}
+
+// generate generates images for req and saves the first to output, or
+// streams all of them to stdout if output is "-". Successful runs are
+// recorded in the history.
+func (a *app) generate(req *drawthings.TextToImageRequest, output string, forceTar bool) error {
+	client := a.newClient()
+	ctx := a.context()
+	if req.Seed < 0 {
+		// Resolve random seeds locally so the result can be reproduced,
+		// but keep the one-off result out of the cache.
+		req.Seed = int(rand.Int31())
+		ctx = drawthings.WithoutCache(ctx)
+	}
+
+	a.printf("Generating image with prompt: %q\n", req.Prompt)
+	a.printf("Parameters: steps=%d, guidance_scale=%.2f, width=%d, height=%d, seed=%d\n",
+		req.Steps, req.GuidanceScale, req.Width, req.Height, req.Seed)
+
+	toStdout := output == stdioName
+	started := time.Now()
+	var err error
+	if toStdout {
+		err = generateToStdout(ctx, a, client, req, forceTar)
+	} else {
+		err = client.GenerateImageAndSave(ctx, req, output)
+	}
+	result := generateResult{
+		Outputs:      []string{},
+		Seed:         req.Seed,
+		Request:      req,
+		GenerationMS: time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		a.setResult(result)
+		return fmt.Errorf("failed to generate image: %w", err)
+	}
+	result.Outputs = []string{output}
+	a.setResult(result)
+
+	if toStdout {
+		a.printf("Image written to stdout\n")
+	} else {
+		a.printf("Image saved to: %s\n", output)
+	}
+	a.recordHistory(historyEntry{Command: "generate", Request: *req, Outputs: result.Outputs})
+	return nil
+}
+
+// generateToStdout generates images for req and streams them to stdout.
+func generateToStdout(ctx context.Context, a *app, client *drawthings.Client, req *drawthings.TextToImageRequest, forceTar bool) error {
+	resp, err := client.GenerateImage(ctx, req)
+	if err != nil {
+		return err
+	}
+	images, err := decodeImages(resp)
+	if err != nil {
+		return err
+	}
+	return writeImageStream(a.stdout, images, forceTar)
+}
+
+// generateResult is the JSON result of the generate command.
+type generateResult struct {
+	Outputs      []string                       `json:"outputs"`
+	Seed         int                            `json:"seed"`
+	Request      *drawthings.TextToImageRequest `json:"request"`
+	GenerationMS int64                          `json:"generation_ms"`
+}
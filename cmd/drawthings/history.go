@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/drawthings_go"
+)
+
+// historyEntry is a finished generation recorded in the history file.
+type historyEntry struct {
+	ID      int       `json:"id"`
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+	// Request holds the parameters sent, with the seed resolved.
+	Request drawthings.TextToImageRequest `json:"request"`
+	// Source, Mask, DenoisingStrength and MaskBlur are set by img2img and
+	// inpaint. Images are recorded by path, not content.
+	Source            string   `json:"source,omitempty"`
+	Mask              string   `json:"mask,omitempty"`
+	DenoisingStrength float64  `json:"denoising_strength,omitempty"`
+	MaskBlur          int      `json:"mask_blur,omitempty"`
+	Outputs           []string `json:"outputs"`
+}
+
+// defaultHistoryPath returns the default location of the history file.
+func defaultHistoryPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "history.jsonl"
+	}
+	return filepath.Join(dir, "drawthings", "history.jsonl")
+}
+
+// readHistory returns the entries of the history file, oldest first. A
+// missing file has no entries.
+func readHistory(path string) ([]historyEntry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, drawthings.NewStorageError("failed to open history", err)
+	}
+	defer f.Close()
+
+	var entries []historyEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var e historyEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// A torn final line from an interrupted run is not fatal.
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, drawthings.NewStorageError("failed to read history", err)
+	}
+	return entries, nil
+}
+
+// recordHistory appends e to the history file with the next ID. Failures
+// are reported as warnings, since the generation itself succeeded.
+func (a *app) recordHistory(e historyEntry) {
+	path := a.globals.historyFile
+	if path == "" {
+		return
+	}
+	if err := appendHistory(path, &e); err != nil {
+		fmt.Fprintf(a.stderr, "Warning: failed to record history: %v\n", err)
+		return
+	}
+	a.printf("History entry: %d\n", e.ID)
+}
+
+// appendHistory assigns e the next ID and appends it to the file at path.
+func appendHistory(path string, e *historyEntry) error {
+	entries, err := readHistory(path)
+	if err != nil {
+		return err
+	}
+	e.ID = 1
+	if len(entries) > 0 {
+		e.ID = entries[len(entries)-1].ID + 1
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return drawthings.NewStorageError("failed to create history directory", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return drawthings.NewStorageError("failed to open history", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return drawthings.NewStorageError("failed to write history", err)
+	}
+	return f.Close()
+}
+
+// historyResult is the JSON result of the history command.
+type historyResult struct {
+	Entries []historyEntry `json:"entries"`
+}
+
+// runHistory implements the "history" command.
+func runHistory(a *app, args []string) error {
+	fs := a.newFlagSet("history")
+	limit := fs.Int("limit", 20, "Number of most recent entries to show (0 for all)")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return usageErrorf("history takes no arguments")
+	}
+	if a.globals.historyFile == "" {
+		return usageErrorf("history is disabled; set -history-file")
+	}
+
+	entries, err := readHistory(a.globals.historyFile)
+	if err != nil {
+		return err
+	}
+	if *limit > 0 && len(entries) > *limit {
+		entries = entries[len(entries)-*limit:]
+	}
+	result := historyResult{Entries: entries}
+	if result.Entries == nil {
+		result.Entries = []historyEntry{}
+	}
+	a.setResult(result)
+	for _, e := range entries {
+		a.printf("%4d  %s  %-8s seed=%-10d %q\n", e.ID, e.Time.Local().Format("2006-01-02 15:04"), e.Command, e.Request.Seed, e.Request.Prompt)
+	}
+	return nil
+}
+
+// runReplay implements the "replay" command.
+func runReplay(a *app, args []string) error {
+	fs := a.newFlagSet("replay")
+	output := fs.String("output", "", "Output file path (default: that of the original run)")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return usageErrorf("replay takes exactly one history entry ID, or \"last\"")
+	}
+	if a.globals.historyFile == "" {
+		return usageErrorf("history is disabled; set -history-file")
+	}
+
+	entries, err := readHistory(a.globals.historyFile)
+	if err != nil {
+		return err
+	}
+	e, err := findHistoryEntry(entries, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	out := *output
+	if out == "" && len(e.Outputs) > 0 {
+		out = e.Outputs[0]
+	}
+	if out == "" || out == stdioName {
+		return usageErrorf("entry %d was written to stdout; set -output", e.ID)
+	}
+
+	a.printf("Replaying entry %d (%s) with seed %d\n", e.ID, e.Command, e.Request.Seed)
+	req := e.Request
+	switch e.Command {
+	case "generate":
+		return a.generate(&req, out, false)
+	case "img2img", "inpaint":
+		return a.imageToImage(&imageJob{
+			command:           e.Command,
+			request:           req,
+			source:            e.Source,
+			mask:              e.Mask,
+			denoisingStrength: e.DenoisingStrength,
+			maskBlur:          e.MaskBlur,
+			output:            out,
+		})
+	default:
+		return fmt.Errorf("entry %d: cannot replay command %q", e.ID, e.Command)
+	}
+}
+
+// findHistoryEntry returns the entry with the given ID, or the newest entry
+// for "last".
+func findHistoryEntry(entries []historyEntry, arg string) (historyEntry, error) {
+	if len(entries) == 0 {
+		return historyEntry{}, usageErrorf("history is empty")
+	}
+	if arg == "last" {
+		return entries[len(entries)-1], nil
+	}
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		return historyEntry{}, usageErrorf("invalid history entry ID %q", arg)
+	}
+	for _, e := range entries {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return historyEntry{}, usageErrorf("no history entry %d", id)
+}
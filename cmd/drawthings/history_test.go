@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drawthings_go/drawthingstest"
+)
+
+func TestHistoryAndReplay(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+	dir := t.TempDir()
+	history := filepath.Join(dir, "state", "history.jsonl")
+
+	source := filepath.Join(dir, "source.png")
+	if err := os.WriteFile(source, drawthingstest.Image("a house", 1, 128, 128), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(args ...string) (string, string, int) {
+		var stdout, stderr bytes.Buffer
+		a := newApp(strings.NewReader(""), &stdout, &stderr)
+		a.getenv = func(string) string { return "" }
+		code := a.execute(append([]string{"-base-url", server.URL, "-history-file", history}, args...))
+		return stdout.String(), stderr.String(), code
+	}
+
+	if _, _, code := run("replay", "last"); code != exitUsage {
+		t.Errorf("replay with empty history: exit code %d, want %d", code, exitUsage)
+	}
+
+	// A random seed is resolved before the request and recorded.
+	first := filepath.Join(dir, "first.png")
+	stdout, stderr, code := run("generate", "-prompt", "a cat", "-seed", "-1", "-output", first)
+	if code != exitOK {
+		t.Fatalf("generate: exit code %d, stderr: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "History entry: 1") {
+		t.Errorf("generate output does not name the history entry: %s", stdout)
+	}
+	if _, stderr, code = run("img2img", "-prompt", "a watercolor house", "-seed", "9", "-output", filepath.Join(dir, "second.png"), source); code != exitOK {
+		t.Fatalf("img2img: exit code %d, stderr: %s", code, stderr)
+	}
+
+	stdout, stderr, code = run("history", "-output-format", "json")
+	if code != exitOK {
+		t.Fatalf("history: exit code %d, stderr: %s", code, stderr)
+	}
+	var doc struct {
+		Result historyResult `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &doc); err != nil {
+		t.Fatalf("invalid JSON output %q: %v", stdout, err)
+	}
+	entries := doc.Result.Entries
+	if len(entries) != 2 || entries[0].ID != 1 || entries[1].ID != 2 {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	if entries[0].Command != "generate" || entries[0].Request.Seed < 0 || entries[0].Outputs[0] != first {
+		t.Errorf("unexpected generate entry: %+v", entries[0])
+	}
+	if entries[1].Command != "img2img" || entries[1].Source != source || entries[1].Request.Seed != 9 {
+		t.Errorf("unexpected img2img entry: %+v", entries[1])
+	}
+	if stdout, _, _ = run("history", "-limit", "1"); strings.Contains(stdout, "a cat") || !strings.Contains(stdout, "a watercolor house") {
+		t.Errorf("history -limit 1 output: %s", stdout)
+	}
+
+	// Replaying sends the recorded seed and writes the same image.
+	server.Reset()
+	replayed := filepath.Join(dir, "replayed.png")
+	if _, stderr, code = run("replay", "-output", replayed, "1"); code != exitOK {
+		t.Fatalf("replay: exit code %d, stderr: %s", code, stderr)
+	}
+	var sent struct {
+		Seed int `json:"seed"`
+	}
+	requests := server.RequestsTo(drawthingstest.PathTxt2Img)
+	if len(requests) != 1 {
+		t.Fatalf("replay sent %d requests, want 1", len(requests))
+	}
+	requests[0].Decode(&sent)
+	if sent.Seed != entries[0].Request.Seed {
+		t.Errorf("replay seed = %d, want %d", sent.Seed, entries[0].Request.Seed)
+	}
+	want, _ := os.ReadFile(first)
+	got, _ := os.ReadFile(replayed)
+	if !bytes.Equal(got, want) {
+		t.Error("replayed image differs from the original")
+	}
+
+	// Replays are recorded too, so "last" is now the replay of entry 1.
+	if _, stderr, code = run("replay", "-output", filepath.Join(dir, "again.png"), "2"); code != exitOK {
+		t.Fatalf("replay 2: exit code %d, stderr: %s", code, stderr)
+	}
+	if _, stderr, code = run("replay", "-output", filepath.Join(dir, "again.png"), "last"); code != exitOK {
+		t.Fatalf("replay last: exit code %d, stderr: %s", code, stderr)
+	}
+	if n := len(server.RequestsTo(drawthingstest.PathImg2Img)); n != 2 {
+		t.Errorf("replays sent %d img2img requests, want 2", n)
+	}
+
+	for _, arg := range []string{"42", "first"} {
+		if _, _, code := run("replay", arg); code != exitUsage {
+			t.Errorf("replay %s: exit code %d, want %d", arg, code, exitUsage)
+		}
+	}
+}
+
+func TestReadHistory_TornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	if err := appendHistory(path, &historyEntry{Command: "generate"}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id": 2, "comm`)
+	f.Close()
+
+	entries, err := readHistory(path)
+	if err != nil || len(entries) != 1 || entries[0].ID != 1 {
+		t.Errorf("readHistory() = %+v, %v", entries, err)
+	}
+}
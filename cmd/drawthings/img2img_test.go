@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drawthings_go"
+	"github.com/drawthings_go/drawthingstest"
+)
+
+func TestImg2ImgAndInpaint(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+	dir := t.TempDir()
+
+	source := filepath.Join(dir, "source.png")
+	if err := os.WriteFile(source, drawthingstest.Image("a house", 1, 200, 130), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mask := filepath.Join(dir, "mask.png")
+	if err := os.WriteFile(mask, drawthingstest.Image("mask", 2, 200, 130), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "out", "result.png")
+
+	run := func(args ...string) (string, string, int) {
+		var stdout, stderr bytes.Buffer
+		a := newApp(strings.NewReader(""), &stdout, &stderr)
+		a.getenv = func(string) string { return "" }
+		a.globals.historyFile = ""
+		code := a.execute(append([]string{"-base-url", server.URL}, args...))
+		return stdout.String(), stderr.String(), code
+	}
+
+	stdout, stderr, code := run("img2img", "-prompt", "a watercolor house", "-seed", "3", "-denoising-strength", "0.5",
+		"-output", output, "-output-format", "json", source)
+	if code != exitOK {
+		t.Fatalf("img2img: exit code %d, stderr: %s", code, stderr)
+	}
+	var doc struct {
+		Result imageResult `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &doc); err != nil {
+		t.Fatalf("invalid JSON output %q: %v", stdout, err)
+	}
+	if doc.Result.Seed != 3 || len(doc.Result.Outputs) != 1 || doc.Result.Outputs[0] != output {
+		t.Errorf("unexpected result: %+v", doc.Result)
+	}
+	var sent struct {
+		Width             int      `json:"width"`
+		Height            int      `json:"height"`
+		DenoisingStrength float64  `json:"denoising_strength"`
+		InitImages        []string `json:"init_images"`
+		Mask              string   `json:"mask"`
+		MaskBlur          int      `json:"mask_blur"`
+	}
+	requests := server.RequestsTo(drawthingstest.PathImg2Img)
+	if len(requests) != 1 {
+		t.Fatalf("sent %d img2img requests, want 1", len(requests))
+	}
+	requests[0].Decode(&sent)
+	// The size defaults to the source rounded to multiples of 64.
+	if sent.Width != 192 || sent.Height != 128 || sent.DenoisingStrength != 0.5 || len(sent.InitImages) != 1 || sent.Mask != "" {
+		t.Errorf("unexpected img2img request: %+v", sent)
+	}
+	f, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = png.Decode(f)
+	f.Close()
+	if err != nil {
+		t.Errorf("output is not a PNG: %v", err)
+	}
+
+	server.Reset()
+	if _, stderr, code = run("inpaint", "-prompt", "a red door", "-mask", mask, "-width", "256", "-output", output, source); code != exitOK {
+		t.Fatalf("inpaint: exit code %d, stderr: %s", code, stderr)
+	}
+	requests = server.RequestsTo(drawthingstest.PathImg2Img)
+	if len(requests) != 1 {
+		t.Fatalf("sent %d inpaint requests, want 1", len(requests))
+	}
+	requests[0].Decode(&sent)
+	if sent.Width != 256 || sent.Height != 128 || sent.Mask == "" || sent.MaskBlur != 4 {
+		t.Errorf("unexpected inpaint request: width=%d height=%d mask=%t blur=%d", sent.Width, sent.Height, sent.Mask != "", sent.MaskBlur)
+	}
+
+	usage := []struct {
+		name string
+		args []string
+	}{
+		{"no source", []string{"img2img", "-prompt", "a house"}},
+		{"no prompt", []string{"img2img", source}},
+		{"no mask", []string{"inpaint", "-prompt", "a door", source}},
+		{"mask on img2img", []string{"img2img", "-prompt", "a house", "-mask", mask, source}},
+		{"missing source", []string{"img2img", "-prompt", "a house", filepath.Join(dir, "missing.png")}},
+		{"not an image", []string{"inpaint", "-prompt", "a door", "-mask", filepath.Join(dir, "out"), source}},
+	}
+	for _, tt := range usage {
+		if _, stderr, code := run(tt.args...); code != exitUsage {
+			t.Errorf("%s: exit code %d, want %d; stderr: %s", tt.name, code, exitUsage, stderr)
+		}
+	}
+	if _, _, code := run("img2img", "-prompt", "a house", "-denoising-strength", "2", "-output", output, source); code != exitValidation {
+		t.Errorf("invalid denoising strength: exit code %d, want %d", code, exitValidation)
+	}
+}
+
+func TestFitDimension(t *testing.T) {
+	tests := []struct{ in, want int }{
+		{1, 64},
+		{95, 64},
+		{96, 128},
+		{512, 512},
+		{100000, drawthings.MaxDimension},
+	}
+	for _, tt := range tests {
+		if got := fitDimension(tt.in); got != tt.want {
+			t.Errorf("fitDimension(%d) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
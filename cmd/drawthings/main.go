@@ -2,9 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strings"
+	"time"
 
 	"github.com/drawthings_go"
 )
@@ -16,80 +21,407 @@ var (
 )
 
 func main() {
-	if err := run(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
-	}
-}
-
-func run() error {
-	var (
-		prompt         = flag.String("prompt", "", "Textual description of the desired image (required)")
-		negativePrompt = flag.String("negative-prompt", "", "Descriptions of elements to exclude from the image")
-		steps          = flag.Int("steps", 20, "Number of inference steps (1-150, default: 20)")
-		guidanceScale  = flag.Float64("guidance-scale", 4.0, "Controls adherence to the prompt (1.0-20.0, default: 4.0)")
-		width          = flag.Int("width", 512, "Width of the generated image in pixels (default: 512)")
-		height         = flag.Int("height", 512, "Height of the generated image in pixels (default: 512)")
-		seed           = flag.Int("seed", -1, "Random seed for image generation (-1 for random, default: -1)")
-		output         = flag.String("output", "output.png", "Output file path for the generated image")
-		baseURL        = flag.String("base-url", drawthings.DefaultBaseURL, "Base URL of the Draw Things API server")
-		timeout        = flag.Duration("timeout", drawthings.DefaultTimeout, "HTTP client timeout")
-		showVersion    = flag.Bool("version", false, "Show version information")
-	)
-
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "Generate images using the Draw Things API.\n\n")
-		fmt.Fprintf(os.Stderr, "Options:\n")
-		flag.PrintDefaults()
-		fmt.Fprintf(os.Stderr, "\nExamples:\n")
-		fmt.Fprintf(os.Stderr, "  %s -prompt \"a beautiful sunset\"\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s -prompt \"a cat\" -steps 30 -width 768 -height 768 -output cat.png\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s -prompt \"landscape\" -seed 42 -guidance-scale 7.0\n", os.Args[0])
-	}
-
-	flag.Parse()
-
-	if *showVersion {
-		fmt.Printf("drawthings version %s\n", version)
-		fmt.Printf("commit: %s\n", commit)
-		fmt.Printf("built: %s\n", date)
-		return nil
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	a := newApp(os.Stdin, os.Stdout, os.Stderr)
+	a.ctx = ctx
+	if code := a.execute(os.Args[1:]); code != exitOK {
+		stop()
+		os.Exit(code)
+	}
+}
+
+// command is a single drawthings subcommand.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(a *app, args []string) error
+}
+
+// commands returns all subcommands in the order they are listed in the help output.
+func commands() []*command {
+	return []*command{
+		{
+			name:    "generate",
+			summary: "Generate an image from a text prompt",
+			run:     runGenerate,
+		},
+		{
+			name:    "img2img",
+			args:    "<image>",
+			summary: "Generate an image from a source image and a text prompt",
+			run:     runImg2Img,
+		},
+		{
+			name:    "inpaint",
+			args:    "<image>",
+			summary: "Repaint the masked areas of an image from a text prompt",
+			run:     runInpaint,
+		},
+		{
+			name:    "batch",
+			args:    "<jobs.jsonl|jobs.csv>",
+			summary: "Generate images for every job in a JSONL or CSV file",
+			run:     runBatch,
+		},
+		{
+			name:    "sweep",
+			summary: "Generate an X/Y/Z parameter sweep and compose a labeled grid image",
+			run:     runSweep,
+		},
+		{
+			name:    "tile",
+			args:    "<image>",
+			summary: "Upscale an image past the server's size limit by refining overlapping tiles",
+			run:     runTile,
+		},
+		{
+			name:    "repl",
+			summary: "Start an interactive session for iterative prompting",
+			run:     runREPL,
+		},
+		{
+			name:    "watch",
+			args:    "<request-file>",
+			summary: "Regenerate an image whenever a request file changes",
+			run:     runWatch,
+		},
+		{
+			name:    "queue",
+			args:    "<add|list|cancel|run>",
+			summary: "Manage a durable job queue that survives restarts",
+			run:     runQueue,
+		},
+		{
+			name:    "serve",
+			summary: "Run a gateway that queues requests from several users to one server",
+			run:     runServe,
+		},
+		{
+			name:    "tokens",
+			args:    "<prompt>",
+			summary: "Count the CLIP tokens of a prompt and show where it is split into chunks",
+			run:     runTokens,
+		},
+		{
+			name:    "styles",
+			summary: "List the style presets available to -style",
+			run:     runStyles,
+		},
+		{
+			name:    "cache",
+			args:    "<stats|clear>",
+			summary: "Show statistics for or clear the result cache",
+			run:     runCache,
+		},
+		{
+			name:    "history",
+			summary: "List recent generations with their resolved seeds",
+			run:     runHistory,
+		},
+		{
+			name:    "replay",
+			args:    "<id|last>",
+			summary: "Rerun a generation from the history with the same parameters and seed",
+			run:     runReplay,
+		},
+		{
+			name:    "models",
+			summary: "List the models the server can load",
+			run:     runModels,
+		},
+		{
+			name:    "options",
+			args:    "[key=value ...]",
+			summary: "Show or change the server's settings",
+			run:     runOptions,
+		},
+		{
+			name:    "progress",
+			summary: "Show the progress of the generation the server is running",
+			run:     runProgress,
+		},
+		{
+			name:    "interrupt",
+			summary: "Stop the generation the server is running",
+			run:     runInterrupt,
+		},
+		{
+			name:    "doctor",
+			summary: "Diagnose problems connecting to the Draw Things server",
+			run:     runDoctor,
+		},
+		{
+			name:    "config",
+			args:    "show",
+			summary: "Show the effective configuration after merging flags, environment and profile",
+			run:     runConfig,
+		},
+		{
+			name:    "version",
+			summary: "Show version information",
+			run:     runVersion,
+		},
+	}
+}
+
+// findCommand returns the subcommand with the given name, or nil.
+func findCommand(name string) *command {
+	for _, cmd := range commands() {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// globalOptions holds the flags shared by every subcommand.
+type globalOptions struct {
+	baseURL      string
+	timeout      time.Duration
+	verbose      bool
+	outputFormat string
+	configPath   string
+	profile      string
+	showVersion  bool
+	cache        bool
+	cacheDir     string
+	cacheMaxMB   int64
+	cacheMaxAge  time.Duration
+	strict       bool
+	maxTokens    int
+	clipVocab    string
+	historyFile  string
+}
+
+// register adds the global flags to fs.
+func (g *globalOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&g.baseURL, "base-url", g.baseURL, "Base URL of the Draw Things API server")
+	fs.DurationVar(&g.timeout, "timeout", g.timeout, "HTTP client timeout (0 for none)")
+	fs.BoolVar(&g.verbose, "verbose", g.verbose, "Log HTTP requests and responses to stderr")
+	fs.StringVar(&g.outputFormat, "output-format", g.outputFormat, "Output format: text or json")
+	fs.StringVar(&g.configPath, "config", g.configPath, "Path to the config file (default: $DRAWTHINGS_CONFIG or ~/.config/drawthings/config.json)")
+	fs.StringVar(&g.profile, "profile", g.profile, "Name of the config profile to use (default: $DRAWTHINGS_PROFILE)")
+	fs.BoolVar(&g.showVersion, "version", g.showVersion, "Show version information")
+	fs.BoolVar(&g.cache, "cache", g.cache, "Reuse cached images for repeated requests with a fixed seed")
+	fs.StringVar(&g.cacheDir, "cache-dir", g.cacheDir, "Directory of the result cache")
+	fs.Int64Var(&g.cacheMaxMB, "cache-max-mb", g.cacheMaxMB, "Evict least recently used cache entries above this size in megabytes (0 for no limit)")
+	fs.DurationVar(&g.cacheMaxAge, "cache-max-age", g.cacheMaxAge, "Evict cache entries unused for this long (0 keeps them)")
+	fs.BoolVar(&g.strict, "strict", g.strict, "Reject prompts with malformed weighting syntax, such as unbalanced parentheses")
+	fs.IntVar(&g.maxTokens, "max-tokens", g.maxTokens, "Warn about prompts with more CLIP tokens than this, or reject them with -strict (0 to skip the check)")
+	fs.StringVar(&g.clipVocab, "clip-vocab", g.clipVocab, "Path to the CLIP merges file bpe_simple_vocab_16e6.txt(.gz) (default: the vocabulary embedded at build time, if any)")
+	fs.StringVar(&g.historyFile, "history-file", g.historyFile, "Path of the generation history used by history and replay (empty to disable)")
+}
+
+// defaultGlobals returns the global options before flags are parsed.
+func defaultGlobals() globalOptions {
+	return globalOptions{
+		baseURL:      drawthings.DefaultBaseURL,
+		timeout:      drawthings.DefaultTimeout,
+		outputFormat: formatText,
+		cacheDir:     defaultCacheDir(),
+		cacheMaxMB:   2048,
+		cacheMaxAge:  30 * 24 * time.Hour,
+		historyFile:  defaultHistoryPath(),
 	}
+}
+
+// app carries the I/O streams and global options for a single CLI invocation.
+type app struct {
+	ctx     context.Context
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+	getenv  func(string) string
+	globals globalOptions
+
+	// cfg and profileName are loaded on first use by parseFlags.
+	cfg         *config
+	profileName string
+	// explicit records flags given on the command line; sources records
+	// where each flag's effective value came from.
+	explicit map[string]bool
+	sources  map[string]string
 
-	if *prompt == "" {
-		flag.Usage()
-		return fmt.Errorf("prompt is required")
+	// commandName, result and usedServer feed the JSON output document.
+	commandName string
+	result      interface{}
+	usedServer  bool
+	// stdoutBusy is set while stdout carries image data.
+	stdoutBusy bool
+}
+
+func newApp(stdin io.Reader, stdout, stderr io.Writer) *app {
+	return &app{
+		ctx:      context.Background(),
+		stdin:    stdin,
+		stdout:   stdout,
+		stderr:   stderr,
+		getenv:   os.Getenv,
+		globals:  defaultGlobals(),
+		explicit: make(map[string]bool),
+		sources:  make(map[string]string),
 	}
+}
 
-	// Create client
-	client := drawthings.NewClient(
-		drawthings.WithBaseURL(*baseURL),
-		drawthings.WithTimeout(*timeout),
-	)
+// run parses the global flags and dispatches to a subcommand.
+//
+// For backwards compatibility, an invocation that does not name a subcommand
+// (e.g. "drawthings -prompt cat") is treated as "drawthings generate".
+func (a *app) run(args []string) error {
+	fs := flag.NewFlagSet("drawthings", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	a.globals.register(fs)
 
-	// Create request
-	req := &drawthings.TextToImageRequest{
-		Prompt:         *prompt,
-		NegativePrompt: *negativePrompt,
-		Steps:          *steps,
-		GuidanceScale:  *guidanceScale,
-		Width:          *width,
-		Height:         *height,
-		Seed:           *seed,
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			a.usage()
+			return err
+		}
+		// Unknown flags belong to the legacy flag-only invocation.
+		a.commandName = "generate"
+		return runGenerate(a, args)
+	}
+	fs.Visit(func(f *flag.Flag) {
+		a.explicit[f.Name] = true
+	})
+	if f := a.globals.outputFormat; f != formatText && f != formatJSON {
+		return usageErrorf("invalid output format %q: must be %q or %q", f, formatText, formatJSON)
 	}
 
-	// Generate and save image
-	fmt.Printf("Generating image with prompt: %q\n", *prompt)
-	fmt.Printf("Parameters: steps=%d, guidance_scale=%.2f, width=%d, height=%d, seed=%d\n",
-		*steps, *guidanceScale, *width, *height, *seed)
+	if a.globals.showVersion {
+		a.commandName = "version"
+		return runVersion(a, nil)
+	}
 
-	ctx := context.Background()
-	if err := client.GenerateImageAndSave(ctx, req, *output); err != nil {
-		return fmt.Errorf("failed to generate image: %w", err)
+	rest := fs.Args()
+	if len(rest) == 0 {
+		a.usage()
+		return usageErrorf("no command given")
 	}
 
-	fmt.Printf("Image saved to: %s\n", *output)
-	return nil
+	if rest[0] == "help" {
+		if len(rest) > 1 {
+			if cmd := findCommand(rest[1]); cmd != nil {
+				return cmd.run(a, []string{"-help"})
+			}
+		}
+		a.usage()
+		return nil
+	}
+
+	cmd := findCommand(rest[0])
+	if cmd == nil {
+		a.usage()
+		return usageErrorf("unknown command %q", rest[0])
+	}
+	a.commandName = cmd.name
+	return cmd.run(a, rest[1:])
+}
+
+// usage prints the top-level help text.
+func (a *app) usage() {
+	w := a.stderr
+	fmt.Fprintf(w, "Usage: drawthings [global options] <command> [options]\n\n")
+	fmt.Fprintf(w, "Generate images using the Draw Things API.\n\n")
+	fmt.Fprintf(w, "Commands:\n")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nGlobal options:\n")
+	fs := flag.NewFlagSet("drawthings", flag.ContinueOnError)
+	fs.SetOutput(w)
+	defaults := defaultGlobals()
+	defaults.register(fs)
+	fs.PrintDefaults()
+	fmt.Fprintf(w, "\nRun \"drawthings help <command>\" for more information about a command.\n")
+	fmt.Fprintf(w, "Invoking drawthings with generate options and no command runs \"generate\".\n")
+}
+
+// newFlagSet creates a flag set for the named command that also accepts the
+// global flags.
+func (a *app) newFlagSet(name string) *flag.FlagSet {
+	cmd := findCommand(name)
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	a.globals.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(a.stderr, "Usage: %s\n\n", strings.TrimSpace("drawthings "+cmd.name+" [options] "+cmd.args))
+		fmt.Fprintf(a.stderr, "%s.\n\n", cmd.summary)
+		fmt.Fprintf(a.stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	return fs
 }
 
+// newClient creates an API client from the global options and extra.
+func (a *app) newClient(extra ...drawthings.Option) *drawthings.Client {
+	opts := []drawthings.Option{
+		drawthings.WithBaseURL(a.globals.baseURL),
+		drawthings.WithTimeout(a.globals.timeout),
+	}
+	if a.globals.verbose {
+		opts = append(opts, drawthings.WithLogger(&stderrLogger{w: a.stderr}))
+	}
+	if a.globals.cache {
+		c, err := a.openCache()
+		if err != nil {
+			fmt.Fprintf(a.stderr, "Warning: result cache disabled: %v\n", err)
+		} else {
+			opts = append(opts, drawthings.WithCache(c))
+		}
+	}
+	if a.globals.strict {
+		opts = append(opts, drawthings.WithStrictValidation(true))
+	}
+	if a.globals.maxTokens > 0 {
+		tok, err := a.tokenizer()
+		if err != nil {
+			fmt.Fprintf(a.stderr, "Warning: token limit disabled: %v\n", err)
+		} else {
+			opts = append(opts,
+				drawthings.WithTokenLimit(tok, a.globals.maxTokens),
+				drawthings.WithWarningHandler(func(err error) { fmt.Fprintf(a.stderr, "Warning: %v\n", err) }),
+			)
+		}
+	}
+	opts = append(opts, extra...)
+	a.usedServer = true
+	return drawthings.NewClient(opts...)
+}
+
+// context returns the context used for API calls. It is cancelled when the
+// process receives an interrupt.
+func (a *app) context() context.Context {
+	return a.ctx
+}
+
+// stderrLogger writes client log output to the given writer.
+type stderrLogger struct {
+	w io.Writer
+}
+
+func (l *stderrLogger) Logf(format string, args ...interface{}) {
+	fmt.Fprintf(l.w, "[drawthings] "+strings.TrimRight(format, "\n")+"\n", args...)
+}
+
+// versionResult is the JSON result of the version command.
+type versionResult struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	Date    string `json:"date"`
+}
+
+// runVersion prints build information.
+func runVersion(a *app, args []string) error {
+	if err := a.parseFlags(a.newFlagSet("version"), args); err != nil {
+		return err
+	}
+	a.setResult(versionResult{Version: version, Commit: commit, Date: date})
+	a.printf("drawthings version %s\n", version)
+	a.printf("commit: %s\n", commit)
+	a.printf("built: %s\n", date)
+	return nil
+}
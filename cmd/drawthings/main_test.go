@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drawthings_go/drawthingstest"
+)
+
+func TestMain(m *testing.M) {
+	// Keep the history and config of test runs out of the user's home.
+	home, err := os.MkdirTemp("", "drawthings-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOME", home)
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	os.Setenv("XDG_CACHE_HOME", filepath.Join(home, ".cache"))
+	code := m.Run()
+	os.RemoveAll(home)
+	os.Exit(code)
+}
+
+func TestRun_Dispatch(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+	dir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		// wantCommand is the command reported in the JSON document.
+		wantCommand string
+		wantOutput  string
+		wantStderr  string
+	}{
+		{
+			name:        "legacy flag-only invocation",
+			args:        []string{"-prompt", "a cat", "-seed", "7", "-base-url", server.URL, "-output", filepath.Join(dir, "legacy.png")},
+			wantCode:    exitOK,
+			wantCommand: "generate",
+			wantOutput:  filepath.Join(dir, "legacy.png"),
+		},
+		{
+			name:        "global flags before legacy flags",
+			args:        []string{"-base-url", server.URL, "-prompt", "a dog", "-seed", "7", "-output", filepath.Join(dir, "globals.png")},
+			wantCode:    exitOK,
+			wantCommand: "generate",
+			wantOutput:  filepath.Join(dir, "globals.png"),
+		},
+		{
+			name:        "legacy invocation without prompt",
+			args:        []string{"-steps", "10"},
+			wantCode:    exitUsage,
+			wantCommand: "generate",
+			wantStderr:  "prompt is required",
+		},
+		{
+			name:        "subcommand",
+			args:        []string{"-base-url", server.URL, "generate", "-prompt", "a cat", "-seed", "7", "-output", filepath.Join(dir, "sub.png")},
+			wantCode:    exitOK,
+			wantCommand: "generate",
+			wantOutput:  filepath.Join(dir, "sub.png"),
+		},
+		{
+			name:       "no command",
+			args:       []string{},
+			wantCode:   exitUsage,
+			wantStderr: "Commands:",
+		},
+		{
+			name:       "unknown command",
+			args:       []string{"bogus"},
+			wantCode:   exitUsage,
+			wantStderr: `unknown command "bogus"`,
+		},
+		{
+			name:       "help",
+			args:       []string{"help"},
+			wantCode:   exitOK,
+			wantStderr: "img2img",
+		},
+		{
+			name:       "help for a command",
+			args:       []string{"help", "inpaint"},
+			wantCode:   exitOK,
+			wantStderr: "-mask",
+		},
+		{
+			name:        "version flag",
+			args:        []string{"-version"},
+			wantCode:    exitOK,
+			wantCommand: "version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			a := newApp(strings.NewReader(""), &stdout, &stderr)
+			a.getenv = func(string) string { return "" }
+			a.globals.historyFile = ""
+
+			code := a.execute(tt.args)
+			if code != tt.wantCode {
+				t.Fatalf("exit code %d, want %d; stderr: %s", code, tt.wantCode, stderr.String())
+			}
+			if a.commandName != tt.wantCommand {
+				t.Errorf("command = %q, want %q", a.commandName, tt.wantCommand)
+			}
+			if tt.wantOutput != "" {
+				if _, err := os.Stat(tt.wantOutput); err != nil {
+					t.Errorf("output not written: %v", err)
+				}
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("stderr %q does not contain %q", stderr.String(), tt.wantStderr)
+			}
+		})
+	}
+
+	// The legacy path reports itself as generate in JSON documents.
+	var stdout bytes.Buffer
+	a := newApp(strings.NewReader(""), &stdout, &bytes.Buffer{})
+	a.getenv = func(string) string { return "" }
+	a.globals.historyFile = ""
+	if code := a.execute([]string{"-output-format", "json", "-prompt", "a cat", "-seed", "7", "-base-url", server.URL, "-output", filepath.Join(dir, "json.png")}); code != exitOK {
+		t.Fatalf("legacy JSON invocation: exit code %d", code)
+	}
+	var doc struct {
+		Command string `json:"command"`
+		OK      bool   `json:"ok"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &doc); err != nil || doc.Command != "generate" || !doc.OK {
+		t.Errorf("legacy JSON document = %+v, %v: %s", doc, err, stdout.String())
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/drawthings_go"
+)
+
+// Output formats selected with -output-format.
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// Process exit codes. Failures from the library are mapped by error type so
+// scripts can tell them apart without parsing messages.
+const (
+	exitOK         = 0
+	exitError      = 1
+	exitUsage      = 2
+	exitValidation = 3
+	exitNetwork    = 4
+	exitAPI        = 5
+	exitDecode     = 6
+	exitStorage    = 7
+	exitCanceled   = 130
+)
+
+// usageError reports invalid command-line usage.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// exitCode returns the process exit code for err.
+func exitCode(err error) int {
+	var usageErr *usageError
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &usageErr):
+		return exitUsage
+	case errors.Is(err, context.Canceled):
+		return exitCanceled
+	}
+
+	switch drawthings.ErrorType(err) {
+	case drawthings.ErrorTypeValidation:
+		return exitValidation
+	case drawthings.ErrorTypeNetwork:
+		return exitNetwork
+	case drawthings.ErrorTypeAPI:
+		return exitAPI
+	case drawthings.ErrorTypeDecode:
+		return exitDecode
+	case drawthings.ErrorTypeStorage:
+		return exitStorage
+	default:
+		return exitError
+	}
+}
+
+// document is the JSON document written to stdout for every command when
+// -output-format is json. Its shape is stable; command-specific data goes
+// into Result.
+type document struct {
+	Command    string      `json:"command"`
+	OK         bool        `json:"ok"`
+	Started    time.Time   `json:"started"`
+	DurationMS int64       `json:"duration_ms"`
+	Server     *serverInfo `json:"server,omitempty"`
+	Result     interface{} `json:"result,omitempty"`
+	Error      *errorInfo  `json:"error,omitempty"`
+}
+
+// serverInfo describes the API server a command talked to.
+type serverInfo struct {
+	BaseURL   string `json:"base_url"`
+	TimeoutMS int64  `json:"timeout_ms"`
+}
+
+// errorInfo describes a failed command.
+type errorInfo struct {
+	Type       string `json:"type"`
+	Message    string `json:"message"`
+	Field      string `json:"field,omitempty"`
+	StatusCode int    `json:"status_code,omitempty"`
+	ExitCode   int    `json:"exit_code"`
+}
+
+// newErrorInfo converts err into its JSON form.
+func newErrorInfo(err error) *errorInfo {
+	info := &errorInfo{
+		Type:     drawthings.ErrorType(err),
+		Message:  err.Error(),
+		ExitCode: exitCode(err),
+	}
+
+	var (
+		usageErr *usageError
+		valErr   *drawthings.ValidationError
+		apiErr   *drawthings.APIError
+	)
+	if errors.As(err, &usageErr) {
+		info.Type = "usage"
+	}
+	if errors.As(err, &valErr) {
+		info.Field = valErr.Field
+	}
+	if errors.As(err, &apiErr) {
+		info.StatusCode = apiErr.StatusCode
+	}
+	return info
+}
+
+// execute runs the CLI and reports the outcome in the selected output
+// format. It returns the process exit code.
+func (a *app) execute(args []string) int {
+	started := time.Now()
+	err := a.run(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+
+	if err != nil {
+		fmt.Fprintf(a.stderr, "Error: %v\n", err)
+	}
+
+	if a.globals.outputFormat == formatJSON {
+		doc := document{
+			Command:    a.commandName,
+			OK:         err == nil,
+			Started:    started.UTC(),
+			DurationMS: time.Since(started).Milliseconds(),
+			Result:     a.result,
+		}
+		if a.usedServer {
+			doc.Server = &serverInfo{
+				BaseURL:   a.globals.baseURL,
+				TimeoutMS: a.globals.timeout.Milliseconds(),
+			}
+		}
+		if err != nil {
+			doc.Error = newErrorInfo(err)
+		}
+
+		enc := json.NewEncoder(a.stdout)
+		enc.SetIndent("", "  ")
+		if encErr := enc.Encode(doc); encErr != nil {
+			fmt.Fprintf(a.stderr, "Error: failed to write JSON output: %v\n", encErr)
+			return exitError
+		}
+	}
+
+	return exitCode(err)
+}
+
+// printf writes a human-oriented message: to stdout in text mode, and to
+// stderr in JSON mode or while stdout carries image data, so that stdout only
+// carries the machine-readable stream.
+func (a *app) printf(format string, args ...interface{}) {
+	w := a.stdout
+	if a.globals.outputFormat == formatJSON || a.stdoutBusy {
+		w = a.stderr
+	}
+	fmt.Fprintf(w, format, args...)
+}
+
+// setResult records the command-specific data for the JSON document.
+func (a *app) setResult(v interface{}) {
+	a.result = v
+}
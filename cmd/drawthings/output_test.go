@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drawthings_go"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, exitOK},
+		{usageErrorf("prompt is required"), exitUsage},
+		{fmt.Errorf("wrapped: %w", drawthings.NewValidationError("steps", "bad")), exitValidation},
+		{drawthings.NewNetworkError("down", nil), exitNetwork},
+		{&drawthings.APIError{StatusCode: 500}, exitAPI},
+		{drawthings.NewDecodeError("bad", nil), exitDecode},
+		{drawthings.NewStorageError("disk full", nil), exitStorage},
+		{drawthings.NewNetworkError("interrupted", context.Canceled), exitCanceled},
+		{fmt.Errorf("other"), exitError},
+	}
+
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestExecute_JSONValidationError(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	a := newApp(strings.NewReader(""), &stdout, &stderr)
+	a.getenv = func(string) string { return "" }
+
+	code := a.execute([]string{"generate", "-output-format", "json", "-prompt", "cat", "-steps", "500", "-seed", "42"})
+	if code != exitValidation {
+		t.Errorf("exit code: got %d, want %d", code, exitValidation)
+	}
+
+	var doc struct {
+		Command string `json:"command"`
+		OK      bool   `json:"ok"`
+		Server  *struct {
+			BaseURL string `json:"base_url"`
+		} `json:"server"`
+		Result struct {
+			Seed int `json:"seed"`
+		} `json:"result"`
+		Error *struct {
+			Type     string `json:"type"`
+			Field    string `json:"field"`
+			ExitCode int    `json:"exit_code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &doc); err != nil {
+		t.Fatalf("stdout is not a JSON document: %v\n%s", err, stdout.String())
+	}
+
+	if doc.Command != "generate" || doc.OK {
+		t.Errorf("unexpected document header: %+v", doc)
+	}
+	if doc.Server == nil || doc.Server.BaseURL != drawthings.DefaultBaseURL {
+		t.Errorf("unexpected server info: %+v", doc.Server)
+	}
+	if doc.Result.Seed != 42 {
+		t.Errorf("seed: got %d, want 42", doc.Result.Seed)
+	}
+	if doc.Error == nil || doc.Error.Type != "validation" || doc.Error.Field != "steps" || doc.Error.ExitCode != exitValidation {
+		t.Errorf("unexpected error info: %+v", doc.Error)
+	}
+	if !strings.Contains(stderr.String(), "Generating image") {
+		t.Errorf("human messages should go to stderr, got %q", stderr.String())
+	}
+}
+
+func TestExecute_Strict(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	a := newApp(strings.NewReader(""), &stdout, &stderr)
+	a.getenv = func(string) string { return "" }
+
+	code := a.execute([]string{"generate", "-strict", "-output-format", "json", "-prompt", "a (cat", "-output", filepath.Join(t.TempDir(), "cat.png")})
+	if code != exitValidation {
+		t.Fatalf("exit code: got %d, want %d", code, exitValidation)
+	}
+	var doc struct {
+		Error struct {
+			Field   string `json:"field"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &doc); err != nil {
+		t.Fatalf("stdout is not a JSON document: %v\n%s", err, stdout.String())
+	}
+	if doc.Error.Field != "prompt" || !strings.Contains(doc.Error.Message, "offset 2: unclosed (") {
+		t.Errorf("unexpected error info: %+v", doc.Error)
+	}
+}
+
+func TestExecute_JSONUsageError(t *testing.T) {
+	var stdout bytes.Buffer
+	a := newApp(strings.NewReader(""), &stdout, &bytes.Buffer{})
+	a.getenv = func(string) string { return "" }
+
+	if code := a.execute([]string{"-output-format", "json", "bogus"}); code != exitUsage {
+		t.Errorf("exit code: got %d, want %d", code, exitUsage)
+	}
+	if !strings.Contains(stdout.String(), `"type": "usage"`) {
+		t.Errorf("expected usage error in JSON output, got %s", stdout.String())
+	}
+}
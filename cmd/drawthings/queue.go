@@ -0,0 +1,333 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/drawthings_go"
+	"github.com/drawthings_go/batch"
+	"github.com/drawthings_go/queue"
+)
+
+// runQueue implements the "queue" command.
+func runQueue(a *app, args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "add":
+			return runQueueAdd(a, args[1:])
+		case "list":
+			return runQueueList(a, args[1:])
+		case "cancel":
+			return runQueueCancel(a, args[1:])
+		case "run":
+			return runQueueRun(a, args[1:])
+		}
+	}
+	fmt.Fprintf(a.stderr, "Usage: drawthings queue <add|list|cancel|run> [options]\n\n")
+	fmt.Fprintf(a.stderr, "Manage a durable job queue that survives crashes and restarts.\n\n")
+	fmt.Fprintf(a.stderr, "  add      Add a job, or every job in a JSONL/CSV file\n")
+	fmt.Fprintf(a.stderr, "  list     List jobs and their states\n")
+	fmt.Fprintf(a.stderr, "  cancel   Cancel pending or running jobs\n")
+	fmt.Fprintf(a.stderr, "  run      Run pending jobs\n")
+	fmt.Fprintf(a.stderr, "\nRun 'drawthings queue <command> -help' for the options of a command.\n")
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+		return flag.ErrHelp
+	}
+	return usageErrorf("expected one of add, list, cancel or run")
+}
+
+// defaultQueuePath returns the default location of the queue file.
+func defaultQueuePath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "queue.jsonl"
+	}
+	return filepath.Join(dir, "drawthings", "queue.jsonl")
+}
+
+// queueFlagSet returns a flag set for a queue subcommand with the
+// -queue-file flag registered.
+func (a *app) queueFlagSet(name, args, summary string) (*flag.FlagSet, *string) {
+	fs := a.newFlagSet("queue")
+	path := fs.String("queue-file", defaultQueuePath(), "Path of the queue file")
+	fs.Usage = func() {
+		fmt.Fprintf(a.stderr, "Usage: %s\n\n", strings.TrimSpace("drawthings queue "+name+" [options] "+args))
+		fmt.Fprintf(a.stderr, "%s.\n\n", summary)
+		fmt.Fprintf(a.stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	return fs, path
+}
+
+func runQueueAdd(a *app, args []string) error {
+	fs, path := a.queueFlagSet("add", "", "Add a job, or every job in a JSONL/CSV file")
+	var params requestOptions
+	params.register(fs)
+	var (
+		prompt      = fs.String("prompt", "", "Textual description of the desired image")
+		file        = fs.String("file", "", "Add every job in a JSONL or CSV job file (see the batch command)")
+		id          = fs.String("id", "", "Job ID (default: next number)")
+		output      = fs.String("output", "", "Output path, relative to the worker's -output-dir (default: <id>.png)")
+		priority    = fs.Int("priority", 0, "Higher priority jobs run first")
+		maxAttempts = fs.Int("max-attempts", queue.DefaultMaxAttempts, "Attempts before a job with retryable errors fails")
+	)
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return usageErrorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	var jobs []queue.Job
+	switch {
+	case *file != "" && (*prompt != "" || *id != "" || *output != ""):
+		return usageErrorf("-file cannot be combined with -prompt, -id or -output")
+	case *file != "":
+		batchJobs, err := batch.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+		chosen, err := a.styles(&params)
+		if err != nil {
+			return err
+		}
+		for _, j := range batchJobs {
+			req := j.TextToImageRequest
+			a.applyFileStyles(&req, &params, chosen)
+			jobs = append(jobs, queue.Job{ID: j.ID, Output: j.Output, Request: req})
+		}
+	case *prompt != "":
+		req, err := a.styledRequest(&params, *prompt)
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, queue.Job{ID: *id, Output: *output, Request: *req})
+	default:
+		fs.Usage()
+		return usageErrorf("-prompt or -file is required")
+	}
+
+	// Reject invalid jobs now rather than when the worker gets to them.
+	for _, j := range jobs {
+		req := j.Request
+		req.SetDefaults()
+		if err := req.Validate(); err != nil {
+			return err
+		}
+	}
+
+	store, err := queue.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	result := queueAddResult{QueueFile: *path, Added: []string{}}
+	for _, j := range jobs {
+		j.Priority = *priority
+		j.MaxAttempts = *maxAttempts
+		added, err := store.Add(j)
+		if err != nil {
+			a.setResult(result)
+			return err
+		}
+		result.Added = append(result.Added, added.ID)
+		a.printf("Added job %s: %q\n", added.ID, added.Request.Prompt)
+	}
+	a.setResult(result)
+	return nil
+}
+
+// fillRequest copies fields from defaults into req where req leaves them unset.
+func fillRequest(req, defaults *drawthings.TextToImageRequest) {
+	if req.NegativePrompt == "" {
+		req.NegativePrompt = defaults.NegativePrompt
+	}
+	if req.Steps == 0 {
+		req.Steps = defaults.Steps
+	}
+	if req.GuidanceScale == 0 {
+		req.GuidanceScale = defaults.GuidanceScale
+	}
+	if req.Width == 0 {
+		req.Width = defaults.Width
+	}
+	if req.Height == 0 {
+		req.Height = defaults.Height
+	}
+	if req.Seed == 0 {
+		req.Seed = defaults.Seed
+	}
+}
+
+func runQueueList(a *app, args []string) error {
+	fs, path := a.queueFlagSet("list", "", "List jobs and their states")
+	stateList := fs.String("state", "", "Only list jobs in these comma-separated states (pending, running, succeeded, failed, canceled)")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	var states []queue.State
+	if *stateList != "" {
+		for _, name := range strings.Split(*stateList, ",") {
+			state, err := queue.ParseState(strings.TrimSpace(name))
+			if err != nil {
+				return usageErrorf("%v", err)
+			}
+			states = append(states, state)
+		}
+	}
+
+	store, err := queue.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	jobs := store.List(states...)
+	if jobs == nil {
+		jobs = []queue.Job{}
+	}
+	a.setResult(queueListResult{QueueFile: *path, Jobs: jobs})
+
+	if len(jobs) == 0 {
+		a.printf("No jobs.\n")
+		return nil
+	}
+	a.printf("%-10s %-10s %8s %8s  %s\n", "ID", "STATE", "PRIORITY", "ATTEMPTS", "PROMPT")
+	for _, j := range jobs {
+		detail := j.Request.Prompt
+		if j.Error != "" && !j.State.Done() || j.State == queue.StateFailed {
+			detail += "  (" + j.Error + ")"
+		}
+		a.printf("%-10s %-10s %8d %5d/%-2d  %s\n", j.ID, j.State, j.Priority, j.Attempts, j.MaxAttempts, detail)
+	}
+	return nil
+}
+
+func runQueueCancel(a *app, args []string) error {
+	fs, path := a.queueFlagSet("cancel", "<id>...", "Cancel pending or running jobs")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return usageErrorf("at least one job ID is required")
+	}
+
+	store, err := queue.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	result := queueCancelResult{Canceled: []string{}}
+	var firstErr error
+	for _, id := range fs.Args() {
+		if _, err := store.Cancel(id); err != nil {
+			a.printf("Could not cancel %s: %v\n", id, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		result.Canceled = append(result.Canceled, id)
+		a.printf("Canceled job %s\n", id)
+	}
+	a.setResult(result)
+	return firstErr
+}
+
+func runQueueRun(a *app, args []string) error {
+	fs, path := a.queueFlagSet("run", "", "Run pending jobs")
+	var (
+		outputDir = fs.String("output-dir", ".", "Directory for generated images")
+		wait      = fs.Bool("wait", false, "Keep running and wait for new jobs when the queue is empty")
+		poll      = fs.Duration("poll", time.Second, "How often to check for new jobs and cancellations")
+		backoff   = fs.Duration("retry-backoff", 10*time.Second, "Delay before the first retry; doubles with each attempt")
+	)
+	defaultUsage := fs.Usage
+	fs.Usage = func() {
+		defaultUsage()
+		fmt.Fprintf(a.stderr, "\nJobs left running by an interrupted or crashed worker are requeued on start.\n")
+		fmt.Fprintf(a.stderr, "Only one worker should run against a queue file at a time.\n")
+	}
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *poll <= 0 {
+		return usageErrorf("-poll must be positive")
+	}
+
+	store, err := queue.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	result := queueRunResult{QueueFile: *path}
+	worker := queue.NewWorker(store, a.newClient(),
+		queue.WithOutputDir(*outputDir),
+		queue.WithWait(*wait),
+		queue.WithPollInterval(*poll),
+		queue.WithRetryBackoff(*backoff),
+		queue.WithEventHandler(func(j queue.Job) {
+			switch j.State {
+			case queue.StateRunning:
+				a.printf("[%s] running   %s (attempt %d/%d): %q\n", time.Now().Format("15:04:05"), j.ID, j.Attempts, j.MaxAttempts, j.Request.Prompt)
+				return
+			case queue.StateSucceeded:
+				result.Succeeded++
+				a.printf("[%s] succeeded %s -> %s\n", time.Now().Format("15:04:05"), j.ID, strings.Join(j.Outputs, ", "))
+			case queue.StatePending:
+				result.Retried++
+				a.printf("[%s] retrying  %s at %s: %s\n", time.Now().Format("15:04:05"), j.ID, j.RetryAt.Format("15:04:05"), j.Error)
+			case queue.StateFailed:
+				result.Failed++
+				a.printf("[%s] failed    %s: %s\n", time.Now().Format("15:04:05"), j.ID, j.Error)
+			case queue.StateCanceled:
+				result.Canceled++
+				a.printf("[%s] canceled  %s\n", time.Now().Format("15:04:05"), j.ID)
+			}
+		}),
+	)
+
+	err = worker.Run(a.context())
+	a.setResult(result)
+	if err != nil {
+		return fmt.Errorf("queue worker stopped: %w", err)
+	}
+	a.printf("Queue empty: %d succeeded, %d failed, %d canceled\n", result.Succeeded, result.Failed, result.Canceled)
+	return nil
+}
+
+// queueAddResult is the JSON result of "queue add".
+type queueAddResult struct {
+	QueueFile string   `json:"queue_file"`
+	Added     []string `json:"added"`
+}
+
+// queueListResult is the JSON result of "queue list".
+type queueListResult struct {
+	QueueFile string      `json:"queue_file"`
+	Jobs      []queue.Job `json:"jobs"`
+}
+
+// queueCancelResult is the JSON result of "queue cancel".
+type queueCancelResult struct {
+	Canceled []string `json:"canceled"`
+}
+
+// queueRunResult is the JSON result of "queue run".
+type queueRunResult struct {
+	QueueFile string `json:"queue_file"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+	Canceled  int    `json:"canceled"`
+	Retried   int    `json:"retried"`
+}
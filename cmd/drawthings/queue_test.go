@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drawthings_go/drawthingstest"
+	"github.com/drawthings_go/queue"
+)
+
+func TestQueue_AddListCancelRun(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+
+	dir := t.TempDir()
+	queueFile := filepath.Join(dir, "queue.jsonl")
+	jobsFile := filepath.Join(dir, "jobs.jsonl")
+	if err := os.WriteFile(jobsFile, []byte(`{"id":"fox","prompt":"a fox"}`+"\n"+`{"id":"owl","prompt":"an owl","steps":12}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// run returns stdout followed by stderr, or only stdout in JSON mode.
+	run := func(args ...string) (string, int) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		a := newApp(strings.NewReader(""), &stdout, &stderr)
+		a.getenv = func(name string) string {
+			if name == "DRAWTHINGS_QUEUE_FILE" {
+				return queueFile
+			}
+			return ""
+		}
+		code := a.execute(args)
+		if a.globals.outputFormat == formatJSON {
+			return stdout.String(), code
+		}
+		return stdout.String() + stderr.String(), code
+	}
+
+	if out, code := run("queue", "add", "-prompt", "a cat", "-priority", "5", "-width", "64", "-height", "64"); code != exitOK {
+		t.Fatalf("add: exit %d\n%s", code, out)
+	}
+	if out, code := run("queue", "add", "-file", jobsFile, "-width", "64", "-height", "64"); code != exitOK {
+		t.Fatalf("add -file: exit %d\n%s", code, out)
+	}
+	if out, code := run("queue", "add", "-prompt", "x", "-steps", "500"); code != exitValidation {
+		t.Errorf("invalid job: exit %d\n%s", code, out)
+	}
+	if out, code := run("queue", "cancel", "owl", "missing"); code != exitError || !strings.Contains(out, "Canceled job owl") {
+		t.Errorf("cancel: exit %d\n%s", code, out)
+	}
+
+	out, code := run("queue", "list", "-output-format", "json", "-state", "pending")
+	if code != exitOK {
+		t.Fatalf("list: exit %d\n%s", code, out)
+	}
+	var doc struct {
+		Result queueListResult `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	if len(doc.Result.Jobs) != 2 || doc.Result.Jobs[0].ID != "000001" || doc.Result.Jobs[1].ID != "fox" {
+		t.Fatalf("pending jobs: %+v", doc.Result.Jobs)
+	}
+
+	out, code = run("queue", "run", "-base-url", server.URL, "-output-dir", dir)
+	if code != exitOK {
+		t.Fatalf("run: exit %d\n%s", code, out)
+	}
+	// The higher priority job runs first.
+	if first, second := strings.Index(out, "running   000001"), strings.Index(out, "running   fox"); first < 0 || second < first {
+		t.Errorf("unexpected run order:\n%s", out)
+	}
+	for _, name := range []string{"000001.png", "fox.png"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %s: %v", name, err)
+		}
+	}
+
+	store, err := queue.Open(queueFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if n := len(store.List(queue.StateSucceeded)); n != 2 {
+		t.Errorf("succeeded jobs: got %d, want 2", n)
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drawthings_go"
+)
+
+// replHelp is printed by the "help" REPL command.
+const replHelp = `Commands:
+  prompt <text>         Set the prompt
+  negative <text>       Set the negative prompt
+  set <name> <value>    Set a parameter (steps, guidance-scale, width, height, seed, vars, ...)
+  seed lock             Pin the seed of the last image so later images reuse it
+  seed random           Use a new random seed for every image
+  seed <n>              Use a fixed seed
+  show                  Print the current request
+  go                    Generate an image from the current request
+  undo                  Revert the last change to the request
+  history               List the images generated in this session
+  help                  Show this help
+  quit                  Leave the session
+`
+
+// replSession is the state of an interactive session.
+type replSession struct {
+	a         *app
+	client    *drawthings.Client
+	params    *flag.FlagSet
+	opts      *generateOptions
+	outputDir string
+	prefix    string
+	interval  time.Duration
+	next      int
+	lastSeed  int
+	undo      []generateOptions
+	history   []replEntry
+}
+
+// replEntry is an image generated during a session.
+type replEntry struct {
+	Path    string                        `json:"path"`
+	Request drawthings.TextToImageRequest `json:"request"`
+}
+
+// runREPL implements the "repl" command.
+func runREPL(a *app, args []string) error {
+	fs := a.newFlagSet("repl")
+	var opts generateOptions
+	opts.register(fs)
+	var (
+		outputDir = fs.String("output-dir", ".", "Directory for generated images")
+		prefix    = fs.String("prefix", "repl_", "File name prefix for generated images")
+		interval  = fs.Duration("progress-interval", time.Second, "Time between progress updates while an image is generated (0 to disable)")
+	)
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *interval < 0 {
+		return usageErrorf("-progress-interval must not be negative")
+	}
+	if opts.prompt == stdioName || opts.promptFile == stdioName || opts.negativePromptFile == stdioName {
+		return usageErrorf("the interactive session reads commands from stdin; prompts cannot")
+	}
+	if err := a.resolvePrompts(&opts); err != nil {
+		return err
+	}
+
+	// The parameter flags double as the "set" command's parser. Registering
+	// them resets opts to the flag defaults, so restore the parsed values.
+	parsed := opts
+	params := flag.NewFlagSet("set", flag.ContinueOnError)
+	params.SetOutput(io.Discard)
+	opts.register(params)
+	opts = parsed
+
+	s := &replSession{
+		a:         a,
+		client:    a.newClient(),
+		params:    params,
+		opts:      &opts,
+		outputDir: *outputDir,
+		prefix:    *prefix,
+		interval:  *interval,
+		next:      1,
+	}
+	err := s.run()
+	a.setResult(s.history)
+	return err
+}
+
+// run reads commands until EOF or "quit".
+func (s *replSession) run() error {
+	s.a.printf("drawthings interactive session; type \"help\" for commands.\n")
+	scanner := bufio.NewScanner(s.a.stdin)
+	for {
+		s.a.printf("> ")
+		if !scanner.Scan() {
+			s.a.printf("\n")
+			return scanner.Err()
+		}
+		if err := s.a.context().Err(); err != nil {
+			return err
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, rest, _ := strings.Cut(line, " ")
+		rest = strings.TrimSpace(rest)
+
+		if name == "quit" || name == "exit" {
+			return nil
+		}
+		if err := s.exec(name, rest); err != nil {
+			s.a.printf("error: %v\n", err)
+		}
+	}
+}
+
+// exec runs a single REPL command.
+func (s *replSession) exec(name, rest string) error {
+	switch name {
+	case "help":
+		s.a.printf("%s", replHelp)
+	case "prompt", "negative":
+		flagName := "prompt"
+		if name == "negative" {
+			flagName = "negative-prompt"
+		}
+		return s.set(flagName, rest)
+	case "set":
+		key, value, ok := strings.Cut(rest, " ")
+		if !ok {
+			return fmt.Errorf("usage: set <name> <value>")
+		}
+		return s.set(key, strings.TrimSpace(value))
+	case "seed":
+		return s.seed(rest)
+	case "show":
+		s.show()
+	case "go":
+		return s.generate()
+	case "undo":
+		if len(s.undo) == 0 {
+			return fmt.Errorf("nothing to undo")
+		}
+		*s.opts = s.undo[len(s.undo)-1]
+		s.undo = s.undo[:len(s.undo)-1]
+		s.show()
+	case "history":
+		if len(s.history) == 0 {
+			s.a.printf("no images generated yet\n")
+		}
+		for i, e := range s.history {
+			s.a.printf("%3d  %s  seed=%d steps=%d  %q\n", i+1, e.Path, e.Request.Seed, e.Request.Steps, e.Request.Prompt)
+		}
+	default:
+		return fmt.Errorf("unknown command %q (type \"help\" for commands)", name)
+	}
+	return nil
+}
+
+// set changes a request parameter, recording the previous state for undo.
+func (s *replSession) set(name, value string) error {
+	f := s.params.Lookup(name)
+	if f == nil || !replSettable[name] {
+		return fmt.Errorf("unknown parameter %q", name)
+	}
+	prev := *s.opts
+	if err := f.Value.Set(value); err != nil {
+		*s.opts = prev
+		return fmt.Errorf("invalid value for %s: %v", name, err)
+	}
+	s.undo = append(s.undo, prev)
+	// Parameters set in the session take precedence over styles.
+	s.a.sources[name] = sourceFlag
+	return nil
+}
+
+// replSettable lists the parameters the "set" command accepts.
+var replSettable = map[string]bool{
+	"prompt":          true,
+	"negative-prompt": true,
+	"steps":           true,
+	"guidance-scale":  true,
+	"width":           true,
+	"height":          true,
+	"seed":            true,
+	"prompt-template": true,
+	"vars":            true,
+	"template-seed":   true,
+}
+
+// seed implements the "seed" command.
+func (s *replSession) seed(arg string) error {
+	switch arg {
+	case "lock":
+		if s.lastSeed == 0 {
+			return fmt.Errorf("no image generated yet; use \"seed <n>\" to pick a seed")
+		}
+		if err := s.set("seed", strconv.Itoa(s.lastSeed)); err != nil {
+			return err
+		}
+		s.a.printf("seed locked to %d\n", s.lastSeed)
+		return nil
+	case "random", "unlock":
+		return s.set("seed", "-1")
+	case "":
+		return fmt.Errorf("usage: seed lock|random|<n>")
+	default:
+		return s.set("seed", arg)
+	}
+}
+
+// show prints the current request.
+func (s *replSession) show() {
+	var names []string
+	for name := range replSettable {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s.a.printf("  %-16s %s\n", name, s.params.Lookup(name).Value.String())
+	}
+}
+
+// generate runs the current request and saves the image under the next
+// free file name.
+func (s *replSession) generate() error {
+	if s.opts.prompt == "" && s.opts.promptTemplate == "" {
+		return fmt.Errorf("set a prompt first")
+	}
+	text, err := s.opts.expand(s.opts.prompt)
+	if err != nil {
+		return err
+	}
+	req, err := s.a.styledRequest(&s.opts.requestOptions, text)
+	if err != nil {
+		return err
+	}
+	ctx := s.a.context()
+	if req.Seed < 0 {
+		req.Seed = int(rand.Int31())
+		ctx = drawthings.WithoutCache(ctx)
+	}
+
+	path := s.nextPath()
+	if s.opts.enabled() {
+		s.a.printf("prompt: %s\n", req.Prompt)
+	}
+	s.a.printf("generating (seed %d)...\n", req.Seed)
+	started := time.Now()
+	stop := s.reportProgress(ctx, started)
+	err = s.client.GenerateImageAndSave(ctx, req, path)
+	stop()
+	if err != nil {
+		return err
+	}
+
+	s.lastSeed = req.Seed
+	s.history = append(s.history, replEntry{Path: path, Request: *req})
+	s.a.printf("saved %s in %s\n", path, time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+// reportProgress prints the elapsed time, and the sampling step if the
+// server reports it, every interval until the returned function is called.
+func (s *replSession) reportProgress(ctx context.Context, started time.Time) (stop func()) {
+	if s.interval == 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			line := fmt.Sprintf("  %s elapsed", time.Since(started).Round(time.Second))
+			// Progress is best effort; not every server reports it.
+			if p, err := s.client.Progress(ctx); err == nil && p.Busy() && p.State.SamplingSteps > 0 {
+				line += fmt.Sprintf(", step %d/%d (%.0f%%)", p.State.SamplingStep, p.State.SamplingSteps, p.Progress*100)
+			}
+			select {
+			case <-done:
+				return
+			default:
+				fmt.Fprintln(s.a.stderr, line)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// nextPath returns the next unused numbered output path.
+func (s *replSession) nextPath() string {
+	for {
+		path := filepath.Join(s.outputDir, fmt.Sprintf("%s%04d.png", s.prefix, s.next))
+		s.next++
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drawthings_go"
+	"github.com/drawthings_go/drawthingstest"
+)
+
+func TestREPL_Script(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+
+	dir := t.TempDir()
+	// An existing file must not be overwritten.
+	if err := os.WriteFile(filepath.Join(dir, "repl_0001.png"), []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	script := `
+prompt a red fox
+set steps 30
+go
+seed lock
+set steps 40
+set width banana
+go
+undo
+undo
+show
+set steps 12
+go
+bogus
+history
+quit
+go
+`
+	var stdout bytes.Buffer
+	a := newApp(strings.NewReader(script), &stdout, &bytes.Buffer{})
+	a.getenv = func(string) string { return "" }
+
+	code := a.execute([]string{"repl", "-base-url", server.URL, "-output-dir", dir})
+	if code != exitOK {
+		t.Fatalf("exit code %d, output:\n%s", code, stdout.String())
+	}
+
+	var requests []drawthings.TextToImageRequest
+	for _, r := range server.RequestsTo(drawthingstest.PathTxt2Img) {
+		var req drawthings.TextToImageRequest
+		if err := r.Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		requests = append(requests, req)
+	}
+	if len(requests) != 3 {
+		t.Fatalf("expected 3 generations, got %d:\n%s", len(requests), stdout.String())
+	}
+	first, second, third := requests[0], requests[1], requests[2]
+	if first.Prompt != "a red fox" || first.Steps != 30 {
+		t.Errorf("unexpected first request: %+v", first)
+	}
+	if second.Seed != first.Seed || second.Steps != 40 {
+		t.Errorf("seed lock not applied: first %+v, second %+v", first, second)
+	}
+	if third.Steps != 12 {
+		t.Errorf("unexpected third request: %+v", third)
+	}
+
+	for _, name := range []string{"repl_0002.png", "repl_0003.png", "repl_0004.png"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %s: %v", name, err)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "repl_0001.png")); string(data) != "keep" {
+		t.Error("existing file was overwritten")
+	}
+
+	out := stdout.String()
+	for _, want := range []string{
+		"invalid value for width",
+		`unknown command "bogus"`,
+		"repl_0004.png  seed=",
+		// Two undos revert "set steps 40" and "seed lock".
+		"seed             -1\n  steps            30",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestREPL_Progress(t *testing.T) {
+	server := drawthingstest.NewServer(drawthingstest.WithLatency(300 * time.Millisecond))
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	a := newApp(strings.NewReader("prompt a red fox\ngo\n"), &stdout, &stderr)
+	a.getenv = func(string) string { return "" }
+
+	code := a.execute([]string{"repl", "-base-url", server.URL, "-output-dir", t.TempDir(), "-progress-interval", "50ms"})
+	if code != exitOK {
+		t.Fatalf("exit code %d, output:\n%s%s", code, stdout.String(), stderr.String())
+	}
+	if out := stderr.String(); !strings.Contains(out, "elapsed, step ") || !strings.Contains(out, "/20 (") {
+		t.Errorf("expected progress updates, got:\n%s", out)
+	}
+	if len(server.RequestsTo(drawthingstest.PathProgress)) == 0 {
+		t.Error("expected the server progress to be polled")
+	}
+}
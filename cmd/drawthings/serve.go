@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/drawthings_go"
+	"github.com/drawthings_go/gateway"
+	"github.com/drawthings_go/metrics"
+	"github.com/drawthings_go/openai"
+)
+
+// metricsPath is where "serve -metrics" exposes Prometheus metrics.
+const metricsPath = "/metrics"
+
+// runServe implements the "serve" command.
+func runServe(a *app, args []string) error {
+	fs := a.newFlagSet("serve")
+	var (
+		listen      = fs.String("listen", "127.0.0.1:7861", "Address to listen on")
+		maxQueue    = fs.Int("max-queue", 0, "Reject requests with 503 once this many are waiting (0 for no limit)")
+		withOpenAI  = fs.Bool("openai", false, "Also serve the OpenAI Images API at "+openai.PathGenerations)
+		imageDir    = fs.String("image-dir", filepath.Join(os.TempDir(), "drawthings-images"), "With -openai, directory for images returned by URL")
+		retention   = fs.Duration("image-retention", 24*time.Hour, "With -openai, remove stored images after this long (0 keeps them)")
+		publicURL   = fs.String("public-url", "", "With -openai, base URL used in image URLs (default: derived from the request)")
+		withMetrics = fs.Bool("metrics", false, "Serve Prometheus metrics at "+metricsPath)
+	)
+	defaultUsage := fs.Usage
+	fs.Usage = func() {
+		defaultUsage()
+		fmt.Fprintf(a.stderr, "\nThe gateway exposes the /sdapi/v1/* API of the server at -base-url and\n")
+		fmt.Fprintf(a.stderr, "forwards generation requests one at a time. Clients take turns; set the\n")
+		fmt.Fprintf(a.stderr, "%s header to identify yourself (defaults to your IP address).\n", gateway.HeaderClient)
+		fmt.Fprintf(a.stderr, "The queue is listed at %s. With -openai, OpenAI-compatible\n", gateway.PathQueue)
+		fmt.Fprintf(a.stderr, "tools can use %s through the same queue. Press Ctrl-C to stop.\n", openai.PathGenerations)
+	}
+
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return usageErrorf("serve takes no arguments")
+	}
+	if *maxQueue < 0 {
+		return usageErrorf("-max-queue must not be negative")
+	}
+
+	var (
+		clientOpts  []drawthings.Option
+		gatewayOpts = []gateway.Option{gateway.WithMaxQueue(*maxQueue)}
+		collector   *metrics.Collector
+	)
+	if *withMetrics {
+		collector = metrics.NewCollector()
+		clientOpts = append(clientOpts, drawthings.WithMetrics(collector))
+		gatewayOpts = append(gatewayOpts, gateway.WithMetrics(collector))
+	}
+	client := a.newClient(clientOpts...)
+	gw := gateway.New(client, append(gatewayOpts, gateway.WithUpstream(client.BaseURL()))...)
+	if collector != nil {
+		gw.Handle(metricsPath, collector)
+	}
+	if *withOpenAI {
+		store, err := openai.NewFileStore(*imageDir, *retention)
+		if err != nil {
+			return drawthings.NewStorageError("failed to prepare image directory", err)
+		}
+		opts := []openai.Option{openai.WithFileStore(store), openai.WithAcquire(gw.Acquire)}
+		if *publicURL != "" {
+			opts = append(opts, openai.WithPublicURL(*publicURL))
+		}
+		gw.Handle("/v1/", openai.NewHandler(client, opts...))
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", *listen, err)
+	}
+	result := serveResult{Listen: ln.Addr().String(), Upstream: client.BaseURL()}
+	log := &accessLog{a: a}
+	srv := &http.Server{Handler: log.wrap(gw)}
+
+	a.printf("Gateway listening on http://%s, forwarding to %s\n", result.Listen, result.Upstream)
+	if collector != nil {
+		a.printf("Metrics at http://%s%s\n", result.Listen, metricsPath)
+	}
+	if *withOpenAI {
+		a.printf("OpenAI Images API at http://%s%s\n", result.Listen, openai.PathGenerations)
+	}
+
+	ctx := a.context()
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		a.printf("Shutting down...\n")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err = srv.Shutdown(shutdownCtx)
+	}
+	result.Requests = log.count()
+	a.setResult(result)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("gateway failed: %w", err)
+	}
+	return nil
+}
+
+// accessLog prints one line per request handled by the gateway.
+type accessLog struct {
+	a  *app
+	mu sync.Mutex
+	n  int
+}
+
+func (l *accessLog) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.n++
+		l.a.printf("[%s] %s %s %d %s queue=%s wait=%sms\n", started.Format("15:04:05"), r.Method, r.URL.Path,
+			rec.status, time.Since(started).Round(time.Millisecond),
+			orDash(w.Header().Get(gateway.HeaderQueuePosition)), orDash(w.Header().Get(gateway.HeaderQueueWait)))
+	})
+}
+
+func (l *accessLog) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.n
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps streaming responses from the reverse proxy working.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// serveResult is the JSON result of the serve command, written on shutdown.
+type serveResult struct {
+	Listen   string `json:"listen"`
+	Upstream string `json:"upstream"`
+	Requests int    `json:"requests"`
+}
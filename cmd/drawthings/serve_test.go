@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drawthings_go"
+	"github.com/drawthings_go/drawthingstest"
+	"github.com/drawthings_go/openai"
+)
+
+func TestServe_ForwardsAndShutsDown(t *testing.T) {
+	upstream := drawthingstest.NewServer()
+	defer upstream.Close()
+
+	// Reserve a free port for the gateway.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	a := newApp(strings.NewReader(""), &stdout, &stderr)
+	a.getenv = func(string) string { return "" }
+	a.ctx = ctx
+
+	done := make(chan int)
+	go func() {
+		done <- a.execute([]string{"serve", "-output-format", "json", "-base-url", upstream.URL, "-listen", addr,
+			"-openai", "-image-dir", t.TempDir(), "-metrics"})
+	}()
+
+	client := drawthings.NewClient(drawthings.WithBaseURL("http://" + addr))
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, err = client.GenerateImage(context.Background(), &drawthings.TextToImageRequest{Prompt: "a fox", Width: 64, Height: 64})
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GenerateImage() through serve: %v", err)
+	}
+
+	// The OpenAI adapter shares the gateway.
+	resp, err := http.Post("http://"+addr+openai.PathGenerations, "application/json",
+		strings.NewReader(`{"prompt":"a fox","size":"64x64"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var images openai.ImageResponse
+	json.NewDecoder(resp.Body).Decode(&images)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(images.Data) != 1 || images.Data[0].URL == "" {
+		t.Errorf("OpenAI request: status %d, response %+v", resp.StatusCode, images)
+	}
+
+	resp, err = http.Get("http://" + addr + metricsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scraped, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	for _, want := range []string{
+		`drawthings_requests_total{endpoint="/sdapi/v1/txt2img",outcome="ok"} 2`,
+		`drawthings_queue_wait_seconds_count{queue="gateway"} 2`,
+	} {
+		if !strings.Contains(string(scraped), want) {
+			t.Errorf("metrics missing %s:\n%s", want, scraped)
+		}
+	}
+
+	cancel()
+	if code := <-done; code != exitOK {
+		t.Fatalf("exit code %d, stderr: %s", code, stderr.String())
+	}
+
+	var doc struct {
+		OK     bool        `json:"ok"`
+		Result serveResult `json:"result"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON output %q: %v", stdout.String(), err)
+	}
+	// Two generations and the metrics scrape.
+	if !doc.OK || doc.Result.Listen != addr || doc.Result.Requests != 3 {
+		t.Errorf("unexpected result: %+v", doc)
+	}
+	if n := len(upstream.RequestsTo(drawthingstest.PathTxt2Img)); n != 2 {
+		t.Errorf("upstream requests: got %d, want 2", n)
+	}
+}
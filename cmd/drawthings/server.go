@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/drawthings_go"
+)
+
+// Option keys under which servers report the loaded model.
+var modelOptionKeys = []string{"sd_model_checkpoint", "model"}
+
+// modelsResult is the JSON result of the models command.
+type modelsResult struct {
+	Models []drawthings.Model `json:"models"`
+	Loaded string             `json:"loaded,omitempty"`
+}
+
+// runModels implements the "models" command.
+func runModels(a *app, args []string) error {
+	fs := a.newFlagSet("models")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return usageErrorf("models takes no arguments")
+	}
+
+	client := a.newClient()
+	models, err := client.Models(a.context())
+	if err != nil {
+		return fmt.Errorf("failed to list models: %w", err)
+	}
+	result := modelsResult{Models: models}
+	if result.Models == nil {
+		result.Models = []drawthings.Model{}
+	}
+	// The loaded model is informational; servers without options still
+	// list their models.
+	if options, err := client.Options(a.context()); err == nil {
+		result.Loaded = loadedModel(options)
+	}
+	a.setResult(result)
+	for _, m := range models {
+		marker := " "
+		if result.Loaded != "" && (m.Title == result.Loaded || m.ModelName == result.Loaded || m.Filename == result.Loaded) {
+			marker = "*"
+		}
+		a.printf("%s %s\n", marker, m.Title)
+	}
+	return nil
+}
+
+// loadedModel returns the model named in the server options, or "".
+func loadedModel(options map[string]interface{}) string {
+	for _, key := range modelOptionKeys {
+		if s, ok := options[key].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// runOptions implements the "options" command.
+func runOptions(a *app, args []string) error {
+	fs := a.newFlagSet("options")
+	defaultUsage := fs.Usage
+	fs.Usage = func() {
+		defaultUsage()
+		fmt.Fprintf(a.stderr, "\nWithout arguments, all settings are shown. Values are parsed as JSON\n")
+		fmt.Fprintf(a.stderr, "and fall back to strings.\n")
+		fmt.Fprintf(a.stderr, "\nExamples:\n")
+		fmt.Fprintf(a.stderr, "  drawthings options sd_model_checkpoint=sdxl.ckpt\n")
+	}
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	client := a.newClient()
+	if fs.NArg() > 0 {
+		changes := make(map[string]interface{}, fs.NArg())
+		for _, arg := range fs.Args() {
+			key, value, ok := strings.Cut(arg, "=")
+			if !ok || key == "" {
+				fs.Usage()
+				return usageErrorf("invalid setting %q: must be key=value", arg)
+			}
+			changes[key] = parseOptionValue(value)
+		}
+		if err := client.SetOptions(a.context(), changes); err != nil {
+			return fmt.Errorf("failed to change options: %w", err)
+		}
+	}
+
+	options, err := client.Options(a.context())
+	if err != nil {
+		return fmt.Errorf("failed to read options: %w", err)
+	}
+	a.setResult(options)
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, _ := json.Marshal(options[key])
+		a.printf("%s=%s\n", key, value)
+	}
+	return nil
+}
+
+// parseOptionValue parses s as JSON, falling back to the string itself.
+func parseOptionValue(s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return s
+	}
+	return v
+}
+
+// runProgress implements the "progress" command.
+func runProgress(a *app, args []string) error {
+	fs := a.newFlagSet("progress")
+	var (
+		watch    = fs.Bool("watch", false, "Keep polling until the server is idle")
+		interval = fs.Duration("interval", time.Second, "Time between polls with -watch")
+	)
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return usageErrorf("progress takes no arguments")
+	}
+	if *interval <= 0 {
+		return usageErrorf("-interval must be positive")
+	}
+
+	client := a.newClient()
+	for {
+		p, err := client.Progress(a.context())
+		if err != nil {
+			return fmt.Errorf("failed to read progress: %w", err)
+		}
+		p.CurrentImage = ""
+		a.setResult(p)
+		if !p.Busy() {
+			a.printf("idle\n")
+			return nil
+		}
+		a.printf("step %d/%d (%.0f%%), about %.0fs left\n",
+			p.State.SamplingStep, p.State.SamplingSteps, p.Progress*100, p.ETARelative)
+		if !*watch {
+			return nil
+		}
+		select {
+		case <-a.context().Done():
+			return a.context().Err()
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// runInterrupt implements the "interrupt" command.
+func runInterrupt(a *app, args []string) error {
+	fs := a.newFlagSet("interrupt")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return usageErrorf("interrupt takes no arguments")
+	}
+	if err := a.newClient().Interrupt(a.context()); err != nil {
+		return fmt.Errorf("failed to interrupt: %w", err)
+	}
+	a.printf("Interrupt sent\n")
+	return nil
+}
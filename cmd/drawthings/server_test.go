@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drawthings_go"
+	"github.com/drawthings_go/drawthingstest"
+)
+
+func TestServerCommands(t *testing.T) {
+	server := drawthingstest.NewServer(drawthingstest.WithLatency(5 * time.Second))
+	defer server.Close()
+
+	run := func(args ...string) (string, string, int) {
+		var stdout, stderr bytes.Buffer
+		a := newApp(strings.NewReader(""), &stdout, &stderr)
+		a.getenv = func(string) string { return "" }
+		code := a.execute(append([]string{"-base-url", server.URL}, args...))
+		return stdout.String(), stderr.String(), code
+	}
+
+	stdout, stderr, code := run("options", "sd_model_checkpoint=sdxl.ckpt", "clip_skip=2")
+	if code != exitOK {
+		t.Fatalf("options: exit code %d, stderr: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, `sd_model_checkpoint="sdxl.ckpt"`) {
+		t.Errorf("unexpected options output: %s", stdout)
+	}
+	var sent map[string]interface{}
+	requests := server.RequestsTo(drawthingstest.PathOptions)
+	requests[0].Decode(&sent)
+	if sent["clip_skip"] != 2.0 || sent["sd_model_checkpoint"] != "sdxl.ckpt" {
+		t.Errorf("options sent %v", sent)
+	}
+	if _, _, code = run("options", "no-value"); code != exitUsage {
+		t.Errorf("options without value: exit code %d, want %d", code, exitUsage)
+	}
+
+	stdout, stderr, code = run("models")
+	if code != exitOK {
+		t.Fatalf("models: exit code %d, stderr: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "* sdxl.ckpt") || strings.Count(stdout, "\n") != 2 {
+		t.Errorf("unexpected models output: %s", stdout)
+	}
+
+	if stdout, _, code = run("progress"); code != exitOK || stdout != "idle\n" {
+		t.Errorf("idle progress: exit code %d, output %q", code, stdout)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := drawthings.NewClient(drawthings.WithBaseURL(server.URL)).GenerateImage(
+			context.Background(), &drawthings.TextToImageRequest{Prompt: "a slow render", Seed: 1})
+		done <- err
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if stdout, _, _ = run("progress"); strings.HasPrefix(stdout, "step ") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("progress never reported the job: %q", stdout)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if stdout, stderr, code = run("interrupt"); code != exitOK || !strings.Contains(stdout, "Interrupt sent") {
+		t.Errorf("interrupt: exit code %d, output %q, stderr %s", code, stdout, stderr)
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("interrupted generation succeeded")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("generation was not interrupted")
+	}
+
+	if _, _, code = run("progress", "-interval", "0"); code != exitUsage {
+		t.Errorf("progress -interval 0: exit code %d, want %d", code, exitUsage)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"archive/tar"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/drawthings_go"
+)
+
+// stdioName is the file name that stands for stdin or stdout.
+const stdioName = "-"
+
+// resolvePrompts fills the prompt and negative prompt from -prompt-file,
+// -negative-prompt-file or stdin ("-prompt -"). At most one of them may read
+// from stdin.
+func (a *app) resolvePrompts(opts *generateOptions) error {
+	if opts.prompt != "" && opts.promptFile != "" {
+		return usageErrorf("-prompt and -prompt-file are mutually exclusive")
+	}
+	if opts.negativePrompt != "" && opts.negativePromptFile != "" {
+		return usageErrorf("-negative-prompt and -negative-prompt-file are mutually exclusive")
+	}
+
+	sources := []struct {
+		value *string
+		file  string
+	}{
+		{&opts.prompt, opts.promptFile},
+		{&opts.negativePrompt, opts.negativePromptFile},
+	}
+
+	stdinUsed := false
+	for _, src := range sources {
+		path := src.file
+		if path == "" && *src.value == stdioName {
+			path = stdioName
+		}
+		if path == "" {
+			continue
+		}
+		if path == stdioName {
+			if stdinUsed {
+				return usageErrorf("only one prompt can be read from stdin")
+			}
+			stdinUsed = true
+		}
+
+		text, err := a.readText(path)
+		if err != nil {
+			return err
+		}
+		*src.value = text
+	}
+	return nil
+}
+
+// readText reads a whole text file, or stdin for "-", trimming surrounding
+// whitespace.
+func (a *app) readText(path string) (string, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if path == stdioName {
+		data, err = io.ReadAll(a.stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", displayName(path), err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func displayName(path string) string {
+	if path == stdioName {
+		return "stdin"
+	}
+	return path
+}
+
+// decodeImages decodes every base64 image of a response.
+func decodeImages(resp *drawthings.TextToImageResponse) ([][]byte, error) {
+	if len(resp.Images) == 0 {
+		return nil, drawthings.NewDecodeError("no images in response", nil)
+	}
+	images := make([][]byte, 0, len(resp.Images))
+	for _, encoded := range resp.Images {
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, drawthings.NewDecodeError("failed to decode base64 image data", err)
+		}
+		images = append(images, data)
+	}
+	return images, nil
+}
+
+// writeImageStream writes images to w: a single image is written as raw
+// bytes, several images (or any number when forceTar is set) as a tar archive
+// with entries named image_<n>.<ext>.
+func writeImageStream(w io.Writer, images [][]byte, forceTar bool) error {
+	if len(images) == 1 && !forceTar {
+		if _, err := w.Write(images[0]); err != nil {
+			return drawthings.NewStorageError("failed to write image to stdout", err)
+		}
+		return nil
+	}
+
+	tw := tar.NewWriter(w)
+	now := time.Now()
+	for i, data := range images {
+		hdr := &tar.Header{
+			Name:    fmt.Sprintf("image_%d%s", i, imageExt(data)),
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return drawthings.NewStorageError("failed to write tar header", err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			return drawthings.NewStorageError("failed to write tar entry", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return drawthings.NewStorageError("failed to finish tar stream", err)
+	}
+	return nil
+}
+
+// imageExt returns a file extension matching the image data.
+func imageExt(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/webp":
+		return ".webp"
+	default:
+		return ".png"
+	}
+}
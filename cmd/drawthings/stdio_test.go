@@ -0,0 +1,117 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drawthings_go"
+	"github.com/drawthings_go/drawthingstest"
+)
+
+var pngHeader = []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}
+
+func TestResolvePrompts(t *testing.T) {
+	negPath := filepath.Join(t.TempDir(), "negative.txt")
+	if err := os.WriteFile(negPath, []byte("blurry, low quality\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a := newApp(strings.NewReader("a red fox\n\n"), &bytes.Buffer{}, &bytes.Buffer{})
+	opts := generateOptions{prompt: "-", negativePromptFile: negPath}
+	if err := a.resolvePrompts(&opts); err != nil {
+		t.Fatalf("resolvePrompts() error = %v", err)
+	}
+	if opts.prompt != "a red fox" {
+		t.Errorf("prompt: got %q", opts.prompt)
+	}
+	if opts.negativePrompt != "blurry, low quality" {
+		t.Errorf("negative prompt: got %q", opts.negativePrompt)
+	}
+}
+
+func TestResolvePrompts_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts generateOptions
+	}{
+		{"both from stdin", generateOptions{promptFile: "-", negativePromptFile: "-"}},
+		{"prompt and prompt file", generateOptions{prompt: "x", promptFile: "p.txt"}},
+		{"missing file", generateOptions{promptFile: filepath.Join(t.TempDir(), "missing.txt")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newApp(strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{})
+			if err := a.resolvePrompts(&tt.opts); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestWriteImageStream(t *testing.T) {
+	var raw bytes.Buffer
+	if err := writeImageStream(&raw, [][]byte{pngHeader}, false); err != nil {
+		t.Fatalf("writeImageStream() error = %v", err)
+	}
+	if !bytes.Equal(raw.Bytes(), pngHeader) {
+		t.Errorf("single image should be written raw, got %x", raw.Bytes())
+	}
+
+	var archive bytes.Buffer
+	if err := writeImageStream(&archive, [][]byte{pngHeader, pngHeader}, false); err != nil {
+		t.Fatalf("writeImageStream() error = %v", err)
+	}
+	tr := tar.NewReader(&archive)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid tar stream: %v", err)
+		}
+		names = append(names, hdr.Name)
+	}
+	if strings.Join(names, ",") != "image_0.png,image_1.png" {
+		t.Errorf("tar entries: got %v", names)
+	}
+}
+
+func TestGenerate_StdinToStdout(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	a := newApp(strings.NewReader("a red fox\n"), &stdout, &stderr)
+	a.getenv = func(string) string { return "" }
+
+	code := a.execute([]string{"generate", "-base-url", server.URL, "-prompt", "-", "-output", "-"})
+	if code != exitOK {
+		t.Fatalf("exit code %d, stderr: %s", code, stderr.String())
+	}
+	requests := server.RequestsTo(drawthingstest.PathTxt2Img)
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+	var got drawthings.TextToImageRequest
+	if err := requests[0].Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Prompt != "a red fox" {
+		t.Errorf("prompt sent: got %q", got.Prompt)
+	}
+	want := drawthingstest.Image(got.Prompt, got.Seed, got.Width, got.Height)
+	if !bytes.Equal(stdout.Bytes(), want) {
+		t.Errorf("stdout should only contain the image, got %q", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "Generating image") {
+		t.Errorf("progress messages should go to stderr, got %q", stderr.String())
+	}
+}
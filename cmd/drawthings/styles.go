@@ -0,0 +1,153 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/drawthings_go"
+	"github.com/drawthings_go/styles"
+)
+
+// styleFileNames are the style files looked for next to the config file
+// when -style-file is not set.
+var styleFileNames = []string{"styles.json", "styles.csv", "styles"}
+
+// styleLibrary loads the style files set with -style-file or, by default,
+// those next to the config file.
+func (a *app) styleLibrary(o *requestOptions) (*styles.Library, error) {
+	if o.styleFile != "" {
+		return styles.Load(o.styleFile)
+	}
+	configPath, _ := a.configPath()
+	var paths []string
+	for _, name := range styleFileNames {
+		path := filepath.Join(filepath.Dir(configPath), name)
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, usageErrorf("no style files found next to %s; set -style-file", configPath)
+	}
+	return styles.Load(paths...)
+}
+
+// styles returns the style presets named by -style, in order, or nil if
+// none are named.
+func (a *app) styles(o *requestOptions) ([]styles.Style, error) {
+	names := styles.ParseNames(o.style)
+	if len(names) == 0 {
+		return nil, nil
+	}
+	lib, err := a.styleLibrary(o)
+	if err != nil {
+		return nil, err
+	}
+	chosen, err := lib.Lookup(names...)
+	if err != nil {
+		return nil, usageErrorf("%v", err)
+	}
+	return chosen, nil
+}
+
+// styledRequest builds an API request for prompt using the parameter flags
+// and applies the styles named by -style.
+func (a *app) styledRequest(o *requestOptions, prompt string) (*drawthings.TextToImageRequest, error) {
+	req := o.request(prompt)
+	chosen, err := a.styles(o)
+	if err != nil {
+		return nil, err
+	}
+	a.applyStyles(req, chosen)
+	return req, nil
+}
+
+// applyStyles applies styles to req, a request built from the parameter
+// flags. Parameters that no flag, environment variable or profile set take
+// the values the styles set.
+func (a *app) applyStyles(req *drawthings.TextToImageRequest, chosen []styles.Style) {
+	if len(chosen) == 0 {
+		return
+	}
+	a.unsetDefaults(req)
+	styles.Apply(req, chosen...)
+	req.SetDefaults()
+}
+
+// applyFileStyles applies styles to req, a request read from a file. The
+// parameters the file leaves unset are taken from the parameter flags in o,
+// and those set by neither take the values the styles set.
+func (a *app) applyFileStyles(req *drawthings.TextToImageRequest, o *requestOptions, chosen []styles.Style) {
+	defaults := o.request("")
+	if len(chosen) == 0 {
+		fillRequest(req, defaults)
+		return
+	}
+	a.unsetDefaults(defaults)
+	fillRequest(req, defaults)
+	styles.Apply(req, chosen...)
+	req.SetDefaults()
+}
+
+// unsetDefaults clears the parameters of req, built from the parameter
+// flags, whose flags were left at their defaults, so styles can set them.
+// A flag set to its default value still counts as set.
+func (a *app) unsetDefaults(req *drawthings.TextToImageRequest) {
+	if !a.paramSet("steps") {
+		req.Steps = 0
+	}
+	if !a.paramSet("guidance-scale") {
+		req.GuidanceScale = 0
+	}
+	if !a.paramSet("width") {
+		req.Width = 0
+	}
+	if !a.paramSet("height") {
+		req.Height = 0
+	}
+}
+
+// paramSet reports whether a flag, environment variable or profile set the
+// named flag.
+func (a *app) paramSet(name string) bool {
+	switch a.sources[name] {
+	case sourceFlag, sourceEnv, sourceProfile:
+		return true
+	}
+	return false
+}
+
+// stylesResult is the JSON result of the styles command.
+type stylesResult struct {
+	Styles []styles.Style `json:"styles"`
+}
+
+// runStyles implements the "styles" command.
+func runStyles(a *app, args []string) error {
+	fs := a.newFlagSet("styles")
+	styleFile := fs.String("style-file", "", "Style file or directory (default: styles.json, styles.csv and styles/ next to the config file)")
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return usageErrorf("styles takes no arguments")
+	}
+
+	lib, err := a.styleLibrary(&requestOptions{styleFile: *styleFile})
+	if err != nil {
+		return err
+	}
+	result := stylesResult{Styles: lib.Styles()}
+	a.setResult(result)
+	for _, s := range result.Styles {
+		a.printf("%s\n", s.Name)
+		if s.Prompt != "" {
+			a.printf("  prompt:          %s\n", s.Prompt)
+		}
+		if s.NegativePrompt != "" {
+			a.printf("  negative prompt: %s\n", s.NegativePrompt)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drawthings_go/drawthingstest"
+)
+
+func TestGenerate_Style(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+	dir := t.TempDir()
+	styleFile := filepath.Join(dir, "house.json")
+	if err := os.WriteFile(styleFile, []byte(`[
+		{"name": "cinematic", "prompt": "cinematic still of {prompt}", "negative_prompt": "cartoon", "steps": 30, "guidance_scale": 6},
+		{"name": "film-grain", "prompt": "film grain"}
+	]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(args ...string) (string, int) {
+		var stdout, stderr bytes.Buffer
+		a := newApp(strings.NewReader(""), &stdout, &stderr)
+		a.getenv = func(string) string { return "" }
+		code := a.execute(append([]string{"generate", "-base-url", server.URL, "-style-file", styleFile,
+			"-output", filepath.Join(dir, "out.png"), "-width", "64", "-height", "64"}, args...))
+		return stderr.String(), code
+	}
+	type sent struct {
+		Prompt         string  `json:"prompt"`
+		NegativePrompt string  `json:"negative_prompt"`
+		Steps          int     `json:"steps"`
+		GuidanceScale  float64 `json:"guidance_scale"`
+	}
+	last := func() sent {
+		requests := server.RequestsTo(drawthingstest.PathTxt2Img)
+		var s sent
+		requests[len(requests)-1].Decode(&s)
+		return s
+	}
+
+	if stderr, code := run("-prompt", "a fox", "-style", "cinematic,film-grain"); code != exitOK {
+		t.Fatalf("exit code %d, stderr: %s", code, stderr)
+	}
+	want := sent{Prompt: "cinematic still of a fox, film grain", NegativePrompt: "cartoon", Steps: 30, GuidanceScale: 6}
+	if got := last(); got != want {
+		t.Errorf("sent %+v, want %+v", got, want)
+	}
+
+	// Flags given on the command line win over the styles.
+	if stderr, code := run("-prompt", "a fox", "-style", "cinematic", "-steps", "12", "-negative-prompt", "blurry"); code != exitOK {
+		t.Fatalf("exit code %d, stderr: %s", code, stderr)
+	}
+	want = sent{Prompt: "cinematic still of a fox", NegativePrompt: "blurry, cartoon", Steps: 12, GuidanceScale: 6}
+	if got := last(); got != want {
+		t.Errorf("sent %+v, want %+v", got, want)
+	}
+
+	// So do flags set to their default values.
+	if stderr, code := run("-prompt", "a fox", "-style", "cinematic", "-steps", "20", "-guidance-scale", "4"); code != exitOK {
+		t.Fatalf("exit code %d, stderr: %s", code, stderr)
+	}
+	want = sent{Prompt: "cinematic still of a fox", NegativePrompt: "cartoon", Steps: 20, GuidanceScale: 4}
+	if got := last(); got != want {
+		t.Errorf("sent %+v, want %+v", got, want)
+	}
+
+	if stderr, code := run("-prompt", "a fox", "-style", "noir"); code != exitUsage || !strings.Contains(stderr, `unknown style "noir"`) {
+		t.Errorf("unknown style: exit code %d, stderr %q", code, stderr)
+	}
+}
+
+func TestStyles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "styles.csv"), []byte("name,prompt,negative_prompt\nWatercolor,\"watercolor of {prompt}\",photo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	a := newApp(strings.NewReader(""), &stdout, &stderr)
+	a.getenv = func(string) string { return "" }
+	code := a.execute([]string{"styles", "-output-format", "json", "-config", filepath.Join(dir, "config.json")})
+	if code != exitOK {
+		t.Fatalf("exit code %d, stderr: %s", code, stderr.String())
+	}
+	var doc struct {
+		Result stylesResult `json:"result"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON output %q: %v", stdout.String(), err)
+	}
+	if len(doc.Result.Styles) != 1 || doc.Result.Styles[0].Name != "Watercolor" || doc.Result.Styles[0].NegativePrompt != "photo" {
+		t.Errorf("unexpected result: %+v", doc.Result)
+	}
+}
+
+func TestBatchAndQueue_Style(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+	dir := t.TempDir()
+	styleFile := filepath.Join(dir, "house.json")
+	if err := os.WriteFile(styleFile, []byte(`{"name": "cinematic", "steps": 30, "guidance_scale": 6, "width": 128}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jobs := filepath.Join(dir, "jobs.jsonl")
+	if err := os.WriteFile(jobs, []byte(`{"id": "set", "prompt": "a fox", "steps": 20, "width": 64, "height": 64}
+{"id": "unset", "prompt": "a fox", "height": 64}
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	type sent struct {
+		Steps         int     `json:"steps"`
+		GuidanceScale float64 `json:"guidance_scale"`
+		Width         int     `json:"width"`
+	}
+	sentBy := func() map[string]sent {
+		got := make(map[string]sent)
+		for _, r := range server.RequestsTo(drawthingstest.PathTxt2Img) {
+			var s sent
+			r.Decode(&s)
+			// Only the job named "set" asks for a width of 64.
+			id := "unset"
+			if s.Width == 64 {
+				id = "set"
+			}
+			got[id] = s
+		}
+		return got
+	}
+
+	styled := []string{"-style", "cinematic", "-style-file", styleFile, "-guidance-scale", "4"}
+	tests := []struct {
+		name    string
+		command []string
+		want    map[string]sent
+	}{
+		{
+			// Job fields win, even at their default values; the style fills
+			// the rest, except for parameters set by flags.
+			name:    "batch",
+			command: append([]string{"batch", "-output-dir", filepath.Join(dir, "batch")}, append(styled, jobs)...),
+			want: map[string]sent{
+				"set":   {Steps: 20, GuidanceScale: 4, Width: 64},
+				"unset": {Steps: 30, GuidanceScale: 4, Width: 128},
+			},
+		},
+		{
+			name:    "queue",
+			command: append([]string{"queue", "add", "-queue-file", filepath.Join(dir, "queue"), "-file", jobs}, styled...),
+			want: map[string]sent{
+				"set":   {Steps: 20, GuidanceScale: 4, Width: 64},
+				"unset": {Steps: 30, GuidanceScale: 4, Width: 128},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.Reset()
+			var stdout, stderr bytes.Buffer
+			a := newApp(strings.NewReader(""), &stdout, &stderr)
+			a.getenv = func(string) string { return "" }
+			if code := a.execute(append([]string{"-base-url", server.URL}, tt.command...)); code != exitOK {
+				t.Fatalf("exit code %d, stderr: %s", code, stderr.String())
+			}
+			if tt.name == "queue" {
+				a = newApp(strings.NewReader(""), &stdout, &stderr)
+				a.getenv = func(string) string { return "" }
+				code := a.execute([]string{"queue", "run", "-base-url", server.URL, "-queue-file", filepath.Join(dir, "queue"),
+					"-output-dir", filepath.Join(dir, "queued")})
+				if code != exitOK {
+					t.Fatalf("queue run: exit code %d, stderr: %s", code, stderr.String())
+				}
+			}
+			got := sentBy()
+			for id, want := range tt.want {
+				if got[id] != want {
+					t.Errorf("job %s sent %+v, want %+v", id, got[id], want)
+				}
+			}
+		})
+	}
+}
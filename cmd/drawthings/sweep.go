@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	"github.com/drawthings_go"
+	"github.com/drawthings_go/internal/fsutil"
+	"github.com/drawthings_go/sweep"
+)
+
+// runSweep implements the "sweep" command.
+func runSweep(a *app, args []string) error {
+	fs := a.newFlagSet("sweep")
+	var params requestOptions
+	params.register(fs)
+	var (
+		prompt   = fs.String("prompt", "", "Textual description of the desired image (required)")
+		xSpec    = fs.String("x", "", "X axis as field=values, e.g. steps=10,20,30 or guidance-scale=3..7:2")
+		ySpec    = fs.String("y", "", "Y axis as field=values")
+		zSpec    = fs.String("z", "", "Z axis as field=values; each value gets its own sub-grid")
+		output   = fs.String("output", "grid.png", "Output file path for the grid image")
+		cellsDir = fs.String("cells-dir", "", "Directory to also save every cell image to")
+	)
+	defaultUsage := fs.Usage
+	fs.Usage = func() {
+		defaultUsage()
+		fmt.Fprintf(a.stderr, "\nAxes accept any request field by JSON or flag name. The special field\n")
+		fmt.Fprintf(a.stderr, "prompt-sr replaces the first value in the prompt with each value in turn.\n")
+		fmt.Fprintf(a.stderr, "\nExamples:\n")
+		fmt.Fprintf(a.stderr, "  drawthings sweep -prompt \"a fox\" -x steps=10,20,30 -y guidance-scale=3,5,7\n")
+		fmt.Fprintf(a.stderr, "  drawthings sweep -prompt \"a red fox\" -x prompt-sr=red,blue,green -seed 42\n")
+	}
+
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *prompt == "" {
+		fs.Usage()
+		return usageErrorf("prompt is required")
+	}
+	if *xSpec == "" && *ySpec == "" && *zSpec == "" {
+		fs.Usage()
+		return usageErrorf("at least one axis is required")
+	}
+
+	base, err := a.styledRequest(&params, *prompt)
+	if err != nil {
+		return err
+	}
+	s := &sweep.Sweep{Base: *base}
+	for _, axis := range []struct {
+		spec string
+		dst  *sweep.Axis
+	}{{*xSpec, &s.X}, {*ySpec, &s.Y}, {*zSpec, &s.Z}} {
+		if axis.spec == "" {
+			continue
+		}
+		parsed, err := sweep.ParseAxis(axis.spec)
+		if err != nil {
+			return usageErrorf("%v", err)
+		}
+		*axis.dst = parsed
+	}
+
+	total := s.X.Len() * s.Y.Len() * s.Z.Len()
+	done := 0
+	cells, err := s.Run(a.context(), a.newClient(), func(c sweep.Cell) {
+		done++
+		if c.Err != nil {
+			a.printf("[%d/%d] failed: %v\n", done, total, c.Err)
+			return
+		}
+		a.printf("[%d/%d] %s\n", done, total, cellLabel(s, c))
+		if *cellsDir != "" {
+			name := fmt.Sprintf("cell_z%d_y%d_x%d.png", c.Z, c.Y, c.X)
+			if err := writeCell(filepath.Join(*cellsDir, name), c.Data); err != nil {
+				fmt.Fprintf(a.stderr, "Warning: %v\n", err)
+			}
+		}
+	})
+	result := sweepResult{Seed: s.Base.Seed}
+	for _, c := range cells {
+		cr := sweepCell{X: c.X, Y: c.Y, Z: c.Z, Request: c.Request}
+		if c.Err != nil {
+			cr.Error = newErrorInfo(c.Err)
+		}
+		result.Cells = append(result.Cells, cr)
+	}
+	a.setResult(&result)
+	if err != nil {
+		return err
+	}
+	a.printf("Seed: %d\n", s.Base.Seed)
+
+	if err := writeGrid(*output, s, cells); err != nil {
+		return err
+	}
+	result.Output = *output
+	a.printf("Grid saved to: %s\n", *output)
+	return nil
+}
+
+// sweepResult is the JSON result of the sweep command.
+type sweepResult struct {
+	Output string      `json:"output,omitempty"`
+	Seed   int         `json:"seed"`
+	Cells  []sweepCell `json:"cells"`
+}
+
+// sweepCell describes one cell of a sweep in the JSON result.
+type sweepCell struct {
+	X       int                           `json:"x"`
+	Y       int                           `json:"y"`
+	Z       int                           `json:"z"`
+	Request drawthings.TextToImageRequest `json:"request"`
+	Error   *errorInfo                    `json:"error,omitempty"`
+}
+
+// cellLabel describes the axis values of a cell.
+func cellLabel(s *sweep.Sweep, c sweep.Cell) string {
+	label := ""
+	for _, part := range []string{s.X.Label(c.X), s.Y.Label(c.Y), s.Z.Label(c.Z)} {
+		if part == "" {
+			continue
+		}
+		if label != "" {
+			label += ", "
+		}
+		label += part
+	}
+	return label
+}
+
+// writeGrid composes the sweep grid and saves it as a PNG file.
+func writeGrid(path string, s *sweep.Sweep, cells []sweep.Cell) error {
+	if dir := filepath.Dir(path); dir != "." && dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return drawthings.NewStorageError("failed to create output directory", err)
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return drawthings.NewStorageError("failed to create grid file", err)
+	}
+	if err := png.Encode(f, s.Grid(cells)); err != nil {
+		f.Close()
+		return drawthings.NewStorageError("failed to encode grid image", err)
+	}
+	return f.Close()
+}
+
+// writeCell saves the encoded image of a single cell.
+func writeCell(path string, data []byte) error {
+	if err := fsutil.WriteFile(path, data); err != nil {
+		return drawthings.NewStorageError("failed to write cell image", err)
+	}
+	return nil
+}
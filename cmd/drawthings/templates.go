@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/drawthings_go/prompt"
+)
+
+// templateOptions holds the prompt template flags.
+type templateOptions struct {
+	promptTemplate string
+	vars           string
+	wildcardDir    string
+	templateSeed   int64
+}
+
+// register adds the prompt template flags to fs.
+func (o *templateOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.promptTemplate, "prompt-template", "", "Expand prompts as templates, using this one when no prompt is given")
+	fs.StringVar(&o.vars, "vars", "", "Prompt template variables as name=value pairs, e.g. color=red,product=mug")
+	fs.StringVar(&o.wildcardDir, "wildcard-dir", "wildcards", "Directory of word lists for __name__ wildcards")
+	fs.Int64Var(&o.templateSeed, "template-seed", 0, "Seed for random choices in prompt templates")
+}
+
+// enabled reports whether prompts are templates.
+func (o *templateOptions) enabled() bool {
+	return o.promptTemplate != "" || o.vars != ""
+}
+
+// renderer returns the renderer for the template flags.
+func (o *templateOptions) renderer() (*prompt.Renderer, error) {
+	vars, err := prompt.ParseVars(o.vars)
+	if err != nil {
+		return nil, usageErrorf("invalid -vars: %v", err)
+	}
+	return prompt.NewRenderer(prompt.WithVars(vars), prompt.WithWildcardDir(o.wildcardDir)), nil
+}
+
+// expand renders text, or the prompt template if text is empty, when
+// templates are enabled, and returns text unchanged otherwise. Choices
+// depend only on -template-seed, so the same flags give the same prompt.
+func (o *templateOptions) expand(text string) (string, error) {
+	if !o.enabled() {
+		return text, nil
+	}
+	if text == "" {
+		text = o.promptTemplate
+	}
+	r, err := o.renderer()
+	if err != nil {
+		return "", err
+	}
+	expanded, err := r.Expand(text, o.templateSeed, nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot expand prompt template: %w", err)
+	}
+	return expanded, nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	// Register the decoders for source images.
+	_ "image/jpeg"
+
+	"github.com/drawthings_go"
+	"github.com/drawthings_go/internal/fsutil"
+	"github.com/drawthings_go/tile"
+)
+
+// tileOptions holds the flags of the tile command.
+type tileOptions struct {
+	requestOptions
+	prompt            string
+	denoisingStrength float64
+	scale             float64
+	tileSize          int
+	overlap           int
+	tilePrompts       string
+	workDir           string
+	keepTiles         bool
+	plan              bool
+	output            string
+}
+
+// register adds the tile flags to fs. The size flags of requestOptions are
+// left out, since every tile sets its own.
+func (o *tileOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.prompt, "prompt", "", "Textual description of the image (required)")
+	fs.StringVar(&o.negativePrompt, "negative-prompt", "", "Descriptions of elements to exclude from the image")
+	fs.IntVar(&o.steps, "steps", 20, "Number of inference steps (1-150, default: 20)")
+	fs.Float64Var(&o.guidanceScale, "guidance-scale", 4.0, "Controls adherence to the prompt (1.0-20.0, default: 4.0)")
+	fs.IntVar(&o.seed, "seed", -1, "Random seed shared by all tiles (-1 for random, default: -1)")
+	fs.StringVar(&o.style, "style", "", "Comma-separated style presets to apply in order, such as cinematic,film-grain")
+	fs.StringVar(&o.styleFile, "style-file", "", "Style file or directory (default: styles.json, styles.csv and styles/ next to the config file)")
+	fs.Float64Var(&o.denoisingStrength, "denoising-strength", 0.35, "How far each tile may move away from the source (0-1, default: 0.35)")
+	fs.Float64Var(&o.scale, "scale", tile.DefaultScale, "Factor to scale the source image by (default: 2)")
+	fs.IntVar(&o.tileSize, "tile-size", tile.DefaultSize, fmt.Sprintf("Largest tile width and height in pixels (%d-%d, default: %d)", drawthings.MinDimension, drawthings.MaxDimension, tile.DefaultSize))
+	fs.IntVar(&o.overlap, "overlap", tile.DefaultOverlap, "Pixels neighboring tiles share, blended across the seam (default: 128)")
+	fs.StringVar(&o.tilePrompts, "tile-prompts", "", "File of row,col=prompt lines overriding the prompt of single tiles")
+	fs.StringVar(&o.workDir, "work-dir", "", "Directory to keep finished tiles in for resuming (default: the output path with .tiles)")
+	fs.BoolVar(&o.keepTiles, "keep-tiles", false, "Keep the work directory after the image is saved")
+	fs.BoolVar(&o.plan, "plan", false, "Print the tile grid without generating anything")
+	fs.StringVar(&o.output, "output", "tiled.png", "Output file path for the image")
+}
+
+// tileResult is the JSON result of the tile command.
+type tileResult struct {
+	Output  string      `json:"output,omitempty"`
+	Seed    int         `json:"seed,omitempty"`
+	Width   int         `json:"width"`
+	Height  int         `json:"height"`
+	Tiles   []tile.Tile `json:"tiles"`
+	Resumed int         `json:"resumed"`
+}
+
+// runTile implements the "tile" command.
+func runTile(a *app, args []string) error {
+	fs := a.newFlagSet("tile")
+	var opts tileOptions
+	opts.register(fs)
+	defaultUsage := fs.Usage
+	fs.Usage = func() {
+		defaultUsage()
+		fmt.Fprintf(a.stderr, "\nThe source image is scaled and refined in overlapping tiles no larger than\n")
+		fmt.Fprintf(a.stderr, "-tile-size, so the output may exceed what the server renders at once. An\n")
+		fmt.Fprintf(a.stderr, "interrupted run resumes from its work directory when run again.\n")
+		fmt.Fprintf(a.stderr, "\nExamples:\n")
+		fmt.Fprintf(a.stderr, "  drawthings tile -prompt \"a castle on a hill\" -scale 4 -output castle-4x.png castle.png\n")
+		fmt.Fprintf(a.stderr, "  drawthings tile -prompt \"a castle\" -tile-size 768 -plan castle.png\n")
+	}
+
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return usageErrorf("tile takes exactly one source image")
+	}
+	src, err := readImage(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	prompts, err := readTilePrompts(opts.tilePrompts)
+	if err != nil {
+		return err
+	}
+
+	workDir := opts.workDir
+	if workDir == "" {
+		workDir = strings.TrimSuffix(opts.output, filepath.Ext(opts.output)) + ".tiles"
+	}
+	chosen, err := a.styles(&opts.requestOptions)
+	if err != nil {
+		return err
+	}
+	styled := func(prompt string) *drawthings.TextToImageRequest {
+		req := opts.request(prompt)
+		a.applyStyles(req, chosen)
+		return req
+	}
+	req := drawthings.ImageToImageRequest{
+		TextToImageRequest: *styled(opts.prompt),
+		DenoisingStrength:  opts.denoisingStrength,
+	}
+
+	runner := tile.NewRunner(a.newClient(),
+		tile.WithScale(opts.scale),
+		tile.WithTileSize(opts.tileSize),
+		tile.WithOverlap(opts.overlap),
+		tile.WithWorkDir(workDir),
+		tile.WithTilePrompt(func(t tile.Tile) string {
+			if p, ok := prompts[[2]int{t.Row, t.Col}]; ok {
+				return styled(p).Prompt
+			}
+			return ""
+		}),
+		tile.WithProgress(func(p tile.Progress) {
+			if p.Resumed {
+				a.printf("[%d/%d] tile %d,%d resumed\n", p.Done, p.Total, p.Tile.Row, p.Tile.Col)
+				return
+			}
+			a.printf("[%d/%d] tile %d,%d done in %s\n", p.Done, p.Total, p.Tile.Row, p.Tile.Col, p.Duration.Round(time.Millisecond))
+		}),
+	)
+
+	b := src.Bounds()
+	tiles, err := runner.Plan(b.Dx(), b.Dy())
+	if err != nil {
+		return err
+	}
+	rows, cols := tiles[len(tiles)-1].Row+1, tiles[len(tiles)-1].Col+1
+	last := tiles[len(tiles)-1].Rect.Max
+	result := tileResult{Width: last.X, Height: last.Y, Tiles: tiles}
+	a.printf("Tiling %dx%d into %d tile(s) (%d rows, %d columns) for a %dx%d image\n",
+		b.Dx(), b.Dy(), len(tiles), rows, cols, last.X, last.Y)
+	if opts.plan {
+		for _, t := range tiles {
+			a.printf("  %d,%d  %v\n", t.Row, t.Col, t.Rect)
+		}
+		a.setResult(&result)
+		return nil
+	}
+	if req.Prompt == "" {
+		fs.Usage()
+		return usageErrorf("prompt is required")
+	}
+
+	res, err := runner.Run(a.context(), src, req)
+	if err != nil {
+		a.setResult(&result)
+		if _, statErr := os.Stat(workDir); statErr == nil && !errors.Is(err, tile.ErrPlanMismatch) {
+			fmt.Fprintf(a.stderr, "Finished tiles are kept in %s; run the same command again to resume\n", workDir)
+		}
+		return fmt.Errorf("failed to generate tiles: %w", err)
+	}
+	result.Seed, result.Resumed = res.Seed, res.Resumed
+	a.setResult(&result)
+	a.printf("Seed: %d\n", res.Seed)
+
+	if err := writePNG(opts.output, res.Image); err != nil {
+		return err
+	}
+	result.Output = opts.output
+	a.printf("Image saved to: %s\n", opts.output)
+	if !opts.keepTiles {
+		if err := os.RemoveAll(workDir); err != nil {
+			fmt.Fprintf(a.stderr, "Warning: failed to remove %s: %v\n", workDir, err)
+		}
+	}
+	return nil
+}
+
+// readImage decodes the PNG or JPEG image at path.
+func readImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, usageErrorf("cannot open source image: %v", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, usageErrorf("cannot decode source image %s: %v", path, err)
+	}
+	return img, nil
+}
+
+// readTilePrompts reads the row,col=prompt lines of the file at path. Blank
+// lines and lines starting with # are skipped.
+func readTilePrompts(path string) (map[[2]int]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, usageErrorf("cannot open tile prompts: %v", err)
+	}
+	defer f.Close()
+	return parseTilePrompts(f, path)
+}
+
+// parseTilePrompts parses row,col=prompt lines from r.
+func parseTilePrompts(r io.Reader, name string) (map[[2]int]string, error) {
+	prompts := make(map[[2]int]string)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pos, prompt, ok := strings.Cut(line, "=")
+		rowText, colText, ok2 := strings.Cut(pos, ",")
+		row, err1 := strconv.Atoi(strings.TrimSpace(rowText))
+		col, err2 := strconv.Atoi(strings.TrimSpace(colText))
+		if !ok || !ok2 || err1 != nil || err2 != nil || row < 0 || col < 0 {
+			return nil, usageErrorf("%s:%d: want row,col=prompt, got %q", name, n, line)
+		}
+		prompts[[2]int{row, col}] = strings.TrimSpace(prompt)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, usageErrorf("cannot read tile prompts: %v", err)
+	}
+	return prompts, nil
+}
+
+// writePNG saves img as a PNG file, creating parent directories.
+func writePNG(path string, img image.Image) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return drawthings.NewStorageError("failed to encode image", err)
+	}
+	if err := fsutil.WriteFile(path, buf.Bytes()); err != nil {
+		return drawthings.NewStorageError("failed to write image file", err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drawthings_go/drawthingstest"
+)
+
+func TestTile(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+	dir := t.TempDir()
+
+	source := filepath.Join(dir, "source.png")
+	if err := os.WriteFile(source, drawthingstest.Image("a castle", 1, 96, 64), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prompts := filepath.Join(dir, "prompts.txt")
+	if err := os.WriteFile(prompts, []byte("# the tower\n0,1 = a tall tower\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "out.png")
+
+	run := func(args ...string) (string, string, int) {
+		var stdout, stderr bytes.Buffer
+		a := newApp(strings.NewReader(""), &stdout, &stderr)
+		a.getenv = func(string) string { return "" }
+		code := a.execute(append([]string{"tile", "-base-url", server.URL, "-output", output,
+			"-scale", "2", "-tile-size", "128", "-overlap", "32"}, args...))
+		return stdout.String(), stderr.String(), code
+	}
+
+	stdout, stderr, code := run("-plan", "-output-format", "json", source)
+	if code != exitOK {
+		t.Fatalf("-plan: exit code %d, stderr: %s", code, stderr)
+	}
+	var doc struct {
+		Result tileResult `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &doc); err != nil {
+		t.Fatalf("invalid JSON output %q: %v", stdout, err)
+	}
+	if doc.Result.Width != 192 || doc.Result.Height != 128 || len(doc.Result.Tiles) != 2 {
+		t.Errorf("unexpected plan: %+v", doc.Result)
+	}
+	if n := len(server.Requests()); n != 0 {
+		t.Errorf("-plan sent %d requests", n)
+	}
+
+	stdout, stderr, code = run("-prompt", "a castle", "-seed", "5", "-tile-prompts", prompts, source)
+	if code != exitOK {
+		t.Fatalf("exit code %d, stderr: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "[2/2] tile 0,1 done") || !strings.Contains(stdout, "Image saved to: "+output) {
+		t.Errorf("unexpected output: %s", stdout)
+	}
+	var sent []string
+	for _, r := range server.RequestsTo(drawthingstest.PathImg2Img) {
+		var body struct {
+			Prompt string `json:"prompt"`
+		}
+		r.Decode(&body)
+		sent = append(sent, body.Prompt)
+	}
+	if strings.Join(sent, "|") != "a castle|a tall tower" {
+		t.Errorf("sent prompts %q", sent)
+	}
+
+	f, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(f)
+	f.Close()
+	if err != nil || img.Bounds() != image.Rect(0, 0, 192, 128) {
+		t.Errorf("output image: %v, %v", err, img)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out.tiles")); !os.IsNotExist(err) {
+		t.Errorf("work directory was not removed: %v", err)
+	}
+
+	if _, stderr, code = run("-prompt", "a castle", "-tile-size", "8192", source); code != exitValidation {
+		t.Errorf("tile too large: exit code %d, want %d; stderr %s", code, exitValidation, stderr)
+	}
+	if _, _, code = run("-prompt", "a castle"); code != exitUsage {
+		t.Errorf("no source image: exit code %d, want %d", code, exitUsage)
+	}
+}
+
+func TestParseTilePrompts(t *testing.T) {
+	prompts, err := parseTilePrompts(strings.NewReader("0,0=sky\n\n# comment\n 1, 2 = a red door = open\n"), "p.txt")
+	if err != nil {
+		t.Fatalf("parseTilePrompts() error = %v", err)
+	}
+	if len(prompts) != 2 || prompts[[2]int{0, 0}] != "sky" || prompts[[2]int{1, 2}] != "a red door = open" {
+		t.Errorf("parseTilePrompts() = %v", prompts)
+	}
+
+	for _, bad := range []string{"sky", "0=sky", "a,b=sky", "-1,0=sky"} {
+		if _, err := parseTilePrompts(strings.NewReader(bad), "p.txt"); err == nil || !strings.Contains(err.Error(), "p.txt:1") {
+			t.Errorf("parseTilePrompts(%q) error = %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/drawthings_go"
+	"github.com/drawthings_go/prompt"
+)
+
+// tokenizer returns the CLIP tokenizer selected by the global options.
+func (a *app) tokenizer() (*prompt.Tokenizer, error) {
+	if a.globals.clipVocab != "" {
+		return prompt.LoadTokenizer(a.globals.clipVocab)
+	}
+	tok, err := prompt.DefaultTokenizer()
+	if err != nil {
+		return nil, fmt.Errorf("%w; set -clip-vocab to a copy of bpe_simple_vocab_16e6.txt.gz", err)
+	}
+	return tok, nil
+}
+
+// tokensResult is the JSON result of the tokens command.
+type tokensResult struct {
+	Limit          int           `json:"limit"`
+	Prompt         promptTokens  `json:"prompt"`
+	NegativePrompt *promptTokens `json:"negative_prompt,omitempty"`
+}
+
+// promptTokens describes the tokens of one prompt.
+type promptTokens struct {
+	Text   string         `json:"text"`
+	Count  int            `json:"count"`
+	Chunks []prompt.Chunk `json:"chunks"`
+}
+
+// runTokens implements the "tokens" command.
+func runTokens(a *app, args []string) error {
+	fs := a.newFlagSet("tokens")
+	var (
+		negative   = fs.String("negative-prompt", "", "Negative prompt to count as well")
+		showTokens = fs.Bool("show-tokens", false, "List every token with its vocabulary ID")
+	)
+	defaultUsage := fs.Usage
+	fs.Usage = func() {
+		defaultUsage()
+		fmt.Fprintf(a.stderr, "\nCLIP encodes prompts %d tokens at a time; servers truncate longer prompts\n", prompt.ChunkSize)
+		fmt.Fprintf(a.stderr, "or split them into chunks. Weighting syntax and LoRA tags are not counted.\n")
+		fmt.Fprintf(a.stderr, "Prompts over -max-tokens (default %d) cause a warning, or an error with -strict.\n", prompt.ChunkSize)
+	}
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return usageErrorf("a prompt is required")
+	}
+
+	tok, err := a.tokenizer()
+	if err != nil {
+		return err
+	}
+	limit := a.globals.maxTokens
+	if limit <= 0 {
+		limit = prompt.ChunkSize
+	}
+	req := drawthings.TextToImageRequest{Prompt: strings.Join(fs.Args(), " "), NegativePrompt: *negative}
+	result := tokensResult{Limit: limit, Prompt: countTokens(tok, req.Prompt)}
+	if req.NegativePrompt != "" {
+		n := countTokens(tok, req.NegativePrompt)
+		result.NegativePrompt = &n
+	}
+	a.setResult(result)
+
+	a.printTokens("Prompt", result.Prompt, limit, *showTokens)
+	if result.NegativePrompt != nil {
+		a.printTokens("Negative prompt", *result.NegativePrompt, limit, *showTokens)
+	}
+
+	if err := req.ValidateTokens(tok, limit); err != nil {
+		if a.globals.strict {
+			return err
+		}
+		fmt.Fprintf(a.stderr, "Warning: %v\n", err)
+	}
+	return nil
+}
+
+// countTokens tokenizes text into chunks.
+func countTokens(tok *prompt.Tokenizer, text string) promptTokens {
+	chunks := tok.Chunks(text)
+	if chunks == nil {
+		chunks = []prompt.Chunk{}
+	}
+	n := 0
+	for _, chunk := range chunks {
+		n += len(chunk.Tokens)
+	}
+	return promptTokens{Text: text, Count: n, Chunks: chunks}
+}
+
+// printTokens prints the token count and chunks of a prompt.
+func (a *app) printTokens(label string, p promptTokens, limit int, showTokens bool) {
+	a.printf("%s: %d tokens (limit %d) in %d chunk(s)\n", label, p.Count, limit, len(p.Chunks))
+	for i, chunk := range p.Chunks {
+		a.printf("  Chunk %d: %d tokens, offsets %d-%d: %q\n", i+1, len(chunk.Tokens), chunk.Start, chunk.End, p.Text[chunk.Start:chunk.End])
+		if !showTokens {
+			continue
+		}
+		for _, token := range chunk.Tokens {
+			a.printf("    %6d  %q\n", token.ID, token.Text)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTokens(t *testing.T) {
+	run := func(args ...string) (string, string, int) {
+		var stdout, stderr bytes.Buffer
+		a := newApp(strings.NewReader(""), &stdout, &stderr)
+		a.getenv = func(string) string { return "" }
+		code := a.execute(append([]string{"tokens", "-clip-vocab", "../../prompt/testdata/merges.txt"}, args...))
+		return stdout.String(), stderr.String(), code
+	}
+
+	stdout, stderr, code := run("-output-format", "json", "-max-tokens", "3", "-negative-prompt", "cat", "(hello:1.2)", "red")
+	if code != exitOK {
+		t.Fatalf("exit code %d, stderr: %s", code, stderr)
+	}
+	var doc struct {
+		Result tokensResult `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &doc); err != nil {
+		t.Fatalf("invalid JSON output %q: %v", stdout, err)
+	}
+	if doc.Result.Limit != 3 || doc.Result.Prompt.Count != 2 || doc.Result.NegativePrompt == nil || doc.Result.NegativePrompt.Count != 3 {
+		t.Errorf("unexpected result: %+v", doc.Result)
+	}
+	if strings.Contains(stderr, "Warning") {
+		t.Errorf("unexpected warning: %s", stderr)
+	}
+
+	stdout, stderr, code = run("-max-tokens", "2", strings.Repeat("red ", 3))
+	if code != exitOK || !strings.Contains(stdout, "Prompt: 3 tokens (limit 2) in 1 chunk(s)") || !strings.Contains(stderr, "Warning: ") {
+		t.Errorf("over the limit: exit code %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	if _, _, code = run("-max-tokens", "2", "-strict", strings.Repeat("red ", 3)); code != exitValidation {
+		t.Errorf("over the limit with -strict: exit code %d, want %d", code, exitValidation)
+	}
+	if _, _, code = run(); code != exitUsage {
+		t.Errorf("no prompt: exit code %d, want %d", code, exitUsage)
+	}
+}
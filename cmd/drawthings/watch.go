@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drawthings_go"
+)
+
+// runWatch implements the "watch" command.
+func runWatch(a *app, args []string) error {
+	fs := a.newFlagSet("watch")
+	var params requestOptions
+	params.register(fs)
+	var (
+		output   = fs.String("output", "output.png", "Output file path for the generated image")
+		interval = fs.Duration("interval", 500*time.Millisecond, "How often to check the request file for changes")
+		debounce = fs.Duration("debounce", 300*time.Millisecond, "Quiet period after a change before regenerating")
+	)
+	defaultUsage := fs.Usage
+	fs.Usage = func() {
+		defaultUsage()
+		fmt.Fprintf(a.stderr, "\nThe request file is YAML (key: value pairs), JSON (.json) or plain text\n")
+		fmt.Fprintf(a.stderr, "(.txt, the prompt only). Keys use the API names: prompt, negative_prompt,\n")
+		fmt.Fprintf(a.stderr, "steps, guidance_scale, width, height, seed. Flags provide defaults for keys\n")
+		fmt.Fprintf(a.stderr, "the file leaves out. Press Ctrl-C to stop.\n")
+	}
+
+	if err := a.parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return usageErrorf("exactly one request file is required")
+	}
+	if *interval <= 0 {
+		return usageErrorf("-interval must be positive")
+	}
+	path := fs.Arg(0)
+
+	chosen, err := a.styles(&params)
+	if err != nil {
+		return err
+	}
+	ctx := a.context()
+	client := a.newClient()
+	changes := watchFile(ctx, path, *interval)
+
+	type outcome struct {
+		gen      int
+		err      error
+		duration time.Duration
+	}
+	var (
+		gen       int
+		renders   int
+		cancelGen context.CancelFunc = func() {}
+		results                      = make(chan outcome, 1)
+	)
+	start := func() {
+		req, err := readRequestFile(path, &drawthings.TextToImageRequest{})
+		if err != nil {
+			a.printf("Error: %v\n", err)
+			return
+		}
+		a.applyFileStyles(req, &params, chosen)
+
+		cancelGen()
+		gen++
+		genCtx, cancel := context.WithCancel(ctx)
+		cancelGen = cancel
+		a.printf("[%s] generating %q (steps=%d, seed=%d)\n", time.Now().Format("15:04:05"), req.Prompt, req.Steps, req.Seed)
+
+		go func(gen int) {
+			started := time.Now()
+			err := client.GenerateImageAndSave(genCtx, req, *output)
+			results <- outcome{gen: gen, err: err, duration: time.Since(started)}
+		}(gen)
+	}
+
+	defer func() { a.setResult(watchResult{Output: *output, Renders: renders}) }()
+
+	a.printf("Watching %s (Ctrl-C to stop)\n", path)
+	start()
+
+	debounceTimer := time.NewTimer(time.Hour)
+	debounceTimer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			cancelGen()
+			return nil
+
+		case <-changes:
+			debounceTimer.Reset(*debounce)
+
+		case <-debounceTimer.C:
+			a.printf("[%s] %s changed\n", time.Now().Format("15:04:05"), path)
+			start()
+
+		case res := <-results:
+			if res.gen != gen {
+				// Superseded by a newer generation.
+				continue
+			}
+			switch {
+			case res.err == nil:
+				renders++
+				a.printf("[%s] saved %s in %s\n", time.Now().Format("15:04:05"), *output, res.duration.Round(time.Millisecond))
+			case errors.Is(res.err, context.Canceled):
+			default:
+				a.printf("Error: %v\n", res.err)
+			}
+		}
+	}
+}
+
+// watchResult is the JSON result of the watch command.
+type watchResult struct {
+	Output  string `json:"output"`
+	Renders int    `json:"renders"`
+}
+
+// watchFile polls path every interval and sends on the returned channel
+// whenever its content changes. Touching a file without changing it is not
+// reported. The channel is closed when ctx is done.
+func watchFile(ctx context.Context, path string, interval time.Duration) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+
+	type state struct {
+		modTime time.Time
+		size    int64
+		sum     [sha256.Size]byte
+		exists  bool
+	}
+	snapshot := func(prev state) state {
+		info, err := os.Stat(path)
+		if err != nil {
+			return state{}
+		}
+		cur := state{modTime: info.ModTime(), size: info.Size(), exists: true, sum: prev.sum}
+		if prev.exists && cur.modTime.Equal(prev.modTime) && cur.size == prev.size {
+			return cur
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return state{}
+		}
+		cur.sum = sha256.Sum256(data)
+		return cur
+	}
+
+	go func() {
+		defer close(changes)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last := snapshot(state{})
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			cur := snapshot(last)
+			if cur.exists != last.exists || cur.sum != last.sum {
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+			last = cur
+		}
+	}()
+	return changes
+}
+
+// readRequestFile reads a request from a YAML, JSON or plain text file,
+// starting from defaults.
+func readRequestFile(path string, defaults *drawthings.TextToImageRequest) (*drawthings.TextToImageRequest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request file: %w", err)
+	}
+	req := *defaults
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".txt":
+		req.Prompt = strings.TrimSpace(string(data))
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	default:
+		values, err := parseSimpleYAML(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		for key, value := range values {
+			if err := setRequestField(&req, key, value); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+			}
+		}
+	}
+
+	if req.Prompt == "" {
+		return nil, fmt.Errorf("%s: prompt is required", path)
+	}
+	return &req, nil
+}
+
+// setRequestField sets a request field by its API name. Dashes may be used
+// instead of underscores.
+func setRequestField(req *drawthings.TextToImageRequest, key, value string) error {
+	parseInt := func(dst *int) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not an integer", key, value)
+		}
+		*dst = n
+		return nil
+	}
+
+	switch strings.ReplaceAll(strings.ToLower(key), "-", "_") {
+	case "prompt":
+		req.Prompt = value
+	case "negative_prompt":
+		req.NegativePrompt = value
+	case "steps":
+		return parseInt(&req.Steps)
+	case "width":
+		return parseInt(&req.Width)
+	case "height":
+		return parseInt(&req.Height)
+	case "seed":
+		return parseInt(&req.Seed)
+	case "guidance_scale":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a number", key, value)
+		}
+		req.GuidanceScale = f
+	default:
+		return fmt.Errorf("unknown key %q", key)
+	}
+	return nil
+}
+
+// parseSimpleYAML parses the subset of YAML used by request files: a flat
+// mapping of "key: value" lines with optional quoting, comments, and "|" or
+// ">" block scalars for multi-line values.
+func parseSimpleYAML(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("line %d: unexpected indentation", i+1)
+		}
+
+		key, raw, ok := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", i+1)
+		}
+		if _, dup := values[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", i+1, key)
+		}
+		raw = strings.TrimSpace(raw)
+
+		if raw == "|" || raw == ">" || raw == "|-" || raw == ">-" {
+			var block []string
+			for i+1 < len(lines) {
+				next := lines[i+1]
+				if strings.TrimSpace(next) != "" && next[0] != ' ' && next[0] != '\t' {
+					break
+				}
+				block = append(block, strings.TrimSpace(next))
+				i++
+			}
+			sep := "\n"
+			if raw[0] == '>' {
+				sep = " "
+			}
+			values[key] = strings.TrimSpace(strings.Join(block, sep))
+			continue
+		}
+
+		value, err := yamlScalar(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// yamlScalar decodes a single-line scalar, stripping trailing comments.
+func yamlScalar(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		end := strings.LastIndex(raw, `"`)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated string")
+		}
+		return strconv.Unquote(raw[:end+1])
+	case strings.HasPrefix(raw, "'"):
+		end := strings.LastIndex(raw, "'")
+		if end == 0 {
+			return "", fmt.Errorf("unterminated string")
+		}
+		return strings.ReplaceAll(raw[1:end], "''", "'"), nil
+	}
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = raw[:i]
+	}
+	return strings.TrimSpace(raw), nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drawthings_go"
+)
+
+func TestParseSimpleYAML(t *testing.T) {
+	input := `# request
+prompt: "a red fox, \"snowy\""
+negative_prompt: 'it''s blurry'  # comment
+steps: 30 # more steps
+description: >
+  folded
+  text
+notes: |
+  line one
+  line two
+`
+	values, err := parseSimpleYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("parseSimpleYAML() error = %v", err)
+	}
+
+	want := map[string]string{
+		"prompt":          `a red fox, "snowy"`,
+		"negative_prompt": "it's blurry",
+		"steps":           "30",
+		"description":     "folded text",
+		"notes":           "line one\nline two",
+	}
+	for key, value := range want {
+		if values[key] != value {
+			t.Errorf("%s: got %q, want %q", key, values[key], value)
+		}
+	}
+}
+
+func TestParseSimpleYAML_Errors(t *testing.T) {
+	for _, input := range []string{
+		"prompt",
+		"  prompt: indented",
+		"prompt: a\nprompt: b",
+		`prompt: "unterminated`,
+	} {
+		if _, err := parseSimpleYAML([]byte(input)); err == nil {
+			t.Errorf("parseSimpleYAML(%q): expected error", input)
+		}
+	}
+}
+
+func TestReadRequestFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"request.yaml": "prompt: a fox\nguidance-scale: 6.5\n",
+		"request.json": `{"prompt": "a fox", "guidance_scale": 6.5}`,
+		"request.txt":  "a fox\n",
+	}
+	defaults := &drawthings.TextToImageRequest{Steps: 25, GuidanceScale: 6.5}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		req, err := readRequestFile(path, defaults)
+		if err != nil {
+			t.Fatalf("readRequestFile(%s) error = %v", name, err)
+		}
+		if req.Prompt != "a fox" || req.GuidanceScale != 6.5 || req.Steps != 25 {
+			t.Errorf("readRequestFile(%s) = %+v", name, req)
+		}
+	}
+
+	bad := filepath.Join(dir, "bad.yaml")
+	if err := os.WriteFile(bad, []byte("prompt: x\nsampler: euler\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readRequestFile(bad, defaults); err == nil {
+		t.Error("expected error for unknown key")
+	}
+}
+
+func TestWatch_RegeneratesAndCancels(t *testing.T) {
+	prompts := make(chan string, 10)
+	cancelled := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req drawthings.TextToImageRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		prompts <- req.Prompt
+		if req.Prompt == "slow" {
+			<-r.Context().Done()
+			cancelled <- req.Prompt
+			return
+		}
+		json.NewEncoder(w).Encode(drawthings.TextToImageResponse{
+			Images: []string{base64.StdEncoding.EncodeToString(pngHeader)},
+		})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "prompt.yaml")
+	output := filepath.Join(dir, "out.png")
+	if err := os.WriteFile(path, []byte("prompt: slow\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var stdout bytes.Buffer
+	a := newApp(strings.NewReader(""), &stdout, &bytes.Buffer{})
+	a.getenv = func(string) string { return "" }
+	a.ctx = ctx
+
+	done := make(chan int)
+	go func() {
+		done <- a.execute([]string{"watch", "-base-url", server.URL, "-output", output,
+			"-interval", "10ms", "-debounce", "20ms", path})
+	}()
+
+	expect := func(ch chan string, want string) {
+		t.Helper()
+		select {
+		case got := <-ch:
+			if got != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+
+	expect(prompts, "slow")
+	if err := os.WriteFile(path, []byte("prompt: fast\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expect(prompts, "fast")
+	expect(cancelled, "slow")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(output); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("output was not written")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case code := <-done:
+		if code != exitOK {
+			t.Errorf("exit code: got %d, want %d", code, exitOK)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not stop after cancellation")
+	}
+}
@@ -0,0 +1,117 @@
+package drawthings
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// WithCoalescing makes identical requests that are in flight at the same
+// time share one call to the server. Requests are identical if their
+// parameters match after SetDefaults; requests with a random seed (-1) are
+// never shared. Each caller receives its own copy of the response.
+//
+// The shared call keeps running while any caller is still waiting for it:
+// a caller whose context ends gets a NetworkError wrapping the context's
+// error, and the call is canceled only when every caller has given up.
+func WithCoalescing(enabled bool) Option {
+	return func(c *Client) {
+		if enabled {
+			c.flights = &flightGroup{flights: make(map[string]*flight)}
+		} else {
+			c.flights = nil
+		}
+	}
+}
+
+// flightGroup tracks the requests a Client has in flight.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is one call to the server shared by its waiting callers.
+type flight struct {
+	done    chan struct{}
+	resp    *TextToImageResponse
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+	// link identifies the shared call in the callers' spans.
+	link string
+}
+
+// flightKey returns the key identical requests share, or "" if req must not
+// be shared with other callers.
+func flightKey(req *TextToImageRequest) string {
+	if req.Seed < 0 {
+		return ""
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// do calls fn once for all concurrent callers with the same key and returns
+// a copy of its result. The caller that starts the call creates the context
+// fn runs on with start, which also returns the link identifying the call;
+// it must not depend on the caller's context, since the call is canceled
+// only when every caller's ctx has ended. shared reports whether the caller
+// joined a call already in flight.
+func (g *flightGroup) do(ctx context.Context, key string, start func() (context.Context, string), fn func(context.Context) (*TextToImageResponse, error)) (resp *TextToImageResponse, link string, shared bool, err error) {
+	g.mu.Lock()
+	f, shared := g.flights[key]
+	if !shared {
+		base, link := start()
+		flightCtx, cancel := context.WithCancel(base)
+		f = &flight{done: make(chan struct{}), cancel: cancel, link: link}
+		g.flights[key] = f
+		go func() {
+			f.resp, f.err = fn(flightCtx)
+			g.forget(key, f)
+			cancel()
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return copyResponse(f.resp), f.link, shared, f.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			// Nobody is left to receive the result.
+			f.cancel()
+			if g.flights[key] == f {
+				delete(g.flights, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, f.link, shared, NewNetworkError("gave up waiting for an identical request in flight", ctx.Err())
+	}
+}
+
+// forget removes a finished flight, so later requests are sent again.
+func (g *flightGroup) forget(key string, f *flight) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+}
+
+// copyResponse returns a copy of resp that shares no memory with it.
+func copyResponse(resp *TextToImageResponse) *TextToImageResponse {
+	if resp == nil {
+		return nil
+	}
+	cp := *resp
+	cp.Images = append([]string(nil), resp.Images...)
+	cp.Parameters = append(json.RawMessage(nil), resp.Parameters...)
+	return &cp
+}
@@ -0,0 +1,190 @@
+package drawthings
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drawthings_go/drawthingstest"
+)
+
+// waitForRenders waits until server has received n txt2img requests.
+func waitForRenders(t *testing.T, server *drawthingstest.Server, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(server.RequestsTo(drawthingstest.PathTxt2Img)) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d renders", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWithCoalescing(t *testing.T) {
+	server := drawthingstest.NewServer(drawthingstest.WithLatency(200 * time.Millisecond))
+	defer server.Close()
+
+	rec := NewSpanRecorder()
+	client := NewClient(WithBaseURL(server.URL), WithCoalescing(true), WithTracer(rec))
+
+	const callers = 4
+	resps := make([]*TextToImageResponse, callers)
+	errs := make([]error, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, parent := rec.Start(context.Background(), "caller")
+			defer parent.End(nil)
+			resps[i], errs[i] = client.GenerateImage(ctx, &TextToImageRequest{Prompt: "fox", Seed: 42})
+		}(i)
+	}
+	wg.Wait()
+
+	if n := len(server.RequestsTo(drawthingstest.PathTxt2Img)); n != 1 {
+		t.Fatalf("expected 1 render, got %d", n)
+	}
+	for i := range resps {
+		if errs[i] != nil {
+			t.Fatalf("caller %d: %v", i, errs[i])
+		}
+		if resps[i].Images[0] != resps[0].Images[0] {
+			t.Errorf("caller %d got a different image", i)
+		}
+	}
+	// Each caller owns its response.
+	resps[0].Images[0] = "changed"
+	if resps[1].Images[0] == "changed" {
+		t.Error("callers share the response's images")
+	}
+
+	joined := 0
+	var shared []RecordedSpan
+	links := make(map[interface{}]int)
+	for _, s := range rec.Spans() {
+		switch s.Name {
+		case "caller":
+			continue
+		case SpanCoalesced:
+			shared = append(shared, s)
+			continue
+		}
+		if s.Attributes[AttrCoalesced] == true {
+			joined++
+		}
+		links[s.Attributes[AttrLink]]++
+	}
+	if joined != callers-1 {
+		t.Errorf("expected %d coalesced spans, got %d", callers-1, joined)
+	}
+	// The shared request has a root span of its own, linked from every
+	// caller's span, and carries its traceparent.
+	if len(shared) != 1 {
+		t.Fatalf("expected 1 %s span, got %d", SpanCoalesced, len(shared))
+	}
+	link := "00-" + shared[0].TraceID + "-" + shared[0].SpanID + "-01"
+	if shared[0].ParentSpanID != "" || !shared[0].Ended || shared[0].Attributes[AttrStatusCode] != 200 {
+		t.Errorf("unexpected shared span: %+v", shared[0])
+	}
+	if links[link] != callers {
+		t.Errorf("caller span links = %v, want %d links to %s", links, callers, link)
+	}
+	if got := server.RequestsTo(drawthingstest.PathTxt2Img)[0].Header.Get("traceparent"); got != link {
+		t.Errorf("shared request traceparent = %q, want %q", got, link)
+	}
+
+	// Finished requests are not shared with later ones, and neither are
+	// requests with a random seed.
+	for i := 0; i < 2; i++ {
+		if _, err := client.GenerateImage(context.Background(), &TextToImageRequest{Prompt: "fox", Seed: 42}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Add(2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			defer wg.Done()
+			client.GenerateImage(context.Background(), &TextToImageRequest{Prompt: "fox"})
+		}()
+	}
+	wg.Wait()
+	if n := len(server.RequestsTo(drawthingstest.PathTxt2Img)); n != 5 {
+		t.Errorf("expected 5 renders, got %d", n)
+	}
+}
+
+func TestWithCoalescing_CallerCanceled(t *testing.T) {
+	server := drawthingstest.NewServer(drawthingstest.WithLatency(200 * time.Millisecond))
+	defer server.Close()
+
+	client := NewClient(WithBaseURL(server.URL), WithCoalescing(true))
+
+	// The first caller starts the request and gives up while it renders.
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := client.GenerateImage(ctx, &TextToImageRequest{Prompt: "fox", Seed: 42})
+		firstErr <- err
+	}()
+	waitForRenders(t, server, 1)
+
+	secondResp := make(chan *TextToImageResponse, 1)
+	secondErr := make(chan error, 1)
+	go func() {
+		resp, err := client.GenerateImage(context.Background(), &TextToImageRequest{Prompt: "fox", Seed: 42})
+		secondResp <- resp
+		secondErr <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	if err := <-firstErr; !errors.Is(err, context.Canceled) || ErrorType(err) != ErrorTypeCanceled {
+		t.Errorf("canceled caller: got %v, want a canceled error", err)
+	}
+	// The other caller still gets the image from the shared render.
+	if err := <-secondErr; err != nil {
+		t.Fatalf("remaining caller: %v", err)
+	}
+	if resp := <-secondResp; len(resp.Images) != 1 {
+		t.Errorf("remaining caller got %d images", len(resp.Images))
+	}
+	if n := len(server.RequestsTo(drawthingstest.PathTxt2Img)); n != 1 {
+		t.Errorf("expected 1 render, got %d", n)
+	}
+}
+
+func TestWithCoalescing_AllCallersCanceled(t *testing.T) {
+	server := drawthingstest.NewServer(drawthingstest.WithLatency(time.Second))
+	defer server.Close()
+
+	client := NewClient(WithBaseURL(server.URL), WithCoalescing(true))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.GenerateImage(ctx, &TextToImageRequest{Prompt: "fox", Seed: 42}); !errors.Is(err, context.Canceled) {
+				t.Errorf("got %v, want a canceled error", err)
+			}
+		}()
+	}
+	waitForRenders(t, server, 1)
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	// With nobody left waiting, the shared request is abandoned and the
+	// next identical request starts afresh.
+	server.SetLatency(0)
+	if _, err := client.GenerateImage(context.Background(), &TextToImageRequest{Prompt: "fox", Seed: 42}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(server.RequestsTo(drawthingstest.PathTxt2Img)); n != 2 {
+		t.Errorf("expected 2 renders, got %d", n)
+	}
+}
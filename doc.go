@@ -41,6 +41,7 @@
 //   - ValidationError: Parameter validation failures
 //   - NetworkError: Network-related errors (timeouts, connection issues)
 //   - DecodeError: Errors during image decoding or processing
+//   - StorageError: Failures writing generated images to disk
 //
 // Use the Is* functions to check error types:
 //
@@ -0,0 +1,104 @@
+package drawthingstest
+
+import (
+	"net/http"
+)
+
+// Failure describes an injected server failure.
+type Failure struct {
+	// StatusCode, if non-zero, is returned with Body instead of a normal response.
+	StatusCode int
+	// Body is the response body sent with StatusCode or Malformed.
+	Body string
+	// Malformed sends Body (or a truncated JSON document) with status 200.
+	Malformed bool
+	// Drop closes the connection without sending a response.
+	Drop bool
+	// NoImages returns a successful response with an empty image list.
+	NoImages bool
+}
+
+// StatusFailure returns a Failure that responds with the given HTTP status.
+func StatusFailure(code int) Failure {
+	return Failure{StatusCode: code, Body: http.StatusText(code)}
+}
+
+// MalformedJSON returns a Failure that responds with invalid JSON.
+func MalformedJSON() Failure {
+	return Failure{Malformed: true}
+}
+
+// DropConnection returns a Failure that closes the connection mid-request.
+func DropConnection() Failure {
+	return Failure{Drop: true}
+}
+
+// NoImages returns a Failure that responds successfully without images.
+func NoImages() Failure {
+	return Failure{NoImages: true}
+}
+
+// QueueFailure makes one upcoming generation request fail with f. Queued
+// failures are used in order, one per request, before any failure set with
+// SetFailure.
+func (s *Server) QueueFailure(f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queued = append(s.queued, f)
+}
+
+// SetFailure makes every generation request fail with f until cleared with
+// ClearFailure.
+func (s *Server) SetFailure(f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failure = &f
+}
+
+// ClearFailure stops failing requests set with SetFailure.
+func (s *Server) ClearFailure() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failure = nil
+}
+
+// fail applies the next injected failure, if any, and reports whether the
+// request has been handled.
+func (s *Server) fail(w http.ResponseWriter) bool {
+	s.mu.Lock()
+	var f *Failure
+	if len(s.queued) > 0 {
+		f = &s.queued[0]
+		s.queued = s.queued[1:]
+	} else {
+		f = s.failure
+	}
+	s.mu.Unlock()
+
+	switch {
+	case f == nil:
+		return false
+	case f.Drop:
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return true
+			}
+		}
+		panic(http.ErrAbortHandler)
+	case f.StatusCode != 0:
+		http.Error(w, f.Body, f.StatusCode)
+	case f.Malformed:
+		body := f.Body
+		if body == "" {
+			body = `{"images": ["`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	case f.NoImages:
+		writeJSON(w, map[string]interface{}{"images": []string{}})
+	default:
+		return false
+	}
+	return true
+}
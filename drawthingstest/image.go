@@ -0,0 +1,120 @@
+package drawthingstest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+)
+
+// Image returns the PNG image the fake server generates for a prompt and
+// seed. The same inputs always produce the same bytes, so tests can compare
+// server output against it.
+func Image(prompt string, seed, width, height int) []byte {
+	return encode(gradient(prompt, seed, width, height))
+}
+
+// RefinedImage returns the PNG image the fake server generates from a
+// source image: the source, scaled to width by height, blended with Image
+// by strength.
+func RefinedImage(init image.Image, prompt string, seed, width, height int, strength float64) []byte {
+	img := gradient(prompt, seed, width, height)
+	b := init.Bounds()
+	t := int(strength * 255)
+	if t < 0 {
+		t = 0
+	} else if t > 255 {
+		t = 255
+	}
+	for y := 0; y < img.Rect.Dy(); y++ {
+		for x := 0; x < img.Rect.Dx(); x++ {
+			src := color.RGBAModel.Convert(init.At(b.Min.X+x*b.Dx()/img.Rect.Dx(), b.Min.Y+y*b.Dy()/img.Rect.Dy())).(color.RGBA)
+			gen := img.RGBAAt(x, y)
+			img.SetRGBA(x, y, color.RGBA{
+				R: blend(src.R, gen.R, t),
+				G: blend(src.G, gen.G, t),
+				B: blend(src.B, gen.B, t),
+				A: 255,
+			})
+		}
+	}
+	return encode(img)
+}
+
+// InpaintedImage returns the PNG image the fake server generates from a
+// source image and an inpainting mask: RefinedImage where the mask is
+// light, and the scaled source where it is dark.
+func InpaintedImage(init, mask image.Image, prompt string, seed, width, height int, strength float64) []byte {
+	img, err := png.Decode(bytes.NewReader(RefinedImage(init, prompt, seed, width, height, strength)))
+	if err != nil {
+		panic("drawthingstest: failed to decode image: " + err.Error())
+	}
+	out := image.NewRGBA(img.Bounds())
+	draw.Draw(out, out.Rect, img, image.Point{}, draw.Src)
+	ib, mb := init.Bounds(), mask.Bounds()
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			m := color.GrayModel.Convert(mask.At(mb.Min.X+x*mb.Dx()/width, mb.Min.Y+y*mb.Dy()/height)).(color.Gray)
+			if m.Y >= 128 {
+				continue
+			}
+			src := color.RGBAModel.Convert(init.At(ib.Min.X+x*ib.Dx()/width, ib.Min.Y+y*ib.Dy()/height)).(color.RGBA)
+			src.A = 255
+			out.SetRGBA(x, y, src)
+		}
+	}
+	return encode(out)
+}
+
+// gradient returns the image generated for a prompt and seed.
+func gradient(prompt string, seed, width, height int) *image.RGBA {
+	if width <= 0 {
+		width = 1
+	}
+	if height <= 0 {
+		height = 1
+	}
+
+	h := sha256.New()
+	h.Write([]byte(prompt))
+	binary.Write(h, binary.LittleEndian, int64(seed))
+	sum := h.Sum(nil)
+
+	// Two colors from the hash, blended in a diagonal gradient.
+	from := color.RGBA{sum[0], sum[1], sum[2], 255}
+	to := color.RGBA{sum[3], sum[4], sum[5], 255}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	span := width + height - 2
+	if span == 0 {
+		span = 1
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			t := (x + y) * 255 / span
+			img.SetRGBA(x, y, color.RGBA{
+				R: blend(from.R, to.R, t),
+				G: blend(from.G, to.G, t),
+				B: blend(from.B, to.B, t),
+				A: 255,
+			})
+		}
+	}
+	return img
+}
+
+// encode encodes img as PNG.
+func encode(img image.Image) []byte {
+	var buf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := enc.Encode(&buf, img); err != nil {
+		panic("drawthingstest: failed to encode image: " + err.Error())
+	}
+	return buf.Bytes()
+}
+
+func blend(a, b uint8, t int) uint8 {
+	return uint8((int(a)*(255-t) + int(b)*t) / 255)
+}
@@ -0,0 +1,481 @@
+// Package drawthingstest provides an in-process fake Draw Things server for
+// tests.
+//
+// The server implements the Stable Diffusion compatible endpoints used by
+// this library. It returns deterministic PNG images derived from the prompt
+// and seed, can simulate latency and report progress while "rendering", can
+// inject failures, and records every request for later assertions:
+//
+//	srv := drawthingstest.NewServer(drawthingstest.WithLatency(50 * time.Millisecond))
+//	defer srv.Close()
+//
+//	client := drawthings.NewClient(drawthings.WithBaseURL(srv.URL))
+//	srv.QueueFailure(drawthingstest.StatusFailure(http.StatusInternalServerError))
+//
+// The package deliberately does not import the drawthings package, so that
+// package's own tests can use it.
+package drawthingstest
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	_ "image/jpeg" // register JPEG decoding for init images
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Endpoint paths served by the fake server.
+const (
+	PathTxt2Img   = "/sdapi/v1/txt2img"
+	PathImg2Img   = "/sdapi/v1/img2img"
+	PathProgress  = "/sdapi/v1/progress"
+	PathInterrupt = "/sdapi/v1/interrupt"
+	PathOptions   = "/sdapi/v1/options"
+	PathModels    = "/sdapi/v1/sd-models"
+)
+
+// DefaultModel is the model the server reports unless changed with
+// WithModel or SetModel.
+const DefaultModel = "drawthingstest_v1.ckpt"
+
+// Server is a fake Draw Things API server.
+type Server struct {
+	// URL is the base URL of the server, for use with drawthings.WithBaseURL.
+	URL string
+
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	latency  time.Duration
+	images   int
+	model    string
+	failure  *Failure
+	queued   []Failure
+	requests []Request
+	job      *job
+}
+
+// job is the generation currently in progress.
+type job struct {
+	started time.Time
+	steps   int
+	cancel  context.CancelFunc
+}
+
+// Option is a function that configures a Server.
+type Option func(*Server)
+
+// WithLatency makes every generation take d. Progress is reported linearly
+// over that time.
+func WithLatency(d time.Duration) Option {
+	return func(s *Server) {
+		s.latency = d
+	}
+}
+
+// WithImagesPerRequest sets how many images each generation returns (default 1).
+// Additional images use consecutive seeds.
+func WithImagesPerRequest(n int) Option {
+	return func(s *Server) {
+		s.images = n
+	}
+}
+
+// WithModel sets the model reported by the options endpoint.
+func WithModel(model string) Option {
+	return func(s *Server) {
+		s.model = model
+	}
+}
+
+// NewServer starts a fake server. Call Close when done.
+func NewServer(opts ...Option) *Server {
+	s := &Server{images: 1, model: DefaultModel}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(PathTxt2Img, s.handleTxt2Img)
+	mux.HandleFunc(PathImg2Img, s.handleImg2Img)
+	mux.HandleFunc(PathProgress, s.handleProgress)
+	mux.HandleFunc(PathInterrupt, s.handleInterrupt)
+	mux.HandleFunc(PathOptions, s.handleOptions)
+	mux.HandleFunc(PathModels, s.handleModels)
+
+	s.srv = httptest.NewServer(s.record(mux))
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.srv.CloseClientConnections()
+	s.srv.Close()
+}
+
+// Request is a request received by the server.
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+	Time   time.Time
+}
+
+// Decode unmarshals the JSON request body into v.
+func (r Request) Decode(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// Requests returns every request received so far, in arrival order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// RequestsTo returns the requests received for path.
+func (s *Server) RequestsTo(path string) []Request {
+	var matched []Request
+	for _, r := range s.Requests() {
+		if r.Path == path {
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
+// Reset clears recorded requests and injected failures.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+	s.queued = nil
+	s.failure = nil
+}
+
+// SetLatency changes the simulated generation time.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// SetModel changes the model reported by the options endpoint, as if the
+// user had switched models in the app.
+func (s *Server) SetModel(model string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.model = model
+}
+
+// record stores each request before passing it on.
+func (s *Server) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Header: r.Header.Clone(),
+			Body:   body,
+			Time:   time.Now(),
+		})
+		s.mu.Unlock()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// txt2imgRequest mirrors the fields of drawthings.TextToImageRequest that
+// affect the generated image.
+type txt2imgRequest struct {
+	Prompt         string  `json:"prompt"`
+	NegativePrompt string  `json:"negative_prompt,omitempty"`
+	Steps          int     `json:"steps,omitempty"`
+	GuidanceScale  float64 `json:"guidance_scale,omitempty"`
+	Width          int     `json:"width,omitempty"`
+	Height         int     `json:"height,omitempty"`
+	Seed           int     `json:"seed,omitempty"`
+}
+
+func (s *Server) handleTxt2Img(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.fail(w) {
+		return
+	}
+
+	var req txt2imgRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Width == 0 {
+		req.Width = 512
+	}
+	if req.Height == 0 {
+		req.Height = 512
+	}
+	if req.Steps == 0 {
+		req.Steps = 20
+	}
+
+	if !s.render(r.Context(), req.Steps) {
+		// Interrupted, or the client went away.
+		http.Error(w, "interrupted", http.StatusServiceUnavailable)
+		return
+	}
+
+	s.mu.Lock()
+	n := s.images
+	s.mu.Unlock()
+	images := make([]string, n)
+	for i := range images {
+		images[i] = base64.StdEncoding.EncodeToString(Image(req.Prompt, req.Seed+i, req.Width, req.Height))
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"images":     images,
+		"parameters": req,
+	})
+}
+
+// img2imgRequest adds the fields of drawthings.ImageToImageRequest to
+// txt2imgRequest.
+type img2imgRequest struct {
+	txt2imgRequest
+	InitImages        []string `json:"init_images"`
+	DenoisingStrength float64  `json:"denoising_strength,omitempty"`
+	Mask              string   `json:"mask,omitempty"`
+}
+
+// decodeImage decodes a base64-encoded image field.
+func decodeImage(encoded string) (image.Image, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+func (s *Server) handleImg2Img(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.fail(w) {
+		return
+	}
+
+	var req img2imgRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.InitImages) == 0 {
+		http.Error(w, "init_images is required", http.StatusBadRequest)
+		return
+	}
+	init, err := decodeImage(req.InitImages[0])
+	if err != nil {
+		http.Error(w, "invalid init image: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var mask image.Image
+	if req.Mask != "" {
+		if mask, err = decodeImage(req.Mask); err != nil {
+			http.Error(w, "invalid mask: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Width == 0 {
+		req.Width = 512
+	}
+	if req.Height == 0 {
+		req.Height = 512
+	}
+	if req.Steps == 0 {
+		req.Steps = 20
+	}
+	if req.DenoisingStrength == 0 {
+		req.DenoisingStrength = 0.75
+	}
+
+	if !s.render(r.Context(), req.Steps) {
+		http.Error(w, "interrupted", http.StatusServiceUnavailable)
+		return
+	}
+
+	s.mu.Lock()
+	n := s.images
+	s.mu.Unlock()
+	images := make([]string, n)
+	for i := range images {
+		data := RefinedImage(init, req.Prompt, req.Seed+i, req.Width, req.Height, req.DenoisingStrength)
+		if mask != nil {
+			data = InpaintedImage(init, mask, req.Prompt, req.Seed+i, req.Width, req.Height, req.DenoisingStrength)
+		}
+		images[i] = base64.StdEncoding.EncodeToString(data)
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"images":     images,
+		"parameters": req.txt2imgRequest,
+	})
+}
+
+// render waits for the simulated latency while tracking progress. It returns
+// false if the generation was interrupted.
+func (s *Server) render(ctx context.Context, steps int) bool {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s.mu.Lock()
+	latency := s.latency
+	current := &job{started: time.Now(), steps: steps, cancel: cancel}
+	s.job = current
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		if s.job == current {
+			s.job = nil
+		}
+		s.mu.Unlock()
+	}()
+
+	if latency <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// progressResponse matches the Stable Diffusion progress endpoint.
+type progressResponse struct {
+	Progress    float64       `json:"progress"`
+	ETARelative float64       `json:"eta_relative"`
+	State       progressState `json:"state"`
+}
+
+type progressState struct {
+	JobCount      int `json:"job_count"`
+	SamplingStep  int `json:"sampling_step"`
+	SamplingSteps int `json:"sampling_steps"`
+}
+
+func (s *Server) handleProgress(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	current, latency := s.job, s.latency
+	s.mu.Unlock()
+
+	var resp progressResponse
+	if current != nil {
+		progress := 1.0
+		if latency > 0 {
+			progress = float64(time.Since(current.started)) / float64(latency)
+			if progress > 1 {
+				progress = 1
+			}
+		}
+		resp = progressResponse{
+			Progress:    progress,
+			ETARelative: (latency - time.Since(current.started)).Seconds(),
+			State: progressState{
+				JobCount:      1,
+				SamplingStep:  int(progress * float64(current.steps)),
+				SamplingSteps: current.steps,
+			},
+		}
+		if resp.ETARelative < 0 {
+			resp.ETARelative = 0
+		}
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) handleInterrupt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mu.Lock()
+	if s.job != nil {
+		s.job.cancel()
+	}
+	s.mu.Unlock()
+	writeJSON(w, map[string]string{})
+}
+
+func (s *Server) handleOptions(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		var options map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&options); err != nil {
+			http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Only the model is a setting of the fake server.
+		if model, ok := options["sd_model_checkpoint"].(string); ok {
+			s.SetModel(model)
+		}
+		writeJSON(w, nil)
+		return
+	}
+	s.mu.Lock()
+	model := s.model
+	s.mu.Unlock()
+	writeJSON(w, map[string]string{"sd_model_checkpoint": model})
+}
+
+// model matches an entry of the Stable Diffusion models endpoint.
+type model struct {
+	Title     string `json:"title"`
+	ModelName string `json:"model_name"`
+	Filename  string `json:"filename"`
+}
+
+// handleModels lists DefaultModel and the loaded model.
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	loaded := s.model
+	s.mu.Unlock()
+	models := []model{}
+	for _, name := range []string{DefaultModel, loaded} {
+		if len(models) > 0 && models[0].Title == name {
+			continue
+		}
+		models = append(models, model{
+			Title:     name,
+			ModelName: strings.TrimSuffix(name, path.Ext(name)),
+			Filename:  name,
+		})
+	}
+	writeJSON(w, models)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,221 @@
+package drawthingstest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func post(t *testing.T, url, body string) *http.Response {
+	t.Helper()
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST %s: %v", url, err)
+	}
+	return resp
+}
+
+func TestImage_Deterministic(t *testing.T) {
+	a := Image("a cat", 1, 32, 16)
+	if !bytes.Equal(a, Image("a cat", 1, 32, 16)) {
+		t.Error("same inputs should produce the same image")
+	}
+	if bytes.Equal(a, Image("a cat", 2, 32, 16)) {
+		t.Error("different seeds should produce different images")
+	}
+	if bytes.Equal(a, Image("a dog", 1, 32, 16)) {
+		t.Error("different prompts should produce different images")
+	}
+
+	img, err := png.Decode(bytes.NewReader(a))
+	if err != nil {
+		t.Fatalf("invalid PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 32 || b.Dy() != 16 {
+		t.Errorf("size: got %dx%d, want 32x16", b.Dx(), b.Dy())
+	}
+}
+
+func TestServer_Txt2Img(t *testing.T) {
+	srv := NewServer(WithImagesPerRequest(2))
+	defer srv.Close()
+
+	resp := post(t, srv.URL+PathTxt2Img, `{"prompt":"a cat","seed":5,"width":16,"height":16}`)
+	defer resp.Body.Close()
+	var body struct {
+		Images []string `json:"images"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Images) != 2 {
+		t.Fatalf("expected 2 images, got %d", len(body.Images))
+	}
+	for i, encoded := range body.Images {
+		data, _ := base64.StdEncoding.DecodeString(encoded)
+		if !bytes.Equal(data, Image("a cat", 5+i, 16, 16)) {
+			t.Errorf("image %d does not match seed %d", i, 5+i)
+		}
+	}
+
+	requests := srv.Requests()
+	if len(requests) != 1 || requests[0].Path != PathTxt2Img {
+		t.Fatalf("unexpected recorded requests: %+v", requests)
+	}
+	var req struct {
+		Prompt string `json:"prompt"`
+	}
+	if err := requests[0].Decode(&req); err != nil || req.Prompt != "a cat" {
+		t.Errorf("recorded body: %q, %v", requests[0].Body, err)
+	}
+
+	srv.Reset()
+	if len(srv.Requests()) != 0 {
+		t.Error("Reset should clear recorded requests")
+	}
+}
+
+func TestServer_Img2Img(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	initPNG := Image("a cat", 1, 8, 8)
+	init, _ := png.Decode(bytes.NewReader(initPNG))
+	body := `{"prompt":"a dog","seed":3,"width":16,"height":16,"denoising_strength":0.5,"init_images":["` + base64.StdEncoding.EncodeToString(initPNG) + `"]}`
+	resp := post(t, srv.URL+PathImg2Img, body)
+	defer resp.Body.Close()
+	var out struct {
+		Images []string `json:"images"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := base64.StdEncoding.DecodeString(out.Images[0])
+	if !bytes.Equal(data, RefinedImage(init, "a dog", 3, 16, 16, 0.5)) {
+		t.Error("img2img image does not match RefinedImage")
+	}
+	if bytes.Equal(RefinedImage(init, "a dog", 3, 16, 16, 0), Image("a dog", 3, 16, 16)) {
+		t.Error("strength 0 should keep the source image")
+	}
+
+	resp = post(t, srv.URL+PathImg2Img, `{"prompt":"a dog"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("without init image: status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+
+	maskImg := image.NewGray(image.Rect(0, 0, 8, 8))
+	for x := 4; x < 8; x++ {
+		for y := 0; y < 8; y++ {
+			maskImg.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	var maskPNG bytes.Buffer
+	png.Encode(&maskPNG, maskImg)
+	body = `{"prompt":"a dog","seed":3,"width":16,"height":16,"init_images":["` + base64.StdEncoding.EncodeToString(initPNG) +
+		`"],"mask":"` + base64.StdEncoding.EncodeToString(maskPNG.Bytes()) + `"}`
+	resp = post(t, srv.URL+PathImg2Img, body)
+	out.Images = nil
+	json.NewDecoder(resp.Body).Decode(&out)
+	resp.Body.Close()
+	data, _ = base64.StdEncoding.DecodeString(out.Images[0])
+	if !bytes.Equal(data, InpaintedImage(init, maskImg, "a dog", 3, 16, 16, 0.75)) {
+		t.Error("inpainted image does not match InpaintedImage")
+	}
+	inpainted, _ := png.Decode(bytes.NewReader(data))
+	if got, want := color.RGBAModel.Convert(inpainted.At(0, 0)), color.RGBAModel.Convert(init.At(0, 0)); got != want {
+		t.Errorf("masked-out pixel = %v, want the source %v", got, want)
+	}
+
+	resp = post(t, srv.URL+PathImg2Img, `{"prompt":"a dog","init_images":["`+base64.StdEncoding.EncodeToString(initPNG)+`"],"mask":"bm90IGFuIGltYWdl"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid mask: status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestServer_Failures(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	srv.QueueFailure(StatusFailure(http.StatusServiceUnavailable))
+	srv.QueueFailure(MalformedJSON())
+
+	resp := post(t, srv.URL+PathTxt2Img, `{"prompt":"x"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("first request: got status %d", resp.StatusCode)
+	}
+
+	resp = post(t, srv.URL+PathTxt2Img, `{"prompt":"x"}`)
+	var v interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err == nil {
+		t.Error("second request should return malformed JSON")
+	}
+	resp.Body.Close()
+
+	srv.SetFailure(DropConnection())
+	if resp, err := http.Post(srv.URL+PathTxt2Img, "application/json", strings.NewReader(`{"prompt":"x"}`)); err == nil {
+		resp.Body.Close()
+		t.Error("expected dropped connection")
+	}
+
+	srv.ClearFailure()
+	resp = post(t, srv.URL+PathTxt2Img, `{"prompt":"x"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("after ClearFailure: got status %d", resp.StatusCode)
+	}
+}
+
+func TestServer_ProgressAndInterrupt(t *testing.T) {
+	srv := NewServer(WithLatency(5 * time.Second))
+	defer srv.Close()
+
+	done := make(chan int)
+	go func() {
+		resp, err := http.Post(srv.URL+PathTxt2Img, "application/json", strings.NewReader(`{"prompt":"x","steps":10}`))
+		if err != nil {
+			done <- 0
+			return
+		}
+		resp.Body.Close()
+		done <- resp.StatusCode
+	}()
+
+	var progress progressResponse
+	deadline := time.Now().Add(2 * time.Second)
+	for progress.State.JobCount == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		resp, err := http.Get(srv.URL + PathProgress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewDecoder(resp.Body).Decode(&progress)
+		resp.Body.Close()
+	}
+	if progress.State.JobCount != 1 || progress.State.SamplingSteps != 10 {
+		t.Fatalf("unexpected progress: %+v", progress)
+	}
+	if progress.Progress < 0 || progress.Progress >= 1 || progress.ETARelative <= 0 {
+		t.Errorf("unexpected progress values: %+v", progress)
+	}
+
+	resp := post(t, srv.URL+PathInterrupt, "")
+	resp.Body.Close()
+	select {
+	case code := <-done:
+		if code != http.StatusServiceUnavailable {
+			t.Errorf("interrupted generation: got status %d", code)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("interrupt did not stop the generation")
+	}
+}
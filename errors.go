@@ -1,6 +1,8 @@
 package drawthings
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 )
@@ -19,16 +21,19 @@ func (e *APIError) Error() string {
 	return fmt.Sprintf("API error (status %d): %s", e.StatusCode, e.Body)
 }
 
-// IsAPIError checks if an error is an APIError.
+// IsAPIError checks if an error is or wraps an APIError.
 func IsAPIError(err error) bool {
-	_, ok := err.(*APIError)
-	return ok
+	var target *APIError
+	return errors.As(err, &target)
 }
 
 // ValidationError represents a parameter validation failure.
 type ValidationError struct {
 	Field   string
 	Message string
+	// Err is the underlying error, such as a *prompt.SyntaxError with the
+	// position of a problem in the prompt.
+	Err error
 }
 
 func (e *ValidationError) Error() string {
@@ -38,10 +43,14 @@ func (e *ValidationError) Error() string {
 	return fmt.Sprintf("validation error: %s", e.Message)
 }
 
-// IsValidationError checks if an error is a ValidationError.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// IsValidationError checks if an error is or wraps a ValidationError.
 func IsValidationError(err error) bool {
-	_, ok := err.(*ValidationError)
-	return ok
+	var target *ValidationError
+	return errors.As(err, &target)
 }
 
 // NetworkError represents a network-related error (timeout, connection refused, etc.).
@@ -61,10 +70,10 @@ func (e *NetworkError) Unwrap() error {
 	return e.Err
 }
 
-// IsNetworkError checks if an error is a NetworkError.
+// IsNetworkError checks if an error is or wraps a NetworkError.
 func IsNetworkError(err error) bool {
-	_, ok := err.(*NetworkError)
-	return ok
+	var target *NetworkError
+	return errors.As(err, &target)
 }
 
 // DecodeError represents an error during base64 decoding or image processing.
@@ -84,10 +93,68 @@ func (e *DecodeError) Unwrap() error {
 	return e.Err
 }
 
-// IsDecodeError checks if an error is a DecodeError.
+// IsDecodeError checks if an error is or wraps a DecodeError.
 func IsDecodeError(err error) bool {
-	_, ok := err.(*DecodeError)
-	return ok
+	var target *DecodeError
+	return errors.As(err, &target)
+}
+
+// StorageError represents a failure to write generated images to disk.
+type StorageError struct {
+	Message string
+	Err     error
+}
+
+func (e *StorageError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("storage error: %s: %v", e.Message, e.Err)
+	}
+	return fmt.Sprintf("storage error: %s", e.Message)
+}
+
+func (e *StorageError) Unwrap() error {
+	return e.Err
+}
+
+// IsStorageError checks if an error is or wraps a StorageError.
+func IsStorageError(err error) bool {
+	var target *StorageError
+	return errors.As(err, &target)
+}
+
+// Error types returned by ErrorType.
+const (
+	ErrorTypeValidation = "validation"
+	ErrorTypeNetwork    = "network"
+	ErrorTypeAPI        = "api"
+	ErrorTypeDecode     = "decode"
+	ErrorTypeStorage    = "storage"
+	ErrorTypeCanceled   = "canceled"
+	ErrorTypeUnknown    = "unknown"
+)
+
+// ErrorType classifies err into one of the ErrorType* categories. Cancelled
+// contexts are reported as ErrorTypeCanceled even when wrapped in a
+// NetworkError. It returns an empty string for a nil error.
+func ErrorType(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled):
+		return ErrorTypeCanceled
+	case IsValidationError(err):
+		return ErrorTypeValidation
+	case IsNetworkError(err):
+		return ErrorTypeNetwork
+	case IsAPIError(err):
+		return ErrorTypeAPI
+	case IsDecodeError(err):
+		return ErrorTypeDecode
+	case IsStorageError(err):
+		return ErrorTypeStorage
+	default:
+		return ErrorTypeUnknown
+	}
 }
 
 // NewAPIError creates a new APIError from an HTTP response.
@@ -123,3 +190,10 @@ func NewDecodeError(message string, err error) *DecodeError {
 	}
 }
 
+// NewStorageError creates a new StorageError.
+func NewStorageError(message string, err error) *StorageError {
+	return &StorageError{
+		Message: message,
+		Err:     err,
+	}
+}
@@ -1,6 +1,7 @@
 package drawthings
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -81,3 +82,54 @@ func TestDecodeError(t *testing.T) {
 	}
 }
 
+func TestStorageError(t *testing.T) {
+	underlyingErr := fmt.Errorf("disk full")
+	err := NewStorageError("failed to write image file", underlyingErr)
+	if err.Message != "failed to write image file" {
+		t.Errorf("Message: got %q, want %q", err.Message, "failed to write image file")
+	}
+
+	if err.Unwrap() != underlyingErr {
+		t.Error("Unwrap should return the underlying error")
+	}
+
+	if !IsStorageError(err) {
+		t.Error("IsStorageError should return true for StorageError")
+	}
+
+	if IsStorageError(nil) {
+		t.Error("IsStorageError should return false for nil")
+	}
+}
+
+func TestIsErrorWrapped(t *testing.T) {
+	err := fmt.Errorf("failed to generate image: %w", NewValidationError("steps", "out of range"))
+	if !IsValidationError(err) {
+		t.Error("IsValidationError should return true for a wrapped ValidationError")
+	}
+	if IsAPIError(err) {
+		t.Error("IsAPIError should return false for a wrapped ValidationError")
+	}
+}
+
+func TestErrorType(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{NewValidationError("steps", "bad"), ErrorTypeValidation},
+		{NewNetworkError("down", nil), ErrorTypeNetwork},
+		{NewNetworkError("cancelled", context.Canceled), ErrorTypeCanceled},
+		{&APIError{StatusCode: 500}, ErrorTypeAPI},
+		{NewDecodeError("bad", nil), ErrorTypeDecode},
+		{fmt.Errorf("wrapped: %w", NewStorageError("disk full", nil)), ErrorTypeStorage},
+		{fmt.Errorf("something else"), ErrorTypeUnknown},
+	}
+
+	for _, tt := range tests {
+		if got := ErrorType(tt.err); got != tt.want {
+			t.Errorf("ErrorType(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
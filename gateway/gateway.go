@@ -0,0 +1,431 @@
+// Package gateway provides an HTTP server that fronts a single Draw Things
+// instance for several users.
+//
+// Draw Things renders one image at a time and has no queue of its own, so
+// concurrent requests from different people collide. The gateway exposes the
+// same /sdapi/v1/* API, queues generation requests, and forwards them one at
+// a time. Requests from the same client run in arrival order; different
+// clients take turns, so a large batch from one person does not block
+// everyone else:
+//
+//	client := drawthings.NewClient(drawthings.WithBaseURL("http://mac.local:7860"))
+//	gw := gateway.New(client, gateway.WithUpstream(client.BaseURL()))
+//	log.Fatal(http.ListenAndServe(":7861", gw))
+//
+// txt2img requests with fields that drawthings.TextToImageRequest does not
+// have are forwarded to the upstream unchanged, or rejected with 400 if
+// there is none.
+//
+// Clients are identified by the X-Drawthings-Client header, falling back to
+// the remote IP address. The current queue is available at
+// GET /gateway/v1/queue.
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drawthings_go"
+)
+
+// Paths served by the gateway.
+const (
+	PathTxt2Img = "/sdapi/v1/txt2img"
+	PathQueue   = "/gateway/v1/queue"
+)
+
+// Headers used by the gateway.
+const (
+	// HeaderClient identifies the caller for fair queuing.
+	HeaderClient = "X-Drawthings-Client"
+	// HeaderRequestID is echoed back, or generated if the caller did not
+	// send one. It identifies the request in the queue listing.
+	HeaderRequestID = "X-Request-Id"
+	// HeaderQueuePosition reports the queue position on arrival (0 means
+	// the request was forwarded immediately).
+	HeaderQueuePosition = "X-Queue-Position"
+	// HeaderQueueWait reports the time spent queued, in milliseconds.
+	HeaderQueueWait = "X-Queue-Wait-Ms"
+)
+
+// queuedPaths are upstream endpoints that render, and therefore wait their
+// turn, when passed through to the upstream server.
+var queuedPaths = map[string]bool{
+	"/sdapi/v1/img2img": true,
+}
+
+// Generator generates images. *drawthings.Client satisfies this interface.
+type Generator interface {
+	GenerateImage(ctx context.Context, req *drawthings.TextToImageRequest) (*drawthings.TextToImageResponse, error)
+}
+
+// Server is an http.Handler that queues and forwards requests to Draw Things.
+type Server struct {
+	gen      Generator
+	proxy    *httputil.ReverseProxy
+	identify func(*http.Request) string
+	maxQueue int
+	metrics  Metrics
+
+	mu     sync.Mutex
+	sched  *scheduler
+	nextID int
+	mux    *http.ServeMux
+}
+
+// Option is a function that configures a Server.
+type Option func(*Server)
+
+// WithUpstream passes requests for other /sdapi/v1/* endpoints, such as
+// progress or options, straight through to the Draw Things server at
+// baseURL. Rendering endpoints still wait in the queue. Without an upstream
+// those endpoints return 404.
+func WithUpstream(baseURL string) Option {
+	return func(s *Server) {
+		target, err := url.Parse(baseURL)
+		if err != nil {
+			panic(fmt.Sprintf("gateway: invalid upstream URL %q: %v", baseURL, err))
+		}
+		s.proxy = httputil.NewSingleHostReverseProxy(target)
+	}
+}
+
+// WithClientIdentifier sets how callers are told apart for fair queuing.
+// The default uses the X-Drawthings-Client header, then the remote IP.
+func WithClientIdentifier(identify func(*http.Request) string) Option {
+	return func(s *Server) {
+		s.identify = identify
+	}
+}
+
+// WithMaxQueue rejects new requests with 503 once n requests are waiting.
+// Zero, the default, means no limit.
+func WithMaxQueue(n int) Option {
+	return func(s *Server) {
+		s.maxQueue = n
+	}
+}
+
+// Metrics receives the time requests spend in the gateway queue.
+// *metrics.Collector satisfies this interface.
+type Metrics interface {
+	ObserveQueueWait(queue string, wait time.Duration)
+}
+
+// WithMetrics records how long each request waited in the queue to m, with
+// queue "gateway".
+func WithMetrics(m Metrics) Option {
+	return func(s *Server) {
+		s.metrics = m
+	}
+}
+
+// New creates a gateway that forwards generation requests to gen.
+func New(gen Generator, opts ...Option) *Server {
+	s := &Server{
+		gen:      gen,
+		identify: defaultIdentify,
+		sched:    newScheduler(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc(PathTxt2Img, s.handleTxt2Img)
+	s.mux.HandleFunc(PathQueue, s.handleQueue)
+	s.mux.HandleFunc("/sdapi/", s.handlePassthrough)
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Handle registers an additional handler on the gateway's mux, for example
+// an adapter serving another API from the same queue.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// defaultIdentify uses the client header, then the remote IP.
+func defaultIdentify(r *http.Request) string {
+	if id := strings.TrimSpace(r.Header.Get(HeaderClient)); id != "" {
+		return id
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// QueueEntry describes a queued or running request.
+type QueueEntry struct {
+	ID       string    `json:"id"`
+	Client   string    `json:"client"`
+	Path     string    `json:"path"`
+	Position int       `json:"position"`
+	Enqueued time.Time `json:"enqueued"`
+	WaitMS   int64     `json:"wait_ms"`
+}
+
+// QueueStatus is a snapshot of the gateway queue.
+type QueueStatus struct {
+	Running *QueueEntry  `json:"running"`
+	Pending []QueueEntry `json:"pending"`
+}
+
+// Queue returns a snapshot of the running and pending requests, in the
+// order they will be forwarded.
+func (s *Server) Queue() QueueStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	status := QueueStatus{Pending: []QueueEntry{}}
+	if t := s.sched.running; t != nil {
+		status.Running = &QueueEntry{
+			ID:       t.id,
+			Client:   t.client,
+			Path:     t.path,
+			Enqueued: t.enqueued,
+			WaitMS:   t.started.Sub(t.enqueued).Milliseconds(),
+		}
+	}
+	for i, t := range s.sched.queued() {
+		status.Pending = append(status.Pending, QueueEntry{
+			ID:       t.id,
+			Client:   t.client,
+			Path:     t.path,
+			Position: i + 1,
+			Enqueued: t.enqueued,
+			WaitMS:   now.Sub(t.enqueued).Milliseconds(),
+		})
+	}
+	return status
+}
+
+// Acquire waits until r may use the upstream server. It returns a release
+// function that must be called when done, or an error if r's context ends
+// first or the queue is full. Handlers registered with Handle use it to
+// share the gateway queue.
+func (s *Server) Acquire(w http.ResponseWriter, r *http.Request) (release func(), err error) {
+	s.mu.Lock()
+	if s.maxQueue > 0 && s.sched.size() >= s.maxQueue {
+		s.mu.Unlock()
+		return nil, errQueueFull
+	}
+	s.nextID++
+	id := r.Header.Get(HeaderRequestID)
+	if id == "" {
+		id = fmt.Sprintf("req-%d", s.nextID)
+	}
+	t := &ticket{
+		id:       id,
+		client:   s.identify(r),
+		path:     r.URL.Path,
+		enqueued: time.Now(),
+		ready:    make(chan struct{}),
+	}
+	position := s.sched.enqueue(t)
+	s.mu.Unlock()
+
+	w.Header().Set(HeaderRequestID, id)
+	w.Header().Set(HeaderQueuePosition, strconv.Itoa(position))
+
+	select {
+	case <-t.ready:
+	case <-r.Context().Done():
+		s.mu.Lock()
+		select {
+		case <-t.ready:
+			// Granted while giving up; pass the turn on.
+			s.sched.done(t)
+		default:
+			s.sched.remove(t)
+		}
+		s.mu.Unlock()
+		return nil, r.Context().Err()
+	}
+
+	wait := t.started.Sub(t.enqueued)
+	w.Header().Set(HeaderQueueWait, strconv.FormatInt(wait.Milliseconds(), 10))
+	if s.metrics != nil {
+		s.metrics.ObserveQueueWait("gateway", wait)
+	}
+	return func() {
+		s.mu.Lock()
+		s.sched.done(t)
+		s.mu.Unlock()
+	}, nil
+}
+
+var errQueueFull = errors.New("gateway queue is full")
+
+func (s *Server) handleTxt2Img(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "use POST", "")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "failed to read request: "+err.Error(), "")
+		return
+	}
+	var req drawthings.TextToImageRequest
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		field, unknown := unknownField(err)
+		switch {
+		case unknown && s.proxy != nil:
+			// The request uses parameters the client does not know, such
+			// as sampler_name; send it upstream as it is.
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+			s.forward(w, r, true)
+		case unknown:
+			writeError(w, http.StatusBadRequest, "invalid_request",
+				fmt.Sprintf("unsupported field %q; run the gateway with an upstream to forward it", field), field)
+		default:
+			writeError(w, http.StatusBadRequest, "invalid_request", "invalid JSON: "+err.Error(), "")
+		}
+		return
+	}
+
+	release, err := s.Acquire(w, r)
+	if err != nil {
+		writeAcquireError(w, err)
+		return
+	}
+	defer release()
+
+	resp, err := s.gen.GenerateImage(r.Context(), &req)
+	if err != nil {
+		writeGenerateError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handlePassthrough(w http.ResponseWriter, r *http.Request) {
+	if s.proxy == nil || !strings.HasPrefix(r.URL.Path, "/sdapi/v1/") {
+		writeError(w, http.StatusNotFound, "not_found", "unknown endpoint "+r.URL.Path, "")
+		return
+	}
+	s.forward(w, r, queuedPaths[r.URL.Path])
+}
+
+// forward passes r to the upstream server, after waiting its turn in the
+// queue if queued is set.
+func (s *Server) forward(w http.ResponseWriter, r *http.Request, queued bool) {
+	if queued {
+		release, err := s.Acquire(w, r)
+		if err != nil {
+			writeAcquireError(w, err)
+			return
+		}
+		defer release()
+	}
+	s.proxy.ServeHTTP(w, r)
+}
+
+// unknownField returns the field named by a json.Decoder error about an
+// unknown field.
+func unknownField(err error) (string, bool) {
+	const prefix = "json: unknown field "
+	msg := err.Error()
+	if !strings.HasPrefix(msg, prefix) {
+		return "", false
+	}
+	field, err := strconv.Unquote(strings.TrimPrefix(msg, prefix))
+	if err != nil {
+		return "", false
+	}
+	return field, true
+}
+
+func (s *Server) handleQueue(w http.ResponseWriter, r *http.Request) {
+	status := s.Queue()
+	client, id := r.URL.Query().Get("client"), r.URL.Query().Get("id")
+	if client != "" || id != "" {
+		keep := func(e QueueEntry) bool {
+			return (client == "" || e.Client == client) && (id == "" || e.ID == id)
+		}
+		if status.Running != nil && !keep(*status.Running) {
+			status.Running = nil
+		}
+		pending := []QueueEntry{}
+		for _, e := range status.Pending {
+			if keep(e) {
+				pending = append(pending, e)
+			}
+		}
+		status.Pending = pending
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// errorResponse is the JSON body of gateway errors.
+type errorResponse struct {
+	Error  string `json:"error"`
+	Detail string `json:"detail"`
+	Field  string `json:"field,omitempty"`
+}
+
+// writeGenerateError writes err from a Generator as an HTTP error response,
+// using the status code that matches its error type.
+func writeGenerateError(w http.ResponseWriter, err error) {
+	var (
+		apiErr *drawthings.APIError
+		valErr *drawthings.ValidationError
+	)
+	switch {
+	case errors.As(err, &valErr):
+		writeError(w, http.StatusUnprocessableEntity, drawthings.ErrorTypeValidation, valErr.Message, valErr.Field)
+	case errors.As(err, &apiErr):
+		detail := apiErr.Body
+		if detail == "" {
+			detail = apiErr.Error()
+		}
+		writeError(w, apiErr.StatusCode, drawthings.ErrorTypeAPI, detail, "")
+	case drawthings.ErrorType(err) == drawthings.ErrorTypeCanceled:
+		writeError(w, http.StatusServiceUnavailable, drawthings.ErrorTypeCanceled, err.Error(), "")
+	default:
+		writeError(w, http.StatusBadGateway, drawthings.ErrorType(err), err.Error(), "")
+	}
+}
+
+func writeAcquireError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errQueueFull) {
+		w.Header().Set("Retry-After", "10")
+		writeError(w, http.StatusServiceUnavailable, "queue_full", err.Error(), "")
+		return
+	}
+	// The caller went away; nobody will read this.
+	writeError(w, http.StatusServiceUnavailable, drawthings.ErrorTypeCanceled, err.Error(), "")
+}
+
+func writeError(w http.ResponseWriter, status int, kind, detail, field string) {
+	writeJSON(w, status, errorResponse{Error: kind, Detail: detail, Field: field})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
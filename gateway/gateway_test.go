@@ -0,0 +1,278 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drawthings_go"
+	"github.com/drawthings_go/drawthingstest"
+)
+
+// blockingGenerator records prompts and holds each generation until released.
+type blockingGenerator struct {
+	mu      sync.Mutex
+	prompts []string
+	release chan struct{}
+}
+
+func (g *blockingGenerator) GenerateImage(ctx context.Context, req *drawthings.TextToImageRequest) (*drawthings.TextToImageResponse, error) {
+	g.mu.Lock()
+	g.prompts = append(g.prompts, req.Prompt)
+	g.mu.Unlock()
+	select {
+	case <-g.release:
+	case <-ctx.Done():
+		return nil, drawthings.NewNetworkError("cancelled", ctx.Err())
+	}
+	return &drawthings.TextToImageResponse{Images: []string{"aW1n"}}, nil
+}
+
+func submit(t *testing.T, url, client, prompt string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url+PathTxt2Img, strings.NewReader(`{"prompt":"`+prompt+`"}`))
+	req.Header.Set(HeaderClient, client)
+	req.Header.Set(HeaderRequestID, prompt)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Errorf("POST %s: %v", prompt, err)
+		return nil
+	}
+	resp.Body.Close()
+	return resp
+}
+
+// waitForQueue waits until n requests are pending.
+func waitForQueue(t *testing.T, gw *Server, n int) QueueStatus {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		status := gw.Queue()
+		if len(status.Pending) == n {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d pending requests, got %+v", n, status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestGateway_FairOrdering(t *testing.T) {
+	gen := &blockingGenerator{release: make(chan struct{})}
+	gw := New(gen)
+	srv := httptest.NewServer(gw)
+	defer srv.Close()
+
+	var wg sync.WaitGroup
+	send := func(client, prompt string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			submit(t, srv.URL, client, prompt)
+		}()
+	}
+
+	// alice's first request occupies the server while the rest queue up.
+	send("alice", "a1")
+	for gw.Queue().Running == nil {
+		time.Sleep(5 * time.Millisecond)
+	}
+	send("alice", "a2")
+	waitForQueue(t, gw, 1)
+	send("alice", "a3")
+	waitForQueue(t, gw, 2)
+	send("bob", "b1")
+	status := waitForQueue(t, gw, 3)
+
+	var order []string
+	for _, e := range status.Pending {
+		order = append(order, e.ID)
+	}
+	if got := strings.Join(order, ","); got != "a2,b1,a3" {
+		t.Errorf("queue order: got %s, want a2,b1,a3", got)
+	}
+
+	// The queue endpoint filters by client.
+	resp, err := http.Get(srv.URL + PathQueue + "?client=bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bob QueueStatus
+	json.NewDecoder(resp.Body).Decode(&bob)
+	resp.Body.Close()
+	if bob.Running != nil || len(bob.Pending) != 1 || bob.Pending[0].Position != 2 {
+		t.Errorf("bob's queue: %+v", bob)
+	}
+
+	close(gen.release)
+	wg.Wait()
+	if got := strings.Join(gen.prompts, ","); got != "a1,a2,b1,a3" {
+		t.Errorf("forwarding order: got %s, want a1,a2,b1,a3", got)
+	}
+}
+
+func TestGateway_CancelledWhileQueued(t *testing.T) {
+	gen := &blockingGenerator{release: make(chan struct{})}
+	gw := New(gen)
+	srv := httptest.NewServer(gw)
+	defer srv.Close()
+
+	go submit(t, srv.URL, "alice", "first")
+	for gw.Queue().Running == nil {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+PathTxt2Img, strings.NewReader(`{"prompt":"gone"}`))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	waitForQueue(t, gw, 1)
+	cancel()
+	<-done
+	waitForQueue(t, gw, 0)
+
+	close(gen.release)
+	for gw.Queue().Running != nil {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := strings.Join(gen.prompts, ","); got != "first" {
+		t.Errorf("cancelled request should not be forwarded, got %s", got)
+	}
+}
+
+func TestGateway_EndToEnd(t *testing.T) {
+	upstream := drawthingstest.NewServer()
+	defer upstream.Close()
+
+	backend := drawthings.NewClient(drawthings.WithBaseURL(upstream.URL))
+	gw := New(backend, WithUpstream(upstream.URL))
+	srv := httptest.NewServer(gw)
+	defer srv.Close()
+
+	// Existing clients can point at the gateway unchanged.
+	client := drawthings.NewClient(drawthings.WithBaseURL(srv.URL))
+	resp, err := client.GenerateImage(context.Background(), &drawthings.TextToImageRequest{Prompt: "a fox", Width: 64, Height: 64})
+	if err != nil {
+		t.Fatalf("GenerateImage() through gateway: %v", err)
+	}
+	if len(resp.Images) != 1 {
+		t.Errorf("expected 1 image, got %d", len(resp.Images))
+	}
+
+	// Validation errors keep their field.
+	r, err := http.Post(srv.URL+PathTxt2Img, "application/json", strings.NewReader(`{"prompt":"x","steps":500}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body errorResponse
+	json.NewDecoder(r.Body).Decode(&body)
+	r.Body.Close()
+	if r.StatusCode != http.StatusUnprocessableEntity || body.Field != "steps" {
+		t.Errorf("validation error: status %d, body %+v", r.StatusCode, body)
+	}
+
+	// Upstream API errors keep their status.
+	upstream.QueueFailure(drawthingstest.StatusFailure(http.StatusInternalServerError))
+	_, err = client.GenerateImage(context.Background(), &drawthings.TextToImageRequest{Prompt: "x"})
+	if apiErr, ok := err.(*drawthings.APIError); !ok || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected upstream APIError 500, got %v", err)
+	}
+
+	// Other endpoints pass through.
+	r, err = http.Get(srv.URL + drawthingstest.PathProgress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		t.Errorf("progress passthrough: status %d", r.StatusCode)
+	}
+	if n := len(upstream.RequestsTo(drawthingstest.PathProgress)); n != 1 {
+		t.Errorf("progress requests upstream: got %d", n)
+	}
+}
+
+func TestGateway_UnknownFields(t *testing.T) {
+	upstream := drawthingstest.NewServer()
+	defer upstream.Close()
+	backend := drawthings.NewClient(drawthings.WithBaseURL(upstream.URL))
+
+	post := func(gw *Server, body string) (*http.Response, map[string]interface{}) {
+		t.Helper()
+		srv := httptest.NewServer(gw)
+		defer srv.Close()
+		r, err := http.Post(srv.URL+PathTxt2Img, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Body.Close()
+		var doc map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&doc)
+		return r, doc
+	}
+	const extended = `{"prompt":"a fox","width":64,"height":64,"seed":3,"sampler_name":"Euler a"}`
+
+	// Without an upstream, fields the client cannot send are rejected.
+	r, doc := post(New(backend), extended)
+	if r.StatusCode != http.StatusBadRequest || doc["field"] != "sampler_name" {
+		t.Errorf("no upstream: status %d, body %v", r.StatusCode, doc)
+	}
+	if n := len(upstream.Requests()); n != 0 {
+		t.Errorf("rejected request reached the upstream: %d requests", n)
+	}
+	if r, doc = post(New(backend), `{"prompt":`); r.StatusCode != http.StatusBadRequest || doc["error"] != "invalid_request" {
+		t.Errorf("invalid JSON: status %d, body %v", r.StatusCode, doc)
+	}
+
+	// With an upstream, they are forwarded as they are, and so is the
+	// response.
+	gw := New(backend, WithUpstream(upstream.URL))
+	r, doc = post(gw, extended)
+	if r.StatusCode != http.StatusOK || r.Header.Get(HeaderQueuePosition) != "0" {
+		t.Fatalf("forwarded request: status %d, headers %v", r.StatusCode, r.Header)
+	}
+	requests := upstream.RequestsTo(drawthingstest.PathTxt2Img)
+	if len(requests) != 1 || string(requests[0].Body) != extended {
+		t.Errorf("upstream received %v", requests)
+	}
+	if params, ok := doc["parameters"].(map[string]interface{}); !ok || params["prompt"] != "a fox" {
+		t.Errorf("forwarded response lost its parameters: %v", doc)
+	}
+
+	// Responses of requests sent through the client keep the server's
+	// parameters too.
+	if r, doc = post(gw, `{"prompt":"a cat","width":64,"height":64,"seed":3}`); r.StatusCode != http.StatusOK || doc["parameters"] == nil {
+		t.Errorf("client response: status %d, body keys %v", r.StatusCode, doc)
+	}
+}
+
+func TestGateway_MaxQueue(t *testing.T) {
+	gen := &blockingGenerator{release: make(chan struct{})}
+	gw := New(gen, WithMaxQueue(1))
+	srv := httptest.NewServer(gw)
+	defer srv.Close()
+	defer close(gen.release)
+
+	go submit(t, srv.URL, "a", "running")
+	for gw.Queue().Running == nil {
+		time.Sleep(5 * time.Millisecond)
+	}
+	go submit(t, srv.URL, "a", "queued")
+	waitForQueue(t, gw, 1)
+
+	resp := submit(t, srv.URL, "b", "rejected")
+	if resp == nil || resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("expected 503 with Retry-After, got %+v", resp)
+	}
+}
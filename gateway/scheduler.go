@@ -0,0 +1,136 @@
+package gateway
+
+import (
+	"time"
+)
+
+// ticket is a request waiting for, or holding, the upstream server.
+type ticket struct {
+	id       string
+	client   string
+	path     string
+	enqueued time.Time
+	started  time.Time
+	ready    chan struct{}
+}
+
+// scheduler grants the upstream server to one ticket at a time. Tickets of
+// the same client run in FIFO order; clients take turns round-robin, so one
+// client submitting many requests cannot starve the others.
+//
+// The caller must hold the Server's mutex for every method.
+type scheduler struct {
+	pending map[string][]*ticket
+	// order lists clients with pending tickets, next turn first.
+	order   []string
+	running *ticket
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{pending: map[string][]*ticket{}}
+}
+
+// enqueue adds t and returns its queue position (0 if it runs immediately).
+func (s *scheduler) enqueue(t *ticket) int {
+	if len(s.pending[t.client]) == 0 {
+		s.order = append(s.order, t.client)
+	}
+	s.pending[t.client] = append(s.pending[t.client], t)
+	if s.running == nil {
+		s.dispatch()
+	}
+	return s.position(t)
+}
+
+// remove drops a ticket that gave up waiting.
+func (s *scheduler) remove(t *ticket) {
+	queue := s.pending[t.client]
+	for i, q := range queue {
+		if q == t {
+			queue = append(queue[:i], queue[i+1:]...)
+			break
+		}
+	}
+	if len(queue) > 0 {
+		s.pending[t.client] = queue
+		return
+	}
+	delete(s.pending, t.client)
+	for i, c := range s.order {
+		if c == t.client {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// done releases the upstream server held by t and starts the next ticket.
+func (s *scheduler) done(t *ticket) {
+	if s.running == t {
+		s.running = nil
+		s.dispatch()
+	}
+}
+
+// dispatch starts the next ticket, if any.
+func (s *scheduler) dispatch() {
+	if len(s.order) == 0 {
+		return
+	}
+	client := s.order[0]
+	t := s.pending[client][0]
+	s.remove(t)
+	if len(s.pending[client]) > 0 {
+		// Move the client to the back of the rotation.
+		s.order = append(s.order[1:], client)
+	}
+	t.started = time.Now()
+	s.running = t
+	close(t.ready)
+}
+
+// queued returns the pending tickets in the order they will run.
+func (s *scheduler) queued() []*ticket {
+	pending := map[string][]*ticket{}
+	var total int
+	for c, q := range s.pending {
+		pending[c] = q
+		total += len(q)
+	}
+	order := append([]string(nil), s.order...)
+
+	tickets := make([]*ticket, 0, total)
+	for len(order) > 0 {
+		client := order[0]
+		tickets = append(tickets, pending[client][0])
+		pending[client] = pending[client][1:]
+		order = order[1:]
+		if len(pending[client]) > 0 {
+			order = append(order, client)
+		}
+	}
+	return tickets
+}
+
+// position returns 0 for the running ticket, and the 1-based position in
+// the queue for pending tickets.
+func (s *scheduler) position(t *ticket) int {
+	if s.running == t {
+		return 0
+	}
+	for i, q := range s.queued() {
+		if q == t {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// size returns the number of pending tickets.
+func (s *scheduler) size() int {
+	var n int
+	for _, q := range s.pending {
+		n += len(q)
+	}
+	return n
+}
@@ -0,0 +1,149 @@
+package drawthings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// progressPath is the Stable Diffusion API endpoint used to check that a
+// server is up and whether it is rendering.
+const progressPath = "/sdapi/v1/progress"
+
+// HealthStatus classifies the outcome of a health check.
+type HealthStatus string
+
+const (
+	// HealthOK means the server answers the API and is idle.
+	HealthOK HealthStatus = "ok"
+	// HealthBusy means the server answers the API but is rendering, so new
+	// requests will wait.
+	HealthBusy HealthStatus = "busy"
+	// HealthUnreachable means the host could not be reached: its name did
+	// not resolve, or the connection timed out or had no route.
+	HealthUnreachable HealthStatus = "unreachable"
+	// HealthRefused means the host is up but nothing listens on the port,
+	// usually because the port is wrong or the API server is not enabled.
+	HealthRefused HealthStatus = "refused"
+	// HealthNotAPI means something answered on the port, but it is not a
+	// Stable Diffusion API server.
+	HealthNotAPI HealthStatus = "not_api"
+)
+
+// Health is the result of a health check.
+type Health struct {
+	Status HealthStatus
+	// Message describes the status in a sentence.
+	Message string
+	// Latency is how long the server took to answer.
+	Latency time.Duration
+	// Progress is the progress of the current job, from 0 to 1, when the
+	// server is busy.
+	Progress float64
+	// JobCount is the number of jobs the server reports as running.
+	JobCount int
+}
+
+// Ready reports whether the server can accept requests.
+func (h *Health) Ready() bool {
+	return h.Status == HealthOK || h.Status == HealthBusy
+}
+
+// progressResponse is the body of the progress endpoint.
+type progressResponse struct {
+	Progress *float64 `json:"progress"`
+	State    *struct {
+		JobCount int `json:"job_count"`
+	} `json:"state"`
+}
+
+// Health checks whether the server is reachable and answers the API. The
+// returned Health is never nil. The error is nil when the server is ready,
+// and otherwise a *NetworkError or *APIError describing the problem.
+//
+// Health is not subject to WithMaxConcurrency. Use a context deadline to
+// bound how long it waits for an unresponsive host.
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	ctx, span := c.tracer.Start(ctx, SpanHealth, Attr(AttrEndpoint, progressPath))
+	h, err := c.health(withTraceParent(ctx, span))
+	span.SetAttributes(Attr(AttrHealth, string(h.Status)))
+	if err != nil {
+		span.SetAttributes(Attr(AttrErrorType, ErrorType(err)))
+	}
+	span.End(err)
+	return h, err
+}
+
+// health performs the check for Health.
+func (c *Client) health(ctx context.Context) (*Health, error) {
+	started := time.Now()
+	resp, err := c.httpClient.Get(ctx, c.baseURL+progressPath)
+	if err != nil {
+		h := &Health{Status: HealthUnreachable}
+		var dnsErr *net.DNSError
+		switch {
+		case errors.Is(ctx.Err(), context.Canceled):
+			h.Message = "health check canceled"
+			return h, NewNetworkError(h.Message, ctx.Err())
+		case errors.As(err, &dnsErr):
+			h.Message = fmt.Sprintf("cannot resolve host %q", dnsErr.Name)
+		case errors.Is(err, syscall.ECONNREFUSED):
+			h.Status = HealthRefused
+			h.Message = "connection refused: nothing is listening on the port"
+		case isTimeout(err):
+			h.Message = "connection timed out"
+		default:
+			h.Message = "host is unreachable"
+		}
+		return h, NewNetworkError(h.Message, err)
+	}
+	defer resp.Body.Close()
+
+	h := &Health{Latency: time.Since(started)}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		h.Status = HealthUnreachable
+		h.Message = "connection closed while reading the response"
+		return h, NewNetworkError(h.Message, err)
+	}
+
+	var progress progressResponse
+	if resp.StatusCode != http.StatusOK ||
+		json.Unmarshal(body, &progress) != nil || progress.Progress == nil || progress.State == nil {
+		h.Status = HealthNotAPI
+		h.Message = fmt.Sprintf("server answered %s but is not a Stable Diffusion API server", resp.Status)
+		apiErr := NewAPIError(resp, string(body))
+		apiErr.Message = h.Message
+		return h, apiErr
+	}
+
+	h.Progress = *progress.Progress
+	h.JobCount = progress.State.JobCount
+	if h.JobCount > 0 {
+		h.Status = HealthBusy
+		h.Message = fmt.Sprintf("server is rendering (%.0f%% done)", h.Progress*100)
+	} else {
+		h.Status = HealthOK
+		h.Message = "server is ready"
+	}
+	return h, nil
+}
+
+// Ping checks that the server is reachable and answers the API. It returns
+// the same error as Health.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Health(ctx)
+	return err
+}
+
+// isTimeout reports whether err is a network timeout.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
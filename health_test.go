@@ -0,0 +1,129 @@
+package drawthings
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/drawthings_go/drawthingstest"
+)
+
+func TestClient_Health(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+	client := NewClient(WithBaseURL(server.URL))
+
+	h, err := client.Health(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if h.Status != HealthOK || !h.Ready() {
+		t.Errorf("expected ready server, got %+v", h)
+	}
+	if err := client.Ping(context.Background()); err != nil {
+		t.Errorf("Ping failed: %v", err)
+	}
+}
+
+func TestClient_Health_Busy(t *testing.T) {
+	server := drawthingstest.NewServer(drawthingstest.WithLatency(500 * time.Millisecond))
+	defer server.Close()
+	client := NewClient(WithBaseURL(server.URL))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.GenerateImage(context.Background(), &TextToImageRequest{Prompt: "fox"})
+	}()
+	defer func() { <-done }()
+
+	deadline := time.Now().Add(time.Second)
+	for len(server.RequestsTo(drawthingstest.PathTxt2Img)) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	h, err := client.Health(context.Background())
+	if err != nil {
+		t.Fatalf("a busy server should be ready, got %v", err)
+	}
+	if h.Status != HealthBusy || h.JobCount != 1 {
+		t.Errorf("expected busy server, got %+v", h)
+	}
+}
+
+func TestClient_Health_Refused(t *testing.T) {
+	// Find a free port and close it so nothing listens there.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	client := NewClient(WithBaseURL("http://" + addr))
+	h, err := client.Health(context.Background())
+	if !IsNetworkError(err) {
+		t.Fatalf("expected NetworkError, got %v", err)
+	}
+	if h.Status != HealthRefused || h.Ready() {
+		t.Errorf("expected refused, got %+v", h)
+	}
+}
+
+func TestClient_Health_Unreachable(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(WithBaseURL("http://drawthings.invalid:7860"))
+	h, err := client.Health(ctx)
+	if !IsNetworkError(err) {
+		t.Fatalf("expected NetworkError, got %v", err)
+	}
+	if h.Status != HealthUnreachable {
+		t.Errorf("expected unreachable, got %+v", h)
+	}
+}
+
+func TestClient_Health_NotAPI(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{
+			name: "not found",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.NotFound(w, r)
+			},
+		},
+		{
+			name: "html",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("<html>router login</html>"))
+			},
+		},
+		{
+			name: "other json",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"status":"ok"}`))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			h, err := NewClient(WithBaseURL(server.URL)).Health(context.Background())
+			if !IsAPIError(err) {
+				t.Fatalf("expected APIError, got %v", err)
+			}
+			if h.Status != HealthNotAPI {
+				t.Errorf("expected not_api, got %+v", h)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package drawthings
+
+import (
+	"context"
+	"fmt"
+)
+
+// img2imgPath is the image-to-image endpoint.
+const img2imgPath = "/sdapi/v1/img2img"
+
+// DefaultDenoisingStrength is the denoising strength used when a request
+// leaves it unset.
+const DefaultDenoisingStrength = 0.75
+
+// ImageToImageRequest represents a request to generate an image from a
+// source image and a text prompt.
+type ImageToImageRequest struct {
+	TextToImageRequest
+
+	// InitImages holds the base64-encoded source image (required).
+	InitImages []string `json:"init_images"`
+
+	// DenoisingStrength is how far the result may move away from the source
+	// image, from 0 (not at all) to 1 (entirely). Like a zero Seed, a zero
+	// value means the default, so the smallest strength that can be sent is
+	// just above 0.
+	// Range: 0-1, Default: 0.75
+	DenoisingStrength float64 `json:"denoising_strength,omitempty"`
+
+	// Mask holds the base64-encoded inpainting mask. White areas of the mask
+	// are repainted and black areas are kept. Without a mask, the whole
+	// image is repainted.
+	Mask string `json:"mask,omitempty"`
+
+	// MaskBlur is the radius in pixels by which the mask edge is blurred.
+	// Range: 0-64
+	MaskBlur int `json:"mask_blur,omitempty"`
+}
+
+// SetDefaults sets default values for optional fields if they are zero
+// values.
+func (r *ImageToImageRequest) SetDefaults() {
+	r.TextToImageRequest.SetDefaults()
+	if r.DenoisingStrength == 0 {
+		r.DenoisingStrength = DefaultDenoisingStrength
+	}
+}
+
+// Validate checks the request parameters like TextToImageRequest.Validate,
+// and also checks the source image and denoising strength.
+func (r *ImageToImageRequest) Validate() error {
+	if err := r.TextToImageRequest.Validate(); err != nil {
+		return err
+	}
+	return r.validateImage()
+}
+
+// validateImage checks the fields specific to image-to-image requests.
+func (r *ImageToImageRequest) validateImage() error {
+	if len(r.InitImages) == 0 || r.InitImages[0] == "" {
+		return NewValidationError("init_images", "a source image is required")
+	}
+	if r.DenoisingStrength < 0 || r.DenoisingStrength > 1 {
+		return NewValidationError("denoising_strength", fmt.Sprintf("denoising_strength must be between 0 and 1, got %.2f", r.DenoisingStrength))
+	}
+	if r.MaskBlur < 0 || r.MaskBlur > 64 {
+		return NewValidationError("mask_blur", fmt.Sprintf("mask_blur must be between 0 and 64, got %d", r.MaskBlur))
+	}
+	return nil
+}
+
+// ImageToImage generates an image from a source image and a text prompt.
+// The response has the same form as that of GenerateImage. Responses are
+// not cached or shared between identical requests.
+func (c *Client) ImageToImage(ctx context.Context, req *ImageToImageRequest) (*TextToImageResponse, error) {
+	req.SetDefaults()
+
+	ctx, span := c.tracer.Start(ctx, SpanImageToImage,
+		Attr(AttrEndpoint, img2imgPath),
+		Attr(AttrSteps, req.Steps),
+		Attr(AttrWidth, req.Width),
+		Attr(AttrHeight, req.Height),
+		Attr(AttrSeed, req.Seed),
+		Attr(AttrGuidanceScale, req.GuidanceScale),
+	)
+	resp, err := c.imageToImage(ctx, req, span)
+	if err != nil {
+		span.SetAttributes(Attr(AttrErrorType, ErrorType(err)))
+	} else {
+		span.SetAttributes(Attr(AttrImages, len(resp.Images)))
+	}
+	span.End(err)
+	return resp, err
+}
+
+// imageToImage sends an img2img request within span.
+func (c *Client) imageToImage(ctx context.Context, req *ImageToImageRequest, span Span) (*TextToImageResponse, error) {
+	if err := c.validate(&req.TextToImageRequest); err != nil {
+		return nil, err
+	}
+	if err := req.validateImage(); err != nil {
+		return nil, err
+	}
+	return c.post(ctx, img2imgPath, req, span)
+}
@@ -0,0 +1,65 @@
+package drawthings
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/drawthings_go/drawthingstest"
+)
+
+func TestImageToImage(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+	recorder := NewSpanRecorder()
+	client := NewClient(WithBaseURL(server.URL), WithTracer(recorder))
+
+	init := base64.StdEncoding.EncodeToString(drawthingstest.Image("a harbor", 1, 64, 64))
+	req := &ImageToImageRequest{
+		TextToImageRequest: TextToImageRequest{Prompt: "a harbor at night", Width: 128, Height: 64, Seed: 7},
+		InitImages:         []string{init},
+	}
+	resp, err := client.ImageToImage(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ImageToImage() error = %v", err)
+	}
+	if len(resp.Images) != 1 {
+		t.Fatalf("expected 1 image, got %d", len(resp.Images))
+	}
+
+	requests := server.RequestsTo(drawthingstest.PathImg2Img)
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 img2img request, got %d", len(requests))
+	}
+	var sent ImageToImageRequest
+	if err := requests[0].Decode(&sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.Prompt != "a harbor at night" || sent.Width != 128 || sent.Steps != 20 || sent.DenoisingStrength != DefaultDenoisingStrength || sent.InitImages[0] != init {
+		t.Errorf("unexpected request %+v", sent.TextToImageRequest)
+	}
+	if spans := recorder.Spans(); len(spans) != 1 || spans[0].Name != SpanImageToImage {
+		t.Errorf("unexpected spans %+v", spans)
+	}
+}
+
+func TestImageToImageRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name  string
+		req   ImageToImageRequest
+		field string
+	}{
+		{"no image", ImageToImageRequest{TextToImageRequest: TextToImageRequest{Prompt: "x"}}, "init_images"},
+		{"strength", ImageToImageRequest{TextToImageRequest: TextToImageRequest{Prompt: "x"}, InitImages: []string{"aGk="}, DenoisingStrength: 1.5}, "denoising_strength"},
+		{"mask blur", ImageToImageRequest{TextToImageRequest: TextToImageRequest{Prompt: "x"}, InitImages: []string{"aGk="}, Mask: "aGk=", MaskBlur: -1}, "mask_blur"},
+		{"too wide", ImageToImageRequest{TextToImageRequest: TextToImageRequest{Prompt: "x", Width: MaxDimension + 64}, InitImages: []string{"aGk="}}, "width"},
+	}
+	for _, tt := range tests {
+		tt.req.SetDefaults()
+		err := tt.req.Validate()
+		valErr, ok := err.(*ValidationError)
+		if !ok || valErr.Field != tt.field {
+			t.Errorf("%s: Validate() error = %v, want a %s ValidationError", tt.name, err, tt.field)
+		}
+	}
+}
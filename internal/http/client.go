@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -15,20 +17,59 @@ type Logger interface {
 	Logf(format string, args ...interface{})
 }
 
+// Observer receives a measurement for every request the client sends.
+// Endpoint is the URL path; outcome is one of the Outcome constants. The
+// duration and byte count cover reading the response body, so they are
+// reported when the body is closed.
+type Observer interface {
+	ObserveRequest(endpoint, outcome string, duration time.Duration, bytes int64)
+}
+
+// Request outcomes reported to an Observer. They match the error types of
+// the drawthings package.
+const (
+	OutcomeOK       = "ok"
+	OutcomeAPI      = "api"
+	OutcomeNetwork  = "network"
+	OutcomeCanceled = "canceled"
+)
+
 // Client wraps an HTTP client with additional functionality.
 type Client struct {
 	httpClient *http.Client
 	logger     Logger
+	observer   Observer
+}
+
+// Option is a function that configures a Client.
+type Option func(*Client)
+
+// WithTransport sets the transport used to send requests.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		c.httpClient.Transport = transport
+	}
+}
+
+// WithObserver reports every request to o.
+func WithObserver(o Observer) Option {
+	return func(c *Client) {
+		c.observer = o
+	}
 }
 
 // NewClient creates a new HTTP client wrapper.
-func NewClient(timeout time.Duration, logger Logger) *Client {
-	return &Client{
+func NewClient(timeout time.Duration, logger Logger, opts ...Option) *Client {
+	c := &Client{
 		httpClient: &http.Client{
 			Timeout: timeout,
 		},
 		logger: logger,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // PostJSON sends a POST request with JSON body and returns the response.
@@ -53,7 +94,7 @@ func (c *Client) PostJSON(ctx context.Context, url string, body interface{}) (*h
 
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
@@ -65,6 +106,109 @@ func (c *Client) PostJSON(ctx context.Context, url string, body interface{}) (*h
 	return resp, nil
 }
 
+// Get sends a GET request and returns the response.
+func (c *Client) Get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if c.logger != nil {
+		c.logger.Logf("GET %s", url)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	if c.logger != nil {
+		c.logger.Logf("Response status: %s", resp.Status)
+	}
+
+	return resp, nil
+}
+
+// headersKey is the context key for headers added with ContextWithHeader.
+type headersKey struct{}
+
+// ContextWithHeader returns a copy of ctx that sets the header key to value
+// on every request sent with it, such as a tracing header.
+func ContextWithHeader(ctx context.Context, key, value string) context.Context {
+	headers := http.Header{}
+	if parent, ok := ctx.Value(headersKey{}).(http.Header); ok {
+		headers = parent.Clone()
+	}
+	headers.Set(key, value)
+	return context.WithValue(ctx, headersKey{}, headers)
+}
+
+// do sends req, reporting it to the observer if there is one.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if headers, ok := req.Context().Value(headersKey{}).(http.Header); ok {
+		for key, values := range headers {
+			req.Header[key] = values
+		}
+	}
+	if c.observer == nil {
+		return c.httpClient.Do(req)
+	}
+
+	started := time.Now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.observer.ObserveRequest(req.URL.Path, failureOutcome(req.Context()), time.Since(started), 0)
+		return nil, err
+	}
+
+	outcome := OutcomeOK
+	if resp.StatusCode >= 400 {
+		outcome = OutcomeAPI
+	}
+	resp.Body = &observedBody{
+		ReadCloser: resp.Body,
+		report: func(read int64, readErr error) {
+			if readErr != nil && outcome == OutcomeOK {
+				outcome = failureOutcome(req.Context())
+			}
+			c.observer.ObserveRequest(req.URL.Path, outcome, time.Since(started), read)
+		},
+	}
+	return resp, nil
+}
+
+// failureOutcome returns the outcome of a request that failed in transit.
+func failureOutcome(ctx context.Context) string {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return OutcomeCanceled
+	}
+	return OutcomeNetwork
+}
+
+// observedBody counts the bytes read from a response body and reports them
+// once, when the body is closed.
+type observedBody struct {
+	io.ReadCloser
+	read    int64
+	readErr error
+	once    sync.Once
+	report  func(read int64, readErr error)
+}
+
+func (b *observedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF && b.readErr == nil {
+		b.readErr = err
+	}
+	return n, err
+}
+
+func (b *observedBody) Close() error {
+	b.once.Do(func() { b.report(b.read, b.readErr) })
+	return b.ReadCloser.Close()
+}
+
 // HTTPError represents an HTTP error response.
 type HTTPError struct {
 	StatusCode int
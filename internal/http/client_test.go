@@ -3,6 +3,7 @@ package httpclient
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -47,6 +48,26 @@ func TestClient_PostJSON(t *testing.T) {
 	}
 }
 
+func TestClient_Get(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("expected GET, got %s", r.Method)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := NewClient(5*time.Second, nil)
+	resp, err := client.Get(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", resp.StatusCode)
+	}
+}
+
 func TestClient_PostJSON_ErrorHandling(t *testing.T) {
 	client := NewClient(100*time.Millisecond, nil)
 	ctx := context.Background()
@@ -165,3 +186,79 @@ func (l *testLogger) Logf(format string, args ...interface{}) {
 	l.logFunc(format, args...)
 }
 
+func TestClient_Observer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer server.Close()
+
+	obs := &testObserver{}
+	client := NewClient(5*time.Second, nil, WithObserver(obs))
+	ctx := context.Background()
+
+	resp, err := client.PostJSON(ctx, server.URL+"/ok", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result map[string]interface{}
+	if err := client.DecodeJSONResponse(resp, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = client.Get(ctx, server.URL+"/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Bytes are counted as they are read; this body is closed unread.
+	resp.Body.Close()
+
+	server.Close()
+	if _, err := client.Get(ctx, server.URL+"/down"); err == nil {
+		t.Fatal("expected an error from a closed server")
+	}
+
+	want := []string{"/ok ok 15", "/missing api 0", "/down network 0"}
+	if len(obs.observed) != len(want) {
+		t.Fatalf("observed %q, want %q", obs.observed, want)
+	}
+	for i := range want {
+		if obs.observed[i] != want[i] {
+			t.Errorf("observation %d = %q, want %q", i, obs.observed[i], want[i])
+		}
+	}
+}
+
+type testObserver struct {
+	observed []string
+}
+
+func (o *testObserver) ObserveRequest(endpoint, outcome string, duration time.Duration, bytes int64) {
+	o.observed = append(o.observed, fmt.Sprintf("%s %s %d", endpoint, outcome, bytes))
+}
+
+func TestContextWithHeader(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer server.Close()
+
+	ctx := ContextWithHeader(context.Background(), "traceparent", "00-a-b-01")
+	ctx = ContextWithHeader(ctx, "X-Other", "1")
+	resp, err := NewClient(5*time.Second, nil).PostJSON(ctx, server.URL, map[string]int{"n": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if got.Get("traceparent") != "00-a-b-01" || got.Get("X-Other") != "1" {
+		t.Errorf("headers not sent: %v", got)
+	}
+	if got.Get("Content-Type") != "application/json" {
+		t.Errorf("context headers replaced Content-Type: %v", got)
+	}
+}
@@ -4,29 +4,50 @@ import (
 	"fmt"
 )
 
+// FieldError describes a parameter that failed validation.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("validation error for field '%s': %s", e.Field, e.Message)
+}
+
+func fieldError(field, format string, args ...interface{}) error {
+	return &FieldError{Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// MinDimension and MaxDimension bound the width and height of an image in
+// pixels.
+const (
+	MinDimension = 64
+	MaxDimension = 4096
+)
+
 // ValidateTextToImageRequest validates request parameters.
 // This is a helper function that works with the request struct fields directly.
+// Failures are returned as *FieldError.
 func ValidateTextToImageRequest(prompt string, steps int, guidanceScale float64, width, height int) error {
 	if prompt == "" {
-		return fmt.Errorf("validation error for field 'prompt': prompt is required and cannot be empty")
+		return fieldError("prompt", "prompt is required and cannot be empty")
 	}
 
 	if steps < 1 || steps > 150 {
-		return fmt.Errorf("validation error for field 'steps': steps must be between 1 and 150, got %d", steps)
+		return fieldError("steps", "steps must be between 1 and 150, got %d", steps)
 	}
 
 	if guidanceScale < 1.0 || guidanceScale > 20.0 {
-		return fmt.Errorf("validation error for field 'guidance_scale': guidance_scale must be between 1.0 and 20.0, got %.2f", guidanceScale)
+		return fieldError("guidance_scale", "guidance_scale must be between 1.0 and 20.0, got %.2f", guidanceScale)
 	}
 
-	if width < 64 || width > 4096 {
-		return fmt.Errorf("validation error for field 'width': width must be between 64 and 4096 pixels, got %d", width)
+	if width < MinDimension || width > MaxDimension {
+		return fieldError("width", "width must be between %d and %d pixels, got %d", MinDimension, MaxDimension, width)
 	}
 
-	if height < 64 || height > 4096 {
-		return fmt.Errorf("validation error for field 'height': height must be between 64 and 4096 pixels, got %d", height)
+	if height < MinDimension || height > MaxDimension {
+		return fieldError("height", "height must be between %d and %d pixels, got %d", MinDimension, MaxDimension, height)
 	}
 
 	return nil
 }
-
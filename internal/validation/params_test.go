@@ -14,6 +14,7 @@ func TestValidateTextToImageRequest(t *testing.T) {
 		width         int
 		height        int
 		wantErr       bool
+		wantField     string
 	}{
 		{
 			name:          "valid request",
@@ -32,6 +33,7 @@ func TestValidateTextToImageRequest(t *testing.T) {
 			width:         512,
 			height:        512,
 			wantErr:       true,
+			wantField:     "prompt",
 		},
 		{
 			name:          "steps too low",
@@ -41,6 +43,7 @@ func TestValidateTextToImageRequest(t *testing.T) {
 			width:         512,
 			height:        512,
 			wantErr:       true,
+			wantField:     "steps",
 		},
 		{
 			name:          "steps too high",
@@ -50,6 +53,7 @@ func TestValidateTextToImageRequest(t *testing.T) {
 			width:         512,
 			height:        512,
 			wantErr:       true,
+			wantField:     "steps",
 		},
 		{
 			name:          "guidance_scale too low",
@@ -59,6 +63,7 @@ func TestValidateTextToImageRequest(t *testing.T) {
 			width:         512,
 			height:        512,
 			wantErr:       true,
+			wantField:     "guidance_scale",
 		},
 		{
 			name:          "guidance_scale too high",
@@ -68,6 +73,7 @@ func TestValidateTextToImageRequest(t *testing.T) {
 			width:         512,
 			height:        512,
 			wantErr:       true,
+			wantField:     "guidance_scale",
 		},
 		{
 			name:          "width too low",
@@ -77,6 +83,7 @@ func TestValidateTextToImageRequest(t *testing.T) {
 			width:         32,
 			height:        512,
 			wantErr:       true,
+			wantField:     "width",
 		},
 		{
 			name:          "width too high",
@@ -86,6 +93,7 @@ func TestValidateTextToImageRequest(t *testing.T) {
 			width:         8192,
 			height:        512,
 			wantErr:       true,
+			wantField:     "width",
 		},
 		{
 			name:          "height too low",
@@ -95,6 +103,7 @@ func TestValidateTextToImageRequest(t *testing.T) {
 			width:         512,
 			height:        32,
 			wantErr:       true,
+			wantField:     "height",
 		},
 		{
 			name:          "height too high",
@@ -104,6 +113,7 @@ func TestValidateTextToImageRequest(t *testing.T) {
 			width:         512,
 			height:        8192,
 			wantErr:       true,
+			wantField:     "height",
 		},
 	}
 
@@ -118,6 +128,13 @@ func TestValidateTextToImageRequest(t *testing.T) {
 				if !strings.Contains(err.Error(), "validation error") {
 					t.Errorf("expected validation error message, got %q", err.Error())
 				}
+				fieldErr, ok := err.(*FieldError)
+				if !ok {
+					t.Fatalf("expected *FieldError, got %T", err)
+				}
+				if fieldErr.Field != tt.wantField {
+					t.Errorf("Field: got %q, want %q", fieldErr.Field, tt.wantField)
+				}
 			}
 		})
 	}
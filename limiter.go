@@ -0,0 +1,208 @@
+package drawthings
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Priority orders requests waiting for a slot when the client limits
+// concurrency with WithMaxConcurrency. Higher priorities are served first;
+// requests of equal priority are served in arrival order.
+type Priority int
+
+// Request priorities.
+const (
+	// PriorityBatch is for background work such as batch and queue jobs.
+	PriorityBatch Priority = -1
+	// PriorityNormal is the default.
+	PriorityNormal Priority = 0
+	// PriorityInteractive is for requests a person is waiting on.
+	PriorityInteractive Priority = 1
+)
+
+// String returns the name of the priority.
+func (p Priority) String() string {
+	switch p {
+	case PriorityBatch:
+		return "batch"
+	case PriorityNormal:
+		return "normal"
+	case PriorityInteractive:
+		return "interactive"
+	default:
+		return "unknown"
+	}
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a context that gives requests made with it priority p.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFromContext returns the priority set with WithPriority, or
+// PriorityNormal.
+func PriorityFromContext(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return PriorityNormal
+}
+
+// priorities lists the lanes from highest to lowest.
+var priorities = []Priority{PriorityInteractive, PriorityNormal, PriorityBatch}
+
+// lane returns the index into priorities for p.
+func lane(p Priority) int {
+	switch {
+	case p >= PriorityInteractive:
+		return 0
+	case p <= PriorityBatch:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// LimiterStats describes the concurrency limiter of a Client.
+type LimiterStats struct {
+	// MaxConcurrency is the configured limit (0 when unlimited).
+	MaxConcurrency int
+	// InFlight is the number of requests currently holding a slot.
+	InFlight int
+	// Waiting is the number of requests waiting for a slot, by priority.
+	Waiting map[Priority]int
+	// Acquired counts requests that obtained a slot.
+	Acquired int64
+	// Abandoned counts requests whose context ended while waiting.
+	Abandoned int64
+	// TotalWait and MaxWait summarize the time spent waiting for a slot.
+	TotalWait time.Duration
+	MaxWait   time.Duration
+}
+
+// AverageWait returns the mean time acquired requests waited for a slot.
+func (s LimiterStats) AverageWait() time.Duration {
+	if s.Acquired == 0 {
+		return 0
+	}
+	return s.TotalWait / time.Duration(s.Acquired)
+}
+
+// limiter is a fair, context-aware semaphore with priority lanes.
+type limiter struct {
+	max int
+
+	mu       sync.Mutex
+	inFlight int
+	waiters  [3][]*waiter
+	stats    LimiterStats
+}
+
+// waiter is a request waiting for a slot. ready is closed when it is granted.
+type waiter struct {
+	ready chan struct{}
+}
+
+func newLimiter(max int) *limiter {
+	return &limiter{max: max}
+}
+
+// acquire waits for a slot and returns the time spent waiting. It fails
+// only when ctx ends first.
+func (l *limiter) acquire(ctx context.Context) (time.Duration, error) {
+	started := time.Now()
+	l.mu.Lock()
+	if l.inFlight < l.max && l.waiting() == 0 {
+		l.inFlight++
+		l.recordAcquire(0)
+		l.mu.Unlock()
+		return 0, nil
+	}
+	w := &waiter{ready: make(chan struct{})}
+	i := lane(PriorityFromContext(ctx))
+	l.waiters[i] = append(l.waiters[i], w)
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		wait := time.Since(started)
+		l.mu.Lock()
+		l.recordAcquire(wait)
+		l.mu.Unlock()
+		return wait, nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		select {
+		case <-w.ready:
+			// Granted while giving up; pass the slot on.
+			l.releaseLocked()
+		default:
+			l.removeLocked(i, w)
+		}
+		l.stats.Abandoned++
+		return time.Since(started), ctx.Err()
+	}
+}
+
+// release frees a slot, handing it to the next waiter if there is one.
+func (l *limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.releaseLocked()
+}
+
+func (l *limiter) releaseLocked() {
+	for i, queue := range l.waiters {
+		if len(queue) > 0 {
+			// The slot moves straight to the waiter; inFlight is unchanged.
+			w := queue[0]
+			l.waiters[i] = queue[1:]
+			close(w.ready)
+			return
+		}
+	}
+	l.inFlight--
+}
+
+func (l *limiter) removeLocked(i int, w *waiter) {
+	queue := l.waiters[i]
+	for j, q := range queue {
+		if q == w {
+			l.waiters[i] = append(queue[:j:j], queue[j+1:]...)
+			return
+		}
+	}
+}
+
+func (l *limiter) waiting() int {
+	var n int
+	for _, queue := range l.waiters {
+		n += len(queue)
+	}
+	return n
+}
+
+func (l *limiter) recordAcquire(wait time.Duration) {
+	l.stats.Acquired++
+	l.stats.TotalWait += wait
+	if wait > l.stats.MaxWait {
+		l.stats.MaxWait = wait
+	}
+}
+
+func (l *limiter) snapshot() LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := l.stats
+	stats.MaxConcurrency = l.max
+	stats.InFlight = l.inFlight
+	stats.Waiting = make(map[Priority]int, len(priorities))
+	for i, p := range priorities {
+		stats.Waiting[p] = len(l.waiters[i])
+	}
+	return stats
+}
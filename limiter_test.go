@@ -0,0 +1,172 @@
+package drawthings
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drawthings_go/drawthingstest"
+)
+
+func TestMaxConcurrency_WaitDoesNotCountAgainstTimeout(t *testing.T) {
+	server := drawthingstest.NewServer(drawthingstest.WithLatency(100 * time.Millisecond))
+	defer server.Close()
+
+	// Three serialized requests take 300ms, twice the timeout, yet each one
+	// only spends 100ms on the wire.
+	client := NewClient(
+		WithBaseURL(server.URL),
+		WithTimeout(150*time.Millisecond),
+		WithMaxConcurrency(1),
+	)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.GenerateImage(context.Background(), &TextToImageRequest{Prompt: "test", Width: 64, Height: 64})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("GenerateImage() error = %v", err)
+		}
+	}
+
+	// The server never saw overlapping requests.
+	requests := server.RequestsTo(drawthingstest.PathTxt2Img)
+	for i := 1; i < len(requests); i++ {
+		if gap := requests[i].Time.Sub(requests[i-1].Time); gap < 90*time.Millisecond {
+			t.Errorf("requests %d and %d overlapped (%v apart)", i-1, i, gap)
+		}
+	}
+
+	stats := client.LimiterStats()
+	if stats.Acquired != 3 || stats.InFlight != 0 || stats.MaxWait < 150*time.Millisecond {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+// gatedTransport blocks every request until released and records prompts.
+type gatedTransport struct {
+	mu      sync.Mutex
+	prompts []string
+	release chan struct{}
+}
+
+func (g *gatedTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var req TextToImageRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	g.mu.Lock()
+	g.prompts = append(g.prompts, req.Prompt)
+	g.mu.Unlock()
+	<-g.release
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Body:       io.NopCloser(strings.NewReader(`{"images":["aW1n"]}`)),
+		Header:     http.Header{},
+	}, nil
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMaxConcurrency_PriorityLanes(t *testing.T) {
+	transport := &gatedTransport{release: make(chan struct{})}
+	client := NewClient(WithTransport(transport), WithMaxConcurrency(1))
+
+	var wg sync.WaitGroup
+	send := func(ctx context.Context, prompt string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.GenerateImage(ctx, &TextToImageRequest{Prompt: prompt}); err != nil {
+				t.Errorf("%s: %v", prompt, err)
+			}
+		}()
+	}
+
+	ctx := context.Background()
+	send(ctx, "first")
+	waitFor(t, func() bool { return client.LimiterStats().InFlight == 1 })
+	send(WithPriority(ctx, PriorityBatch), "batch-1")
+	waitFor(t, func() bool { return client.LimiterStats().Waiting[PriorityBatch] == 1 })
+	send(WithPriority(ctx, PriorityBatch), "batch-2")
+	waitFor(t, func() bool { return client.LimiterStats().Waiting[PriorityBatch] == 2 })
+	send(WithPriority(ctx, PriorityInteractive), "interactive")
+	waitFor(t, func() bool { return client.LimiterStats().Waiting[PriorityInteractive] == 1 })
+
+	close(transport.release)
+	wg.Wait()
+
+	if got := strings.Join(transport.prompts, ","); got != "first,interactive,batch-1,batch-2" {
+		t.Errorf("order: got %s", got)
+	}
+}
+
+func TestMaxConcurrency_CancelWhileWaiting(t *testing.T) {
+	transport := &gatedTransport{release: make(chan struct{})}
+	client := NewClient(WithTransport(transport), WithMaxConcurrency(1))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.GenerateImage(context.Background(), &TextToImageRequest{Prompt: "first"})
+	}()
+	waitFor(t, func() bool { return client.LimiterStats().InFlight == 1 })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		_, err := client.GenerateImage(ctx, &TextToImageRequest{Prompt: "waiting"})
+		errc <- err
+	}()
+	waitFor(t, func() bool { return client.LimiterStats().Waiting[PriorityNormal] == 1 })
+	cancel()
+
+	err := <-errc
+	if ErrorType(err) != ErrorTypeCanceled {
+		t.Errorf("expected a canceled error, got %v", err)
+	}
+	stats := client.LimiterStats()
+	if stats.Abandoned != 1 || stats.Waiting[PriorityNormal] != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	close(transport.release)
+	<-done
+	if got := strings.Join(transport.prompts, ","); got != "first" {
+		t.Errorf("cancelled request should not be sent, got %s", got)
+	}
+	if stats := client.LimiterStats(); stats.InFlight != 0 {
+		t.Errorf("slot leaked: %+v", stats)
+	}
+}
+
+func TestPriorityFromContext(t *testing.T) {
+	if p := PriorityFromContext(context.Background()); p != PriorityNormal {
+		t.Errorf("default priority: got %v", p)
+	}
+	if p := PriorityFromContext(WithPriority(context.Background(), PriorityBatch)); p != PriorityBatch {
+		t.Errorf("got %v, want batch", p)
+	}
+}
@@ -0,0 +1,236 @@
+// Package metrics collects measurements from Draw Things clients and
+// gateways and exposes them in the Prometheus text format.
+//
+// A Collector is passed to drawthings.WithMetrics, gateway.WithMetrics and
+// queue.WithMetrics, and served over HTTP for scraping:
+//
+//	collector := metrics.NewCollector()
+//	client := drawthings.NewClient(drawthings.WithMetrics(collector))
+//	http.Handle("/metrics", collector)
+//
+// It has no dependencies outside the standard library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the latency and queue
+// wait histograms. Renders take from under a second to several minutes.
+var DefaultBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// Collector records measurements and serves them in the Prometheus text
+// format. It is safe for concurrent use. The zero value is not usable; create
+// collectors with NewCollector.
+type Collector struct {
+	namespace string
+	buckets   []float64
+
+	mu        sync.Mutex
+	requests  map[labels]uint64
+	durations map[labels]*histogram
+	bytes     map[labels]uint64
+	retries   map[labels]uint64
+	waits     map[labels]*histogram
+}
+
+// Option is a function that configures a Collector.
+type Option func(*Collector)
+
+// WithNamespace sets the prefix of metric names (default: "drawthings").
+func WithNamespace(namespace string) Option {
+	return func(c *Collector) {
+		c.namespace = namespace
+	}
+}
+
+// WithBuckets sets the histogram bucket upper bounds, in seconds.
+func WithBuckets(buckets []float64) Option {
+	return func(c *Collector) {
+		c.buckets = append([]float64(nil), buckets...)
+		sort.Float64s(c.buckets)
+	}
+}
+
+// NewCollector creates an empty collector.
+func NewCollector(opts ...Option) *Collector {
+	c := &Collector{
+		namespace: "drawthings",
+		buckets:   DefaultBuckets,
+		requests:  make(map[labels]uint64),
+		durations: make(map[labels]*histogram),
+		bytes:     make(map[labels]uint64),
+		retries:   make(map[labels]uint64),
+		waits:     make(map[labels]*histogram),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ObserveRequest records a request to the Draw Things server. Endpoint is
+// the URL path and outcome is "ok" or the error type of a failed request.
+func (c *Collector) ObserveRequest(endpoint, outcome string, duration time.Duration, bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.requests[labels{"endpoint", endpoint, "outcome", outcome}]++
+	c.histogram(c.durations, labels{"endpoint", endpoint, "", ""}).observe(duration.Seconds())
+	c.bytes[labels{"endpoint", endpoint, "", ""}] += uint64(bytes)
+}
+
+// ObserveRetry records that a request was sent again after a failure.
+// Source names what retried it, such as "pool" or "queue".
+func (c *Collector) ObserveRetry(source string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.retries[labels{"source", source, "", ""}]++
+}
+
+// ObserveQueueWait records how long a request waited before it was sent.
+// Queue names where it waited, such as "client" or "gateway".
+func (c *Collector) ObserveQueueWait(queue string, wait time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.histogram(c.waits, labels{"queue", queue, "", ""}).observe(wait.Seconds())
+}
+
+// histogram returns the histogram for l in m, creating it if needed.
+func (c *Collector) histogram(m map[labels]*histogram, l labels) *histogram {
+	h, ok := m[l]
+	if !ok {
+		h = &histogram{bounds: c.buckets, counts: make([]uint64, len(c.buckets))}
+		m[l] = h
+	}
+	return h
+}
+
+// ServeHTTP writes the current measurements in the Prometheus text format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Write(w)
+}
+
+// Write writes the current measurements to w in the Prometheus text format.
+func (c *Collector) Write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	c.writeCounters(bw, "requests_total", "Requests sent to the Draw Things server.", c.requests)
+	c.writeHistograms(bw, "request_duration_seconds", "Time from sending a request to reading the whole response.", c.durations)
+	c.writeCounters(bw, "response_bytes_total", "Response body bytes received from the Draw Things server.", c.bytes)
+	c.writeCounters(bw, "retries_total", "Retries of requests or jobs after a retryable failure.", c.retries)
+	c.writeHistograms(bw, "queue_wait_seconds", "Time requests waited before being sent.", c.waits)
+	return bw.Flush()
+}
+
+func (c *Collector) writeCounters(w *bufio.Writer, name, help string, m map[labels]uint64) {
+	name = c.name(name)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, l := range sortedKeys(m) {
+		fmt.Fprintf(w, "%s%s %d\n", name, l.format(""), m[l])
+	}
+}
+
+func (c *Collector) writeHistograms(w *bufio.Writer, name, help string, m map[labels]*histogram) {
+	name = c.name(name)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, l := range sortedKeys(m) {
+		h := m[l]
+		var cumulative uint64
+		for i, bound := range h.bounds {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, l.format(formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, l.format("+Inf"), h.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, l.format(""), formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, l.format(""), h.count)
+	}
+}
+
+func (c *Collector) name(name string) string {
+	if c.namespace == "" {
+		return name
+	}
+	return c.namespace + "_" + name
+}
+
+// labels holds up to two label name/value pairs. Unused pairs are empty.
+type labels [4]string
+
+// format renders the labels, adding an "le" label if le is not empty.
+func (l labels) format(le string) string {
+	var pairs []string
+	for i := 0; i < len(l); i += 2 {
+		if l[i] != "" {
+			pairs = append(pairs, l[i]+`="`+escape(l[i+1])+`"`)
+		}
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// sortedKeys returns the keys of m in a stable order.
+func sortedKeys[V any](m map[labels]V) []labels {
+	keys := make([]labels, 0, len(m))
+	for l := range m {
+		keys = append(keys, l)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		for k := range keys[i] {
+			if keys[i][k] != keys[j][k] {
+				return keys[i][k] < keys[j][k]
+			}
+		}
+		return false
+	})
+	return keys
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// histogram counts observations into buckets. counts[i] holds observations
+// in (bounds[i-1], bounds[i]]; larger ones only count towards count and sum.
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(v float64) {
+	h.count++
+	h.sum += v
+	if i := sort.SearchFloat64s(h.bounds, v); i < len(h.bounds) {
+		h.counts[i]++
+	}
+}
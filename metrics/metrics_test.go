@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollector_Write(t *testing.T) {
+	c := NewCollector(WithBuckets([]float64{5, 1}))
+	c.ObserveRequest("/sdapi/v1/txt2img", "ok", 500*time.Millisecond, 1000)
+	c.ObserveRequest("/sdapi/v1/txt2img", "ok", 2*time.Second, 2000)
+	c.ObserveRequest("/sdapi/v1/txt2img", "api", 10*time.Second, 24)
+	c.ObserveRequest("/sdapi/v1/progress", "network", 0, 0)
+	c.ObserveRetry("pool")
+	c.ObserveRetry("pool")
+	c.ObserveQueueWait("gateway", 3*time.Second)
+
+	var buf bytes.Buffer
+	if err := c.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP drawthings_requests_total Requests sent to the Draw Things server.
+# TYPE drawthings_requests_total counter
+drawthings_requests_total{endpoint="/sdapi/v1/progress",outcome="network"} 1
+drawthings_requests_total{endpoint="/sdapi/v1/txt2img",outcome="api"} 1
+drawthings_requests_total{endpoint="/sdapi/v1/txt2img",outcome="ok"} 2
+# HELP drawthings_request_duration_seconds Time from sending a request to reading the whole response.
+# TYPE drawthings_request_duration_seconds histogram
+drawthings_request_duration_seconds_bucket{endpoint="/sdapi/v1/progress",le="1"} 1
+drawthings_request_duration_seconds_bucket{endpoint="/sdapi/v1/progress",le="5"} 1
+drawthings_request_duration_seconds_bucket{endpoint="/sdapi/v1/progress",le="+Inf"} 1
+drawthings_request_duration_seconds_sum{endpoint="/sdapi/v1/progress"} 0
+drawthings_request_duration_seconds_count{endpoint="/sdapi/v1/progress"} 1
+drawthings_request_duration_seconds_bucket{endpoint="/sdapi/v1/txt2img",le="1"} 1
+drawthings_request_duration_seconds_bucket{endpoint="/sdapi/v1/txt2img",le="5"} 2
+drawthings_request_duration_seconds_bucket{endpoint="/sdapi/v1/txt2img",le="+Inf"} 3
+drawthings_request_duration_seconds_sum{endpoint="/sdapi/v1/txt2img"} 12.5
+drawthings_request_duration_seconds_count{endpoint="/sdapi/v1/txt2img"} 3
+# HELP drawthings_response_bytes_total Response body bytes received from the Draw Things server.
+# TYPE drawthings_response_bytes_total counter
+drawthings_response_bytes_total{endpoint="/sdapi/v1/progress"} 0
+drawthings_response_bytes_total{endpoint="/sdapi/v1/txt2img"} 3024
+# HELP drawthings_retries_total Retries of requests or jobs after a retryable failure.
+# TYPE drawthings_retries_total counter
+drawthings_retries_total{source="pool"} 2
+# HELP drawthings_queue_wait_seconds Time requests waited before being sent.
+# TYPE drawthings_queue_wait_seconds histogram
+drawthings_queue_wait_seconds_bucket{queue="gateway",le="1"} 0
+drawthings_queue_wait_seconds_bucket{queue="gateway",le="5"} 1
+drawthings_queue_wait_seconds_bucket{queue="gateway",le="+Inf"} 1
+drawthings_queue_wait_seconds_sum{queue="gateway"} 3
+drawthings_queue_wait_seconds_count{queue="gateway"} 1
+`
+	if got := buf.String(); got != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCollector_ServeHTTP(t *testing.T) {
+	c := NewCollector(WithNamespace("studio"))
+	c.ObserveRetry(`a "quoted"` + "\nsource")
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	body := rec.Body.String()
+	if want := `studio_retries_total{source="a \"quoted\"\nsource"} 1`; !strings.Contains(body, want) {
+		t.Errorf("output missing %s:\n%s", want, body)
+	}
+	if !strings.Contains(body, "# TYPE studio_queue_wait_seconds histogram") {
+		t.Errorf("empty metrics should still be described:\n%s", body)
+	}
+}
@@ -0,0 +1,318 @@
+// Package openai serves the OpenAI Images API on top of Draw Things.
+//
+// The Handler accepts POST /v1/images/generations requests in the OpenAI
+// format (prompt, n, size, response_format), generates the images through a
+// drawthings.Client, and returns OpenAI-shaped responses. Tools that speak
+// the OpenAI protocol can then use Draw Things by changing their base URL:
+//
+//	client := drawthings.NewClient()
+//	store, _ := openai.NewFileStore("/var/lib/drawthings/images", 24*time.Hour)
+//	h := openai.NewHandler(client, openai.WithFileStore(store))
+//	log.Fatal(http.ListenAndServe(":8080", h))
+//
+// Responses with response_format "url" link to images kept in a FileStore
+// and served by the handler under /v1/images/files/.
+package openai
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drawthings_go"
+)
+
+// Paths served by the handler.
+const (
+	PathGenerations = "/v1/images/generations"
+	PathFiles       = "/v1/images/files/"
+)
+
+// Response formats.
+const (
+	FormatURL     = "url"
+	FormatB64JSON = "b64_json"
+)
+
+// MaxImages is the largest n accepted in a request.
+const MaxImages = 10
+
+// Generator generates images. *drawthings.Client satisfies this interface.
+type Generator interface {
+	GenerateImage(ctx context.Context, req *drawthings.TextToImageRequest) (*drawthings.TextToImageResponse, error)
+}
+
+// ImageRequest is an OpenAI image generation request.
+type ImageRequest struct {
+	Prompt         string `json:"prompt"`
+	Model          string `json:"model,omitempty"`
+	N              int    `json:"n,omitempty"`
+	Size           string `json:"size,omitempty"`
+	ResponseFormat string `json:"response_format,omitempty"`
+	Quality        string `json:"quality,omitempty"`
+	Style          string `json:"style,omitempty"`
+	User           string `json:"user,omitempty"`
+}
+
+// ImageResponse is an OpenAI image generation response.
+type ImageResponse struct {
+	Created int64       `json:"created"`
+	Data    []ImageData `json:"data"`
+}
+
+// ImageData is one generated image.
+type ImageData struct {
+	URL     string `json:"url,omitempty"`
+	B64JSON string `json:"b64_json,omitempty"`
+}
+
+// ErrorResponse is an OpenAI error response.
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail describes an error in an ErrorResponse.
+type ErrorDetail struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    *string `json:"code"`
+}
+
+// Handler is an http.Handler serving the OpenAI Images API.
+type Handler struct {
+	gen       Generator
+	store     *FileStore
+	publicURL string
+	acquire   func(http.ResponseWriter, *http.Request) (func(), error)
+	mux       *http.ServeMux
+}
+
+// Option is a function that configures a Handler.
+type Option func(*Handler)
+
+// WithFileStore keeps images in store so "url" responses can be served.
+// Without a store, only b64_json responses are available.
+func WithFileStore(store *FileStore) Option {
+	return func(h *Handler) {
+		h.store = store
+	}
+}
+
+// WithPublicURL sets the base URL used in "url" responses, for when the
+// handler runs behind a proxy. By default it is derived from the request.
+func WithPublicURL(baseURL string) Option {
+	return func(h *Handler) {
+		h.publicURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithAcquire makes each request wait for acquire before generating, such
+// as gateway.Server.Acquire to share the gateway queue.
+func WithAcquire(acquire func(http.ResponseWriter, *http.Request) (release func(), err error)) Option {
+	return func(h *Handler) {
+		h.acquire = acquire
+	}
+}
+
+// NewHandler creates a handler that generates images with gen.
+func NewHandler(gen Generator, opts ...Option) *Handler {
+	h := &Handler{gen: gen}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	h.mux = http.NewServeMux()
+	h.mux.HandleFunc(PathGenerations, h.handleGenerations)
+	if h.store != nil {
+		h.mux.Handle(PathFiles, h.store)
+	}
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) handleGenerations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "use POST", "")
+		return
+	}
+	var req ImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid JSON: "+err.Error(), "")
+		return
+	}
+
+	base, n, err := h.translate(&req)
+	if err != nil {
+		var valErr *drawthings.ValidationError
+		if errors.As(err, &valErr) {
+			writeError(w, http.StatusBadRequest, "invalid_request_error", valErr.Message, valErr.Field)
+		} else {
+			writeError(w, http.StatusInternalServerError, "server_error", err.Error(), "")
+		}
+		return
+	}
+
+	if h.acquire != nil {
+		release, err := h.acquire(w, r)
+		if err != nil {
+			writeError(w, http.StatusServiceUnavailable, "server_error", err.Error(), "")
+			return
+		}
+		defer release()
+	}
+
+	resp := ImageResponse{Created: time.Now().Unix(), Data: []ImageData{}}
+	for len(resp.Data) < n {
+		genReq := *base
+		if genReq.Seed > 0 {
+			// Fixed seeds give distinct images for each of the n results.
+			genReq.Seed += len(resp.Data)
+		}
+		out, err := h.gen.GenerateImage(r.Context(), &genReq)
+		if err != nil {
+			writeGenerateError(w, err)
+			return
+		}
+		if len(out.Images) == 0 {
+			// Retrying would loop forever on a server that never returns images.
+			writeError(w, http.StatusBadGateway, "server_error", "the server returned no images", "")
+			return
+		}
+		for _, encoded := range out.Images {
+			if len(resp.Data) == n {
+				break
+			}
+			data, err := h.imageData(r, req.ResponseFormat, encoded)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "server_error", err.Error(), "")
+				return
+			}
+			resp.Data = append(resp.Data, data)
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// translate validates req, applies OpenAI defaults, and returns the
+// equivalent Draw Things request and the number of images to generate.
+func (h *Handler) translate(req *ImageRequest) (*drawthings.TextToImageRequest, int, error) {
+	if req.ResponseFormat == "" {
+		req.ResponseFormat = FormatURL
+	}
+	switch req.ResponseFormat {
+	case FormatB64JSON:
+	case FormatURL:
+		if h.store == nil {
+			return nil, 0, drawthings.NewValidationError("response_format", "url responses are not enabled on this server; use b64_json")
+		}
+	default:
+		return nil, 0, drawthings.NewValidationError("response_format", fmt.Sprintf("%q is not one of url, b64_json", req.ResponseFormat))
+	}
+
+	n := req.N
+	if n == 0 {
+		n = 1
+	}
+	if n < 1 || n > MaxImages {
+		return nil, 0, drawthings.NewValidationError("n", fmt.Sprintf("n must be between 1 and %d", MaxImages))
+	}
+
+	out := &drawthings.TextToImageRequest{Prompt: req.Prompt}
+	if req.Size != "" {
+		width, height, err := parseSize(req.Size)
+		if err != nil {
+			return nil, 0, err
+		}
+		out.Width, out.Height = width, height
+	}
+
+	// Validate up front so n requests don't fail one by one.
+	check := *out
+	check.SetDefaults()
+	if err := check.Validate(); err != nil {
+		var valErr *drawthings.ValidationError
+		if errors.As(err, &valErr) && (valErr.Field == "width" || valErr.Field == "height") {
+			valErr.Field = "size"
+		}
+		return nil, 0, err
+	}
+	return out, n, nil
+}
+
+// parseSize parses an OpenAI size such as "1024x1024".
+func parseSize(size string) (int, int, error) {
+	w, h, ok := strings.Cut(size, "x")
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	if !ok || errW != nil || errH != nil {
+		return 0, 0, drawthings.NewValidationError("size", fmt.Sprintf("invalid size %q, expected WIDTHxHEIGHT", size))
+	}
+	return width, height, nil
+}
+
+// imageData converts a base64 image from Draw Things to the requested format.
+func (h *Handler) imageData(r *http.Request, format, encoded string) (ImageData, error) {
+	if format == FormatB64JSON {
+		return ImageData{B64JSON: encoded}, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return ImageData{}, fmt.Errorf("failed to decode image: %w", err)
+	}
+	name, err := h.store.Save(data)
+	if err != nil {
+		return ImageData{}, err
+	}
+	return ImageData{URL: h.baseURL(r) + PathFiles + name}, nil
+}
+
+// baseURL returns the public URL of the handler.
+func (h *Handler) baseURL(r *http.Request) string {
+	if h.publicURL != "" {
+		return h.publicURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// writeGenerateError writes a Generator error in the OpenAI error format.
+func writeGenerateError(w http.ResponseWriter, err error) {
+	var valErr *drawthings.ValidationError
+	if errors.As(err, &valErr) {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", valErr.Message, valErr.Field)
+		return
+	}
+	status := http.StatusBadGateway
+	if drawthings.ErrorType(err) == drawthings.ErrorTypeCanceled {
+		status = http.StatusServiceUnavailable
+	}
+	writeError(w, status, "server_error", err.Error(), "")
+}
+
+func writeError(w http.ResponseWriter, status int, kind, message, param string) {
+	detail := ErrorDetail{Message: message, Type: kind}
+	if param != "" {
+		detail.Param = &param
+	}
+	writeJSON(w, status, ErrorResponse{Error: detail})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,186 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/drawthings_go"
+	"github.com/drawthings_go/drawthingstest"
+)
+
+func newTestServer(t *testing.T, opts ...Option) (*drawthingstest.Server, *httptest.Server) {
+	t.Helper()
+	upstream := drawthingstest.NewServer()
+	t.Cleanup(upstream.Close)
+
+	store, err := NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := drawthings.NewClient(drawthings.WithBaseURL(upstream.URL))
+	srv := httptest.NewServer(NewHandler(client, append([]Option{WithFileStore(store)}, opts...)...))
+	t.Cleanup(srv.Close)
+	return upstream, srv
+}
+
+func post(t *testing.T, url, body string, v interface{}) int {
+	t.Helper()
+	resp, err := http.Post(url+PathGenerations, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func TestGenerations_B64JSON(t *testing.T) {
+	upstream, srv := newTestServer(t)
+
+	var resp ImageResponse
+	code := post(t, srv.URL, `{"prompt":"a red fox","n":2,"size":"256x128","response_format":"b64_json"}`, &resp)
+	if code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if len(resp.Data) != 2 || resp.Created == 0 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	requests := upstream.RequestsTo(drawthingstest.PathTxt2Img)
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 upstream requests, got %d", len(requests))
+	}
+	for i, r := range requests {
+		var req drawthings.TextToImageRequest
+		if err := r.Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		if req.Prompt != "a red fox" || req.Width != 256 || req.Height != 128 {
+			t.Errorf("request %d not translated: %+v", i, req)
+		}
+		got, _ := base64.StdEncoding.DecodeString(resp.Data[i].B64JSON)
+		if !bytes.Equal(got, drawthingstest.Image(req.Prompt, req.Seed, req.Width, req.Height)) {
+			t.Errorf("image %d does not match the upstream render", i)
+		}
+	}
+}
+
+func TestGenerations_URL(t *testing.T) {
+	_, srv := newTestServer(t)
+
+	var resp ImageResponse
+	if code := post(t, srv.URL, `{"prompt":"a lighthouse","size":"64x64"}`, &resp); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if len(resp.Data) != 1 || !strings.HasPrefix(resp.Data[0].URL, srv.URL+PathFiles) {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	img, err := http.Get(resp.Data[0].URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(img.Body)
+	img.Body.Close()
+	if img.StatusCode != http.StatusOK || !bytes.HasPrefix(data, []byte("\x89PNG")) {
+		t.Errorf("image URL: status %d, %d bytes", img.StatusCode, len(data))
+	}
+
+	for _, path := range []string{"../../etc/passwd", "missing.png", strings.Repeat("0", 32) + ".png"} {
+		r, err := http.Get(srv.URL + PathFiles + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+		if r.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s: status %d, want 404", path, r.StatusCode)
+		}
+	}
+}
+
+func TestGenerations_PublicURL(t *testing.T) {
+	_, srv := newTestServer(t, WithPublicURL("https://images.example.com/"))
+
+	var resp ImageResponse
+	post(t, srv.URL, `{"prompt":"a lighthouse","size":"64x64"}`, &resp)
+	if len(resp.Data) != 1 || !strings.HasPrefix(resp.Data[0].URL, "https://images.example.com"+PathFiles) {
+		t.Errorf("unexpected URL: %+v", resp)
+	}
+}
+
+func TestGenerations_Errors(t *testing.T) {
+	upstream, srv := newTestServer(t)
+
+	tests := []struct {
+		body  string
+		param string
+	}{
+		{`{"prompt":""}`, "prompt"},
+		{`{"prompt":"x","n":11}`, "n"},
+		{`{"prompt":"x","size":"huge"}`, "size"},
+		{`{"prompt":"x","size":"8192x512"}`, "size"},
+		{`{"prompt":"x","response_format":"gif"}`, "response_format"},
+	}
+	for _, tt := range tests {
+		var resp ErrorResponse
+		code := post(t, srv.URL, tt.body, &resp)
+		if code != http.StatusBadRequest || resp.Error.Type != "invalid_request_error" ||
+			resp.Error.Param == nil || *resp.Error.Param != tt.param {
+			t.Errorf("%s: status %d, error %+v", tt.body, code, resp.Error)
+		}
+	}
+	if n := len(upstream.Requests()); n != 0 {
+		t.Errorf("invalid requests should not reach the server, got %d", n)
+	}
+
+	upstream.QueueFailure(drawthingstest.StatusFailure(http.StatusInternalServerError))
+	var resp ErrorResponse
+	code := post(t, srv.URL, `{"prompt":"x","response_format":"b64_json"}`, &resp)
+	if code != http.StatusBadGateway || resp.Error.Type != "server_error" {
+		t.Errorf("upstream failure: status %d, error %+v", code, resp.Error)
+	}
+}
+
+// emptyGenerator returns responses without images.
+type emptyGenerator struct{ calls int }
+
+func (g *emptyGenerator) GenerateImage(context.Context, *drawthings.TextToImageRequest) (*drawthings.TextToImageResponse, error) {
+	g.calls++
+	return &drawthings.TextToImageResponse{}, nil
+}
+
+func TestGenerations_NoImages(t *testing.T) {
+	gen := &emptyGenerator{}
+	srv := httptest.NewServer(NewHandler(gen))
+	defer srv.Close()
+
+	var resp ErrorResponse
+	code := post(t, srv.URL, `{"prompt":"x","n":2,"response_format":"b64_json"}`, &resp)
+	if code != http.StatusBadGateway || resp.Error.Type != "server_error" {
+		t.Errorf("status %d, error %+v; want 502", code, resp.Error)
+	}
+	if gen.calls != 1 {
+		t.Errorf("generator called %d times, want 1", gen.calls)
+	}
+}
+
+func TestGenerations_URLWithoutStore(t *testing.T) {
+	upstream := drawthingstest.NewServer()
+	defer upstream.Close()
+	srv := httptest.NewServer(NewHandler(drawthings.NewClient(drawthings.WithBaseURL(upstream.URL))))
+	defer srv.Close()
+
+	var resp ErrorResponse
+	if code := post(t, srv.URL, `{"prompt":"x"}`, &resp); code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", code)
+	}
+}
@@ -0,0 +1,97 @@
+package openai
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileStore keeps generated images on disk so they can be served by URL.
+type FileStore struct {
+	dir       string
+	retention time.Duration
+}
+
+// NewFileStore creates a store in dir, creating the directory if needed.
+// Files older than retention are removed as new images are saved; zero
+// keeps files forever.
+func NewFileStore(dir string, retention time.Duration) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create image directory: %w", err)
+	}
+	return &FileStore{dir: dir, retention: retention}, nil
+}
+
+// Dir returns the directory images are stored in.
+func (s *FileStore) Dir() string {
+	return s.dir
+}
+
+// Save writes data under a new random name and returns the name.
+func (s *FileStore) Save(data []byte) (string, error) {
+	s.expire()
+
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", err
+	}
+	name := hex.EncodeToString(id[:]) + imageExt(data)
+	if err := os.WriteFile(filepath.Join(s.dir, name), data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write image: %w", err)
+	}
+	return name, nil
+}
+
+// ServeHTTP serves a stored image named by the last element of the URL path.
+func (s *FileStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	if !validName(name) {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, filepath.Join(s.dir, name))
+}
+
+// expire removes files older than the retention period.
+func (s *FileStore) expire() {
+	if s.retention <= 0 {
+		return
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-s.retention)
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && validName(e.Name()) && info.ModTime().Before(cutoff) {
+			os.Remove(filepath.Join(s.dir, e.Name()))
+		}
+	}
+}
+
+// validName reports whether name looks like a name returned by Save.
+func validName(name string) bool {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	if len(base) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(base)
+	return err == nil
+}
+
+// imageExt returns a file extension for image data.
+func imageExt(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/webp":
+		return ".webp"
+	default:
+		return ".png"
+	}
+}
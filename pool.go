@@ -0,0 +1,343 @@
+package drawthings
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Strategy selects which pool member serves a request.
+type Strategy int
+
+const (
+	// LeastBusy picks the member with the fewest requests in flight,
+	// rotating between members that are equally busy.
+	LeastBusy Strategy = iota
+	// RoundRobin picks members in turn.
+	RoundRobin
+)
+
+// Pool spreads requests over several Draw Things servers. It has the same
+// generation methods as Client, so it can be used wherever a Client is.
+//
+// Members that fail with retryable errors (network errors and 5xx or 429
+// responses) are ejected after a number of consecutive failures and probed
+// periodically until they respond again. A request that fails with a
+// retryable error is retried on another member.
+type Pool struct {
+	members        []*poolMember
+	strategy       Strategy
+	ejectAfter     int
+	reprobe        time.Duration
+	healthInterval time.Duration
+
+	mu   sync.Mutex
+	next int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// poolMember is a client in a pool and its health.
+type poolMember struct {
+	client *Client
+
+	// The fields below are guarded by Pool.mu.
+	inFlight  int
+	requests  int64
+	failures  int64
+	streak    int
+	ejected   bool
+	lastError error
+	lastProbe time.Time
+}
+
+// PoolOption is a function that configures a Pool.
+type PoolOption func(*Pool)
+
+// WithStrategy sets how members are chosen (default: LeastBusy).
+func WithStrategy(s Strategy) PoolOption {
+	return func(p *Pool) {
+		p.strategy = s
+	}
+}
+
+// WithEjectAfter ejects a member after n consecutive retryable failures
+// (default: 2).
+func WithEjectAfter(n int) PoolOption {
+	return func(p *Pool) {
+		p.ejectAfter = n
+	}
+}
+
+// WithReprobeInterval sets how often ejected members are checked with Ping
+// (default: 10s).
+func WithReprobeInterval(d time.Duration) PoolOption {
+	return func(p *Pool) {
+		p.reprobe = d
+	}
+}
+
+// WithHealthCheckInterval also probes healthy members at this interval and
+// ejects those that do not respond, so failures are noticed before a
+// request is sent. Zero, the default, disables active checks.
+func WithHealthCheckInterval(d time.Duration) PoolOption {
+	return func(p *Pool) {
+		p.healthInterval = d
+	}
+}
+
+// NewPool creates a pool over clients. Call Close to stop health checks.
+func NewPool(clients []*Client, opts ...PoolOption) (*Pool, error) {
+	if len(clients) == 0 {
+		return nil, errors.New("drawthings: a pool needs at least one client")
+	}
+	p := &Pool{
+		strategy:   LeastBusy,
+		ejectAfter: 2,
+		reprobe:    10 * time.Second,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	for _, c := range clients {
+		p.members = append(p.members, &poolMember{client: c})
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.ejectAfter < 1 {
+		p.ejectAfter = 1
+	}
+
+	go p.checkHealth()
+	return p, nil
+}
+
+// Close stops the background health checks.
+func (p *Pool) Close() {
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+	<-p.done
+}
+
+// GenerateImage generates an image on one of the pool's servers, failing
+// over to another server on retryable errors.
+func (p *Pool) GenerateImage(ctx context.Context, req *TextToImageRequest) (*TextToImageResponse, error) {
+	req.SetDefaults()
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return p.do(ctx, func(c *Client) (*TextToImageResponse, error) {
+		return c.GenerateImage(ctx, req)
+	})
+}
+
+// ImageToImage generates an image from a source image on one of the pool's
+// servers, failing over to another server on retryable errors.
+func (p *Pool) ImageToImage(ctx context.Context, req *ImageToImageRequest) (*TextToImageResponse, error) {
+	req.SetDefaults()
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return p.do(ctx, func(c *Client) (*TextToImageResponse, error) {
+		return c.ImageToImage(ctx, req)
+	})
+}
+
+// do calls fn with the client of each member in turn until it succeeds,
+// fails with an error that is not retryable, or every member was tried.
+func (p *Pool) do(ctx context.Context, fn func(*Client) (*TextToImageResponse, error)) (*TextToImageResponse, error) {
+	tried := make(map[*poolMember]bool, len(p.members))
+	var lastErr error
+	for len(tried) < len(p.members) {
+		m := p.pick(tried)
+		if len(tried) > 0 && m.client.metrics != nil {
+			m.client.metrics.ObserveRetry("pool")
+		}
+		tried[m] = true
+
+		resp, err := fn(m.client)
+		p.record(m, err)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil || !retryable(err) {
+			return nil, err
+		}
+	}
+	return nil, lastErr
+}
+
+// GenerateImageAndSave generates an image on one of the pool's servers and
+// saves it to outputPath.
+func (p *Pool) GenerateImageAndSave(ctx context.Context, req *TextToImageRequest, outputPath string) error {
+	resp, err := p.GenerateImage(ctx, req)
+	if err != nil {
+		return err
+	}
+	return saveFirstImage(resp, outputPath)
+}
+
+// pick chooses a member that has not been tried yet, preferring members
+// that are not ejected, and marks it busy.
+func (p *Pool) pick(tried map[*poolMember]bool) *poolMember {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var best *poolMember
+	n := len(p.members)
+	for pass := 0; pass < 2 && best == nil; pass++ {
+		// The second pass falls back to ejected members rather than failing.
+		for i := 0; i < n; i++ {
+			m := p.members[(p.next+i)%n]
+			if tried[m] || m.ejected && pass == 0 {
+				continue
+			}
+			if best == nil {
+				best = m
+				if p.strategy == RoundRobin {
+					break
+				}
+			} else if m.inFlight < best.inFlight {
+				best = m
+			}
+		}
+	}
+	p.next = (p.next + 1) % n
+	best.inFlight++
+	best.requests++
+	return best
+}
+
+// record updates a member's health after a request.
+func (p *Pool) record(m *poolMember, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m.inFlight--
+	switch {
+	case err == nil:
+		m.streak = 0
+		m.ejected = false
+	case retryable(err):
+		m.failures++
+		m.streak++
+		m.lastError = err
+		if m.streak >= p.ejectAfter {
+			m.ejected = true
+		}
+	}
+}
+
+// checkHealth probes ejected members, and healthy ones if active health
+// checks are enabled, until the pool is closed.
+func (p *Pool) checkHealth() {
+	defer close(p.done)
+
+	interval := p.reprobe
+	if p.healthInterval > 0 && p.healthInterval < interval {
+		interval = p.healthInterval
+	}
+	if interval <= 0 {
+		<-p.stop
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-p.stop
+		cancel()
+	}()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			for _, m := range p.due(now) {
+				err := m.client.Ping(ctx)
+				p.mu.Lock()
+				if err == nil {
+					m.ejected = false
+					m.streak = 0
+				} else if ctx.Err() == nil {
+					m.ejected = true
+					m.lastError = err
+				}
+				p.mu.Unlock()
+			}
+		}
+	}
+}
+
+// due returns the members to probe now.
+func (p *Pool) due(now time.Time) []*poolMember {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var members []*poolMember
+	for _, m := range p.members {
+		interval := p.healthInterval
+		if m.ejected {
+			interval = p.reprobe
+		}
+		if interval > 0 && now.Sub(m.lastProbe) >= interval {
+			m.lastProbe = now
+			members = append(members, m)
+		}
+	}
+	return members
+}
+
+// MemberStatus describes a pool member.
+type MemberStatus struct {
+	BaseURL   string
+	Healthy   bool
+	InFlight  int
+	Requests  int64
+	Failures  int64
+	LastError error
+}
+
+// Members returns the status of each pool member, in the order the clients
+// were given to NewPool.
+func (p *Pool) Members() []MemberStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	statuses := make([]MemberStatus, len(p.members))
+	for i, m := range p.members {
+		statuses[i] = MemberStatus{
+			BaseURL:   m.client.BaseURL(),
+			Healthy:   !m.ejected,
+			InFlight:  m.inFlight,
+			Requests:  m.requests,
+			Failures:  m.failures,
+			LastError: m.lastError,
+		}
+	}
+	return statuses
+}
+
+// retryable reports whether err might not recur on another attempt or server.
+func retryable(err error) bool {
+	switch ErrorType(err) {
+	case ErrorTypeNetwork:
+		return true
+	case ErrorTypeAPI:
+		var apiErr *APIError
+		return errors.As(err, &apiErr) &&
+			(apiErr.StatusCode >= 500 || apiErr.StatusCode == http.StatusTooManyRequests)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,202 @@
+package drawthings
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/drawthings_go/drawthingstest"
+)
+
+func newTestPool(t *testing.T, n int, opts ...PoolOption) (*Pool, []*drawthingstest.Server) {
+	t.Helper()
+	var (
+		servers []*drawthingstest.Server
+		clients []*Client
+	)
+	for i := 0; i < n; i++ {
+		s := drawthingstest.NewServer()
+		t.Cleanup(s.Close)
+		servers = append(servers, s)
+		clients = append(clients, NewClient(WithBaseURL(s.URL)))
+	}
+	pool, err := NewPool(clients, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return pool, servers
+}
+
+func TestNewPool_NoClients(t *testing.T) {
+	if _, err := NewPool(nil); err == nil {
+		t.Fatal("expected an error for an empty pool")
+	}
+}
+
+func TestPool_RoundRobin(t *testing.T) {
+	pool, servers := newTestPool(t, 3, WithStrategy(RoundRobin))
+
+	for i := 0; i < 6; i++ {
+		if _, err := pool.GenerateImage(context.Background(), &TextToImageRequest{Prompt: "fox"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, s := range servers {
+		if got := len(s.RequestsTo(drawthingstest.PathTxt2Img)); got != 2 {
+			t.Errorf("server %d got %d requests, want 2", i, got)
+		}
+	}
+}
+
+func TestPool_LeastBusy(t *testing.T) {
+	pool, servers := newTestPool(t, 2)
+	servers[0].SetLatency(300 * time.Millisecond)
+
+	// Occupy the first server, then send a request that must avoid it.
+	done := make(chan error, 1)
+	go func() {
+		_, err := pool.GenerateImage(context.Background(), &TextToImageRequest{Prompt: "slow"})
+		done <- err
+	}()
+	deadline := time.Now().Add(time.Second)
+	for pool.Members()[0].InFlight+pool.Members()[1].InFlight == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := pool.GenerateImage(context.Background(), &TextToImageRequest{Prompt: "fast"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	for i, s := range servers {
+		if got := len(s.RequestsTo(drawthingstest.PathTxt2Img)); got != 1 {
+			t.Errorf("server %d got %d requests, want 1", i, got)
+		}
+	}
+}
+
+func TestPool_Failover(t *testing.T) {
+	pool, servers := newTestPool(t, 2, WithStrategy(RoundRobin))
+	servers[0].QueueFailure(drawthingstest.StatusFailure(http.StatusInternalServerError))
+
+	resp, err := pool.GenerateImage(context.Background(), &TextToImageRequest{Prompt: "fox"})
+	if err != nil {
+		t.Fatalf("expected failover to succeed, got %v", err)
+	}
+	if len(resp.Images) != 1 {
+		t.Errorf("expected 1 image, got %d", len(resp.Images))
+	}
+	if got := len(servers[1].RequestsTo(drawthingstest.PathTxt2Img)); got != 1 {
+		t.Errorf("second server got %d requests, want 1", got)
+	}
+	if m := pool.Members()[0]; m.Failures != 1 || m.LastError == nil {
+		t.Errorf("failure not recorded: %+v", m)
+	}
+}
+
+func TestPool_ImageToImageFailover(t *testing.T) {
+	pool, servers := newTestPool(t, 2, WithStrategy(RoundRobin))
+	servers[0].QueueFailure(drawthingstest.StatusFailure(http.StatusInternalServerError))
+
+	req := &ImageToImageRequest{
+		TextToImageRequest: TextToImageRequest{Prompt: "fox"},
+		InitImages:         []string{base64.StdEncoding.EncodeToString(drawthingstest.Image("fox", 1, 64, 64))},
+	}
+	if _, err := pool.ImageToImage(context.Background(), req); err != nil {
+		t.Fatalf("expected failover to succeed, got %v", err)
+	}
+	if got := len(servers[1].RequestsTo(drawthingstest.PathImg2Img)); got != 1 {
+		t.Errorf("second server got %d requests, want 1", got)
+	}
+
+	if _, err := pool.ImageToImage(context.Background(), &ImageToImageRequest{TextToImageRequest: TextToImageRequest{Prompt: "fox"}}); ErrorType(err) != ErrorTypeValidation {
+		t.Errorf("missing init image: got %v, want a validation error", err)
+	}
+}
+
+func TestPool_NoFailoverOnClientErrors(t *testing.T) {
+	pool, servers := newTestPool(t, 2, WithStrategy(RoundRobin))
+	servers[0].QueueFailure(drawthingstest.StatusFailure(http.StatusBadRequest))
+
+	_, err := pool.GenerateImage(context.Background(), &TextToImageRequest{Prompt: "fox"})
+	if !IsAPIError(err) {
+		t.Fatalf("expected APIError, got %v", err)
+	}
+	if len(servers[1].Requests()) != 0 {
+		t.Error("4xx error was retried on another server")
+	}
+
+	_, err = pool.GenerateImage(context.Background(), &TextToImageRequest{Prompt: "fox", Steps: 500})
+	if !IsValidationError(err) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	for i, s := range servers {
+		if got := len(s.RequestsTo(drawthingstest.PathTxt2Img)); got > 1 {
+			t.Errorf("server %d received an invalid request", i)
+		}
+	}
+}
+
+func TestPool_AllMembersFail(t *testing.T) {
+	pool, servers := newTestPool(t, 2)
+	for _, s := range servers {
+		s.QueueFailure(drawthingstest.StatusFailure(http.StatusServiceUnavailable))
+	}
+
+	_, err := pool.GenerateImage(context.Background(), &TextToImageRequest{Prompt: "fox"})
+	if !IsAPIError(err) {
+		t.Fatalf("expected APIError, got %v", err)
+	}
+	for i, s := range servers {
+		if got := len(s.RequestsTo(drawthingstest.PathTxt2Img)); got != 1 {
+			t.Errorf("server %d got %d requests, want 1", i, got)
+		}
+	}
+}
+
+func TestPool_EjectAndReprobe(t *testing.T) {
+	pool, servers := newTestPool(t, 2,
+		WithStrategy(RoundRobin),
+		WithEjectAfter(1),
+		WithReprobeInterval(300*time.Millisecond),
+	)
+	servers[0].QueueFailure(drawthingstest.DropConnection())
+
+	if _, err := pool.GenerateImage(context.Background(), &TextToImageRequest{Prompt: "fox"}); err != nil {
+		t.Fatal(err)
+	}
+	if pool.Members()[0].Healthy {
+		t.Fatal("expected the failing server to be ejected")
+	}
+
+	// The server is reachable, so the next probe brings it back.
+	deadline := time.Now().Add(2 * time.Second)
+	for !pool.Members()[0].Healthy {
+		if time.Now().After(deadline) {
+			t.Fatal("ejected server was not re-admitted")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPool_SkipsEjectedMembers(t *testing.T) {
+	pool, servers := newTestPool(t, 2, WithStrategy(RoundRobin), WithEjectAfter(1), WithReprobeInterval(time.Hour))
+	servers[0].QueueFailure(drawthingstest.StatusFailure(http.StatusBadGateway))
+
+	for i := 0; i < 4; i++ {
+		if _, err := pool.GenerateImage(context.Background(), &TextToImageRequest{Prompt: "fox"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := len(servers[0].RequestsTo(drawthingstest.PathTxt2Img)); got != 1 {
+		t.Errorf("ejected server got %d requests, want 1", got)
+	}
+	if got := len(servers[1].RequestsTo(drawthingstest.PathTxt2Img)); got != 4 {
+		t.Errorf("healthy server got %d requests, want 4", got)
+	}
+}
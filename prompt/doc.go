@@ -0,0 +1,31 @@
+// Package prompt works with the text of prompts.
+//
+// # Templates
+//
+// Prompt templates produce prompt variants from variables, inline
+// alternatives and wildcard word lists:
+//
+//	a {color} {product} on a {marble|wooden|glass} table, __lighting__
+//
+// {name} is replaced by the value of a variable, {a|b|c} by one of the
+// alternatives, and __name__ by a random line of the wordlist name.txt.
+// Choices are made with a seeded random number generator, so rendering a
+// template again with the same seed gives the same prompt.
+//
+// # Weighting Syntax
+//
+// ParseWeights parses the emphasis syntax of AUTOMATIC1111 and similar
+// front ends into a tree of nodes, reporting malformed syntax that servers
+// would silently misread:
+//
+//	a (red:1.3) fox, ((detailed)), [blurry], <lora:film_grain:0.6>
+//
+// FormatWeights writes the tree back out, in the same dialect or another.
+//
+// # Token Counting
+//
+// Tokenizer is CLIP's byte-level BPE tokenizer. It counts the tokens of
+// prompts and splits them into the chunks of ChunkSize tokens that CLIP
+// encodes at once, so prompts that servers truncate can be found before
+// they are sent.
+package prompt
@@ -0,0 +1,407 @@
+package prompt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+)
+
+// maxDepth limits how deeply variable values and wildcard entries may
+// refer to further variables and wildcards.
+const maxDepth = 16
+
+// SyntaxError reports a malformed template or prompt.
+type SyntaxError struct {
+	// Offset is the byte offset of the error in the text.
+	Offset  int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("offset %d: %s", e.Offset, e.Message)
+}
+
+// Template is a parsed prompt template. A Template is safe for concurrent
+// use.
+type Template struct {
+	text  string
+	nodes []node
+}
+
+// node is a part of a template.
+type node interface {
+	render(s *state, b *strings.Builder) error
+}
+
+// literal is text copied to the output.
+type literal string
+
+// variable is a {name} reference.
+type variable string
+
+// wildcard is a __name__ reference.
+type wildcard string
+
+// choice is an {a|b|c} list of alternatives.
+type choice [][]node
+
+// Parse parses a prompt template.
+//
+// Braces hold a variable name or alternatives separated by "|". An
+// alternative may be empty and may contain further alternatives, variables
+// and wildcards. Wildcard names consist of letters, digits, "-", "_" and "/".
+// A backslash before "{", "}" or "|" produces the character itself.
+func Parse(text string) (*Template, error) {
+	p := &parser{text: text}
+	nodes, err := p.parse(false)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{text: text, nodes: nodes}, nil
+}
+
+// MustParse is like Parse but panics if the template cannot be parsed.
+func MustParse(text string) *Template {
+	t, err := Parse(text)
+	if err != nil {
+		panic("prompt: " + err.Error())
+	}
+	return t
+}
+
+// String returns the source text of the template.
+func (t *Template) String() string {
+	return t.text
+}
+
+// parser parses template text.
+type parser struct {
+	text string
+	pos  int
+}
+
+// parse parses nodes up to the end of the text or, inside braces, up to the
+// next "|" or "}", which is left unconsumed.
+func (p *parser) parse(inBraces bool) ([]node, error) {
+	var (
+		nodes []node
+		text  strings.Builder
+	)
+	flush := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, literal(text.String()))
+			text.Reset()
+		}
+	}
+
+	for p.pos < len(p.text) {
+		c := p.text[p.pos]
+		switch {
+		case c == '\\' && p.pos+1 < len(p.text) && strings.IndexByte("{}|", p.text[p.pos+1]) >= 0:
+			text.WriteByte(p.text[p.pos+1])
+			p.pos += 2
+		case c == '{':
+			flush()
+			n, err := p.parseBraces()
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, n)
+		case (c == '|' || c == '}') && inBraces:
+			flush()
+			return nodes, nil
+		case c == '}':
+			return nil, &SyntaxError{Offset: p.pos, Message: "unexpected }"}
+		case strings.HasPrefix(p.text[p.pos:], "__"):
+			if name, ok := wildcardName(p.text[p.pos+2:]); ok {
+				flush()
+				nodes = append(nodes, wildcard(name))
+				p.pos += len(name) + 4
+				continue
+			}
+			text.WriteString("__")
+			p.pos += 2
+		default:
+			text.WriteByte(c)
+			p.pos++
+		}
+	}
+	flush()
+	return nodes, nil
+}
+
+// parseBraces parses a {name} or {a|b} expression starting at "{".
+func (p *parser) parseBraces() (node, error) {
+	start := p.pos
+	p.pos++
+	var alternatives [][]node
+	for {
+		alt, err := p.parse(true)
+		if err != nil {
+			return nil, err
+		}
+		alternatives = append(alternatives, alt)
+		if p.pos >= len(p.text) {
+			return nil, &SyntaxError{Offset: start, Message: "unclosed {"}
+		}
+		p.pos++
+		if p.text[p.pos-1] == '}' {
+			break
+		}
+	}
+
+	if len(alternatives) > 1 {
+		return choice(alternatives), nil
+	}
+	name := strings.TrimSpace(p.text[start+1 : p.pos-1])
+	if !validName(name, "-_.") {
+		return nil, &SyntaxError{Offset: start, Message: fmt.Sprintf("{%s} is neither a variable name nor a list of alternatives", name)}
+	}
+	return variable(name), nil
+}
+
+// wildcardName returns the wildcard name at the start of s, which follows
+// an opening "__".
+func wildcardName(s string) (string, bool) {
+	end := strings.Index(s, "__")
+	if end <= 0 {
+		return "", false
+	}
+	name := s[:end]
+	return name, validName(name, "-_/")
+}
+
+// validName reports whether name consists of letters, digits and the
+// characters in extra.
+func validName(name, extra string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		isAlnum := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+		if !isAlnum && !strings.ContainsRune(extra, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Renderer renders templates. A Renderer is safe for concurrent use.
+type Renderer struct {
+	vars      map[string]string
+	wildcards fs.FS
+
+	mu    sync.Mutex
+	lists map[string][]*Template
+}
+
+// Option is a function that configures a Renderer.
+type Option func(*Renderer)
+
+// WithVars sets the values of template variables. Values are themselves
+// templates, so a value may list alternatives; one of them is chosen per
+// prompt and used wherever the variable appears.
+func WithVars(vars map[string]string) Option {
+	return func(r *Renderer) {
+		r.vars = vars
+	}
+}
+
+// WithWildcards reads wildcard word lists from fsys: __name__ picks a line
+// of the file name.txt. Blank lines and lines starting with "#" are ignored,
+// and each line is itself a template.
+func WithWildcards(fsys fs.FS) Option {
+	return func(r *Renderer) {
+		r.wildcards = fsys
+	}
+}
+
+// WithWildcardDir reads wildcard word lists from the directory dir.
+func WithWildcardDir(dir string) Option {
+	return WithWildcards(os.DirFS(dir))
+}
+
+// NewRenderer creates a Renderer with the provided options.
+func NewRenderer(opts ...Option) *Renderer {
+	r := &Renderer{lists: make(map[string][]*Template)}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Render renders t, making random choices with a generator seeded with
+// seed. Variables in vars take precedence over those of the renderer.
+func (r *Renderer) Render(t *Template, seed int64, vars map[string]string) (string, error) {
+	s := &state{renderer: r, rng: rand.New(rand.NewSource(seed)), vars: vars, rendered: make(map[string]string)}
+	var b strings.Builder
+	if err := renderNodes(s, t.nodes, &b); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Expand parses text as a template and renders it.
+func (r *Renderer) Expand(text string, seed int64, vars map[string]string) (string, error) {
+	t, err := Parse(text)
+	if err != nil {
+		return "", err
+	}
+	return r.Render(t, seed, vars)
+}
+
+// list returns the parsed entries of the wildcard name.
+func (r *Renderer) list(name string) ([]*Template, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if list, ok := r.lists[name]; ok {
+		return list, nil
+	}
+	if r.wildcards == nil {
+		return nil, fmt.Errorf("wildcard __%s__: no wildcard directory configured", name)
+	}
+
+	f, err := r.wildcards.Open(name + ".txt")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("unknown wildcard __%s__", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("wildcard __%s__: %w", name, err)
+	}
+	defer f.Close()
+
+	var list []*Template
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		t, err := Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("wildcard __%s__: line %d: %w", name, line, err)
+		}
+		list = append(list, t)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("wildcard __%s__: %w", name, err)
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("wildcard __%s__ has no entries", name)
+	}
+	r.lists[name] = list
+	return list, nil
+}
+
+// state is the state of one Render call.
+type state struct {
+	renderer *Renderer
+	rng      *rand.Rand
+	vars     map[string]string
+	rendered map[string]string
+	depth    int
+}
+
+func renderNodes(s *state, nodes []node, b *strings.Builder) error {
+	for _, n := range nodes {
+		if err := n.render(s, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n literal) render(s *state, b *strings.Builder) error {
+	b.WriteString(string(n))
+	return nil
+}
+
+func (n choice) render(s *state, b *strings.Builder) error {
+	return renderNodes(s, n[s.rng.Intn(len(n))], b)
+}
+
+func (n variable) render(s *state, b *strings.Builder) error {
+	// A variable whose value has alternatives takes the same value
+	// everywhere in the prompt.
+	if value, ok := s.rendered[string(n)]; ok {
+		b.WriteString(value)
+		return nil
+	}
+	value, ok := s.vars[string(n)]
+	if !ok {
+		value, ok = s.renderer.vars[string(n)]
+	}
+	if !ok {
+		return fmt.Errorf("undefined variable {%s}", string(n))
+	}
+	t, err := Parse(value)
+	if err != nil {
+		return fmt.Errorf("variable {%s}: %w", string(n), err)
+	}
+	var rendered strings.Builder
+	if err := s.nested("{"+string(n)+"}", t, &rendered); err != nil {
+		return err
+	}
+	s.rendered[string(n)] = rendered.String()
+	b.WriteString(rendered.String())
+	return nil
+}
+
+func (n wildcard) render(s *state, b *strings.Builder) error {
+	list, err := s.renderer.list(string(n))
+	if err != nil {
+		return err
+	}
+	return s.nested("__"+string(n)+"__", list[s.rng.Intn(len(list))], b)
+}
+
+// nested renders t in place of the reference ref.
+func (s *state) nested(ref string, t *Template, b *strings.Builder) error {
+	if s.depth >= maxDepth {
+		return fmt.Errorf("%s: references nested more than %d deep", ref, maxDepth)
+	}
+	s.depth++
+	defer func() { s.depth-- }()
+	return renderNodes(s, t.nodes, b)
+}
+
+// ParseVars parses a comma-separated list of name=value pairs, such as
+// "color=red,product=mug". A comma that is not followed by another name=
+// belongs to the preceding value, so "style=soft, warm light" is one
+// variable.
+func ParseVars(s string) (map[string]string, error) {
+	vars := make(map[string]string)
+	if strings.TrimSpace(s) == "" {
+		return vars, nil
+	}
+
+	var names []string
+	for _, part := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !validName(name, "-_.") {
+			if len(names) == 0 {
+				return nil, fmt.Errorf("invalid variable %q: expected name=value", part)
+			}
+			last := names[len(names)-1]
+			vars[last] += "," + part
+			continue
+		}
+		if _, dup := vars[name]; dup {
+			return nil, fmt.Errorf("variable %q set more than once", name)
+		}
+		vars[name] = value
+		names = append(names, name)
+	}
+	for _, name := range names {
+		vars[name] = strings.TrimSpace(vars[name])
+	}
+	return vars, nil
+}
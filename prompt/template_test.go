@@ -0,0 +1,157 @@
+package prompt
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRender(t *testing.T) {
+	wildcards := fstest.MapFS{
+		"colors.txt":        {Data: []byte("# primary colors\nred\n\nblue\n")},
+		"scenes/studio.txt": {Data: []byte("a {white|grey} studio\n")},
+		"nested.txt":        {Data: []byte("__colors__ and {product}\n")},
+	}
+	r := NewRenderer(
+		WithVars(map[string]string{"product": "mug", "color": "red"}),
+		WithWildcards(wildcards),
+	)
+
+	tests := []struct {
+		template string
+		vars     map[string]string
+		want     []string
+	}{
+		{"a {color} {product}", nil, []string{"a red mug"}},
+		{"a { color } {product}", map[string]string{"color": "green"}, []string{"a green mug"}},
+		{"{red|blue} car", nil, []string{"red car", "blue car"}},
+		{"a{| shiny} car", nil, []string{"a car", "a shiny car"}},
+		{"{a {red|blue}|plain} car", nil, []string{"a red car", "a blue car", "plain car"}},
+		{"__colors__ car", nil, []string{"red car", "blue car"}},
+		{"in __scenes/studio__", nil, []string{"in a white studio", "in a grey studio"}},
+		{"__nested__", nil, []string{"red and mug", "blue and mug"}},
+		{`\{literal\} \| bar`, nil, []string{"{literal} | bar"}},
+		{"snake__case and __ underscores", nil, []string{"snake__case and __ underscores"}},
+		// A variable's choice is made once per prompt.
+		{"{tone} and {tone}", map[string]string{"tone": "{warm|cool}"}, []string{"warm and warm", "cool and cool"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			tmpl, err := Parse(tt.template)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			seen := map[string]bool{}
+			for seed := int64(0); seed < 50; seed++ {
+				got, err := r.Render(tmpl, seed, tt.vars)
+				if err != nil {
+					t.Fatalf("Render() error = %v", err)
+				}
+				seen[got] = true
+			}
+			for _, want := range tt.want {
+				if !seen[want] {
+					t.Errorf("never rendered %q; got %v", want, seen)
+				}
+			}
+			if len(seen) != len(tt.want) {
+				t.Errorf("rendered %v, want only %v", seen, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender_Deterministic(t *testing.T) {
+	r := NewRenderer()
+	tmpl := MustParse("{a|b|c|d} {e|f|g|h} {i|j|k|l}")
+	first, _ := r.Render(tmpl, 42, nil)
+	for i := 0; i < 10; i++ {
+		if got, _ := r.Render(tmpl, 42, nil); got != first {
+			t.Fatalf("seed 42 rendered %q, then %q", first, got)
+		}
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		template string
+		offset   int
+	}{
+		{"a {red|blue", 2},
+		{"a {color", 2},
+		{"a } b", 2},
+		{"a {two words} b", 2},
+		{"a {} b", 2},
+		{"{x|{y}", 0},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.template)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Parse(%q) error = %v, want a SyntaxError", tt.template, err)
+			continue
+		}
+		if syntaxErr.Offset != tt.offset {
+			t.Errorf("Parse(%q) offset = %d, want %d", tt.template, syntaxErr.Offset, tt.offset)
+		}
+	}
+}
+
+func TestRender_Errors(t *testing.T) {
+	wildcards := fstest.MapFS{
+		"empty.txt": {Data: []byte("# nothing here\n")},
+		"loop.txt":  {Data: []byte("__loop__\n")},
+	}
+	tests := []struct {
+		name     string
+		renderer *Renderer
+		template string
+		want     string
+	}{
+		{"undefined variable", NewRenderer(), "{color}", "undefined variable {color}"},
+		{"no wildcard dir", NewRenderer(), "__colors__", "no wildcard directory"},
+		{"unknown wildcard", NewRenderer(WithWildcards(wildcards)), "__colors__", "unknown wildcard __colors__"},
+		{"empty wildcard", NewRenderer(WithWildcards(wildcards)), "__empty__", "has no entries"},
+		{"recursive wildcard", NewRenderer(WithWildcards(wildcards)), "__loop__", "nested more than"},
+		{"bad variable value", NewRenderer(WithVars(map[string]string{"x": "{oops"})), "{x}", "variable {x}: offset 0: unclosed {"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.renderer.Expand(tt.template, 1, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expand(%q) error = %v, want it to contain %q", tt.template, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseVars(t *testing.T) {
+	tests := []struct {
+		in   string
+		want map[string]string
+	}{
+		{"", map[string]string{}},
+		{"color=red,product=mug", map[string]string{"color": "red", "product": "mug"}},
+		{"style=soft, warm light , color={red|blue}", map[string]string{"style": "soft, warm light", "color": "{red|blue}"}},
+		{"expr=a=b", map[string]string{"expr": "a=b"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseVars(tt.in)
+		if err != nil {
+			t.Errorf("ParseVars(%q) error = %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseVars(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"red", "color=red,color=blue"} {
+		if _, err := ParseVars(in); err == nil {
+			t.Errorf("ParseVars(%q) succeeded, want an error", in)
+		}
+	}
+}
@@ -0,0 +1,436 @@
+package prompt
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// ChunkSize is the number of prompt tokens CLIP encodes at once: its
+	// context of 77 tokens less the start and end markers. Longer prompts
+	// are truncated or, by front ends that support it, split into chunks
+	// encoded separately.
+	ChunkSize = 75
+
+	// StartOfText and EndOfText are CLIP's special tokens.
+	StartOfText = "<|startoftext|>"
+	EndOfText   = "<|endoftext|>"
+
+	// maxMerges is the number of merges CLIP uses from its merges file.
+	maxMerges = 49152 - 256 - 2
+
+	// vocabFile is the name of CLIP's merges file in the vocab directory.
+	vocabFile = "vocab/bpe_simple_vocab_16e6.txt.gz"
+)
+
+// vocab holds the merges file of OpenAI's CLIP, which is MIT licensed.
+//
+//go:embed vocab
+var vocab embed.FS
+
+// ErrNoVocabulary is returned by DefaultTokenizer when the program was built
+// without the CLIP vocabulary. Copy the file into the vocab directory of
+// this package before building, or load it with LoadTokenizer.
+var ErrNoVocabulary = errors.New("prompt: built without the CLIP vocabulary (" + vocabFile + ")")
+
+// wordPattern splits text into words the way CLIP does before applying BPE.
+var wordPattern = regexp.MustCompile(`(?i)<\|startoftext\|>|<\|endoftext\|>|'s|'t|'re|'ve|'m|'ll|'d|\p{L}+|\p{N}|[^\s\p{L}\p{N}]+`)
+
+// Token is a token of a prompt.
+type Token struct {
+	// ID is the index of the token in the vocabulary.
+	ID int `json:"id"`
+	// Text is the lowercased text the token stands for.
+	Text string `json:"text"`
+	// Offset is the byte offset of the token in the prompt.
+	Offset int `json:"offset"`
+}
+
+// Chunk is a run of at most ChunkSize tokens that CLIP encodes together.
+type Chunk struct {
+	// Start and End are the byte offsets of the chunk's text in the prompt.
+	Start  int     `json:"start"`
+	End    int     `json:"end"`
+	Tokens []Token `json:"tokens"`
+}
+
+// LimitError reports a prompt with more tokens than a limit.
+type LimitError struct {
+	Tokens int
+	Limit  int
+	// Offset is the byte offset of the first token past the limit.
+	Offset int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%d tokens, more than the limit of %d; text from offset %d on is past the limit", e.Tokens, e.Limit, e.Offset)
+}
+
+// Tokenizer is the byte-level BPE tokenizer of CLIP, the text encoder of
+// Stable Diffusion. A Tokenizer is safe for concurrent use.
+type Tokenizer struct {
+	encoder     map[string]int
+	ranks       map[[2]string]int
+	byteEncoder [256]string
+	byteDecoder map[rune]byte
+
+	mu    sync.Mutex
+	cache map[string][]string
+}
+
+// maxCached bounds the number of words whose BPE tokens are cached.
+const maxCached = 10000
+
+var (
+	defaultOnce      sync.Once
+	defaultTokenizer *Tokenizer
+	defaultErr       error
+)
+
+// DefaultTokenizer returns a tokenizer using the CLIP vocabulary embedded
+// in the program, or ErrNoVocabulary if it was built without it.
+func DefaultTokenizer() (*Tokenizer, error) {
+	defaultOnce.Do(func() {
+		f, err := vocab.Open(vocabFile)
+		if errors.Is(err, fs.ErrNotExist) {
+			defaultErr = ErrNoVocabulary
+			return
+		}
+		if err != nil {
+			defaultErr = err
+			return
+		}
+		defer f.Close()
+		defaultTokenizer, defaultErr = NewTokenizer(f)
+	})
+	return defaultTokenizer, defaultErr
+}
+
+// LoadTokenizer reads a CLIP merges file, such as bpe_simple_vocab_16e6.txt
+// or its gzipped form, from path.
+func LoadTokenizer(path string) (*Tokenizer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open vocabulary: %w", err)
+	}
+	defer f.Close()
+	return NewTokenizer(f)
+}
+
+// NewTokenizer reads a CLIP merges file from r. The file may be gzipped.
+// Its first line is a version header; each further line holds a pair of
+// symbols, in order of merge priority. Like CLIP, only the first 48,894
+// merges are used.
+func NewTokenizer(r io.Reader) (*Tokenizer, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vocabulary: %w", err)
+		}
+		defer zr.Close()
+		br = bufio.NewReader(zr)
+	}
+
+	t := &Tokenizer{
+		encoder:     make(map[string]int),
+		ranks:       make(map[[2]string]int),
+		byteDecoder: make(map[rune]byte),
+		cache:       make(map[string][]string),
+	}
+	symbols := byteSymbols()
+	for i, r := range symbols {
+		t.byteEncoder[i] = string(r)
+		t.byteDecoder[r] = byte(i)
+	}
+	// The vocabulary lists the byte symbols in CLIP's order, then the same
+	// symbols ending a word, then the merged symbols.
+	order := byteOrder()
+	for _, b := range order {
+		t.encoder[t.byteEncoder[b]] = len(t.encoder)
+	}
+	for _, b := range order {
+		t.encoder[t.byteEncoder[b]+"</w>"] = len(t.encoder)
+	}
+
+	scanner := bufio.NewScanner(br)
+	line, merges := 0, 0
+	for scanner.Scan() && merges < maxMerges {
+		line++
+		if line == 1 {
+			continue
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("vocabulary line %d: expected a pair of symbols", line)
+		}
+		t.ranks[[2]string{fields[0], fields[1]}] = merges
+		t.encoder[fields[0]+fields[1]] = 256*2 + merges
+		merges++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read vocabulary: %w", err)
+	}
+	if merges == 0 {
+		return nil, errors.New("vocabulary has no merges")
+	}
+	t.encoder[StartOfText] = 256*2 + merges
+	t.encoder[EndOfText] = 256*2 + merges + 1
+	return t, nil
+}
+
+// byteOrder returns the bytes in the order CLIP lists them: printable
+// Latin-1 characters first, then the rest.
+func byteOrder() []int {
+	var order []int
+	printable := make([]bool, 256)
+	for b := 0; b < 256; b++ {
+		if isPrintableByte(b) {
+			order = append(order, b)
+			printable[b] = true
+		}
+	}
+	for b := 0; b < 256; b++ {
+		if !printable[b] {
+			order = append(order, b)
+		}
+	}
+	return order
+}
+
+// byteSymbols maps each byte to the character standing for it in the
+// vocabulary. Printable Latin-1 characters stand for themselves, the other
+// bytes for characters from U+0100 on.
+func byteSymbols() [256]rune {
+	var symbols [256]rune
+	n := 0
+	for b := 0; b < 256; b++ {
+		if isPrintableByte(b) {
+			symbols[b] = rune(b)
+		} else {
+			symbols[b] = rune(256 + n)
+			n++
+		}
+	}
+	return symbols
+}
+
+func isPrintableByte(b int) bool {
+	return b >= '!' && b <= '~' || b >= 0xa1 && b <= 0xac || b >= 0xae && b <= 0xff
+}
+
+// Tokenize splits text into tokens, without the start and end markers.
+// Weighting syntax is tokenized like any other text; see TokenizePrompt.
+func (t *Tokenizer) Tokenize(text string) []Token {
+	var tokens []Token
+	for _, loc := range wordPattern.FindAllStringIndex(text, -1) {
+		word := text[loc[0]:loc[1]]
+		if special := strings.ToLower(word); special == StartOfText || special == EndOfText {
+			tokens = append(tokens, Token{ID: t.encoder[special], Text: special, Offset: loc[0]})
+			continue
+		}
+		offset := loc[0]
+		for _, symbol := range t.bpe(strings.ToLower(word)) {
+			decoded := t.decode(symbol)
+			tokens = append(tokens, Token{ID: t.encoder[symbol], Text: decoded, Offset: offset})
+			offset += len(decoded)
+		}
+	}
+	return tokens
+}
+
+// TokenizePrompt tokenizes text as a front end does before encoding it:
+// A1111 weighting syntax is removed and LoRA tags are left out. For a prompt
+// edit such as [cat:dog:0.5], the tokens of its longest variant are
+// counted. Text that is not valid weighting syntax is tokenized as is.
+func (t *Tokenizer) TokenizePrompt(text string) []Token {
+	nodes, err := ParseWeights(text, DialectA1111)
+	if err != nil {
+		return t.Tokenize(text)
+	}
+	return t.tokenizeNodes(nodes)
+}
+
+func (t *Tokenizer) tokenizeNodes(nodes []Node) []Token {
+	var tokens []Token
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *Text:
+			tokens = append(tokens, t.shifted(n.Text, n.Offset)...)
+		case *Emphasis:
+			tokens = append(tokens, t.tokenizeNodes(n.Children)...)
+		case *Edit:
+			tokens = append(tokens, t.tokenizeEdit(n)...)
+		}
+	}
+	return tokens
+}
+
+// tokenizeEdit returns the tokens of the longest variant of a prompt edit.
+func (t *Tokenizer) tokenizeEdit(n *Edit) []Token {
+	inner := n.Raw[1 : len(n.Raw)-1]
+	parts := splitTopLevel(inner, '|')
+	if len(parts) == 1 {
+		// [from:to:when] or [to:when]; the last part is the step.
+		parts = splitTopLevel(inner, ':')
+		if len(parts) > 1 {
+			parts = parts[:len(parts)-1]
+		}
+	}
+	var longest []Token
+	for _, part := range parts {
+		tokens := t.TokenizePrompt(inner[part[0]:part[1]])
+		if len(tokens) > len(longest) {
+			longest = tokens
+		}
+	}
+	for i := range longest {
+		longest[i].Offset += n.Offset + 1
+	}
+	return longest
+}
+
+// splitTopLevel returns the spans of s separated by sep outside brackets.
+func splitTopLevel(s string, sep byte) [][2]int {
+	var spans [][2]int
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case c == sep && depth == 0:
+			spans = append(spans, [2]int{start, i})
+			start = i + 1
+		}
+	}
+	return append(spans, [2]int{start, len(s)})
+}
+
+// shifted tokenizes text found at offset in the prompt.
+func (t *Tokenizer) shifted(text string, offset int) []Token {
+	tokens := t.Tokenize(text)
+	for i := range tokens {
+		tokens[i].Offset += offset
+	}
+	return tokens
+}
+
+// Count returns the number of tokens of a prompt, as TokenizePrompt
+// counts them.
+func (t *Tokenizer) Count(text string) int {
+	return len(t.TokenizePrompt(text))
+}
+
+// Chunks splits the tokens of a prompt into chunks of ChunkSize tokens.
+// Tokens past the first chunk are dropped by servers that truncate
+// prompts.
+func (t *Tokenizer) Chunks(text string) []Chunk {
+	tokens := t.TokenizePrompt(text)
+	var chunks []Chunk
+	for start := 0; start < len(tokens); start += ChunkSize {
+		end := start + ChunkSize
+		if end > len(tokens) {
+			end = len(tokens)
+		}
+		last := tokens[end-1]
+		chunk := Chunk{
+			Start:  tokens[start].Offset,
+			End:    last.Offset + len(last.Text),
+			Tokens: tokens[start:end],
+		}
+		if chunk.End > len(text) {
+			chunk.End = len(text)
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// CheckLimit returns a *LimitError if the prompt has more than limit
+// tokens.
+func (t *Tokenizer) CheckLimit(text string, limit int) error {
+	tokens := t.TokenizePrompt(text)
+	if len(tokens) <= limit {
+		return nil
+	}
+	return &LimitError{Tokens: len(tokens), Limit: limit, Offset: tokens[limit].Offset}
+}
+
+// bpe returns the vocabulary symbols of a lowercased word.
+func (t *Tokenizer) bpe(word string) []string {
+	t.mu.Lock()
+	cached, ok := t.cache[word]
+	t.mu.Unlock()
+	if ok {
+		return cached
+	}
+
+	var symbols []string
+	for i := 0; i < len(word); i++ {
+		symbols = append(symbols, t.byteEncoder[word[i]])
+	}
+	symbols[len(symbols)-1] += "</w>"
+
+	for len(symbols) > 1 {
+		best, bestRank := -1, 0
+		for i := 0; i+1 < len(symbols); i++ {
+			rank, ok := t.ranks[[2]string{symbols[i], symbols[i+1]}]
+			if ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		// Merge every occurrence of the pair, left to right.
+		first, second := symbols[best], symbols[best+1]
+		merged := symbols[:0:0]
+		for i := 0; i < len(symbols); i++ {
+			if i+1 < len(symbols) && symbols[i] == first && symbols[i+1] == second {
+				merged = append(merged, first+second)
+				i++
+				continue
+			}
+			merged = append(merged, symbols[i])
+		}
+		symbols = merged
+	}
+
+	t.mu.Lock()
+	if len(t.cache) >= maxCached {
+		t.cache = make(map[string][]string)
+	}
+	t.cache[word] = symbols
+	t.mu.Unlock()
+	return symbols
+}
+
+// decode returns the text a vocabulary symbol stands for.
+func (t *Tokenizer) decode(symbol string) string {
+	symbol = strings.TrimSuffix(symbol, "</w>")
+	b := make([]byte, 0, len(symbol))
+	for len(symbol) > 0 {
+		r, size := utf8.DecodeRuneInString(symbol)
+		b = append(b, t.byteDecoder[r])
+		symbol = symbol[size:]
+	}
+	return string(b)
+}
@@ -0,0 +1,181 @@
+package prompt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testTokenizer(t *testing.T) *Tokenizer {
+	t.Helper()
+	tok, err := LoadTokenizer("testdata/merges.txt")
+	if err != nil {
+		t.Fatalf("LoadTokenizer() error = %v", err)
+	}
+	return tok
+}
+
+func TestTokenizer_Tokenize(t *testing.T) {
+	tok := testTokenizer(t)
+	got := tok.Tokenize("Hello, red cat")
+	want := []Token{
+		{ID: 515, Text: "hello", Offset: 0},
+		{ID: 256 + ',' - '!', Text: ",", Offset: 5},
+		{ID: 517, Text: "red", Offset: 7},
+		{ID: 'c' - '!', Text: "c", Offset: 11},
+		{ID: 'a' - '!', Text: "a", Offset: 12},
+		{ID: 256 + 't' - '!', Text: "t", Offset: 13},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Tokenize() = %+v, want %+v", got, want)
+	}
+
+	// Bytes outside printable Latin-1 have symbols of their own.
+	got = tok.Tokenize("→")
+	if len(got) != 3 || got[0].Text+got[1].Text+got[2].Text != "→" || got[1].ID < 188 {
+		t.Errorf("Tokenize(→) = %+v", got)
+	}
+}
+
+func TestTokenizer_TokenizePrompt(t *testing.T) {
+	tok := testTokenizer(t)
+	got := tok.TokenizePrompt("(red:1.3) <lora:x:0.5> [cat:hello:0.5]")
+	want := []Token{
+		{ID: 517, Text: "red", Offset: 1},
+		{ID: 'c' - '!', Text: "c", Offset: 24},
+		{ID: 'a' - '!', Text: "a", Offset: 25},
+		{ID: 256 + 't' - '!', Text: "t", Offset: 26},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TokenizePrompt() = %+v, want %+v", got, want)
+	}
+	if n := tok.Count("a (red fox"); n != 6 {
+		t.Errorf("Count() of malformed syntax = %d, want 6", n)
+	}
+}
+
+func TestTokenizer_Chunks(t *testing.T) {
+	tok := testTokenizer(t)
+	text := strings.Repeat("red ", 80)
+	chunks := tok.Chunks(text)
+	if len(chunks) != 2 {
+		t.Fatalf("got %d chunks, want 2", len(chunks))
+	}
+	if len(chunks[0].Tokens) != ChunkSize || chunks[0].Start != 0 || chunks[0].End != 74*4+3 {
+		t.Errorf("first chunk = %d tokens %d-%d", len(chunks[0].Tokens), chunks[0].Start, chunks[0].End)
+	}
+	if len(chunks[1].Tokens) != 5 || chunks[1].Start != 300 || chunks[1].End != len(text)-1 {
+		t.Errorf("second chunk = %d tokens %d-%d", len(chunks[1].Tokens), chunks[1].Start, chunks[1].End)
+	}
+
+	var limitErr *LimitError
+	if err := tok.CheckLimit(text, ChunkSize); !errors.As(err, &limitErr) {
+		t.Fatalf("CheckLimit() error = %v, want a LimitError", err)
+	}
+	if limitErr.Tokens != 80 || limitErr.Limit != ChunkSize || limitErr.Offset != 300 {
+		t.Errorf("CheckLimit() = %+v", limitErr)
+	}
+	if err := tok.CheckLimit(text, 80); err != nil {
+		t.Errorf("CheckLimit() at the limit error = %v", err)
+	}
+}
+
+func TestNewTokenizer_Gzip(t *testing.T) {
+	data, err := os.ReadFile("testdata/merges.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	tok, err := NewTokenizer(&buf)
+	if err != nil {
+		t.Fatalf("NewTokenizer() error = %v", err)
+	}
+	if n := tok.Count("hello"); n != 1 {
+		t.Errorf("Count(hello) = %d, want 1", n)
+	}
+
+	if _, err := NewTokenizer(strings.NewReader("#version: 0.2\n")); err == nil {
+		t.Error("expected an error for a vocabulary without merges")
+	}
+}
+
+// clipTokenizer returns the tokenizer of the embedded CLIP vocabulary, or
+// of the copy named by $CLIP_VOCAB.
+func clipTokenizer(t *testing.T) *Tokenizer {
+	t.Helper()
+	tok, err := DefaultTokenizer()
+	if errors.Is(err, ErrNoVocabulary) {
+		path := os.Getenv("CLIP_VOCAB")
+		if path == "" {
+			t.Skip("built without the CLIP vocabulary; set CLIP_VOCAB to a copy of " + vocabFile)
+		}
+		tok, err = LoadTokenizer(path)
+	}
+	if err != nil {
+		t.Fatalf("DefaultTokenizer() error = %v", err)
+	}
+	return tok
+}
+
+func tokenIDs(tokens []Token) []int {
+	var ids []int
+	for _, token := range tokens {
+		ids = append(ids, token.ID)
+	}
+	return ids
+}
+
+func TestDefaultTokenizer(t *testing.T) {
+	tok := clipTokenizer(t)
+	tests := []struct {
+		text string
+		want []int
+	}{
+		{"a photo of a cat", []int{320, 1125, 539, 320, 2368}},
+		{"A Photo of a DOG", []int{320, 1125, 539, 320, 1929}},
+		{"a cat, a dog", []int{320, 2368, 267, 320, 1929}},
+		{StartOfText + "a cat" + EndOfText, []int{49406, 320, 2368, 49407}},
+	}
+	for _, tt := range tests {
+		if got := tokenIDs(tok.Tokenize(tt.text)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) IDs = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultTokenizer_Counts(t *testing.T) {
+	tok := clipTokenizer(t)
+	tests := []struct {
+		prompt string
+		want   int
+	}{
+		{"", 0},
+		{"a photo of a cat", 5},
+		{"a photo of a cat, a photo of a dog", 11},
+		{"(a photo:1.2) of a [cat]", 5},
+		{"a photo of a cat <lora:film:0.8>", 5},
+		{strings.Repeat("a cat ", 40), 80},
+	}
+	for _, tt := range tests {
+		if got := tok.Count(tt.prompt); got != tt.want {
+			t.Errorf("Count(%q) = %d, want %d", tt.prompt, got, tt.want)
+		}
+	}
+
+	chunks := tok.Chunks(strings.Repeat("a cat ", 40))
+	if len(chunks) != 2 || len(chunks[0].Tokens) != ChunkSize || len(chunks[1].Tokens) != 5 {
+		t.Errorf("Chunks() = %d chunks", len(chunks))
+	}
+	err := tok.CheckLimit(strings.Repeat("a cat ", 40), ChunkSize)
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Tokens != 80 || limitErr.Offset != 6*37+2 {
+		t.Errorf("CheckLimit() error = %v", err)
+	}
+}
@@ -0,0 +1,417 @@
+package prompt
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Dialect is a syntax for weighting parts of a prompt.
+type Dialect int
+
+const (
+	// DialectA1111 is the AUTOMATIC1111 syntax: (text) multiplies the weight
+	// by 1.1, [text] divides it by 1.1 and (text:1.3) sets it. It also has
+	// <lora:name:weight> tags and [from:to:when] prompt editing.
+	DialectA1111 Dialect = iota
+	// DialectNovelAI is the NovelAI syntax: {text} multiplies the weight by
+	// 1.05 and [text] divides it by 1.05.
+	DialectNovelAI
+	// DialectCompel is the syntax of the Compel library: (text)1.3. It can
+	// be written but not parsed.
+	DialectCompel
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case DialectA1111:
+		return "a1111"
+	case DialectNovelAI:
+		return "novelai"
+	case DialectCompel:
+		return "compel"
+	default:
+		return fmt.Sprintf("Dialect(%d)", int(d))
+	}
+}
+
+// Node is a part of a parsed prompt: *Text, *Emphasis, *LoRA or *Edit.
+type Node interface {
+	// Pos returns the byte offset of the node in the parsed text.
+	Pos() int
+}
+
+// Text is plain prompt text, with escapes removed.
+type Text struct {
+	Offset int
+	Text   string
+}
+
+// Emphasis changes the weight of the nodes it contains.
+type Emphasis struct {
+	Offset int
+	// Weight multiplies the weight of the children, for example 1.1 for
+	// (text) in the A1111 dialect.
+	Weight   float64
+	Children []Node
+}
+
+// LoRA is an A1111 <lora:name:weight> tag. <lyco:...> tags are LoRAs too.
+type LoRA struct {
+	Offset int
+	// Kind is "lora" or "lyco".
+	Kind string
+	Name string
+	// Weight is the strength of the LoRA, 1 if the tag does not set one.
+	Weight float64
+}
+
+// Edit is A1111 prompt editing ([from:to:when]) or alternation ([a|b]).
+// Its text is kept as written.
+type Edit struct {
+	Offset int
+	Raw    string
+}
+
+func (n *Text) Pos() int     { return n.Offset }
+func (n *Emphasis) Pos() int { return n.Offset }
+func (n *LoRA) Pos() int     { return n.Offset }
+func (n *Edit) Pos() int     { return n.Offset }
+
+// Weight factors of the bracket syntaxes.
+const (
+	a1111Factor   = 1.1
+	novelAIFactor = 1.05
+)
+
+// ParseWeights parses the weighting syntax of dialect d in text.
+//
+// Unlike the servers, which read malformed syntax as best they can,
+// ParseWeights reports unbalanced brackets, empty groups, weights that are
+// not numbers and malformed LoRA tags as a *SyntaxError.
+func ParseWeights(text string, d Dialect) ([]Node, error) {
+	if d != DialectA1111 && d != DialectNovelAI {
+		return nil, fmt.Errorf("prompt: cannot parse the %s dialect", d)
+	}
+	p := &weightParser{text: text, dialect: d}
+	nodes, err := p.parse(0)
+	if err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// weightParser parses weighting syntax.
+type weightParser struct {
+	text    string
+	pos     int
+	dialect Dialect
+}
+
+// parse parses nodes up to the end of the text or the closing bracket
+// close, which is left unconsumed. close is 0 at the top level.
+func (p *weightParser) parse(close byte) ([]Node, error) {
+	var (
+		nodes []Node
+		text  strings.Builder
+		start = p.pos
+	)
+	flush := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, &Text{Offset: start, Text: text.String()})
+			text.Reset()
+		}
+	}
+	up, down, closers, escapes := byte('('), byte('['), ")]", `()[]\`
+	if p.dialect == DialectNovelAI {
+		up, closers, escapes = '{', "}]", `{}[]\`
+	}
+
+	for p.pos < len(p.text) {
+		if text.Len() == 0 {
+			start = p.pos
+		}
+		c := p.text[p.pos]
+		switch {
+		case c == '\\' && p.pos+1 < len(p.text) && strings.IndexByte(escapes, p.text[p.pos+1]) >= 0:
+			text.WriteByte(p.text[p.pos+1])
+			p.pos += 2
+		case c == close:
+			flush()
+			return nodes, nil
+		case close == ')' && c == ':':
+			// (text:weight) ends here; the caller parses the weight.
+			if end := strings.IndexAny(p.text[p.pos:], "()"); end >= 0 && p.text[p.pos+end] == ')' {
+				flush()
+				return nodes, nil
+			}
+			text.WriteByte(c)
+			p.pos++
+		case c == up:
+			flush()
+			n, err := p.parseGroup(c)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, n)
+		case c == down:
+			flush()
+			if p.dialect == DialectA1111 {
+				if raw, ok := p.edit(); ok {
+					nodes = append(nodes, &Edit{Offset: p.pos, Raw: raw})
+					p.pos += len(raw)
+					continue
+				}
+			}
+			n, err := p.parseGroup(c)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, n)
+		case strings.IndexByte(closers, c) >= 0:
+			return nil, &SyntaxError{Offset: p.pos, Message: fmt.Sprintf("unmatched %c", c)}
+		case c == '<' && p.dialect == DialectA1111:
+			n, ok, err := p.parseLoRA()
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				text.WriteByte(c)
+				p.pos++
+				continue
+			}
+			flush()
+			nodes = append(nodes, n)
+		default:
+			text.WriteByte(c)
+			p.pos++
+		}
+	}
+	flush()
+	if close != 0 {
+		return nil, errUnclosed
+	}
+	return nodes, nil
+}
+
+// errUnclosed is returned by parse when the text ends inside a group. The
+// group reports it at its opening bracket.
+var errUnclosed = &SyntaxError{Message: "unclosed group"}
+
+// parseGroup parses an emphasis group starting at the bracket open.
+func (p *weightParser) parseGroup(open byte) (Node, error) {
+	start := p.pos
+	closing := map[byte]byte{'(': ')', '[': ']', '{': '}'}[open]
+	p.pos++
+	children, err := p.parse(closing)
+	if err == errUnclosed {
+		return nil, &SyntaxError{Offset: start, Message: fmt.Sprintf("unclosed %c", open)}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	factor := a1111Factor
+	if p.dialect == DialectNovelAI {
+		factor = novelAIFactor
+	}
+	weight := factor
+	if open == '[' {
+		weight = 1 / factor
+	}
+	if p.text[p.pos] == ':' {
+		end := p.pos + strings.IndexByte(p.text[p.pos:], ')')
+		value := strings.TrimSpace(p.text[p.pos+1 : end])
+		w, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(w) || math.IsInf(w, 0) {
+			return nil, &SyntaxError{Offset: p.pos + 1, Message: fmt.Sprintf("invalid weight %q", value)}
+		}
+		weight = w
+		p.pos = end
+	}
+	p.pos++
+
+	if len(children) == 0 {
+		return nil, &SyntaxError{Offset: start, Message: fmt.Sprintf("empty %c%c", open, closing)}
+	}
+	return &Emphasis{Offset: start, Weight: weight, Children: children}, nil
+}
+
+// edit returns the text of an A1111 prompt editing or alternation group
+// starting at "[", which has a ":" or "|" outside nested brackets.
+func (p *weightParser) edit() (string, bool) {
+	depth := 0
+	special := false
+	for i := p.pos; i < len(p.text); i++ {
+		switch c := p.text[i]; {
+		case c == '\\':
+			i++
+		case c == '[' || c == '(':
+			depth++
+		case c == ']' || c == ')':
+			depth--
+			if depth == 0 {
+				return p.text[p.pos : i+1], special && c == ']'
+			}
+		case (c == ':' || c == '|') && depth == 1:
+			special = true
+		}
+	}
+	return "", false
+}
+
+// parseLoRA parses a <lora:name:weight> tag starting at "<". It reports
+// false if the tag is not a LoRA tag.
+func (p *weightParser) parseLoRA() (Node, bool, error) {
+	rest := p.text[p.pos+1:]
+	kind, _, ok := strings.Cut(rest, ":")
+	if !ok || (kind != "lora" && kind != "lyco") {
+		return nil, false, nil
+	}
+	end := strings.IndexByte(rest, '>')
+	if end < 0 {
+		return nil, false, &SyntaxError{Offset: p.pos, Message: fmt.Sprintf("unclosed <%s: tag", kind)}
+	}
+
+	fields := strings.Split(rest[len(kind)+1:end], ":")
+	n := &LoRA{Offset: p.pos, Kind: kind, Name: strings.TrimSpace(fields[0]), Weight: 1}
+	if n.Name == "" {
+		return nil, false, &SyntaxError{Offset: p.pos, Message: fmt.Sprintf("<%s:> tag without a name", kind)}
+	}
+	if len(fields) > 2 {
+		return nil, false, &SyntaxError{Offset: p.pos, Message: fmt.Sprintf("<%s:> tag with more than one weight", kind)}
+	}
+	if len(fields) == 2 {
+		value := strings.TrimSpace(fields[1])
+		w, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(w) || math.IsInf(w, 0) {
+			return nil, false, &SyntaxError{Offset: p.pos, Message: fmt.Sprintf("invalid %s weight %q", kind, value)}
+		}
+		n.Weight = w
+	}
+	p.pos += end + 2
+	return n, true, nil
+}
+
+// FormatWeights writes nodes in dialect d. Weights that the bracket
+// syntax of d cannot express exactly are written as explicit weights in
+// the A1111 and Compel dialects, and rounded to the nearest number of
+// brackets in the NovelAI dialect, where weights that are not positive
+// numbers, such as 0 or -1, leave the text unbracketed. LoRA tags and prompt
+// editing are kept as written.
+func FormatWeights(nodes []Node, d Dialect) string {
+	var b strings.Builder
+	formatNodes(&b, nodes, d)
+	return b.String()
+}
+
+// ConvertWeights parses text in the dialect from and writes it in the
+// dialect to.
+func ConvertWeights(text string, from, to Dialect) (string, error) {
+	nodes, err := ParseWeights(text, from)
+	if err != nil {
+		return "", err
+	}
+	return FormatWeights(nodes, to), nil
+}
+
+func formatNodes(b *strings.Builder, nodes []Node, d Dialect) {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *Text:
+			b.WriteString(escapeWeights(n.Text, d))
+		case *LoRA:
+			fmt.Fprintf(b, "<%s:%s", n.Kind, n.Name)
+			if n.Weight != 1 {
+				b.WriteString(":" + formatWeight(n.Weight))
+			}
+			b.WriteByte('>')
+		case *Edit:
+			b.WriteString(n.Raw)
+		case *Emphasis:
+			formatEmphasis(b, n, d)
+		}
+	}
+}
+
+func formatEmphasis(b *strings.Builder, n *Emphasis, d Dialect) {
+	switch d {
+	case DialectNovelAI:
+		if !(n.Weight > 0) || math.IsInf(n.Weight, 0) {
+			// Brackets only scale by positive factors.
+			formatNodes(b, n.Children, d)
+			return
+		}
+		count := int(math.Round(math.Log(n.Weight) / math.Log(novelAIFactor)))
+		open, close := "{", "}"
+		if count < 0 {
+			open, close, count = "[", "]", -count
+		}
+		b.WriteString(strings.Repeat(open, count))
+		formatNodes(b, n.Children, d)
+		b.WriteString(strings.Repeat(close, count))
+	case DialectCompel:
+		n = collapse(n, func(float64) bool { return false })
+		b.WriteByte('(')
+		formatNodes(b, n.Children, d)
+		b.WriteString(")" + formatWeight(n.Weight))
+	default:
+		n = collapse(n, func(w float64) bool {
+			return sameWeight(w, a1111Factor) || sameWeight(w, 1/a1111Factor)
+		})
+		switch {
+		case sameWeight(n.Weight, a1111Factor):
+			b.WriteByte('(')
+			formatNodes(b, n.Children, d)
+			b.WriteByte(')')
+		case sameWeight(n.Weight, 1/a1111Factor):
+			b.WriteByte('[')
+			formatNodes(b, n.Children, d)
+			b.WriteByte(']')
+		default:
+			b.WriteByte('(')
+			formatNodes(b, n.Children, d)
+			b.WriteString(":" + formatWeight(n.Weight) + ")")
+		}
+	}
+}
+
+// collapse merges directly nested emphasis into one, unless both weights
+// can be written with brackets, so {{text}} becomes (text:1.1) rather than
+// ((text:1.05):1.05).
+func collapse(n *Emphasis, bracket func(float64) bool) *Emphasis {
+	for len(n.Children) == 1 {
+		child, ok := n.Children[0].(*Emphasis)
+		if !ok || bracket(n.Weight) && bracket(child.Weight) {
+			break
+		}
+		n = &Emphasis{Offset: n.Offset, Weight: n.Weight * child.Weight, Children: child.Children}
+	}
+	return n
+}
+
+// escapeWeights escapes the characters that are syntax in dialect d.
+func escapeWeights(text string, d Dialect) string {
+	special := "()[]"
+	if d == DialectNovelAI {
+		special = "{}[]"
+	}
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' || strings.IndexByte(special, text[i]) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(text[i])
+	}
+	return b.String()
+}
+
+// formatWeight formats a weight with at most two decimals.
+func formatWeight(w float64) string {
+	return strconv.FormatFloat(math.Round(w*100)/100, 'f', -1, 64)
+}
+
+func sameWeight(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
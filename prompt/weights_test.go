@@ -0,0 +1,129 @@
+package prompt
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseWeights(t *testing.T) {
+	nodes, err := ParseWeights(`a (red:1.3) fox, ((detailed)), [blurry] <lora:film_grain:0.6> \(literal\) [cat:dog:0.5]`, DialectA1111)
+	if err != nil {
+		t.Fatalf("ParseWeights() error = %v", err)
+	}
+	want := []Node{
+		&Text{Offset: 0, Text: "a "},
+		&Emphasis{Offset: 2, Weight: 1.3, Children: []Node{&Text{Offset: 3, Text: "red"}}},
+		&Text{Offset: 11, Text: " fox, "},
+		&Emphasis{Offset: 17, Weight: 1.1, Children: []Node{
+			&Emphasis{Offset: 18, Weight: 1.1, Children: []Node{&Text{Offset: 19, Text: "detailed"}}},
+		}},
+		&Text{Offset: 29, Text: ", "},
+		&Emphasis{Offset: 31, Weight: 1 / 1.1, Children: []Node{&Text{Offset: 32, Text: "blurry"}}},
+		&Text{Offset: 39, Text: " "},
+		&LoRA{Offset: 40, Kind: "lora", Name: "film_grain", Weight: 0.6},
+		&Text{Offset: 61, Text: " (literal) "},
+		&Edit{Offset: 74, Raw: "[cat:dog:0.5]"},
+	}
+	if !reflect.DeepEqual(nodes, want) {
+		for i := range nodes {
+			if i < len(want) && !reflect.DeepEqual(nodes[i], want[i]) {
+				t.Errorf("node %d = %+v, want %+v", i, nodes[i], want[i])
+			}
+		}
+		if len(nodes) != len(want) {
+			t.Errorf("got %d nodes, want %d", len(nodes), len(want))
+		}
+	}
+}
+
+func TestParseWeights_Errors(t *testing.T) {
+	tests := []struct {
+		text    string
+		dialect Dialect
+		offset  int
+		message string
+	}{
+		{"a (red fox", DialectA1111, 2, "unclosed ("},
+		{"a ((red) fox", DialectA1111, 2, "unclosed ("},
+		{"a red) fox", DialectA1111, 5, "unmatched )"},
+		{"a [red fox", DialectA1111, 2, "unclosed ["},
+		{"a () fox", DialectA1111, 2, "empty ()"},
+		{"a (red:high) fox", DialectA1111, 7, `invalid weight "high"`},
+		{"a (red:) fox", DialectA1111, 7, `invalid weight ""`},
+		{"<lora:film", DialectA1111, 0, "unclosed <lora: tag"},
+		{"x <lora::0.5>", DialectA1111, 2, "<lora:> tag without a name"},
+		{"x <lora:film:strong>", DialectA1111, 2, `invalid lora weight "strong"`},
+		{"a {red fox", DialectNovelAI, 2, "unclosed {"},
+		{"a red} fox", DialectNovelAI, 5, "unmatched }"},
+	}
+	for _, tt := range tests {
+		_, err := ParseWeights(tt.text, tt.dialect)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("ParseWeights(%q) error = %v, want a SyntaxError", tt.text, err)
+			continue
+		}
+		if syntaxErr.Offset != tt.offset || syntaxErr.Message != tt.message {
+			t.Errorf("ParseWeights(%q) error = %d: %s, want %d: %s", tt.text, syntaxErr.Offset, syntaxErr.Message, tt.offset, tt.message)
+		}
+	}
+
+	// Characters that are only syntax in another dialect are text.
+	for _, tt := range []struct {
+		text    string
+		dialect Dialect
+	}{
+		{"a {red} fox: (ok)", DialectA1111},
+		{"a (red fox", DialectNovelAI},
+		{"a <lora:x> tag", DialectNovelAI},
+		{"a < b and time: 10:30", DialectA1111},
+	} {
+		if _, err := ParseWeights(tt.text, tt.dialect); err != nil {
+			t.Errorf("ParseWeights(%q, %s) error = %v", tt.text, tt.dialect, err)
+		}
+	}
+}
+
+func TestFormatWeights(t *testing.T) {
+	tests := []struct {
+		text     string
+		from, to Dialect
+		want     string
+	}{
+		// Re-serializing keeps the syntax.
+		{`a (red:1.3) fox, ((detailed)), [blurry] <lora:film:0.6> \(x\) [cat:dog:0.5]`, DialectA1111, DialectA1111,
+			`a (red:1.3) fox, ((detailed)), [blurry] <lora:film:0.6> \(x\) [cat:dog:0.5]`},
+		{"a (red: 1.10) fox", DialectA1111, DialectA1111, "a (red) fox"},
+		{"a (red:1.3) fox, [blurry]", DialectA1111, DialectCompel, "a (red)1.3 fox, (blurry)0.91"},
+		{"a (red:1.1) {fox}", DialectA1111, DialectNovelAI, `a {{red}} \{fox\}`},
+		{"a {{red}} [fox] (x)", DialectNovelAI, DialectA1111, `a (red:1.1) (fox:0.95) \(x\)`},
+		{"a {red}", DialectNovelAI, DialectNovelAI, "a {red}"},
+		// Weights brackets cannot express leave the text unbracketed.
+		{"a (red:0) fox", DialectA1111, DialectNovelAI, "a red fox"},
+		{"a (red:-1) fox", DialectA1111, DialectNovelAI, "a red fox"},
+		{"a (red:0) fox", DialectA1111, DialectA1111, "a (red:0) fox"},
+	}
+	for _, tt := range tests {
+		got, err := ConvertWeights(tt.text, tt.from, tt.to)
+		if err != nil {
+			t.Errorf("ConvertWeights(%q) error = %v", tt.text, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ConvertWeights(%q, %s, %s) = %q, want %q", tt.text, tt.from, tt.to, got, tt.want)
+		}
+	}
+
+	for _, w := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		nodes := []Node{&Emphasis{Weight: w, Children: []Node{&Text{Text: "red"}}}}
+		if got := FormatWeights(nodes, DialectNovelAI); got != "red" {
+			t.Errorf("FormatWeights(weight %v) = %q, want %q", w, got, "red")
+		}
+	}
+
+	if _, err := ParseWeights("(x)1.2", DialectCompel); err == nil {
+		t.Error("expected an error parsing the Compel dialect")
+	}
+}
@@ -0,0 +1,443 @@
+// Package queue provides a durable job queue for long generation runs.
+//
+// Jobs are kept in a Store backed by an append-only JSONL log, so the queue
+// survives crashes and restarts: every state change appends the job's new
+// state, and the latest line for a job wins. Several processes may share a
+// store file, for example one adding jobs while another runs them; call
+// Refresh to pick up changes made by others. Only one Worker should run
+// against a store at a time.
+//
+//	store, err := queue.Open("queue.jsonl")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer store.Close()
+//
+//	store.Add(queue.Job{Request: drawthings.TextToImageRequest{Prompt: "a lighthouse"}})
+//	err = queue.NewWorker(store, client, queue.WithOutputDir("out")).Run(ctx)
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/drawthings_go"
+)
+
+// State is the lifecycle state of a job.
+type State string
+
+// Job states.
+const (
+	StatePending   State = "pending"
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+	StateCanceled  State = "canceled"
+)
+
+// Done reports whether the state is final.
+func (s State) Done() bool {
+	return s == StateSucceeded || s == StateFailed || s == StateCanceled
+}
+
+// ParseState parses a state name.
+func ParseState(s string) (State, error) {
+	switch state := State(s); state {
+	case StatePending, StateRunning, StateSucceeded, StateFailed, StateCanceled:
+		return state, nil
+	}
+	return "", fmt.Errorf("invalid job state %q", s)
+}
+
+// DefaultMaxAttempts is the number of attempts a job gets unless it sets
+// MaxAttempts.
+const DefaultMaxAttempts = 3
+
+// Job is a queued generation request.
+type Job struct {
+	// ID identifies the job. Jobs added without an ID are numbered.
+	ID string `json:"id"`
+
+	// Request is the generation request.
+	Request drawthings.TextToImageRequest `json:"request"`
+
+	// Output is an optional output path, relative to the worker's output
+	// directory unless absolute. The default is "<id>.png".
+	Output string `json:"output,omitempty"`
+
+	// Priority orders pending jobs; higher runs first. Jobs of equal
+	// priority run in the order they were added.
+	Priority int `json:"priority"`
+
+	// MaxAttempts limits how often a job is tried before it fails.
+	MaxAttempts int `json:"max_attempts"`
+
+	// RandomSeed is set when the worker picked the seed of a request
+	// without one. Such jobs bypass the client's result cache.
+	RandomSeed bool `json:"random_seed,omitempty"`
+
+	State     State     `json:"state"`
+	Attempts  int       `json:"attempts"`
+	Outputs   []string  `json:"outputs,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	ErrorType string    `json:"error_type,omitempty"`
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+	// RetryAt delays a pending job that failed with a retryable error.
+	RetryAt *time.Time `json:"retry_at,omitempty"`
+}
+
+// Errors returned by Store methods.
+var (
+	ErrNotFound  = errors.New("job not found")
+	ErrDuplicate = errors.New("job ID already exists")
+	ErrFinished  = errors.New("job already finished")
+)
+
+// Store is a durable set of jobs.
+type Store struct {
+	path string
+
+	mu     sync.Mutex
+	file   *os.File
+	offset int64
+	jobs   map[string]*Job
+	seq    int
+}
+
+// Open opens the store at path, creating it if needed.
+func Open(path string) (*Store, error) {
+	if dir := filepath.Dir(path); dir != "." && dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, drawthings.NewStorageError("failed to create queue directory", err)
+		}
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, drawthings.NewStorageError("failed to open queue", err)
+	}
+	s := &Store{path: path, file: f, jobs: make(map[string]*Job)}
+	if err := s.Refresh(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close closes the store.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// Path returns the path of the store's log file.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Refresh applies changes appended to the log since it was last read,
+// including those written by other processes.
+func (s *Store) Refresh() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refreshLocked()
+}
+
+// refreshLocked implements Refresh. The caller must hold s.mu.
+func (s *Store) refreshLocked() error {
+	data, err := io.ReadAll(io.NewSectionReader(s.file, s.offset, 1<<62))
+	if err != nil {
+		return drawthings.NewStorageError("failed to read queue", err)
+	}
+	// Leave a partially written last line for the next refresh.
+	end := bytes.LastIndexByte(data, '\n') + 1
+	scanner := bufio.NewScanner(bytes.NewReader(data[:end]))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var job Job
+		if err := json.Unmarshal(line, &job); err != nil {
+			// A torn write from a crash; later lines are still valid.
+			continue
+		}
+		s.apply(&job)
+	}
+	s.offset += int64(end)
+	return nil
+}
+
+// apply records job as the latest state of its ID.
+func (s *Store) apply(job *Job) {
+	s.jobs[job.ID] = job
+	if n, err := strconv.Atoi(job.ID); err == nil && n > s.seq {
+		s.seq = n
+	}
+}
+
+// write appends job to the log and applies it. The caller must hold s.mu.
+func (s *Store) write(job *Job) error {
+	job.Updated = time.Now()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return drawthings.NewStorageError("failed to write queue", err)
+	}
+	s.apply(job)
+	return nil
+}
+
+// Add adds a pending job and returns it with its ID and defaults filled in.
+func (s *Store) Add(job Job) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refreshLocked(); err != nil {
+		return Job{}, err
+	}
+	if job.ID == "" {
+		s.seq++
+		job.ID = fmt.Sprintf("%06d", s.seq)
+	} else if _, ok := s.jobs[job.ID]; ok {
+		return Job{}, fmt.Errorf("%w: %s", ErrDuplicate, job.ID)
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = DefaultMaxAttempts
+	}
+	job.State = StatePending
+	job.Attempts = 0
+	job.Created = time.Now()
+	if err := s.write(&job); err != nil {
+		return Job{}, err
+	}
+	return job, nil
+}
+
+// Get returns the job with the given ID.
+func (s *Store) Get(id string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return *job, nil
+}
+
+// List returns the jobs in any of the given states (all jobs if none are
+// given) in the order they were added.
+func (s *Store) List(states ...State) []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var jobs []Job
+	for _, job := range s.jobs {
+		if len(states) == 0 || hasState(states, job.State) {
+			jobs = append(jobs, *job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].Created.Equal(jobs[j].Created) {
+			return jobs[i].Created.Before(jobs[j].Created)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs
+}
+
+func hasState(states []State, state State) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// Cancel cancels a pending or running job. A running job is interrupted by
+// its worker the next time the worker checks the store.
+func (s *Store) Cancel(id string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refreshLocked(); err != nil {
+		return Job{}, err
+	}
+	current, ok := s.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if current.State.Done() {
+		return *current, fmt.Errorf("%w: %s is %s", ErrFinished, id, current.State)
+	}
+	job := *current
+	job.State = StateCanceled
+	if err := s.write(&job); err != nil {
+		return Job{}, err
+	}
+	return job, nil
+}
+
+// Recover requeues jobs left running by a worker that stopped without
+// finishing them, and returns how many it requeued. Jobs that have used up
+// their attempts fail instead, so a job that crashes the worker is not
+// retried forever. Workers call it when they start.
+func (s *Store) Recover() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int
+	for _, current := range s.jobs {
+		if current.State != StateRunning {
+			continue
+		}
+		job := *current
+		if job.Attempts >= job.MaxAttempts {
+			job.State = StateFailed
+			job.Error = "the worker stopped during the last attempt"
+		} else {
+			job.State = StatePending
+			n++
+		}
+		if err := s.write(&job); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// claim marks the next runnable job as running and returns it. Pending jobs
+// run by descending priority, then in the order they were added. Jobs added
+// or canceled by other processes are seen before choosing.
+func (s *Store) claim(now time.Time) (Job, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refreshLocked(); err != nil {
+		return Job{}, false, err
+	}
+	var next *Job
+	for _, job := range s.jobs {
+		if job.State != StatePending || job.RetryAt != nil && job.RetryAt.After(now) {
+			continue
+		}
+		if next == nil || runsBefore(job, next) {
+			next = job
+		}
+	}
+	if next == nil {
+		return Job{}, false, nil
+	}
+	job := *next
+	job.State = StateRunning
+	job.Attempts++
+	if err := s.write(&job); err != nil {
+		return Job{}, false, err
+	}
+	return job, true, nil
+}
+
+func runsBefore(a, b *Job) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if !a.Created.Equal(b.Created) {
+		return a.Created.Before(b.Created)
+	}
+	return a.ID < b.ID
+}
+
+// update records a new state for a job claimed by the worker, unless the
+// job was canceled in the meantime. It returns the stored job.
+func (s *Store) update(job Job) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refreshLocked(); err != nil {
+		return Job{}, err
+	}
+	if current, ok := s.jobs[job.ID]; ok && current.State == StateCanceled {
+		return *current, nil
+	}
+	if err := s.write(&job); err != nil {
+		return Job{}, err
+	}
+	return job, nil
+}
+
+// nextRetry returns the earliest RetryAt of the pending jobs, and false if
+// there are no pending jobs.
+func (s *Store) nextRetry() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next time.Time
+	found := false
+	for _, job := range s.jobs {
+		if job.State != StatePending {
+			continue
+		}
+		var at time.Time
+		if job.RetryAt != nil {
+			at = *job.RetryAt
+		}
+		if !found || at.Before(next) {
+			next, found = at, true
+		}
+	}
+	return next, found
+}
+
+// Compact rewrites the log with only the latest state of each job. It must
+// not run while other processes use the store.
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var buf bytes.Buffer
+	ids := make([]string, 0, len(s.jobs))
+	for id := range s.jobs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		data, err := json.Marshal(s.jobs[id])
+		if err != nil {
+			return err
+		}
+		buf.Write(append(data, '\n'))
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return drawthings.NewStorageError("failed to compact queue", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return drawthings.NewStorageError("failed to compact queue", err)
+	}
+	f, err := os.OpenFile(s.path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return drawthings.NewStorageError("failed to reopen queue", err)
+	}
+	s.file.Close()
+	s.file = f
+	s.offset = int64(buf.Len())
+	return nil
+}
@@ -0,0 +1,228 @@
+package queue
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/drawthings_go"
+)
+
+func openStore(t *testing.T, path string) *Store {
+	t.Helper()
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStore_PersistsAcrossOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.jsonl")
+	s := openStore(t, path)
+
+	a, err := s.Add(Job{Request: drawthings.TextToImageRequest{Prompt: "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ID != "000001" || a.State != StatePending || a.MaxAttempts != DefaultMaxAttempts {
+		t.Errorf("unexpected job: %+v", a)
+	}
+	if _, err := s.Add(Job{ID: "custom", Request: drawthings.TextToImageRequest{Prompt: "b"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(Job{ID: "custom"}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("expected ErrDuplicate, got %v", err)
+	}
+	if _, err := s.Cancel("custom"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Cancel("custom"); !errors.Is(err, ErrFinished) {
+		t.Errorf("expected ErrFinished, got %v", err)
+	}
+	if _, err := s.Cancel("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	reopened := openStore(t, path)
+	jobs := reopened.List()
+	if len(jobs) != 2 || jobs[0].ID != "000001" || jobs[1].State != StateCanceled {
+		t.Fatalf("unexpected jobs after reopening: %+v", jobs)
+	}
+	if pending := reopened.List(StatePending); len(pending) != 1 {
+		t.Errorf("expected 1 pending job, got %d", len(pending))
+	}
+	// Numbering continues after the existing jobs.
+	if c, _ := reopened.Add(Job{}); c.ID != "000002" {
+		t.Errorf("next ID: got %q, want 000002", c.ID)
+	}
+}
+
+func TestStore_SharedBetweenProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.jsonl")
+	worker := openStore(t, path)
+	cli := openStore(t, path)
+
+	job, err := cli.Add(Job{Request: drawthings.TextToImageRequest{Prompt: "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := worker.Get(job.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatal("worker should not see the job before refreshing")
+	}
+	if err := worker.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := worker.Get(job.ID); err != nil {
+		t.Fatalf("worker should see the job after refreshing: %v", err)
+	}
+
+	// A torn line at the end is left for the next refresh.
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"id":"000001","state":"cance`)
+	f.Close()
+	if err := worker.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := worker.Get(job.ID); got.State != StatePending {
+		t.Errorf("partial line should be ignored, got state %s", got.State)
+	}
+}
+
+func TestStore_ClaimSeesOtherProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.jsonl")
+	worker := openStore(t, path)
+	cli := openStore(t, path)
+
+	// Jobs canceled by another process are not claimed, even if the worker
+	// read them as pending.
+	first, _ := cli.Add(Job{ID: "first"})
+	if err := worker.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.Cancel(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if job, ok, err := worker.claim(time.Now()); err != nil || ok {
+		t.Fatalf("claim() = %+v, %t, %v; want no job", job, ok, err)
+	}
+
+	// Jobs added by another process are claimed without a Refresh.
+	cli.Add(Job{ID: "second"})
+	job, ok, err := worker.claim(time.Now())
+	if err != nil || !ok || job.ID != "second" {
+		t.Fatalf("claim() = %+v, %t, %v; want job second", job, ok, err)
+	}
+	if got, _ := cli.Get("first"); got.State != StateCanceled {
+		t.Errorf("canceled job is %s", got.State)
+	}
+}
+
+func TestStore_ClaimOrderAndRecover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.jsonl")
+	s := openStore(t, path)
+
+	s.Add(Job{ID: "low"})
+	s.Add(Job{ID: "high", Priority: 5})
+	s.Add(Job{ID: "low2"})
+	// Delayed jobs are skipped until RetryAt, regardless of priority.
+	later := time.Now().Add(time.Hour)
+	s.Add(Job{ID: "later", Priority: 9, RetryAt: &later})
+
+	var order []string
+	for {
+		job, ok, err := s.claim(time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		order = append(order, job.ID)
+	}
+	if got := len(order); got != 3 || order[0] != "high" || order[1] != "low" || order[2] != "low2" {
+		t.Errorf("claim order: got %v, want [high low low2]", order)
+	}
+
+	// Jobs left running by a crashed worker are requeued.
+	reopened := openStore(t, path)
+	n, err := reopened.Recover()
+	if err != nil || n != 3 {
+		t.Fatalf("Recover() = %d, %v; want 3", n, err)
+	}
+	if running := reopened.List(StateRunning); len(running) != 0 {
+		t.Errorf("expected no running jobs, got %+v", running)
+	}
+}
+
+func TestStore_RecoverUsedUpAttempts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.jsonl")
+	s := openStore(t, path)
+	s.Add(Job{ID: "last", MaxAttempts: 1})
+	s.Add(Job{ID: "again", MaxAttempts: 2})
+
+	// Each crash leaves the claimed jobs running.
+	for crash := 1; crash <= 2; crash++ {
+		for {
+			_, ok, err := s.claim(time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				break
+			}
+		}
+		s = openStore(t, path)
+		if _, err := s.Recover(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, id := range []string{"last", "again"} {
+		job, _ := s.Get(id)
+		if job.State != StateFailed || job.Error == "" || job.Attempts != job.MaxAttempts {
+			t.Errorf("job %s after crashes: %+v; want failed after %d attempts", id, job, job.MaxAttempts)
+		}
+	}
+	if _, ok, err := s.claim(time.Now()); err != nil || ok {
+		t.Errorf("claim() = %t, %v; want no job", ok, err)
+	}
+}
+
+func TestStore_Compact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.jsonl")
+	s := openStore(t, path)
+	s.Add(Job{ID: "a"})
+	s.Cancel("a")
+	s.Add(Job{ID: "b"})
+
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if lines := len(splitLines(data)); lines != 2 {
+		t.Errorf("expected 2 lines after compaction, got %d", lines)
+	}
+	// The store keeps working after compaction.
+	if _, err := s.Add(Job{ID: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if jobs := openStore(t, path).List(); len(jobs) != 3 {
+		t.Errorf("expected 3 jobs, got %d", len(jobs))
+	}
+}
+
+func splitLines(data []byte) []string {
+	var lines []string
+	start := 0
+	for i, b := range data {
+		if b == '\n' {
+			lines = append(lines, string(data[start:i]))
+			start = i + 1
+		}
+	}
+	return lines
+}
@@ -0,0 +1,307 @@
+package queue
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/drawthings_go"
+	"github.com/drawthings_go/internal/fsutil"
+)
+
+// Generator generates images. *drawthings.Client satisfies this interface.
+type Generator interface {
+	GenerateImage(ctx context.Context, req *drawthings.TextToImageRequest) (*drawthings.TextToImageResponse, error)
+}
+
+// Worker runs queued jobs one at a time.
+type Worker struct {
+	store     *Store
+	generator Generator
+	outputDir string
+	poll      time.Duration
+	backoff   time.Duration
+	wait      bool
+	onEvent   func(Job)
+	metrics   Metrics
+}
+
+// WorkerOption is a function that configures a Worker.
+type WorkerOption func(*Worker)
+
+// WithOutputDir sets the directory relative output paths are resolved
+// against (default: the current directory).
+func WithOutputDir(dir string) WorkerOption {
+	return func(w *Worker) {
+		w.outputDir = dir
+	}
+}
+
+// WithPollInterval sets how often the worker checks the store for new jobs
+// and cancellations (default: 1s).
+func WithPollInterval(d time.Duration) WorkerOption {
+	return func(w *Worker) {
+		w.poll = d
+	}
+}
+
+// WithRetryBackoff sets the delay before the first retry of a failed job.
+// The delay doubles with each further attempt (default: 10s).
+func WithRetryBackoff(d time.Duration) WorkerOption {
+	return func(w *Worker) {
+		w.backoff = d
+	}
+}
+
+// WithWait keeps the worker running and waiting for new jobs when the queue
+// is empty, instead of returning.
+func WithWait(wait bool) WorkerOption {
+	return func(w *Worker) {
+		w.wait = wait
+	}
+}
+
+// WithEventHandler calls fn with the job each time a job starts, succeeds,
+// fails, is retried or is canceled. fn is called from the worker goroutine.
+func WithEventHandler(fn func(Job)) WorkerOption {
+	return func(w *Worker) {
+		w.onEvent = fn
+	}
+}
+
+// Metrics receives a count of retried jobs. *metrics.Collector satisfies
+// this interface.
+type Metrics interface {
+	ObserveRetry(source string)
+}
+
+// WithMetrics records each retry of a failed job to m, with source "queue".
+func WithMetrics(m Metrics) WorkerOption {
+	return func(w *Worker) {
+		w.metrics = m
+	}
+}
+
+// NewWorker creates a worker that runs the jobs in store through gen.
+func NewWorker(store *Store, gen Generator, opts ...WorkerOption) *Worker {
+	w := &Worker{
+		store:     store,
+		generator: gen,
+		outputDir: ".",
+		poll:      time.Second,
+		backoff:   10 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Run requeues jobs left running by a previous worker, then runs pending
+// jobs until none are left (or, with WithWait, until ctx is done). If ctx
+// ends while a job is running, the job is returned to the queue without
+// counting the attempt, and Run returns ctx.Err().
+func (w *Worker) Run(ctx context.Context) error {
+	if _, err := w.store.Recover(); err != nil {
+		return err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		job, ok, err := w.store.claim(time.Now())
+		if err != nil {
+			return err
+		}
+		if ok {
+			if err := w.runJob(ctx, job); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Nothing runnable: stop, or sleep until the next retry or poll.
+		delay := w.poll
+		retryAt, pending := w.store.nextRetry()
+		if !pending && !w.wait {
+			return nil
+		}
+		if pending {
+			if d := time.Until(retryAt); d < delay || !w.wait {
+				delay = d
+			}
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// runJob runs one claimed job and records its outcome.
+func (w *Worker) runJob(ctx context.Context, job Job) error {
+	if job.Request.Seed <= 0 {
+		// Resolve random seeds once, so retries reproduce the same image.
+		job.Request.Seed = int(rand.Int31())
+		job.RandomSeed = true
+		var err error
+		if job, err = w.store.update(job); err != nil {
+			return err
+		}
+		if job.State == StateCanceled {
+			w.emit(job)
+			return nil
+		}
+	}
+	w.emit(job)
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go w.watchCancel(jobCtx, job.ID, cancel)
+
+	outputs, genErr := w.generate(jobCtx, job)
+
+	if ctx.Err() != nil {
+		// Interrupted by shutdown: requeue without using up an attempt.
+		job.State = StatePending
+		job.Attempts--
+		if _, err := w.store.update(job); err != nil {
+			return err
+		}
+		return ctx.Err()
+	}
+
+	if genErr == nil {
+		job.State = StateSucceeded
+		job.Outputs = outputs
+		job.Error, job.ErrorType = "", ""
+		job.RetryAt = nil
+	} else {
+		job.Error = genErr.Error()
+		job.ErrorType = drawthings.ErrorType(genErr)
+		if retryable(genErr) && job.Attempts < job.MaxAttempts {
+			job.State = StatePending
+			retryAt := time.Now().Add(w.backoff << (job.Attempts - 1))
+			job.RetryAt = &retryAt
+			if w.metrics != nil {
+				w.metrics.ObserveRetry("queue")
+			}
+		} else {
+			job.State = StateFailed
+		}
+	}
+	job, err := w.store.update(job)
+	if err != nil {
+		return err
+	}
+	w.emit(job)
+	return nil
+}
+
+// watchCancel cancels a running job when it is canceled in the store.
+func (w *Worker) watchCancel(ctx context.Context, id string, cancel context.CancelFunc) {
+	ticker := time.NewTicker(w.poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if w.store.Refresh() != nil {
+				continue
+			}
+			if job, err := w.store.Get(id); err == nil && job.State == StateCanceled {
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// generate renders a job and writes its images.
+func (w *Worker) generate(ctx context.Context, job Job) ([]string, error) {
+	req := job.Request
+	if drawthings.PriorityFromContext(ctx) == drawthings.PriorityNormal {
+		// Let interactive requests on a shared client go first.
+		ctx = drawthings.WithPriority(ctx, drawthings.PriorityBatch)
+	}
+	if job.RandomSeed {
+		// One-off renders are not worth keeping.
+		ctx = drawthings.WithoutCache(ctx)
+	}
+	resp, err := w.generator.GenerateImage(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	var outputs []string
+	for i, encoded := range resp.Images {
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, drawthings.NewDecodeError("failed to decode base64 image data", err)
+		}
+		path := w.outputPath(job, i)
+		if err := fsutil.WriteFile(path, data); err != nil {
+			return nil, drawthings.NewStorageError("failed to write image file", err)
+		}
+		outputs = append(outputs, path)
+	}
+	return outputs, nil
+}
+
+// outputPath returns the file path for the image-th image of a job.
+func (w *Worker) outputPath(job Job, image int) string {
+	name := job.Output
+	if name == "" {
+		name = job.ID + ".png"
+	}
+	if image > 0 {
+		ext := filepath.Ext(name)
+		name = fmt.Sprintf("%s_%d%s", strings.TrimSuffix(name, ext), image, ext)
+	}
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(w.outputDir, name)
+}
+
+func (w *Worker) emit(job Job) {
+	if w.onEvent != nil {
+		w.onEvent(job)
+	}
+}
+
+// retryable reports whether a failed job may succeed if tried again.
+func retryable(err error) bool {
+	switch drawthings.ErrorType(err) {
+	case drawthings.ErrorTypeNetwork, drawthings.ErrorTypeDecode:
+		return true
+	case drawthings.ErrorTypeAPI:
+		var apiErr *drawthings.APIError
+		return errors.As(err, &apiErr) &&
+			(apiErr.StatusCode >= 500 || apiErr.StatusCode == http.StatusTooManyRequests)
+	default:
+		return false
+	}
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
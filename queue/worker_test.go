@@ -0,0 +1,188 @@
+package queue
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drawthings_go"
+	"github.com/drawthings_go/cache"
+	"github.com/drawthings_go/drawthingstest"
+)
+
+func TestWorker_RunsJobsAndRetries(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+	server.QueueFailure(drawthingstest.StatusFailure(http.StatusServiceUnavailable))
+
+	dir := t.TempDir()
+	s := openStore(t, filepath.Join(dir, "queue.jsonl"))
+	s.Add(Job{ID: "retry", Request: drawthings.TextToImageRequest{Prompt: "a", Width: 64, Height: 64}})
+	s.Add(Job{ID: "invalid", Request: drawthings.TextToImageRequest{Prompt: "b", Steps: 500}})
+	s.Add(Job{ID: "named", Output: "sub/named.png", Request: drawthings.TextToImageRequest{Prompt: "c", Width: 64, Height: 64, Seed: 7}})
+
+	var mu sync.Mutex
+	var events []string
+	retries := &retryCounter{}
+	client := drawthings.NewClient(drawthings.WithBaseURL(server.URL))
+	w := NewWorker(s, client,
+		WithOutputDir(dir),
+		WithMetrics(retries),
+		WithRetryBackoff(10*time.Millisecond),
+		WithEventHandler(func(j Job) {
+			mu.Lock()
+			events = append(events, j.ID+":"+string(j.State))
+			mu.Unlock()
+		}),
+	)
+	if err := w.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	retried, _ := s.Get("retry")
+	if retried.State != StateSucceeded || retried.Attempts != 2 {
+		t.Errorf("retry job: %+v", retried)
+	}
+	if retries.counts["queue"] != 1 {
+		t.Errorf("expected 1 recorded retry, got %v", retries.counts)
+	}
+	if retried.Request.Seed <= 0 {
+		t.Errorf("random seed should be resolved and stored, got %d", retried.Request.Seed)
+	}
+	invalid, _ := s.Get("invalid")
+	if invalid.State != StateFailed || invalid.Attempts != 1 || invalid.ErrorType != drawthings.ErrorTypeValidation {
+		t.Errorf("validation errors should not be retried: %+v", invalid)
+	}
+	named, _ := s.Get("named")
+	if named.State != StateSucceeded || len(named.Outputs) != 1 || named.Outputs[0] != filepath.Join(dir, "sub", "named.png") {
+		t.Errorf("named job: %+v", named)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "retry.png")); err != nil {
+		t.Errorf("expected default output file: %v", err)
+	}
+
+	// Both attempts of the retried job used the same seed.
+	requests := server.RequestsTo(drawthingstest.PathTxt2Img)
+	var seeds []int
+	for _, r := range requests {
+		var req drawthings.TextToImageRequest
+		r.Decode(&req)
+		if req.Prompt == "a" {
+			seeds = append(seeds, req.Seed)
+		}
+	}
+	if len(seeds) != 2 || seeds[0] != seeds[1] {
+		t.Errorf("retry seeds: %v", seeds)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) == 0 || events[0] != "retry:running" {
+		t.Errorf("unexpected events: %v", events)
+	}
+}
+
+func TestWorker_RandomSeedBypassesCache(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+	rc, err := cache.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	s := openStore(t, filepath.Join(dir, "queue.jsonl"))
+	s.Add(Job{ID: "random", Request: drawthings.TextToImageRequest{Prompt: "a", Width: 64, Height: 64}})
+	s.Add(Job{ID: "fixed", Request: drawthings.TextToImageRequest{Prompt: "b", Width: 64, Height: 64, Seed: 7}})
+
+	client := drawthings.NewClient(drawthings.WithBaseURL(server.URL), drawthings.WithCache(rc))
+	if err := NewWorker(s, client, WithOutputDir(dir)).Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if job, _ := s.Get("random"); job.State != StateSucceeded || !job.RandomSeed {
+		t.Errorf("random job: %+v", job)
+	}
+	if job, _ := s.Get("fixed"); job.State != StateSucceeded || job.RandomSeed {
+		t.Errorf("fixed job: %+v", job)
+	}
+	stats, err := rc.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != 1 {
+		t.Errorf("%d cache entries, want 1 for the fixed seed only", stats.Entries)
+	}
+}
+
+type retryCounter struct {
+	counts map[string]int
+}
+
+func (c *retryCounter) ObserveRetry(source string) {
+	if c.counts == nil {
+		c.counts = make(map[string]int)
+	}
+	c.counts[source]++
+}
+
+func TestWorker_CancelAndShutdown(t *testing.T) {
+	server := drawthingstest.NewServer(drawthingstest.WithLatency(5 * time.Second))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "queue.jsonl")
+	s := openStore(t, path)
+	s.Add(Job{ID: "cancel-me", Request: drawthings.TextToImageRequest{Prompt: "a"}})
+	s.Add(Job{ID: "interrupted", Request: drawthings.TextToImageRequest{Prompt: "b"}})
+
+	// Another process cancels the running job.
+	cli := openStore(t, path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	running := make(chan string, 4)
+	client := drawthings.NewClient(drawthings.WithBaseURL(server.URL))
+	w := NewWorker(s, client,
+		WithOutputDir(t.TempDir()),
+		WithPollInterval(10*time.Millisecond),
+		WithEventHandler(func(j Job) {
+			if j.State == StateRunning {
+				running <- j.ID
+			}
+		}),
+	)
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+
+	if id := <-running; id != "cancel-me" {
+		t.Fatalf("first job: got %s", id)
+	}
+	if _, err := cli.Cancel("cancel-me"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case id := <-running:
+		if id != "interrupted" {
+			t.Fatalf("second job: got %s", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("cancel did not interrupt the running job")
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run() error = %v, want context.Canceled", err)
+	}
+
+	reopened := openStore(t, path)
+	if j, _ := reopened.Get("cancel-me"); j.State != StateCanceled {
+		t.Errorf("cancel-me: %+v", j)
+	}
+	if j, _ := reopened.Get("interrupted"); j.State != StatePending || j.Attempts != 0 {
+		t.Errorf("interrupted job should be requeued without using an attempt: %+v", j)
+	}
+}
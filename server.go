@@ -0,0 +1,133 @@
+package drawthings
+
+import (
+	"context"
+	"net/http"
+
+	httpclient "github.com/drawthings_go/internal/http"
+)
+
+// Endpoints of the server management calls.
+const (
+	interruptPath = "/sdapi/v1/interrupt"
+	modelsPath    = "/sdapi/v1/sd-models"
+)
+
+// Progress describes the generation a server is running.
+type Progress struct {
+	// Progress is the fraction of the current job that is done, from 0 to 1.
+	Progress float64 `json:"progress"`
+	// ETARelative is the estimated number of seconds left.
+	ETARelative float64       `json:"eta_relative"`
+	State       ProgressState `json:"state"`
+	// CurrentImage is the base64-encoded preview of the image, if the
+	// server sends one.
+	CurrentImage string `json:"current_image,omitempty"`
+}
+
+// ProgressState holds the job counters of a progress report.
+type ProgressState struct {
+	JobCount      int  `json:"job_count"`
+	SamplingStep  int  `json:"sampling_step"`
+	SamplingSteps int  `json:"sampling_steps"`
+	Interrupted   bool `json:"interrupted,omitempty"`
+}
+
+// Busy reports whether the server is running a job.
+func (p *Progress) Busy() bool {
+	return p.State.JobCount > 0
+}
+
+// Model is a model the server can load.
+type Model struct {
+	Title     string `json:"title"`
+	ModelName string `json:"model_name"`
+	Hash      string `json:"hash,omitempty"`
+	Filename  string `json:"filename,omitempty"`
+}
+
+// Progress returns the progress of the generation the server is running.
+func (c *Client) Progress(ctx context.Context) (*Progress, error) {
+	var p Progress
+	if err := c.call(ctx, SpanProgress, http.MethodGet, progressPath, nil, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Interrupt asks the server to stop the generation it is running. The
+// interrupted request fails with an error or returns a partial image,
+// depending on the server.
+func (c *Client) Interrupt(ctx context.Context) error {
+	var ignored interface{}
+	return c.call(ctx, SpanInterrupt, http.MethodPost, interruptPath, struct{}{}, &ignored)
+}
+
+// Models returns the models the server can load.
+func (c *Client) Models(ctx context.Context) ([]Model, error) {
+	var models []Model
+	if err := c.call(ctx, SpanModels, http.MethodGet, modelsPath, nil, &models); err != nil {
+		return nil, err
+	}
+	return models, nil
+}
+
+// Options returns the server's settings, such as the loaded model in
+// "sd_model_checkpoint" (A1111) or "model" (Draw Things).
+func (c *Client) Options(ctx context.Context) (map[string]interface{}, error) {
+	var options map[string]interface{}
+	if err := c.call(ctx, SpanOptions, http.MethodGet, optionsPath, nil, &options); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// SetOptions changes the given server settings and leaves the others as
+// they are.
+func (c *Client) SetOptions(ctx context.Context, options map[string]interface{}) error {
+	var ignored interface{}
+	return c.call(ctx, SpanSetOptions, http.MethodPost, optionsPath, options, &ignored)
+}
+
+// call sends a request to the endpoint at path within a span named name and
+// decodes the JSON response into v. A nil body sends a GET request.
+func (c *Client) call(ctx context.Context, name, method, path string, body, v interface{}) error {
+	ctx, span := c.tracer.Start(ctx, name, Attr(AttrEndpoint, path))
+	ctx = withTraceParent(ctx, span)
+
+	var (
+		resp *http.Response
+		err  error
+	)
+	if method == http.MethodGet {
+		resp, err = c.httpClient.Get(ctx, c.baseURL+path)
+	} else {
+		resp, err = c.httpClient.PostJSON(ctx, c.baseURL+path, body)
+	}
+	if err != nil {
+		err = NewNetworkError("API request failed", err)
+	} else {
+		span.SetAttributes(Attr(AttrStatusCode, resp.StatusCode))
+		if decodeErr := c.httpClient.DecodeJSONResponse(resp, v); decodeErr != nil {
+			err = responseError(decodeErr)
+		}
+	}
+
+	if err != nil {
+		span.SetAttributes(Attr(AttrErrorType, ErrorType(err)))
+	}
+	span.End(err)
+	return err
+}
+
+// responseError converts an error from DecodeJSONResponse into an *APIError
+// for error statuses, or a *DecodeError for undecodable bodies.
+func responseError(err error) error {
+	if httpErr, ok := err.(*httpclient.HTTPError); ok {
+		return NewAPIError(&http.Response{
+			StatusCode: httpErr.StatusCode,
+			Status:     httpErr.Status,
+		}, httpErr.Body)
+	}
+	return NewDecodeError("failed to decode response", err)
+}
@@ -0,0 +1,99 @@
+package drawthings
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/drawthings_go/drawthingstest"
+)
+
+func TestClient_ProgressAndInterrupt(t *testing.T) {
+	server := drawthingstest.NewServer(drawthingstest.WithLatency(5 * time.Second))
+	defer server.Close()
+	client := NewClient(WithBaseURL(server.URL))
+	ctx := context.Background()
+
+	p, err := client.Progress(ctx)
+	if err != nil {
+		t.Fatalf("Progress() error = %v", err)
+	}
+	if p.Busy() {
+		t.Errorf("idle server reported busy: %+v", p)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.GenerateImage(ctx, &TextToImageRequest{Prompt: "a slow render", Seed: 1})
+		done <- err
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if p, err = client.Progress(ctx); err == nil && p.Busy() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server never reported a job: %+v, %v", p, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if p.State.SamplingSteps != 20 {
+		t.Errorf("progress = %+v, want 20 sampling steps", p)
+	}
+
+	if err := client.Interrupt(ctx); err != nil {
+		t.Fatalf("Interrupt() error = %v", err)
+	}
+	select {
+	case err := <-done:
+		if !IsAPIError(err) {
+			t.Errorf("interrupted GenerateImage() error = %v, want an API error", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("GenerateImage() was not interrupted")
+	}
+}
+
+func TestClient_ModelsAndOptions(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+	recorder := NewSpanRecorder()
+	client := NewClient(WithBaseURL(server.URL), WithTracer(recorder))
+	ctx := context.Background()
+
+	if err := client.SetOptions(ctx, map[string]interface{}{"sd_model_checkpoint": "sdxl.ckpt"}); err != nil {
+		t.Fatalf("SetOptions() error = %v", err)
+	}
+	options, err := client.Options(ctx)
+	if err != nil {
+		t.Fatalf("Options() error = %v", err)
+	}
+	if options["sd_model_checkpoint"] != "sdxl.ckpt" {
+		t.Errorf("Options() = %v", options)
+	}
+
+	models, err := client.Models(ctx)
+	if err != nil {
+		t.Fatalf("Models() error = %v", err)
+	}
+	if len(models) != 2 || models[1].Title != "sdxl.ckpt" || models[1].ModelName != "sdxl" {
+		t.Errorf("Models() = %+v", models)
+	}
+
+	var names []string
+	for _, span := range recorder.Spans() {
+		names = append(names, span.Name)
+	}
+	want := []string{SpanSetOptions, SpanOptions, SpanModels}
+	if len(names) != len(want) || names[0] != want[0] || names[1] != want[1] || names[2] != want[2] {
+		t.Errorf("spans = %v, want %v", names, want)
+	}
+
+	_, err = NewClient(WithBaseURL(server.URL + "/missing")).Models(ctx)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Models() from a missing endpoint error = %v, want a 404 APIError", err)
+	}
+}
@@ -0,0 +1,171 @@
+package styles
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Load reads styles from files and directories. JSON files (.json) hold a
+// style or a list of styles; CSV files (.csv) use the styles.csv format of
+// AUTOMATIC1111. Directories are searched for both, without descending into
+// subdirectories. A style replaces one of the same name read earlier.
+func Load(paths ...string) (*Library, error) {
+	l := NewLibrary()
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read styles: %w", err)
+		}
+		files := []string{path}
+		if info.IsDir() {
+			if files, err = styleFiles(path); err != nil {
+				return nil, err
+			}
+		}
+		for _, file := range files {
+			styles, err := ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range styles {
+				l.Add(s)
+			}
+		}
+	}
+	return l, nil
+}
+
+// styleFiles returns the style files in dir, sorted by name.
+func styleFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read styles: %w", err)
+	}
+	var files []string
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if !e.IsDir() && (ext == ".json" || ext == ".csv") {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// ReadFile reads the styles of a JSON or CSV file, chosen by the file
+// extension. A JSON style without a name is named after the file.
+func ReadFile(path string) ([]Style, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read styles: %w", err)
+	}
+	defer f.Close()
+
+	var styles []Style
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		styles, err = ReadCSV(f)
+	} else {
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		styles, err = ReadJSON(f, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return styles, nil
+}
+
+// ReadJSON reads a JSON style or list of styles. A single style without a
+// name is given defaultName.
+func ReadJSON(r io.Reader, defaultName string) ([]Style, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read styles: %w", err)
+	}
+	data = bytes.TrimSpace(data)
+
+	var styles []Style
+	if bytes.HasPrefix(data, []byte("[")) {
+		err = unmarshal(data, &styles)
+	} else {
+		var s Style
+		err = unmarshal(data, &s)
+		if s.Name == "" {
+			s.Name = defaultName
+		}
+		styles = []Style{s}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse styles: %w", err)
+	}
+	for i := range styles {
+		if err := styles[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+	return styles, nil
+}
+
+// unmarshal decodes data into v, rejecting unknown fields.
+func unmarshal(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// ReadCSV reads styles in the styles.csv format of AUTOMATIC1111: a header
+// row naming the columns name, prompt and negative_prompt, then one style
+// per row. Other columns, such as the description column some forks add,
+// are ignored, as are rows without a name.
+func ReadCSV(r io.Reader) ([]Style, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, fmt.Errorf("CSV header has no name column")
+	}
+	cell := func(record []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	var styles []Style
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		s := Style{
+			Name:           strings.TrimSpace(cell(record, "name")),
+			Prompt:         cell(record, "prompt"),
+			NegativePrompt: cell(record, "negative_prompt"),
+		}
+		if s.Name == "" {
+			continue
+		}
+		styles = append(styles, s)
+	}
+	return styles, nil
+}
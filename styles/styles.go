@@ -0,0 +1,192 @@
+// Package styles merges named style presets into text-to-image requests.
+//
+// A style adds text to the prompt and negative prompt and may supply
+// defaults for parameters such as steps and guidance scale. Styles are read
+// from JSON files or from the styles.csv files of AUTOMATIC1111's web UI,
+// and several styles can be applied in order:
+//
+//	lib, err := styles.Load("styles.json")
+//	chosen, err := lib.Lookup("cinematic", "film-grain")
+//	styles.Apply(req, chosen...)
+package styles
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/drawthings_go"
+)
+
+// Placeholder marks where a style inserts the request's prompt.
+const Placeholder = "{prompt}"
+
+// Mode says how a style's text is combined with the request's text.
+type Mode string
+
+const (
+	// Append adds the style's text after the prompt, separated by ", ".
+	Append Mode = "append"
+	// Prepend adds the style's text before the prompt, separated by ", ".
+	Prepend Mode = "prepend"
+	// Replace replaces the prompt with the style's text, in which
+	// Placeholder stands for the original prompt.
+	Replace Mode = "replace"
+)
+
+// Style is a named preset.
+type Style struct {
+	Name string `json:"name"`
+
+	// Prompt and NegativePrompt are combined with the request's prompts
+	// as Mode and NegativeMode say. Empty texts leave the prompts alone.
+	Prompt         string `json:"prompt,omitempty"`
+	NegativePrompt string `json:"negative_prompt,omitempty"`
+
+	// Mode and NegativeMode default to Replace if the text contains
+	// Placeholder and to Append otherwise, as in AUTOMATIC1111.
+	Mode         Mode `json:"mode,omitempty"`
+	NegativeMode Mode `json:"negative_mode,omitempty"`
+
+	// Parameters used where the request leaves them unset.
+	Steps         int     `json:"steps,omitempty"`
+	GuidanceScale float64 `json:"guidance_scale,omitempty"`
+	Width         int     `json:"width,omitempty"`
+	Height        int     `json:"height,omitempty"`
+}
+
+// validate checks the style's name and modes.
+func (s *Style) validate() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return fmt.Errorf("style without a name")
+	}
+	for _, m := range []Mode{s.Mode, s.NegativeMode} {
+		switch m {
+		case "", Append, Prepend, Replace:
+		default:
+			return fmt.Errorf("style %q: unknown mode %q (want append, prepend or replace)", s.Name, m)
+		}
+	}
+	return nil
+}
+
+// Apply merges styles into req in order, so each style's text is combined
+// with the prompts produced by the styles before it. Parameters are taken
+// from the last style that sets them, but only where req leaves them unset
+// (zero); SetDefaults fills the rest.
+func Apply(req *drawthings.TextToImageRequest, styles ...Style) {
+	orig := *req
+	for _, s := range styles {
+		req.Prompt = merge(req.Prompt, s.Prompt, s.Mode)
+		req.NegativePrompt = merge(req.NegativePrompt, s.NegativePrompt, s.NegativeMode)
+		if orig.Steps == 0 && s.Steps != 0 {
+			req.Steps = s.Steps
+		}
+		if orig.GuidanceScale == 0 && s.GuidanceScale != 0 {
+			req.GuidanceScale = s.GuidanceScale
+		}
+		if orig.Width == 0 && s.Width != 0 {
+			req.Width = s.Width
+		}
+		if orig.Height == 0 && s.Height != 0 {
+			req.Height = s.Height
+		}
+	}
+}
+
+// merge combines text with a style's text.
+func merge(text, style string, mode Mode) string {
+	if style == "" {
+		return text
+	}
+	if mode == "" {
+		mode = Append
+		if strings.Contains(style, Placeholder) {
+			mode = Replace
+		}
+	}
+	switch mode {
+	case Replace:
+		return strings.ReplaceAll(style, Placeholder, text)
+	case Prepend:
+		return join(style, text)
+	default:
+		return join(text, style)
+	}
+}
+
+// join joins the non-empty parts with ", ".
+func join(a, b string) string {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	}
+	return a + ", " + b
+}
+
+// Library is a set of styles looked up by name. Names are compared without
+// regard to case.
+type Library struct {
+	styles map[string]Style
+}
+
+// NewLibrary creates a library holding styles.
+func NewLibrary(styles ...Style) *Library {
+	l := &Library{styles: make(map[string]Style)}
+	for _, s := range styles {
+		l.Add(s)
+	}
+	return l
+}
+
+// Add adds s to the library, replacing a style of the same name.
+func (l *Library) Add(s Style) {
+	l.styles[strings.ToLower(s.Name)] = s
+}
+
+// Get returns the style called name.
+func (l *Library) Get(name string) (Style, bool) {
+	s, ok := l.styles[strings.ToLower(strings.TrimSpace(name))]
+	return s, ok
+}
+
+// Lookup returns the named styles in the order given. It fails if any of
+// them is not in the library.
+func (l *Library) Lookup(names ...string) ([]Style, error) {
+	styles := make([]Style, 0, len(names))
+	for _, name := range names {
+		s, ok := l.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown style %q", name)
+		}
+		styles = append(styles, s)
+	}
+	return styles, nil
+}
+
+// Styles returns the styles of the library sorted by name.
+func (l *Library) Styles() []Style {
+	styles := make([]Style, 0, len(l.styles))
+	for _, s := range l.styles {
+		styles = append(styles, s)
+	}
+	sort.Slice(styles, func(i, j int) bool {
+		return strings.ToLower(styles[i].Name) < strings.ToLower(styles[j].Name)
+	})
+	return styles
+}
+
+// ParseNames splits a comma-separated list of style names, such as
+// "cinematic,film-grain".
+func ParseNames(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,127 @@
+package styles
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/drawthings_go"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		prompt string
+		styles []Style
+		want   string
+	}{
+		{"append", "a fox", []Style{{Prompt: "cinematic lighting"}}, "a fox, cinematic lighting"},
+		{"prepend", "a fox", []Style{{Prompt: "photo of", Mode: Prepend}}, "photo of, a fox"},
+		{"placeholder", "a fox", []Style{{Prompt: "film still of {prompt}, grain"}}, "film still of a fox, grain"},
+		{"replace without placeholder", "a fox", []Style{{Prompt: "a cat", Mode: Replace}}, "a cat"},
+		{"append to empty prompt", "", []Style{{Prompt: "grain"}}, "grain"},
+		{"in order", "a fox", []Style{{Prompt: "still of {prompt}"}, {Prompt: "grain"}, {Prompt: "[{prompt}]"}}, "[still of a fox, grain]"},
+		{"empty style", "a fox", []Style{{Steps: 30}}, "a fox"},
+	}
+	for _, tt := range tests {
+		req := drawthings.TextToImageRequest{Prompt: tt.prompt}
+		Apply(&req, tt.styles...)
+		if req.Prompt != tt.want {
+			t.Errorf("%s: prompt = %q, want %q", tt.name, req.Prompt, tt.want)
+		}
+	}
+
+	req := drawthings.TextToImageRequest{Prompt: "a fox", NegativePrompt: "blurry", Steps: 25}
+	Apply(&req,
+		Style{NegativePrompt: "lowres", Steps: 40, GuidanceScale: 6, Width: 768},
+		Style{NegativePrompt: "text", NegativeMode: Prepend, GuidanceScale: 7},
+	)
+	want := drawthings.TextToImageRequest{Prompt: "a fox", NegativePrompt: "text, blurry, lowres", Steps: 25, GuidanceScale: 7, Width: 768}
+	if req != want {
+		t.Errorf("Apply() = %+v, want %+v", req, want)
+	}
+}
+
+func TestLibrary(t *testing.T) {
+	lib := NewLibrary(Style{Name: "Cinematic", Prompt: "a"}, Style{Name: "grain", Prompt: "b"})
+	lib.Add(Style{Name: "GRAIN", Prompt: "c"})
+	styles, err := lib.Lookup("cinematic", " grain ")
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	if len(styles) != 2 || styles[0].Prompt != "a" || styles[1].Prompt != "c" {
+		t.Errorf("Lookup() = %+v", styles)
+	}
+	if _, err := lib.Lookup("cinematic", "noir"); err == nil || !strings.Contains(err.Error(), `"noir"`) {
+		t.Errorf("Lookup() of an unknown style error = %v", err)
+	}
+	if names := ParseNames(" cinematic, ,film-grain"); !reflect.DeepEqual(names, []string{"cinematic", "film-grain"}) {
+		t.Errorf("ParseNames() = %q", names)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"house.json": `[
+			{"name": "cinematic", "prompt": "cinematic still of {prompt}", "negative_prompt": "cartoon", "steps": 30},
+			{"name": "film-grain", "prompt": "film grain", "guidance_scale": 5.5}
+		]`,
+		"noir.json": `{"prompt": "black and white", "mode": "prepend"}`,
+		"styles.csv": "\ufeffname,prompt,negative_prompt,description\n" +
+			"Watercolor,\"watercolor painting of {prompt}, soft edges\",photo,imported\n" +
+			",ignored,,\n" +
+			"cinematic,\"a1111 {prompt}\",,\n",
+		"notes.txt": "not a style file",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lib, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	var names []string
+	for _, s := range lib.Styles() {
+		names = append(names, s.Name)
+	}
+	if want := []string{"cinematic", "film-grain", "noir", "Watercolor"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("styles = %q, want %q", names, want)
+	}
+	// styles.csv is read after house.json.
+	if s, _ := lib.Get("cinematic"); s.Prompt != "a1111 {prompt}" {
+		t.Errorf("cinematic = %+v", s)
+	}
+
+	styles, err := lib.Lookup("watercolor", "film-grain", "noir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := drawthings.TextToImageRequest{Prompt: "a harbor"}
+	Apply(&req, styles...)
+	if req.Prompt != "black and white, watercolor painting of a harbor, soft edges, film grain" || req.NegativePrompt != "photo" || req.GuidanceScale != 5.5 {
+		t.Errorf("Apply() = %+v", req)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	for _, data := range []string{
+		`{"name": "x", "mode": "after"}`,
+		`[{"prompt": "no name"}]`,
+		`{"name": "x", "colour": "red"}`,
+	} {
+		if err := os.WriteFile(bad, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(bad); err == nil {
+			t.Errorf("Load(%s) succeeded", data)
+		}
+	}
+	if _, err := Load(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,213 @@
+package sweep
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/drawthings_go"
+)
+
+// Axis is a request field and the values it takes across a sweep.
+type Axis struct {
+	// Field is the request field name as given by the user.
+	Field string
+	// Values are the string forms of the values, in order.
+	Values []string
+
+	index   []int
+	replace bool
+}
+
+// ParseAxis parses an axis specification of the form "field=values".
+//
+// Field is the JSON name, flag name or Go name of a TextToImageRequest field
+// (for example guidance_scale, guidance-scale or GuidanceScale). Values are
+// either a comma-separated list ("10,20,30") or a numeric range
+// "start..end" or "start..end:step" (step defaults to 1).
+//
+// The special field "prompt-sr" performs a search and replace on the prompt:
+// the first value is searched for and replaced by each value in turn.
+func ParseAxis(spec string) (Axis, error) {
+	name, values, ok := strings.Cut(spec, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.TrimSpace(values) == "" {
+		return Axis{}, fmt.Errorf("invalid axis %q: expected field=values", spec)
+	}
+
+	axis := Axis{Field: name}
+	if normalize(name) == "promptsr" {
+		axis.replace = true
+		axis.index = promptIndex
+		axis.Values = splitList(values)
+		return axis, nil
+	}
+
+	field, ok := requestField(name)
+	if !ok {
+		return Axis{}, fmt.Errorf("invalid axis %q: unknown request field %q", spec, name)
+	}
+	axis.index = field.Index
+
+	if start, end, ok := strings.Cut(values, ".."); ok && field.Type.Kind() != reflect.String {
+		list, err := expandRange(start, end, field.Type.Kind())
+		if err != nil {
+			return Axis{}, fmt.Errorf("invalid axis %q: %w", spec, err)
+		}
+		axis.Values = list
+	} else {
+		axis.Values = splitList(values)
+	}
+
+	// Check every value up front so a typo fails before any image is generated.
+	var req drawthings.TextToImageRequest
+	for _, v := range axis.Values {
+		if err := axis.apply(&req, v); err != nil {
+			return Axis{}, fmt.Errorf("invalid axis %q: %w", spec, err)
+		}
+	}
+	return axis, nil
+}
+
+// Len returns the number of values on the axis, treating an empty axis as a
+// single implicit value.
+func (a Axis) Len() int {
+	if len(a.Values) == 0 {
+		return 1
+	}
+	return len(a.Values)
+}
+
+// Label returns the grid label for the i-th value.
+func (a Axis) Label(i int) string {
+	if len(a.Values) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s: %s", a.Field, a.Values[i])
+}
+
+// apply sets the axis field of req to value.
+func (a Axis) apply(req *drawthings.TextToImageRequest, value string) error {
+	if a.index == nil {
+		return nil
+	}
+	if a.replace {
+		if len(a.Values) > 0 {
+			req.Prompt = strings.ReplaceAll(req.Prompt, a.Values[0], value)
+		}
+		return nil
+	}
+
+	f := reflect.ValueOf(req).Elem().FieldByIndex(a.index)
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		f.SetInt(n)
+	case reflect.Float64, reflect.Float32:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		f.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		f.SetBool(b)
+	default:
+		return fmt.Errorf("field type %s cannot be swept", f.Type())
+	}
+	return nil
+}
+
+// promptIndex is the field index of TextToImageRequest.Prompt.
+var promptIndex = func() []int {
+	f, _ := reflect.TypeOf(drawthings.TextToImageRequest{}).FieldByName("Prompt")
+	return f.Index
+}()
+
+// requestField finds a TextToImageRequest field by JSON, flag or Go name.
+func requestField(name string) (reflect.StructField, bool) {
+	want := normalize(name)
+	t := reflect.TypeOf(drawthings.TextToImageRequest{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if normalize(f.Name) == want || (tag != "" && normalize(tag) == want) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// normalize lower-cases a field name and strips separators.
+func normalize(name string) string {
+	name = strings.ToLower(name)
+	name = strings.ReplaceAll(name, "_", "")
+	return strings.ReplaceAll(name, "-", "")
+}
+
+func splitList(s string) []string {
+	parts := strings.Split(s, ",")
+	values := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			values = append(values, p)
+		}
+	}
+	return values
+}
+
+// maxRangeValues bounds the size of an expanded range.
+const maxRangeValues = 1000
+
+// expandRange expands "start..end[:step]" into a list of values.
+func expandRange(startStr, rest string, kind reflect.Kind) ([]string, error) {
+	endStr, stepStr, hasStep := strings.Cut(rest, ":")
+	start, err := strconv.ParseFloat(strings.TrimSpace(startStr), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid range start %q", startStr)
+	}
+	end, err := strconv.ParseFloat(strings.TrimSpace(endStr), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid range end %q", endStr)
+	}
+	step := 1.0
+	if hasStep {
+		if step, err = strconv.ParseFloat(strings.TrimSpace(stepStr), 64); err != nil || step <= 0 {
+			return nil, fmt.Errorf("invalid range step %q", stepStr)
+		}
+	}
+	if end < start {
+		step = -step
+	}
+
+	isInt := kind >= reflect.Int && kind <= reflect.Int64
+	var values []string
+	for i := 0; ; i++ {
+		v := start + float64(i)*step
+		if (step > 0 && v > end+1e-9) || (step < 0 && v < end-1e-9) {
+			break
+		}
+		if len(values) == maxRangeValues {
+			return nil, fmt.Errorf("range has more than %d values", maxRangeValues)
+		}
+		if isInt {
+			values = append(values, strconv.FormatInt(int64(math.Round(v)), 10))
+		} else {
+			values = append(values, strconv.FormatFloat(math.Round(v*1e6)/1e6, 'f', -1, 64))
+		}
+	}
+	return values, nil
+}
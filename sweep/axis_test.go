@@ -0,0 +1,78 @@
+package sweep
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/drawthings_go"
+)
+
+func TestParseAxis(t *testing.T) {
+	tests := []struct {
+		spec   string
+		values []string
+	}{
+		{"steps=10,20,30", []string{"10", "20", "30"}},
+		{"guidance-scale=3, 5 ,7", []string{"3", "5", "7"}},
+		{"guidance_scale=3..5:0.5", []string{"3", "3.5", "4", "4.5", "5"}},
+		{"GuidanceScale=1..2:0.25", []string{"1", "1.25", "1.5", "1.75", "2"}},
+		{"width=512..768:128", []string{"512", "640", "768"}},
+		{"seed=3..1", []string{"3", "2", "1"}},
+		{"prompt=a cat,a dog", []string{"a cat", "a dog"}},
+		{"negative-prompt=blurry..ugly", []string{"blurry..ugly"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			axis, err := ParseAxis(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseAxis() error = %v", err)
+			}
+			if !reflect.DeepEqual(axis.Values, tt.values) {
+				t.Errorf("values: got %q, want %q", axis.Values, tt.values)
+			}
+		})
+	}
+}
+
+func TestParseAxis_Errors(t *testing.T) {
+	tests := []string{
+		"steps",
+		"=1,2",
+		"steps=",
+		"sampler=euler",
+		"steps=ten,twenty",
+		"steps=1..10:0",
+		"steps=1..x",
+		"steps=0..100000",
+	}
+
+	for _, spec := range tests {
+		if _, err := ParseAxis(spec); err == nil {
+			t.Errorf("ParseAxis(%q): expected error", spec)
+		}
+	}
+}
+
+func TestAxisApply(t *testing.T) {
+	req := drawthings.TextToImageRequest{Prompt: "a red fox in the snow"}
+
+	for spec, check := range map[string]func(drawthings.TextToImageRequest) bool{
+		"steps=42":               func(r drawthings.TextToImageRequest) bool { return r.Steps == 42 },
+		"guidance-scale=6.5":     func(r drawthings.TextToImageRequest) bool { return r.GuidanceScale == 6.5 },
+		"negative_prompt=blurry": func(r drawthings.TextToImageRequest) bool { return r.NegativePrompt == "blurry" },
+		"prompt-sr=red,blue":     func(r drawthings.TextToImageRequest) bool { return r.Prompt == "a blue fox in the snow" },
+	} {
+		axis, err := ParseAxis(spec)
+		if err != nil {
+			t.Fatalf("ParseAxis(%q) error = %v", spec, err)
+		}
+		r := req
+		if err := axis.apply(&r, axis.Values[len(axis.Values)-1]); err != nil {
+			t.Fatalf("apply(%q) error = %v", spec, err)
+		}
+		if !check(r) {
+			t.Errorf("apply(%q) produced %+v", spec, r)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Package sweep generates X/Y/Z parameter sweeps over text-to-image requests
+// and composes the results into labeled grid images.
+//
+// Every cell of a sweep shares the same seed, so differences between cells
+// come only from the swept parameters.
+package sweep
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg" // register JPEG decoding for server responses
+	_ "image/png"  // register PNG decoding for server responses
+	"math/rand"
+
+	"github.com/drawthings_go"
+)
+
+// Generator generates images from text prompts. *drawthings.Client satisfies it.
+type Generator interface {
+	GenerateImage(ctx context.Context, req *drawthings.TextToImageRequest) (*drawthings.TextToImageResponse, error)
+}
+
+// Sweep describes a parameter sweep. Axes with no values are ignored.
+type Sweep struct {
+	Base    drawthings.TextToImageRequest
+	X, Y, Z Axis
+
+	// randomSeed is set when Cells picked the seed of Base.
+	randomSeed bool
+}
+
+// Cell is a single point of a sweep.
+type Cell struct {
+	// X, Y and Z are the value indexes on each axis.
+	X, Y, Z int
+	// Request is the request sent for this cell.
+	Request drawthings.TextToImageRequest
+	// Data is the encoded image returned by the server.
+	Data []byte
+	// Image is the decoded image, or nil if generation failed.
+	Image image.Image
+	// Err is the generation error, if any.
+	Err error
+}
+
+// Cells returns the requests of the sweep, ordered by Z, then Y, then X.
+//
+// If Base.Seed is unset or -1, Cells picks a random seed and stores it in
+// Base.Seed, so every cell and every later call share the same seed.
+func (s *Sweep) Cells() ([]Cell, error) {
+	if s.Base.Seed <= 0 {
+		s.Base.Seed = int(rand.Int31())
+		s.randomSeed = true
+	}
+
+	var cells []Cell
+	for z := 0; z < s.Z.Len(); z++ {
+		for y := 0; y < s.Y.Len(); y++ {
+			for x := 0; x < s.X.Len(); x++ {
+				req := s.Base
+				for _, av := range []struct {
+					axis Axis
+					i    int
+				}{{s.Z, z}, {s.Y, y}, {s.X, x}} {
+					if len(av.axis.Values) == 0 {
+						continue
+					}
+					if err := av.axis.apply(&req, av.axis.Values[av.i]); err != nil {
+						return nil, fmt.Errorf("axis %s: %w", av.axis.Field, err)
+					}
+				}
+				cells = append(cells, Cell{X: x, Y: y, Z: z, Request: req})
+			}
+		}
+	}
+	return cells, nil
+}
+
+// Run generates every cell of the sweep in order, calling onCell (if not
+// nil) after each one. A failed cell is recorded in its Err field and does
+// not stop the sweep; Run returns an error only if the sweep is invalid or
+// ctx is cancelled. Cells rendered with a seed picked by Cells bypass the
+// client's result cache.
+func (s *Sweep) Run(ctx context.Context, gen Generator, onCell func(Cell)) ([]Cell, error) {
+	cells, err := s.Cells()
+	if err != nil {
+		return nil, err
+	}
+	if s.randomSeed {
+		ctx = drawthings.WithoutCache(ctx)
+	}
+
+	for i := range cells {
+		if err := ctx.Err(); err != nil {
+			return cells, err
+		}
+
+		cell := &cells[i]
+		req := cell.Request
+		resp, err := gen.GenerateImage(ctx, &req)
+		if err == nil {
+			cell.Data, cell.Image, err = decodeFirst(resp)
+		}
+		cell.Err = err
+
+		if onCell != nil {
+			onCell(*cell)
+		}
+	}
+	return cells, ctx.Err()
+}
+
+// decodeFirst decodes the first image of a response.
+func decodeFirst(resp *drawthings.TextToImageResponse) ([]byte, image.Image, error) {
+	if len(resp.Images) == 0 {
+		return nil, nil, drawthings.NewDecodeError("no images in response", nil)
+	}
+	data, err := base64.StdEncoding.DecodeString(resp.Images[0])
+	if err != nil {
+		return nil, nil, drawthings.NewDecodeError("failed to decode base64 image data", err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, drawthings.NewDecodeError("failed to decode image", err)
+	}
+	return data, img, nil
+}
+
+var (
+	backgroundColor = color.RGBA{255, 255, 255, 255}
+	textColor       = color.RGBA{0, 0, 0, 255}
+	failedColor     = color.RGBA{200, 200, 200, 255}
+)
+
+// Grid composes cells into a single image: X values run across the columns,
+// Y values down the rows, and each Z value gets its own sub-grid, placed side
+// by side. Failed cells are drawn as gray placeholders.
+func (s *Sweep) Grid(cells []Cell) *image.RGBA {
+	cellW, cellH := 0, 0
+	for _, c := range cells {
+		w, h := c.Request.Width, c.Request.Height
+		if c.Image != nil {
+			w, h = c.Image.Bounds().Dx(), c.Image.Bounds().Dy()
+		}
+		if w > cellW {
+			cellW = w
+		}
+		if h > cellH {
+			cellH = h
+		}
+	}
+	if cellW == 0 || cellH == 0 {
+		cellW, cellH = 512, 512
+	}
+
+	scale := cellW / 256
+	if scale < 1 {
+		scale = 1
+	}
+	pad := 4 * scale
+	labelH := glyphHeight*scale + 2*pad
+
+	leftW, topH, titleH := 0, 0, 0
+	if len(s.Y.Values) > 0 {
+		for i := range s.Y.Values {
+			if w := textWidth(s.Y.Label(i), scale) + 2*pad; w > leftW {
+				leftW = w
+			}
+		}
+		if leftW > cellW {
+			leftW = cellW
+		}
+	}
+	if len(s.X.Values) > 0 {
+		topH = labelH
+	}
+	if len(s.Z.Values) > 0 {
+		titleH = labelH
+	}
+
+	nx, ny, nz := s.X.Len(), s.Y.Len(), s.Z.Len()
+	subW := leftW + nx*cellW
+	subH := titleH + topH + ny*cellH
+	gap := 2 * pad
+	if nz == 1 {
+		gap = 0
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, nz*subW+(nz-1)*gap, subH))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(backgroundColor), image.Point{}, draw.Src)
+
+	for z := 0; z < nz; z++ {
+		ox := z * (subW + gap)
+		if titleH > 0 {
+			drawText(dst, ox+pad, pad, truncateText(s.Z.Label(z), subW-2*pad, scale), scale, textColor)
+		}
+		if topH > 0 {
+			for x := 0; x < nx; x++ {
+				label := truncateText(s.X.Label(x), cellW-2*pad, scale)
+				lx := ox + leftW + x*cellW + (cellW-textWidth(label, scale))/2
+				drawText(dst, lx, titleH+pad, label, scale, textColor)
+			}
+		}
+		if leftW > 0 {
+			for y := 0; y < ny; y++ {
+				label := truncateText(s.Y.Label(y), leftW-2*pad, scale)
+				ly := titleH + topH + y*cellH + (cellH-glyphHeight*scale)/2
+				drawText(dst, ox+pad, ly, label, scale, textColor)
+			}
+		}
+	}
+
+	for _, c := range cells {
+		ox := c.Z*(subW+gap) + leftW + c.X*cellW
+		oy := titleH + topH + c.Y*cellH
+		r := image.Rect(ox, oy, ox+cellW, oy+cellH)
+		if c.Image == nil {
+			draw.Draw(dst, r.Inset(pad/2), image.NewUniform(failedColor), image.Point{}, draw.Src)
+			label := truncateText("failed", cellW-2*pad, scale)
+			drawText(dst, ox+(cellW-textWidth(label, scale))/2, oy+(cellH-glyphHeight*scale)/2, label, scale, textColor)
+			continue
+		}
+		draw.Draw(dst, r, c.Image, c.Image.Bounds().Min, draw.Over)
+	}
+	return dst
+}
@@ -0,0 +1,180 @@
+package sweep
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/drawthings_go"
+	"github.com/drawthings_go/cache"
+	"github.com/drawthings_go/drawthingstest"
+)
+
+// colorGenerator returns a solid image whose red channel encodes the steps
+// and green channel the guidance scale, and fails requests with 13 steps.
+type colorGenerator struct {
+	requests []drawthings.TextToImageRequest
+}
+
+func (g *colorGenerator) GenerateImage(ctx context.Context, req *drawthings.TextToImageRequest) (*drawthings.TextToImageResponse, error) {
+	g.requests = append(g.requests, *req)
+	if req.Steps == 13 {
+		return nil, &drawthings.APIError{StatusCode: 500, Body: "unlucky"}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, req.Width, req.Height))
+	c := color.RGBA{uint8(req.Steps), uint8(req.GuidanceScale * 10), 0, 255}
+	for y := 0; y < req.Height; y++ {
+		for x := 0; x < req.Width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return &drawthings.TextToImageResponse{Images: []string{base64.StdEncoding.EncodeToString(buf.Bytes())}}, nil
+}
+
+func mustAxis(t *testing.T, spec string) Axis {
+	t.Helper()
+	axis, err := ParseAxis(spec)
+	if err != nil {
+		t.Fatalf("ParseAxis(%q) error = %v", spec, err)
+	}
+	return axis
+}
+
+func TestSweep_Cells(t *testing.T) {
+	s := &Sweep{
+		Base: drawthings.TextToImageRequest{Prompt: "fox", Seed: -1},
+		X:    mustAxis(t, "steps=10,20,30"),
+		Y:    mustAxis(t, "guidance-scale=3,5"),
+	}
+
+	cells, err := s.Cells()
+	if err != nil {
+		t.Fatalf("Cells() error = %v", err)
+	}
+	if len(cells) != 6 {
+		t.Fatalf("expected 6 cells, got %d", len(cells))
+	}
+	if s.Base.Seed <= 0 {
+		t.Errorf("expected a fixed seed, got %d", s.Base.Seed)
+	}
+	for _, c := range cells {
+		if c.Request.Seed != s.Base.Seed {
+			t.Errorf("cell seed %d differs from sweep seed %d", c.Request.Seed, s.Base.Seed)
+		}
+	}
+	last := cells[5]
+	if last.X != 2 || last.Y != 1 || last.Request.Steps != 30 || last.Request.GuidanceScale != 5 {
+		t.Errorf("unexpected last cell: %+v", last)
+	}
+}
+
+func TestSweep_RunAndGrid(t *testing.T) {
+	s := &Sweep{
+		Base: drawthings.TextToImageRequest{Prompt: "fox", Width: 64, Height: 32, Seed: 7},
+		X:    mustAxis(t, "steps=10,13"),
+		Y:    mustAxis(t, "guidance-scale=3,5"),
+		Z:    mustAxis(t, "negative-prompt=a,b"),
+	}
+
+	gen := &colorGenerator{}
+	var seen int
+	cells, err := s.Run(context.Background(), gen, func(Cell) { seen++ })
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(gen.requests) != 8 || seen != 8 {
+		t.Fatalf("expected 8 requests and callbacks, got %d and %d", len(gen.requests), seen)
+	}
+
+	var failed int
+	for _, c := range cells {
+		if c.Err != nil {
+			failed++
+			if !drawthings.IsAPIError(c.Err) {
+				t.Errorf("unexpected error type %T", c.Err)
+			}
+		}
+	}
+	if failed != 4 {
+		t.Errorf("expected 4 failed cells, got %d", failed)
+	}
+
+	grid := s.Grid(cells)
+	b := grid.Bounds()
+	if b.Dx() <= 2*2*64 || b.Dy() <= 2*32 {
+		t.Fatalf("grid too small: %v", b)
+	}
+
+	// Find the first successful cell (steps=10, guidance=3) by its color.
+	want := color.RGBA{10, 30, 0, 255}
+	found := false
+	for y := b.Min.Y; y < b.Max.Y && !found; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if grid.RGBAAt(x, y) == want {
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		t.Error("grid does not contain the generated cell image")
+	}
+}
+
+func TestSweep_RunCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s := &Sweep{Base: drawthings.TextToImageRequest{Prompt: "fox"}, X: mustAxis(t, "steps=1,2")}
+	gen := &colorGenerator{}
+	if _, err := s.Run(ctx, gen, nil); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if len(gen.requests) != 0 {
+		t.Errorf("expected no requests, got %d", len(gen.requests))
+	}
+}
+
+func TestSweep_RandomSeedBypassesCache(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+	rc, err := cache.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := drawthings.NewClient(drawthings.WithBaseURL(server.URL), drawthings.WithCache(rc))
+
+	for _, seed := range []int{-1, 7} {
+		s := &Sweep{Base: drawthings.TextToImageRequest{Prompt: "fox", Width: 64, Height: 64, Seed: seed}, X: mustAxis(t, "steps=1,2")}
+		if _, err := s.Run(context.Background(), client, nil); err != nil {
+			t.Fatal(err)
+		}
+		stats, err := rc.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Only the sweep with a fixed seed is cached.
+		if stats.Entries != 0 && seed < 0 || stats.Entries != 2 && seed > 0 {
+			t.Errorf("seed %d: %d cache entries", seed, stats.Entries)
+		}
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	if got := truncateText("short", 1000, 1); got != "short" {
+		t.Errorf("truncateText() = %q", got)
+	}
+	got := truncateText("a much longer label", textWidth("a much", 1), 1)
+	if textWidth(got, 1) > textWidth("a much", 1) {
+		t.Errorf("truncated text %q does not fit", got)
+	}
+}
@@ -0,0 +1,125 @@
+package tile
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// toRGBA returns img as an *image.RGBA with its origin at (0, 0).
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	if rgba, ok := img.(*image.RGBA); ok && b.Min == (image.Point{}) {
+		return rgba
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
+
+// resize scales img to width by height with bilinear interpolation.
+func resize(img image.Image, width, height int) *image.RGBA {
+	src := toRGBA(img)
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	if sw == width && sh == height {
+		return src
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		// Sample at pixel centers.
+		fy := (float64(y)+0.5)*float64(sh)/float64(height) - 0.5
+		y0, ty := split(fy, sh)
+		for x := 0; x < width; x++ {
+			fx := (float64(x)+0.5)*float64(sw)/float64(width) - 0.5
+			x0, tx := split(fx, sw)
+			x1, y1 := min(x0+1, sw-1), min(y0+1, sh-1)
+			a, b := src.RGBAAt(x0, y0), src.RGBAAt(x1, y0)
+			c, d := src.RGBAAt(x0, y1), src.RGBAAt(x1, y1)
+			lerp := func(a, b, c, d uint8) uint8 {
+				top := float64(a) + (float64(b)-float64(a))*tx
+				bottom := float64(c) + (float64(d)-float64(c))*tx
+				return uint8(top + (bottom-top)*ty + 0.5)
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: lerp(a.R, b.R, c.R, d.R),
+				G: lerp(a.G, b.G, c.G, d.G),
+				B: lerp(a.B, b.B, c.B, d.B),
+				A: lerp(a.A, b.A, c.A, d.A),
+			})
+		}
+	}
+	return dst
+}
+
+// split returns the integer part of f, clamped to [0, n), and the fraction
+// towards the next pixel.
+func split(f float64, n int) (int, float64) {
+	if f <= 0 {
+		return 0, 0
+	}
+	i := int(f)
+	if i >= n-1 {
+		return n - 1, 0
+	}
+	return i, f - float64(i)
+}
+
+// canvas accumulates tiles weighted by feathered masks.
+type canvas struct {
+	width, height int
+	feather       int
+	sum           []float64
+	weight        []float64
+}
+
+// newCanvas creates a canvas for a width by height image. Tiles fade in
+// over feather pixels from edges that lie inside the image.
+func newCanvas(width, height, feather int) *canvas {
+	return &canvas{
+		width:   width,
+		height:  height,
+		feather: feather,
+		sum:     make([]float64, width*height*4),
+		weight:  make([]float64, width*height),
+	}
+}
+
+// add blends img into the area r of the canvas.
+func (c *canvas) add(img *image.RGBA, r image.Rectangle) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		wy := c.ramp(y-r.Min.Y, r.Min.Y > 0) * c.ramp(r.Max.Y-1-y, r.Max.Y < c.height)
+		for x := r.Min.X; x < r.Max.X; x++ {
+			w := wy * c.ramp(x-r.Min.X, r.Min.X > 0) * c.ramp(r.Max.X-1-x, r.Max.X < c.width)
+			p := img.RGBAAt(x-r.Min.X, y-r.Min.Y)
+			i := y*c.width + x
+			c.sum[i*4] += w * float64(p.R)
+			c.sum[i*4+1] += w * float64(p.G)
+			c.sum[i*4+2] += w * float64(p.B)
+			c.sum[i*4+3] += w * float64(p.A)
+			c.weight[i] += w
+		}
+	}
+}
+
+// ramp returns the weight of a pixel d pixels from a tile edge. Edges at
+// the image border are not feathered.
+func (c *canvas) ramp(d int, inside bool) float64 {
+	if !inside || c.feather == 0 || d >= c.feather {
+		return 1
+	}
+	return (float64(d) + 0.5) / float64(c.feather)
+}
+
+// image returns the blended image.
+func (c *canvas) image() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, c.width, c.height))
+	for i, w := range c.weight {
+		if w == 0 {
+			continue
+		}
+		for ch := 0; ch < 4; ch++ {
+			img.Pix[i*4+ch] = uint8(c.sum[i*4+ch]/w + 0.5)
+		}
+	}
+	return img
+}
@@ -0,0 +1,61 @@
+package tile
+
+import (
+	"fmt"
+	"image"
+)
+
+// Tile is a part of the output image refined with one request.
+type Tile struct {
+	// Index is the position of the tile in the grid, row by row.
+	Index int `json:"index"`
+	// Row and Col are the 0-based row and column of the tile.
+	Row int `json:"row"`
+	Col int `json:"col"`
+	// Rect is the area of the output image the tile covers.
+	Rect image.Rectangle `json:"rect"`
+}
+
+// Grid splits a width by height image into tiles of at most size pixels per
+// side that overlap their neighbors by at least overlap pixels. Tiles are
+// spread evenly, so the last row and column end at the image edge.
+func Grid(width, height, size, overlap int) ([]Tile, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("tile size must be positive, got %d", size)
+	}
+	if overlap < 0 || overlap >= size {
+		return nil, fmt.Errorf("overlap must be between 0 and the tile size %d, got %d", size, overlap)
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid image size %dx%d", width, height)
+	}
+
+	xs, ys := spans(width, size, overlap), spans(height, size, overlap)
+	tiles := make([]Tile, 0, len(xs)*len(ys))
+	for row, y := range ys {
+		for col, x := range xs {
+			tiles = append(tiles, Tile{
+				Index: len(tiles),
+				Row:   row,
+				Col:   col,
+				Rect:  image.Rect(x[0], y[0], x[1], y[1]),
+			})
+		}
+	}
+	return tiles, nil
+}
+
+// spans returns the [start, end) ranges of the tiles along one axis.
+func spans(length, size, overlap int) [][2]int {
+	if length <= size {
+		return [][2]int{{0, length}}
+	}
+	step := size - overlap
+	n := (length - overlap + step - 1) / step
+	spans := make([][2]int, n)
+	for i := range spans {
+		start := i * (length - size) / (n - 1)
+		spans[i] = [2]int{start, start + size}
+	}
+	return spans
+}
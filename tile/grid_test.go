@@ -0,0 +1,128 @@
+package tile
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestGrid(t *testing.T) {
+	tests := []struct {
+		width, height, size, overlap int
+		rows, cols                   int
+	}{
+		{100, 80, 1024, 128, 1, 1},
+		{1024, 1024, 1024, 128, 1, 1},
+		{2048, 1024, 1024, 128, 1, 3},
+		{1920, 1080, 768, 64, 2, 3},
+		{4000, 3000, 1024, 0, 3, 4},
+	}
+
+	for _, tt := range tests {
+		tiles, err := Grid(tt.width, tt.height, tt.size, tt.overlap)
+		if err != nil {
+			t.Fatalf("Grid(%d, %d, %d, %d) error = %v", tt.width, tt.height, tt.size, tt.overlap, err)
+		}
+		last := tiles[len(tiles)-1]
+		if last.Row+1 != tt.rows || last.Col+1 != tt.cols || len(tiles) != tt.rows*tt.cols {
+			t.Errorf("Grid(%d, %d, %d, %d) = %d tiles ending at %d,%d, want %dx%d",
+				tt.width, tt.height, tt.size, tt.overlap, len(tiles), last.Row, last.Col, tt.rows, tt.cols)
+			continue
+		}
+
+		covered := image.Rectangle{}
+		for i, tile := range tiles {
+			if tile.Index != i {
+				t.Errorf("tile %d has index %d", i, tile.Index)
+			}
+			if tile.Rect.Dx() > tt.size || tile.Rect.Dy() > tt.size {
+				t.Errorf("tile %d is %v, larger than %d", i, tile.Rect, tt.size)
+			}
+			covered = covered.Union(tile.Rect)
+			if tile.Col > 0 {
+				if overlap := tiles[i-1].Rect.Max.X - tile.Rect.Min.X; overlap < tt.overlap {
+					t.Errorf("tiles %d and %d overlap by %d, want at least %d", i-1, i, overlap, tt.overlap)
+				}
+			}
+			if tile.Row > 0 {
+				if overlap := tiles[i-tt.cols].Rect.Max.Y - tile.Rect.Min.Y; overlap < tt.overlap {
+					t.Errorf("tiles %d and %d overlap by %d, want at least %d", i-tt.cols, i, overlap, tt.overlap)
+				}
+			}
+		}
+		if covered != image.Rect(0, 0, tt.width, tt.height) {
+			t.Errorf("tiles cover %v, want the whole %dx%d image", covered, tt.width, tt.height)
+		}
+	}
+}
+
+func TestGrid_Invalid(t *testing.T) {
+	tests := []struct {
+		name                         string
+		width, height, size, overlap int
+	}{
+		{"zero size", 100, 100, 0, 0},
+		{"overlap equals size", 100, 100, 64, 64},
+		{"negative overlap", 100, 100, 64, -1},
+		{"empty image", 0, 100, 64, 8},
+	}
+	for _, tt := range tests {
+		if _, err := Grid(tt.width, tt.height, tt.size, tt.overlap); err == nil {
+			t.Errorf("%s: Grid() error = nil", tt.name)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.SetRGBA(0, 0, color.RGBA{0, 0, 0, 255})
+	src.SetRGBA(1, 0, color.RGBA{200, 200, 200, 255})
+
+	got := resize(src, 8, 2)
+	if got.Rect != image.Rect(0, 0, 8, 2) {
+		t.Fatalf("resize() bounds = %v", got.Rect)
+	}
+	if got.RGBAAt(0, 0).R != 0 || got.RGBAAt(7, 1).R != 200 {
+		t.Errorf("edges = %v, %v, want the source colors", got.RGBAAt(0, 0), got.RGBAAt(7, 1))
+	}
+	for x := 1; x < 8; x++ {
+		if got.RGBAAt(x, 0).R < got.RGBAAt(x-1, 0).R {
+			t.Errorf("resize() is not a smooth ramp at x=%d: %d after %d", x, got.RGBAAt(x, 0).R, got.RGBAAt(x-1, 0).R)
+		}
+	}
+	if resize(got, 8, 2) != got {
+		t.Error("resize() to the same size should return the image")
+	}
+}
+
+func TestCanvas_Feather(t *testing.T) {
+	fill := func(c color.RGBA) *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, 60, 10))
+		for i := 0; i < len(img.Pix); i += 4 {
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+		}
+		return img
+	}
+
+	// Two tiles overlapping in columns 40-59.
+	c := newCanvas(100, 10, 20)
+	c.add(fill(color.RGBA{0, 0, 0, 255}), image.Rect(0, 0, 60, 10))
+	c.add(fill(color.RGBA{255, 255, 255, 255}), image.Rect(40, 0, 100, 10))
+	img := c.image()
+
+	if r := img.RGBAAt(39, 5).R; r != 0 {
+		t.Errorf("left of the seam = %d, want 0", r)
+	}
+	if r := img.RGBAAt(60, 5).R; r != 255 {
+		t.Errorf("right of the seam = %d, want 255", r)
+	}
+	for x := 41; x < 60; x++ {
+		prev, cur := img.RGBAAt(x-1, 5).R, img.RGBAAt(x, 5).R
+		if cur < prev || cur-prev > 40 {
+			t.Errorf("seam at x=%d jumps from %d to %d", x, prev, cur)
+		}
+	}
+	if a := img.RGBAAt(50, 5).A; a != 255 {
+		t.Errorf("alpha in the seam = %d, want 255", a)
+	}
+}
@@ -0,0 +1,443 @@
+// Package tile renders images larger than a Draw Things server can produce
+// in one request.
+//
+// A base image is scaled to the output size and split into overlapping
+// tiles. Each tile is refined with an image-to-image request, and the
+// results are blended back together with feathered seams. Finished tiles
+// can be kept in a work directory, so an interrupted run resumes where it
+// stopped.
+package tile
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	// Register decoders for the formats servers may return.
+	_ "image/jpeg"
+
+	"github.com/drawthings_go"
+	"github.com/drawthings_go/internal/fsutil"
+)
+
+// Defaults for a Runner.
+const (
+	DefaultScale   = 2.0
+	DefaultSize    = 1024
+	DefaultOverlap = 128
+)
+
+// planFile is the name of the plan in a work directory.
+const planFile = "plan.json"
+
+// ErrPlanMismatch is returned when a work directory holds tiles made for a
+// different source image, layout or request.
+var ErrPlanMismatch = errors.New("work directory holds tiles of a different run")
+
+// Generator generates images from source images. *drawthings.Client and
+// *drawthings.Pool satisfy it.
+type Generator interface {
+	ImageToImage(ctx context.Context, req *drawthings.ImageToImageRequest) (*drawthings.TextToImageResponse, error)
+}
+
+// optionsReader is implemented by generators that report the server
+// settings, such as *drawthings.Client.
+type optionsReader interface {
+	Options(ctx context.Context) (map[string]interface{}, error)
+}
+
+// Option keys under which servers report the loaded model and the sampler.
+var (
+	modelKeys   = []string{"sd_model_checkpoint", "model"}
+	samplerKeys = []string{"sampler_name", "sampler"}
+)
+
+// Progress reports a finished tile.
+type Progress struct {
+	Tile Tile
+	// Done is the number of tiles finished so far, including this one.
+	Done int
+	// Total is the number of tiles in the grid.
+	Total int
+	// Resumed is true if the tile was read from the work directory rather
+	// than generated.
+	Resumed bool
+	// Duration is the time spent generating the tile.
+	Duration time.Duration
+}
+
+// Result is the outcome of a tiled run.
+type Result struct {
+	// Image is the blended output image.
+	Image *image.RGBA
+	// Seed is the seed sent with every tile.
+	Seed int
+	// Tiles is the grid the image was rendered in.
+	Tiles []Tile
+	// Resumed is the number of tiles read from the work directory.
+	Resumed int
+}
+
+// Runner renders images in tiles.
+type Runner struct {
+	generator  Generator
+	scale      float64
+	size       int
+	overlap    int
+	workDir    string
+	tilePrompt func(Tile) string
+	onProgress func(Progress)
+}
+
+// Option is a function that configures a Runner.
+type Option func(*Runner)
+
+// WithScale sets the factor the base image is scaled by (default 2).
+func WithScale(scale float64) Option {
+	return func(r *Runner) {
+		r.scale = scale
+	}
+}
+
+// WithTileSize sets the largest width and height of a tile in pixels
+// (default 1024). It must lie between drawthings.MinDimension and
+// drawthings.MaxDimension.
+func WithTileSize(size int) Option {
+	return func(r *Runner) {
+		r.size = size
+	}
+}
+
+// WithOverlap sets the least number of pixels neighboring tiles share
+// (default 128). Seams are blended across the overlap.
+func WithOverlap(overlap int) Option {
+	return func(r *Runner) {
+		r.overlap = overlap
+	}
+}
+
+// WithWorkDir keeps finished tiles in dir. A run with the same source,
+// layout and request reuses them instead of generating them again, unless
+// the generator reports that the server's model or sampler has changed.
+func WithWorkDir(dir string) Option {
+	return func(r *Runner) {
+		r.workDir = dir
+	}
+}
+
+// WithTilePrompt sets a function that returns the prompt for a tile. An
+// empty prompt falls back to that of the request.
+func WithTilePrompt(fn func(Tile) string) Option {
+	return func(r *Runner) {
+		r.tilePrompt = fn
+	}
+}
+
+// WithProgress sets a function called after each tile is finished.
+func WithProgress(fn func(Progress)) Option {
+	return func(r *Runner) {
+		r.onProgress = fn
+	}
+}
+
+// NewRunner creates a tile runner that refines tiles with gen.
+func NewRunner(gen Generator, opts ...Option) *Runner {
+	r := &Runner{
+		generator: gen,
+		scale:     DefaultScale,
+		size:      DefaultSize,
+		overlap:   DefaultOverlap,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Plan returns the tiles a source image of the given size is split into.
+func (r *Runner) Plan(width, height int) ([]Tile, error) {
+	w, h, err := r.outputSize(width, height)
+	if err != nil {
+		return nil, err
+	}
+	return Grid(w, h, r.size, r.overlap)
+}
+
+// outputSize validates the layout and returns the size of the output image
+// for a width by height source.
+func (r *Runner) outputSize(width, height int) (int, int, error) {
+	if r.size < drawthings.MinDimension || r.size > drawthings.MaxDimension {
+		return 0, 0, drawthings.NewValidationError("tile_size", fmt.Sprintf("tile size must be between %d and %d pixels, got %d", drawthings.MinDimension, drawthings.MaxDimension, r.size))
+	}
+	if r.overlap < 0 || r.overlap > r.size/2 {
+		return 0, 0, drawthings.NewValidationError("overlap", fmt.Sprintf("overlap must be between 0 and half the tile size (%d), got %d", r.size/2, r.overlap))
+	}
+	if r.scale <= 0 || math.IsInf(r.scale, 0) || math.IsNaN(r.scale) {
+		return 0, 0, drawthings.NewValidationError("scale", fmt.Sprintf("scale must be positive, got %v", r.scale))
+	}
+	w := int(math.Round(float64(width) * r.scale))
+	h := int(math.Round(float64(height) * r.scale))
+	if w < drawthings.MinDimension || h < drawthings.MinDimension {
+		return 0, 0, drawthings.NewValidationError("scale", fmt.Sprintf("output image must be at least %d pixels on each side, got %dx%d", drawthings.MinDimension, w, h))
+	}
+	return w, h, nil
+}
+
+// Run scales src, refines it tile by tile with req, and returns the blended
+// image. The width, height and source image of req are set per tile; its
+// other fields apply to every tile. A negative seed is replaced by a random
+// one shared by all tiles, which a resumed run reuses.
+func (r *Runner) Run(ctx context.Context, src image.Image, req drawthings.ImageToImageRequest) (*Result, error) {
+	b := src.Bounds()
+	width, height, err := r.outputSize(b.Dx(), b.Dy())
+	if err != nil {
+		return nil, err
+	}
+	tiles, err := Grid(width, height, r.size, r.overlap)
+	if err != nil {
+		return nil, err
+	}
+	base := resize(src, width, height)
+
+	p := r.newPlan(base, tiles, req)
+	if r.workDir != "" {
+		r.readSettings(ctx, &p)
+		if err := r.preparePlan(&p); err != nil {
+			return nil, err
+		}
+	}
+	if p.Seed < 0 {
+		p.Seed = int(rand.Int31())
+	}
+
+	result := &Result{Seed: p.Seed, Tiles: tiles}
+	c := newCanvas(width, height, r.overlap)
+	for i, t := range tiles {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		started := time.Now()
+		img, resumed := r.readTile(t)
+		if img == nil {
+			img, err = r.refine(ctx, base, t, p.Tiles[i].Prompt, p.Seed, req)
+			if err != nil {
+				return nil, fmt.Errorf("tile %d (row %d, column %d): %w", t.Index, t.Row, t.Col, err)
+			}
+			if err := r.writeTile(t, img); err != nil {
+				return nil, err
+			}
+		} else {
+			result.Resumed++
+		}
+		c.add(img, t.Rect)
+
+		if r.onProgress != nil {
+			r.onProgress(Progress{
+				Tile:     t,
+				Done:     i + 1,
+				Total:    len(tiles),
+				Resumed:  resumed,
+				Duration: time.Since(started),
+			})
+		}
+	}
+
+	result.Image = c.image()
+	return result, nil
+}
+
+// refine generates the tile t of base.
+func (r *Runner) refine(ctx context.Context, base *image.RGBA, t Tile, prompt string, seed int, req drawthings.ImageToImageRequest) (*image.RGBA, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, base.SubImage(t.Rect)); err != nil {
+		return nil, fmt.Errorf("failed to encode tile: %w", err)
+	}
+
+	req.Prompt = prompt
+	req.Seed = seed
+	req.Width, req.Height = t.Rect.Dx(), t.Rect.Dy()
+	req.InitImages = []string{base64.StdEncoding.EncodeToString(buf.Bytes())}
+	resp, err := r.generator.ImageToImage(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Images) == 0 {
+		return nil, drawthings.NewDecodeError("no images in response", nil)
+	}
+	data, err := base64.StdEncoding.DecodeString(resp.Images[0])
+	if err != nil {
+		return nil, drawthings.NewDecodeError("failed to decode base64 image data", err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, drawthings.NewDecodeError("failed to decode image", err)
+	}
+	// Servers may round the size; fit the result back into the tile.
+	return resize(img, t.Rect.Dx(), t.Rect.Dy()), nil
+}
+
+// plan records what a work directory's tiles were made from.
+type plan struct {
+	Source            string     `json:"source"`
+	Width             int        `json:"width"`
+	Height            int        `json:"height"`
+	NegativePrompt    string     `json:"negative_prompt,omitempty"`
+	Model             string     `json:"model,omitempty"`
+	Sampler           string     `json:"sampler,omitempty"`
+	Steps             int        `json:"steps"`
+	GuidanceScale     float64    `json:"guidance_scale"`
+	DenoisingStrength float64    `json:"denoising_strength"`
+	Seed              int        `json:"seed"`
+	Tiles             []tilePlan `json:"tiles"`
+}
+
+// tilePlan is the part of a plan specific to one tile.
+type tilePlan struct {
+	Tile
+	Prompt string `json:"prompt"`
+}
+
+// newPlan describes a run over base.
+func (r *Runner) newPlan(base *image.RGBA, tiles []Tile, req drawthings.ImageToImageRequest) plan {
+	req.SetDefaults()
+	sum := sha256.Sum256(base.Pix)
+	p := plan{
+		Source:            hex.EncodeToString(sum[:]),
+		Width:             base.Rect.Dx(),
+		Height:            base.Rect.Dy(),
+		NegativePrompt:    req.NegativePrompt,
+		Steps:             req.Steps,
+		GuidanceScale:     req.GuidanceScale,
+		DenoisingStrength: req.DenoisingStrength,
+		Seed:              req.Seed,
+		Tiles:             make([]tilePlan, len(tiles)),
+	}
+	for i, t := range tiles {
+		prompt := ""
+		if r.tilePrompt != nil {
+			prompt = r.tilePrompt(t)
+		}
+		if prompt == "" {
+			prompt = req.Prompt
+		}
+		p.Tiles[i] = tilePlan{Tile: t, Prompt: prompt}
+	}
+	return p
+}
+
+// readSettings records the model and sampler of the server in p, if the
+// generator reports them, so tiles rendered with other settings are not
+// reused. Servers without settings leave them empty.
+func (r *Runner) readSettings(ctx context.Context, p *plan) {
+	reader, ok := r.generator.(optionsReader)
+	if !ok {
+		return
+	}
+	options, err := reader.Options(ctx)
+	if err != nil {
+		return
+	}
+	p.Model = optionString(options, modelKeys)
+	p.Sampler = optionString(options, samplerKeys)
+}
+
+// optionString returns the first non-empty string option of keys.
+func optionString(options map[string]interface{}, keys []string) string {
+	for _, key := range keys {
+		if s, ok := options[key].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// preparePlan compares p with the plan in the work directory, taking its
+// seed if p has a random one, or writes p if there is none. Tiles are only
+// reused when the plans match.
+func (r *Runner) preparePlan(p *plan) error {
+	path := filepath.Join(r.workDir, planFile)
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		var prev plan
+		if err := json.Unmarshal(data, &prev); err != nil {
+			return fmt.Errorf("%w: cannot read %s: %v", ErrPlanMismatch, path, err)
+		}
+		if p.Seed < 0 {
+			p.Seed = prev.Seed
+		}
+		want, _ := json.Marshal(p)
+		got, _ := json.Marshal(prev)
+		if !bytes.Equal(want, got) {
+			return fmt.Errorf("%w: %s; remove it to start over", ErrPlanMismatch, r.workDir)
+		}
+		return nil
+	case !errors.Is(err, os.ErrNotExist):
+		return drawthings.NewStorageError("failed to read tile plan", err)
+	}
+
+	if p.Seed < 0 {
+		p.Seed = int(rand.Int31())
+	}
+	data, err = json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode tile plan: %w", err)
+	}
+	if err := fsutil.WriteFile(path, append(data, '\n')); err != nil {
+		return drawthings.NewStorageError("failed to write tile plan", err)
+	}
+	return nil
+}
+
+// tilePath returns the path of tile t in the work directory.
+func (r *Runner) tilePath(t Tile) string {
+	return filepath.Join(r.workDir, fmt.Sprintf("tile-%03d.png", t.Index))
+}
+
+// readTile returns tile t from the work directory, or nil if it has not
+// been generated yet.
+func (r *Runner) readTile(t Tile) (*image.RGBA, bool) {
+	if r.workDir == "" {
+		return nil, false
+	}
+	f, err := os.Open(r.tilePath(t))
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil || img.Bounds().Dx() != t.Rect.Dx() || img.Bounds().Dy() != t.Rect.Dy() {
+		// Regenerate tiles that are damaged or of another size.
+		return nil, false
+	}
+	return toRGBA(img), true
+}
+
+// writeTile saves tile t in the work directory, if there is one.
+func (r *Runner) writeTile(t Tile, img *image.RGBA) error {
+	if r.workDir == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return fmt.Errorf("failed to encode tile: %w", err)
+	}
+	if err := fsutil.WriteFile(r.tilePath(t), buf.Bytes()); err != nil {
+		return drawthings.NewStorageError("failed to write tile file", err)
+	}
+	return nil
+}
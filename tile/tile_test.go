@@ -0,0 +1,234 @@
+package tile
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/drawthings_go"
+	"github.com/drawthings_go/drawthingstest"
+)
+
+// source returns a width by height test image.
+func source(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x * 4), uint8(y * 4), 128, 255})
+		}
+	}
+	return img
+}
+
+// fakeGenerator returns a flat gray image per request and fails the
+// request numbered failAt, counting from 1.
+type fakeGenerator struct {
+	requests []drawthings.ImageToImageRequest
+	failAt   int
+}
+
+func (g *fakeGenerator) ImageToImage(ctx context.Context, req *drawthings.ImageToImageRequest) (*drawthings.TextToImageResponse, error) {
+	g.requests = append(g.requests, *req)
+	if len(g.requests) == g.failAt {
+		return nil, drawthings.NewNetworkError("connection refused", nil)
+	}
+	img := image.NewGray(image.Rect(0, 0, req.Width, req.Height))
+	for i := range img.Pix {
+		img.Pix[i] = 100
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return &drawthings.TextToImageResponse{
+		Images: []string{base64.StdEncoding.EncodeToString(buf.Bytes())},
+	}, nil
+}
+
+func TestRunner_Run(t *testing.T) {
+	srv := drawthingstest.NewServer()
+	defer srv.Close()
+	client := drawthings.NewClient(drawthings.WithBaseURL(srv.URL))
+
+	var progress []Progress
+	runner := NewRunner(client,
+		WithScale(4),
+		WithTileSize(128),
+		WithOverlap(32),
+		WithTilePrompt(func(t Tile) string {
+			if t.Row == 1 && t.Col == 2 {
+				return "a red door"
+			}
+			return ""
+		}),
+		WithProgress(func(p Progress) {
+			progress = append(progress, p)
+		}),
+	)
+
+	src := source(64, 48)
+	req := drawthings.ImageToImageRequest{
+		TextToImageRequest: drawthings.TextToImageRequest{Prompt: "a house", Seed: 9},
+		DenoisingStrength:  0.4,
+	}
+	result, err := runner.Run(context.Background(), src, req)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if result.Image.Rect != image.Rect(0, 0, 256, 192) {
+		t.Errorf("image bounds = %v, want 256x192", result.Image.Rect)
+	}
+	if len(result.Tiles) != 6 || len(progress) != 6 {
+		t.Fatalf("got %d tiles and %d progress reports, want 6", len(result.Tiles), len(progress))
+	}
+	if p := progress[5]; p.Done != 6 || p.Total != 6 || p.Resumed {
+		t.Errorf("last progress = %+v", p)
+	}
+
+	sent := srv.RequestsTo(drawthingstest.PathImg2Img)
+	if len(sent) != 6 {
+		t.Fatalf("server got %d img2img requests, want 6", len(sent))
+	}
+	for i, r := range sent {
+		var body drawthings.ImageToImageRequest
+		if err := r.Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		want := "a house"
+		if i == 5 {
+			want = "a red door"
+		}
+		if body.Prompt != want || body.Seed != 9 || body.DenoisingStrength != 0.4 {
+			t.Errorf("request %d = prompt %q, seed %d, strength %v", i, body.Prompt, body.Seed, body.DenoisingStrength)
+		}
+		if body.Width != 128 || body.Height != 128 || len(body.InitImages) != 1 {
+			t.Errorf("request %d = %dx%d with %d images", i, body.Width, body.Height, len(body.InitImages))
+		}
+	}
+
+	// Pixels away from the seams come from a single tile.
+	base := resize(src, 256, 192)
+	data := drawthingstest.RefinedImage(base.SubImage(result.Tiles[0].Rect), "a house", 9, 128, 128, 0.4)
+	want, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := result.Image.RGBAAt(10, 10); got != color.RGBAModel.Convert(want.At(10, 10)) {
+		t.Errorf("pixel (10, 10) = %v, want %v", got, want.At(10, 10))
+	}
+}
+
+func TestRunner_Resume(t *testing.T) {
+	dir := t.TempDir()
+	src := source(64, 64)
+	req := drawthings.ImageToImageRequest{
+		TextToImageRequest: drawthings.TextToImageRequest{Prompt: "a forest", Seed: -1},
+	}
+	opts := []Option{WithScale(3), WithTileSize(128), WithOverlap(32), WithWorkDir(dir)}
+
+	failing := &fakeGenerator{failAt: 3}
+	_, err := NewRunner(failing, opts...).Run(context.Background(), src, req)
+	var netErr *drawthings.NetworkError
+	if !errors.As(err, &netErr) {
+		t.Fatalf("Run() error = %v, want a *NetworkError", err)
+	}
+	seed := failing.requests[0].Seed
+	if seed < 0 {
+		t.Fatalf("tiles were sent with seed %d, want a resolved seed", seed)
+	}
+
+	gen := &fakeGenerator{}
+	var resumed int
+	result, err := NewRunner(gen, append(opts, WithProgress(func(p Progress) {
+		if p.Resumed {
+			resumed++
+		}
+	}))...).Run(context.Background(), src, req)
+	if err != nil {
+		t.Fatalf("Run() after failure error = %v", err)
+	}
+	if result.Resumed != 2 || resumed != 2 {
+		t.Errorf("resumed %d tiles (%d reported), want 2", result.Resumed, resumed)
+	}
+	if len(gen.requests) != len(result.Tiles)-2 {
+		t.Errorf("generated %d tiles, want %d", len(gen.requests), len(result.Tiles)-2)
+	}
+	if result.Seed != seed || gen.requests[0].Seed != seed {
+		t.Errorf("resumed run used seed %d, want %d", result.Seed, seed)
+	}
+
+	req.Prompt = "a desert"
+	_, err = NewRunner(gen, opts...).Run(context.Background(), src, req)
+	if !errors.Is(err, ErrPlanMismatch) {
+		t.Errorf("Run() with another prompt error = %v, want ErrPlanMismatch", err)
+	}
+}
+
+// optionsGenerator is a fakeGenerator that reports server settings.
+type optionsGenerator struct {
+	fakeGenerator
+	options map[string]interface{}
+}
+
+func (g *optionsGenerator) Options(context.Context) (map[string]interface{}, error) {
+	return g.options, nil
+}
+
+func TestRunner_ResumeChecksSettings(t *testing.T) {
+	dir := t.TempDir()
+	src := source(64, 64)
+	req := drawthings.ImageToImageRequest{
+		TextToImageRequest: drawthings.TextToImageRequest{Prompt: "a forest", Seed: 5},
+	}
+	opts := []Option{WithScale(3), WithTileSize(128), WithOverlap(32), WithWorkDir(dir)}
+	settings := map[string]interface{}{"model": "sdxl.ckpt", "sampler": "DPM++ 2M Karras"}
+
+	gen := &optionsGenerator{options: settings}
+	if _, err := NewRunner(gen, opts...).Run(context.Background(), src, req); err != nil {
+		t.Fatal(err)
+	}
+	rerun := &optionsGenerator{options: settings}
+	if _, err := NewRunner(rerun, opts...).Run(context.Background(), src, req); err != nil || len(rerun.requests) != 0 {
+		t.Fatalf("rerun with the same settings: %d requests, error %v; want every tile resumed", len(rerun.requests), err)
+	}
+
+	for _, changed := range []map[string]interface{}{
+		{"model": "flux.ckpt", "sampler": "DPM++ 2M Karras"},
+		{"model": "sdxl.ckpt", "sampler": "Euler A"},
+	} {
+		_, err := NewRunner(&optionsGenerator{options: changed}, opts...).Run(context.Background(), src, req)
+		if !errors.Is(err, ErrPlanMismatch) {
+			t.Errorf("Run() with settings %v error = %v, want ErrPlanMismatch", changed, err)
+		}
+	}
+}
+
+func TestRunner_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []Option
+		field string
+	}{
+		{"tile too large", []Option{WithTileSize(drawthings.MaxDimension + 64)}, "tile_size"},
+		{"tile too small", []Option{WithTileSize(32)}, "tile_size"},
+		{"overlap too large", []Option{WithTileSize(256), WithOverlap(200)}, "overlap"},
+		{"zero scale", []Option{WithScale(0)}, "scale"},
+		{"output too small", []Option{WithScale(0.1)}, "scale"},
+	}
+
+	for _, tt := range tests {
+		gen := &fakeGenerator{}
+		_, err := NewRunner(gen, tt.opts...).Run(context.Background(), source(64, 64), drawthings.ImageToImageRequest{})
+		var valErr *drawthings.ValidationError
+		if !errors.As(err, &valErr) || valErr.Field != tt.field {
+			t.Errorf("%s: Run() error = %v, want a validation error for %s", tt.name, err, tt.field)
+		}
+		if len(gen.requests) != 0 {
+			t.Errorf("%s: sent %d requests", tt.name, len(gen.requests))
+		}
+	}
+}
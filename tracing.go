@@ -0,0 +1,239 @@
+package drawthings
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"sync"
+	"time"
+
+	httpclient "github.com/drawthings_go/internal/http"
+)
+
+// Span names used by the client.
+const (
+	SpanGenerateImage = "drawthings.GenerateImage"
+	SpanHealth        = "drawthings.Health"
+	SpanImageToImage  = "drawthings.ImageToImage"
+	SpanProgress      = "drawthings.Progress"
+	SpanInterrupt     = "drawthings.Interrupt"
+	SpanModels        = "drawthings.Models"
+	SpanOptions       = "drawthings.Options"
+	SpanSetOptions    = "drawthings.SetOptions"
+	SpanCoalesced     = "drawthings.CoalescedRequest"
+)
+
+// Span attribute keys set by the client.
+const (
+	AttrEndpoint      = "drawthings.endpoint"
+	AttrSteps         = "drawthings.steps"
+	AttrWidth         = "drawthings.width"
+	AttrHeight        = "drawthings.height"
+	AttrSeed          = "drawthings.seed"
+	AttrGuidanceScale = "drawthings.guidance_scale"
+	AttrQueueWait     = "drawthings.queue_wait_ms"
+	AttrImages        = "drawthings.images"
+	AttrHealth        = "drawthings.health"
+	AttrCache         = "drawthings.cache"
+	AttrCoalesced     = "drawthings.coalesced"
+	AttrLink          = "drawthings.link"
+	AttrStatusCode    = "http.status_code"
+	AttrResponseBytes = "http.response_size"
+	AttrErrorType     = "error.type"
+)
+
+// traceParentHeader is the W3C Trace Context header sent with requests.
+const traceParentHeader = "traceparent"
+
+// Attribute is a key/value pair attached to a span.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attr returns an Attribute.
+func Attr(key string, value interface{}) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Tracer starts spans around client operations. Implement it to connect the
+// client to a tracing system such as OpenTelemetry; the default tracer does
+// nothing, and SpanRecorder records spans in memory for tests.
+type Tracer interface {
+	// Start begins a span named name, as a child of any span in ctx, and
+	// returns a context carrying the new span.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is an operation started by a Tracer.
+type Span interface {
+	// SetAttributes adds attributes to the span.
+	SetAttributes(attrs ...Attribute)
+	// End finishes the span. err is the error the operation failed with,
+	// or nil.
+	End(err error)
+	// TraceParent returns the W3C traceparent header for requests made
+	// within the span, or "" to send none.
+	TraceParent() string
+}
+
+// WithTracer traces GenerateImage and Health calls with t. Requests sent
+// within a span carry its W3C traceparent header, so server-side or gateway
+// traces join the caller's trace.
+func WithTracer(t Tracer) Option {
+	return func(c *Client) {
+		c.tracer = t
+	}
+}
+
+// NopTracer is a Tracer whose spans do nothing. It is the default.
+type NopTracer struct{}
+
+// Start returns ctx unchanged and a span that does nothing.
+func (NopTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(...Attribute) {}
+func (nopSpan) End(error)                  {}
+func (nopSpan) TraceParent() string        { return "" }
+
+// SpanRecorder is a Tracer that keeps finished and running spans in memory,
+// for tests. It generates W3C-compatible trace and span IDs.
+type SpanRecorder struct {
+	mu    sync.Mutex
+	spans []*RecordedSpan
+}
+
+// NewSpanRecorder creates an empty SpanRecorder.
+func NewSpanRecorder() *SpanRecorder {
+	return &SpanRecorder{}
+}
+
+// RecordedSpan is a span captured by a SpanRecorder.
+type RecordedSpan struct {
+	Name         string
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Attributes   map[string]interface{}
+	Start        time.Time
+	End          time.Time
+	// Ended reports whether End was called.
+	Ended bool
+	// Err is the error passed to End.
+	Err error
+}
+
+type recorderSpanKey struct{}
+
+// Start begins a recorded span.
+func (r *SpanRecorder) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	rs := &RecordedSpan{
+		Name:       name,
+		SpanID:     randomHex(8),
+		Attributes: make(map[string]interface{}),
+		Start:      time.Now(),
+	}
+	if parent, ok := ctx.Value(recorderSpanKey{}).(*recordedSpan); ok {
+		rs.TraceID = parent.span.TraceID
+		rs.ParentSpanID = parent.span.SpanID
+	} else {
+		rs.TraceID = randomHex(16)
+	}
+	for _, a := range attrs {
+		rs.Attributes[a.Key] = a.Value
+	}
+
+	r.mu.Lock()
+	r.spans = append(r.spans, rs)
+	r.mu.Unlock()
+
+	s := &recordedSpan{recorder: r, span: rs}
+	return context.WithValue(ctx, recorderSpanKey{}, s), s
+}
+
+// Spans returns copies of the recorded spans in the order they started.
+func (r *SpanRecorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	spans := make([]RecordedSpan, len(r.spans))
+	for i, s := range r.spans {
+		spans[i] = *s
+		spans[i].Attributes = make(map[string]interface{}, len(s.Attributes))
+		for k, v := range s.Attributes {
+			spans[i].Attributes[k] = v
+		}
+	}
+	return spans
+}
+
+// Reset discards all recorded spans.
+func (r *SpanRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = nil
+}
+
+// recordedSpan is the Span handed out by a SpanRecorder.
+type recordedSpan struct {
+	recorder *SpanRecorder
+	span     *RecordedSpan
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...Attribute) {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	for _, a := range attrs {
+		s.span.Attributes[a.Key] = a.Value
+	}
+}
+
+func (s *recordedSpan) End(err error) {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	if s.span.Ended {
+		return
+	}
+	s.span.End = time.Now()
+	s.span.Ended = true
+	s.span.Err = err
+}
+
+func (s *recordedSpan) TraceParent() string {
+	return "00-" + s.span.TraceID + "-" + s.span.SpanID + "-01"
+}
+
+// withTraceParent returns a context that sends span's traceparent header
+// with requests.
+func withTraceParent(ctx context.Context, span Span) context.Context {
+	if tp := span.TraceParent(); tp != "" {
+		return httpclient.ContextWithHeader(ctx, traceParentHeader, tp)
+	}
+	return ctx
+}
+
+// randomHex returns n random bytes, hex-encoded.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic("drawthings: cannot generate trace ID: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
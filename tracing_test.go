@@ -0,0 +1,122 @@
+package drawthings
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/drawthings_go/drawthingstest"
+)
+
+var traceParentPattern = regexp.MustCompile(`^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`)
+
+func TestTracing_NopDefault(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+
+	client := NewClient(WithBaseURL(server.URL))
+	if _, err := client.GenerateImage(context.Background(), &TextToImageRequest{Prompt: "fox"}); err != nil {
+		t.Fatal(err)
+	}
+	if tp := server.Requests()[0].Header.Get("traceparent"); tp != "" {
+		t.Errorf("no-op tracer sent traceparent %q", tp)
+	}
+}
+
+func TestTracing_GenerateImage(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+
+	rec := NewSpanRecorder()
+	client := NewClient(WithBaseURL(server.URL), WithTracer(rec), WithMaxConcurrency(1))
+
+	ctx, parent := rec.Start(context.Background(), "handler")
+	_, err := client.GenerateImage(ctx, &TextToImageRequest{Prompt: "fox", Steps: 12, Width: 640, Height: 384, Seed: 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent.End(nil)
+
+	spans := rec.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	span := spans[1]
+	if span.Name != SpanGenerateImage || !span.Ended || span.Err != nil {
+		t.Errorf("unexpected span: %+v", span)
+	}
+	if span.TraceID != spans[0].TraceID || span.ParentSpanID != spans[0].SpanID {
+		t.Errorf("span is not a child of the caller's span: %+v", span)
+	}
+	for key, want := range map[string]interface{}{
+		AttrEndpoint:   "/sdapi/v1/txt2img",
+		AttrSteps:      12,
+		AttrWidth:      640,
+		AttrHeight:     384,
+		AttrSeed:       9,
+		AttrStatusCode: http.StatusOK,
+		AttrImages:     1,
+	} {
+		if got := span.Attributes[key]; got != want {
+			t.Errorf("attribute %s = %v, want %v", key, got, want)
+		}
+	}
+	if n, _ := span.Attributes[AttrResponseBytes].(int64); n <= 0 {
+		t.Errorf("expected response bytes, got %v", span.Attributes[AttrResponseBytes])
+	}
+	if _, ok := span.Attributes[AttrQueueWait]; !ok {
+		t.Error("expected queue wait attribute with a concurrency limit")
+	}
+
+	tp := server.Requests()[0].Header.Get("traceparent")
+	if !traceParentPattern.MatchString(tp) || tp != "00-"+span.TraceID+"-"+span.SpanID+"-01" {
+		t.Errorf("traceparent %q does not identify the span %s/%s", tp, span.TraceID, span.SpanID)
+	}
+}
+
+func TestTracing_Errors(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+
+	rec := NewSpanRecorder()
+	client := NewClient(WithBaseURL(server.URL), WithTracer(rec))
+
+	server.QueueFailure(drawthingstest.StatusFailure(http.StatusInternalServerError))
+	_, apiErr := client.GenerateImage(context.Background(), &TextToImageRequest{Prompt: "fox"})
+	_, valErr := client.GenerateImage(context.Background(), &TextToImageRequest{Prompt: "fox", Steps: 500})
+
+	spans := rec.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	if s := spans[0]; s.Err != apiErr || s.Attributes[AttrErrorType] != ErrorTypeAPI ||
+		s.Attributes[AttrStatusCode] != http.StatusInternalServerError {
+		t.Errorf("unexpected API error span: %+v", s)
+	}
+	if s := spans[1]; s.Err != valErr || s.Attributes[AttrErrorType] != ErrorTypeValidation || !s.Ended {
+		t.Errorf("unexpected validation error span: %+v", s)
+	}
+	if s := spans[1]; s.TraceID == spans[0].TraceID {
+		t.Error("unrelated calls should start separate traces")
+	}
+}
+
+func TestTracing_Health(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+
+	rec := NewSpanRecorder()
+	client := NewClient(WithBaseURL(server.URL), WithTracer(rec))
+	if err := client.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := rec.Spans()
+	if len(spans) != 1 || spans[0].Name != SpanHealth || spans[0].Attributes[AttrHealth] != string(HealthOK) {
+		t.Fatalf("unexpected spans: %+v", spans)
+	}
+	if tp := server.Requests()[0].Header.Get("traceparent"); !traceParentPattern.MatchString(tp) {
+		t.Errorf("unexpected traceparent %q", tp)
+	}
+}
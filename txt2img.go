@@ -3,13 +3,11 @@ package drawthings
 import (
 	"context"
 	"encoding/base64"
-	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 
 	httpclient "github.com/drawthings_go/internal/http"
-	"github.com/drawthings_go/internal/validation"
 )
 
 // GenerateImage generates an image from a text prompt using the Draw Things API.
@@ -17,20 +15,151 @@ func (c *Client) GenerateImage(ctx context.Context, req *TextToImageRequest) (*T
 	// Set defaults for optional fields
 	req.SetDefaults()
 
+	ctx, span := c.tracer.Start(ctx, SpanGenerateImage, requestAttrs(req)...)
+	resp, err := c.generateImage(ctx, req, span)
+	endGenerateSpan(span, resp, err)
+	return resp, err
+}
+
+// requestAttrs returns the span attributes describing a txt2img request.
+func requestAttrs(req *TextToImageRequest) []Attribute {
+	return []Attribute{
+		Attr(AttrEndpoint, txt2imgPath),
+		Attr(AttrSteps, req.Steps),
+		Attr(AttrWidth, req.Width),
+		Attr(AttrHeight, req.Height),
+		Attr(AttrSeed, req.Seed),
+		Attr(AttrGuidanceScale, req.GuidanceScale),
+	}
+}
+
+// endGenerateSpan records the outcome of a txt2img request and ends span.
+func endGenerateSpan(span Span, resp *TextToImageResponse, err error) {
+	if err != nil {
+		span.SetAttributes(Attr(AttrErrorType, ErrorType(err)))
+	} else {
+		span.SetAttributes(Attr(AttrImages, len(resp.Images)))
+	}
+	span.End(err)
+}
+
+// validate checks req as configured by WithStrictValidation and
+// WithTokenLimit.
+func (c *Client) validate(req *TextToImageRequest) error {
+	validate := req.Validate
+	if c.strict {
+		validate = req.ValidateStrict
+	}
+	if err := validate(); err != nil {
+		return err
+	}
+	if c.tokenizer != nil {
+		if err := req.ValidateTokens(c.tokenizer, c.tokenLimit); err != nil {
+			if c.strict {
+				return err
+			}
+			c.warn(err)
+		}
+	}
+	return nil
+}
+
+// generateImage sends a txt2img request within span.
+func (c *Client) generateImage(ctx context.Context, req *TextToImageRequest, span Span) (*TextToImageResponse, error) {
 	// Validate request parameters
-	if err := validation.ValidateTextToImageRequest(req.Prompt, req.Steps, req.GuidanceScale, req.Width, req.Height); err != nil {
-		// Convert to ValidationError
-		return nil, NewValidationError("", err.Error())
+	if err := c.validate(req); err != nil {
+		return nil, err
+	}
+
+	// Serve repeated fixed-seed requests from the cache
+	cacheKey := c.cacheKey(ctx, req)
+	if cacheKey != "" {
+		if cached, ok := c.cache.Get(cacheKey); ok {
+			span.SetAttributes(Attr(AttrCache, cacheHit))
+			return cached, nil
+		}
+		span.SetAttributes(Attr(AttrCache, cacheMiss))
+	} else if c.cache != nil {
+		span.SetAttributes(Attr(AttrCache, cacheBypass))
+	}
+
+	// Share one call between identical requests in flight
+	if c.flights != nil {
+		if key := flightKey(req); key != "" {
+			return c.coalesce(ctx, key, req, span, cacheKey)
+		}
+	}
+	return c.send(ctx, req, span, cacheKey)
+}
+
+// coalesce sends req once for all identical requests in flight. The shared
+// call may outlive the caller that started it, so it gets its own copy of
+// req and runs detached from every caller, in a span of its own that keeps
+// only the priority of the caller that started it. Each caller's span is
+// linked to it by the shared span's traceparent in AttrLink.
+func (c *Client) coalesce(ctx context.Context, key string, req *TextToImageRequest, span Span, cacheKey string) (*TextToImageResponse, error) {
+	r := *req
+	var flightSpan Span
+	start := func() (context.Context, string) {
+		flightCtx := WithPriority(context.Background(), PriorityFromContext(ctx))
+		flightCtx, flightSpan = c.tracer.Start(flightCtx, SpanCoalesced, requestAttrs(&r)...)
+		return flightCtx, flightSpan.TraceParent()
+	}
+	resp, link, joined, err := c.flights.do(ctx, key, start, func(ctx context.Context) (*TextToImageResponse, error) {
+		resp, err := c.send(ctx, &r, flightSpan, cacheKey)
+		endGenerateSpan(flightSpan, resp, err)
+		return resp, err
+	})
+	span.SetAttributes(Attr(AttrCoalesced, joined))
+	if link != "" {
+		span.SetAttributes(Attr(AttrLink, link))
+	}
+	return resp, err
+}
+
+// send posts req to the server within span and caches the response under
+// cacheKey, if it is set.
+func (c *Client) send(ctx context.Context, req *TextToImageRequest, span Span, cacheKey string) (*TextToImageResponse, error) {
+	apiResp, err := c.post(ctx, txt2imgPath, req, span)
+	if err != nil {
+		return nil, err
+	}
+	if cacheKey != "" {
+		if err := c.cache.Put(cacheKey, apiResp); err != nil && c.logger != nil {
+			c.logger.Logf("failed to cache response: %v", err)
+		}
+	}
+	return apiResp, nil
+}
+
+// post sends a generation request to the endpoint at path within span.
+func (c *Client) post(ctx context.Context, path string, req interface{}, span Span) (*TextToImageResponse, error) {
+	// Wait for a slot before the HTTP timeout starts
+	if c.limiter != nil {
+		wait, err := c.limiter.acquire(ctx)
+		if err != nil {
+			return nil, NewNetworkError("gave up waiting for a request slot", err)
+		}
+		defer c.limiter.release()
+		if c.metrics != nil {
+			c.metrics.ObserveQueueWait("client", wait)
+		}
+		span.SetAttributes(Attr(AttrQueueWait, wait.Milliseconds()))
 	}
 
 	// Build the API endpoint URL
-	url := fmt.Sprintf("%s/sdapi/v1/txt2img", c.baseURL)
+	url := c.baseURL + path
 
 	// Make the API request
-	resp, err := c.httpClient.PostJSON(ctx, url, req)
+	resp, err := c.httpClient.PostJSON(withTraceParent(ctx, span), url, req)
 	if err != nil {
 		return nil, NewNetworkError("API request failed", err)
 	}
+	body := &countingReader{ReadCloser: resp.Body}
+	resp.Body = body
+	defer func() {
+		span.SetAttributes(Attr(AttrStatusCode, resp.StatusCode), Attr(AttrResponseBytes, body.n))
+	}()
 
 	// Decode the response
 	var apiResp TextToImageResponse
@@ -59,7 +188,14 @@ func (c *Client) GenerateImageAndSave(ctx context.Context, req *TextToImageReque
 	if err != nil {
 		return err
 	}
+	return saveFirstImage(resp, outputPath)
+}
+
+// txt2imgPath is the text-to-image endpoint.
+const txt2imgPath = "/sdapi/v1/txt2img"
 
+// saveFirstImage decodes the first image in resp and writes it to outputPath.
+func saveFirstImage(resp *TextToImageResponse, outputPath string) error {
 	if len(resp.Images) == 0 {
 		return NewDecodeError("no images in response", nil)
 	}
@@ -74,13 +210,13 @@ func (c *Client) GenerateImageAndSave(ctx context.Context, req *TextToImageReque
 	dir := filepath.Dir(outputPath)
 	if dir != "." && dir != "" {
 		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("failed to create output directory: %w", err)
+			return NewStorageError("failed to create output directory", err)
 		}
 	}
 
 	// Write the image to file
 	if err := os.WriteFile(outputPath, imageData, 0644); err != nil {
-		return fmt.Errorf("failed to write image file: %w", err)
+		return NewStorageError("failed to write image file", err)
 	}
 
 	return nil
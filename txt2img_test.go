@@ -1,62 +1,34 @@
 package drawthings
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
-	"encoding/json"
+	"fmt"
 	"net/http"
-	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/drawthings_go/drawthingstest"
+	"github.com/drawthings_go/prompt"
 )
 
 func TestGenerateImage(t *testing.T) {
-	// Create a test server
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			t.Errorf("expected POST, got %s", r.Method)
-		}
-		if r.URL.Path != "/sdapi/v1/txt2img" {
-			t.Errorf("expected path /sdapi/v1/txt2img, got %s", r.URL.Path)
-		}
-
-		// Decode request
-		var req TextToImageRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			t.Errorf("failed to decode request: %v", err)
-		}
-
-		// Create a minimal valid PNG (1x1 transparent)
-		pngData := []byte{
-			0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A,
-			0x00, 0x00, 0x00, 0x0D, 0x49, 0x48, 0x44, 0x52,
-			0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01,
-			0x08, 0x06, 0x00, 0x00, 0x00, 0x1F, 0x15, 0xC4,
-			0x89, 0x00, 0x00, 0x00, 0x0A, 0x49, 0x44, 0x41,
-			0x54, 0x78, 0x9C, 0x63, 0x00, 0x01, 0x00, 0x00,
-			0x05, 0x00, 0x01, 0x0D, 0x0A, 0x2D, 0xB4, 0x00,
-			0x00, 0x00, 0x00, 0x49, 0x45, 0x4E, 0x44, 0xAE,
-			0x42, 0x60, 0x82,
-		}
-		encoded := base64.StdEncoding.EncodeToString(pngData)
-
-		response := TextToImageResponse{
-			Images: []string{encoded},
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
-	}))
+	server := drawthingstest.NewServer()
 	defer server.Close()
 
-	// Create client with test server URL
 	client := NewClient(WithBaseURL(server.URL))
 
 	req := &TextToImageRequest{
 		Prompt: "a test image",
 		Steps:  20,
+		Width:  64,
+		Height: 64,
+		Seed:   42,
 	}
 
 	ctx := context.Background()
@@ -65,8 +37,30 @@ func TestGenerateImage(t *testing.T) {
 		t.Fatalf("GenerateImage() error = %v", err)
 	}
 
-	if len(resp.Images) == 0 {
-		t.Error("expected at least one image in response")
+	if len(resp.Images) != 1 {
+		t.Fatalf("expected one image in response, got %d", len(resp.Images))
+	}
+	got, err := base64.StdEncoding.DecodeString(resp.Images[0])
+	if err != nil {
+		t.Fatalf("failed to decode image: %v", err)
+	}
+	if want := drawthingstest.Image("a test image", 42, 64, 64); !bytes.Equal(got, want) {
+		t.Error("image does not match the one derived from the prompt and seed")
+	}
+
+	requests := server.RequestsTo(drawthingstest.PathTxt2Img)
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+	if requests[0].Method != http.MethodPost {
+		t.Errorf("expected POST, got %s", requests[0].Method)
+	}
+	var sent TextToImageRequest
+	if err := requests[0].Decode(&sent); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+	if sent.Prompt != "a test image" || sent.Steps != 20 || sent.Seed != 42 {
+		t.Errorf("unexpected request sent: %+v", sent)
 	}
 }
 
@@ -85,14 +79,75 @@ func TestGenerateImage_ValidationError(t *testing.T) {
 	if !IsValidationError(err) {
 		t.Errorf("expected ValidationError, got %T", err)
 	}
+	if valErr, ok := err.(*ValidationError); ok && valErr.Field != "prompt" {
+		t.Errorf("Field: got %q, want %q", valErr.Field, "prompt")
+	}
+}
+
+func TestGenerateImage_StrictValidation(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+
+	req := TextToImageRequest{Prompt: "a (red fox", Width: 64, Height: 64}
+	if _, err := NewClient(WithBaseURL(server.URL)).GenerateImage(context.Background(), &req); err != nil {
+		t.Fatalf("lenient client: %v", err)
+	}
+	_, err := NewClient(WithBaseURL(server.URL), WithStrictValidation(true)).GenerateImage(context.Background(), &req)
+	if !IsValidationError(err) {
+		t.Errorf("strict client: got %v, want a ValidationError", err)
+	}
+	if n := len(server.RequestsTo(drawthingstest.PathTxt2Img)); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
+}
+
+// recordingLogger collects log lines.
+type recordingLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) Logf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func TestGenerateImage_TokenLimit(t *testing.T) {
+	server := drawthingstest.NewServer()
+	defer server.Close()
+	tok, err := prompt.LoadTokenizer("prompt/testdata/merges.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := TextToImageRequest{Prompt: strings.Repeat("red ", 80), Width: 64, Height: 64}
+	logger := &recordingLogger{}
+	client := NewClient(WithBaseURL(server.URL), WithLogger(logger), WithTokenLimit(tok, 0))
+	if _, err := client.GenerateImage(context.Background(), &req); err != nil {
+		t.Fatalf("lenient client: %v", err)
+	}
+	warned := false
+	for _, line := range logger.lines {
+		warned = warned || strings.Contains(line, "warning: ") && strings.Contains(line, "80 tokens")
+	}
+	if !warned {
+		t.Errorf("expected a token limit warning, got %q", logger.lines)
+	}
+
+	client = NewClient(WithBaseURL(server.URL), WithTokenLimit(tok, 0), WithStrictValidation(true))
+	if _, err := client.GenerateImage(context.Background(), &req); !IsValidationError(err) {
+		t.Errorf("strict client: got %v, want a ValidationError", err)
+	}
+	if n := len(server.RequestsTo(drawthingstest.PathTxt2Img)); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
 }
 
 func TestGenerateImage_ServerError(t *testing.T) {
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("internal server error"))
-	}))
+	server := drawthingstest.NewServer()
 	defer server.Close()
+	server.QueueFailure(drawthingstest.StatusFailure(http.StatusInternalServerError))
 
 	client := NewClient(WithBaseURL(server.URL))
 	req := &TextToImageRequest{
@@ -107,6 +162,41 @@ func TestGenerateImage_ServerError(t *testing.T) {
 	if !IsAPIError(err) {
 		t.Errorf("expected APIError, got %T", err)
 	}
+
+	// The failure is only used once.
+	if _, err := client.GenerateImage(ctx, req); err != nil {
+		t.Errorf("second GenerateImage() error = %v", err)
+	}
+}
+
+func TestGenerateImage_InjectedFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		failure drawthingstest.Failure
+		check   func(error) bool
+	}{
+		// Response bodies that cannot be read or parsed surface as network errors.
+		{"malformed JSON", drawthingstest.MalformedJSON(), IsNetworkError},
+		{"dropped connection", drawthingstest.DropConnection(), IsNetworkError},
+		{"no images", drawthingstest.NoImages(), IsDecodeError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := drawthingstest.NewServer()
+			defer server.Close()
+			server.SetFailure(tt.failure)
+
+			client := NewClient(WithBaseURL(server.URL))
+			_, err := client.GenerateImage(context.Background(), &TextToImageRequest{Prompt: "test"})
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !tt.check(err) {
+				t.Errorf("unexpected error type %T: %v", err, err)
+			}
+		})
+	}
 }
 
 func TestGenerateImageAndSave(t *testing.T) {
@@ -114,35 +204,16 @@ func TestGenerateImageAndSave(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputPath := filepath.Join(tmpDir, "test_output.png")
 
-	// Create a test server
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Create a minimal valid PNG
-		pngData := []byte{
-			0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A,
-			0x00, 0x00, 0x00, 0x0D, 0x49, 0x48, 0x44, 0x52,
-			0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01,
-			0x08, 0x06, 0x00, 0x00, 0x00, 0x1F, 0x15, 0xC4,
-			0x89, 0x00, 0x00, 0x00, 0x0A, 0x49, 0x44, 0x41,
-			0x54, 0x78, 0x9C, 0x63, 0x00, 0x01, 0x00, 0x00,
-			0x05, 0x00, 0x01, 0x0D, 0x0A, 0x2D, 0xB4, 0x00,
-			0x00, 0x00, 0x00, 0x49, 0x45, 0x4E, 0x44, 0xAE,
-			0x42, 0x60, 0x82,
-		}
-		encoded := base64.StdEncoding.EncodeToString(pngData)
-
-		response := TextToImageResponse{
-			Images: []string{encoded},
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
-	}))
+	server := drawthingstest.NewServer()
 	defer server.Close()
 
 	client := NewClient(WithBaseURL(server.URL))
 	req := &TextToImageRequest{
 		Prompt: "a test image",
 		Steps:  20,
+		Width:  64,
+		Height: 64,
+		Seed:   7,
 	}
 
 	ctx := context.Background()
@@ -151,27 +222,17 @@ func TestGenerateImageAndSave(t *testing.T) {
 		t.Fatalf("GenerateImageAndSave() error = %v", err)
 	}
 
-	// Verify file was created
-	if _, err := os.Stat(outputPath); os.IsNotExist(err) {
-		t.Fatal("output file was not created")
-	}
-
-	// Verify file is not empty
-	info, err := os.Stat(outputPath)
+	data, err := os.ReadFile(outputPath)
 	if err != nil {
-		t.Fatalf("failed to stat output file: %v", err)
+		t.Fatalf("failed to read output file: %v", err)
 	}
-	if info.Size() == 0 {
-		t.Error("output file is empty")
+	if want := drawthingstest.Image("a test image", 7, 64, 64); !bytes.Equal(data, want) {
+		t.Error("saved image does not match the generated image")
 	}
 }
 
 func TestGenerateImage_Timeout(t *testing.T) {
-	// Create a slow server
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		time.Sleep(2 * time.Second)
-		w.WriteHeader(http.StatusOK)
-	}))
+	server := drawthingstest.NewServer(drawthingstest.WithLatency(2 * time.Second))
 	defer server.Close()
 
 	client := NewClient(
@@ -192,4 +253,3 @@ func TestGenerateImage_Timeout(t *testing.T) {
 		t.Errorf("expected NetworkError, got %T: %v", err, err)
 	}
 }
-
@@ -1,5 +1,19 @@
 package drawthings
 
+import (
+	"encoding/json"
+
+	"github.com/drawthings_go/internal/validation"
+	"github.com/drawthings_go/prompt"
+)
+
+// MinDimension and MaxDimension bound the Width and Height of a request in
+// pixels. Package tile renders larger images in parts.
+const (
+	MinDimension = validation.MinDimension
+	MaxDimension = validation.MaxDimension
+)
+
 // TextToImageRequest represents a request to generate an image from text.
 type TextToImageRequest struct {
 	// Prompt is the textual description of the desired image (required).
@@ -48,9 +62,67 @@ func (r *TextToImageRequest) SetDefaults() {
 	}
 }
 
+// Validate checks the request parameters against the API limits and returns a
+// *ValidationError naming the offending field. Call SetDefaults first if
+// optional fields may be unset.
+func (r *TextToImageRequest) Validate() error {
+	if err := validation.ValidateTextToImageRequest(r.Prompt, r.Steps, r.GuidanceScale, r.Width, r.Height); err != nil {
+		if fieldErr, ok := err.(*validation.FieldError); ok {
+			return NewValidationError(fieldErr.Field, fieldErr.Message)
+		}
+		return NewValidationError("", err.Error())
+	}
+	return nil
+}
+
+// ValidateStrict checks the request like Validate, and also checks the
+// A1111 weighting syntax of the prompt and negative prompt. Unbalanced
+// brackets, empty groups, weights that are not numbers and malformed LoRA
+// tags are reported as a ValidationError that wraps a *prompt.SyntaxError
+// with the offset of the problem.
+func (r *TextToImageRequest) ValidateStrict() error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	for _, field := range []struct{ name, text string }{
+		{"prompt", r.Prompt},
+		{"negative_prompt", r.NegativePrompt},
+	} {
+		if _, err := prompt.ParseWeights(field.text, prompt.DialectA1111); err != nil {
+			return &ValidationError{Field: field.name, Message: err.Error(), Err: err}
+		}
+	}
+	return nil
+}
+
+// ValidateTokens checks that the prompt and negative prompt have at most
+// limit CLIP tokens, as counted by tok. A longer prompt is reported as a
+// ValidationError that wraps a *prompt.LimitError with the offset of the
+// first token past the limit. A limit of zero or less means
+// prompt.ChunkSize.
+func (r *TextToImageRequest) ValidateTokens(tok *prompt.Tokenizer, limit int) error {
+	if limit <= 0 {
+		limit = prompt.ChunkSize
+	}
+	for _, field := range []struct{ name, text string }{
+		{"prompt", r.Prompt},
+		{"negative_prompt", r.NegativePrompt},
+	} {
+		if err := tok.CheckLimit(field.text, limit); err != nil {
+			return &ValidationError{Field: field.name, Message: err.Error(), Err: err}
+		}
+	}
+	return nil
+}
+
 // TextToImageResponse represents the response from a text-to-image generation request.
 type TextToImageResponse struct {
 	// Images contains base64-encoded image data.
 	Images []string `json:"images"`
+	// Parameters echoes the parameters the server used, if it sends them.
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+	// Info holds the server's description of the generation; AUTOMATIC1111
+	// sends a JSON document as a string.
+	Info string `json:"info,omitempty"`
 }
 
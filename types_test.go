@@ -1,7 +1,10 @@
 package drawthings
 
 import (
+	"errors"
 	"testing"
+
+	"github.com/drawthings_go/prompt"
 )
 
 func TestTextToImageRequest_SetDefaults(t *testing.T) {
@@ -86,3 +89,66 @@ func TestTextToImageRequest_SetDefaults(t *testing.T) {
 	}
 }
 
+func TestTextToImageRequest_Validate(t *testing.T) {
+	req := &TextToImageRequest{Prompt: "a cat"}
+	req.SetDefaults()
+	if err := req.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	req.Width = 8192
+	err := req.Validate()
+	valErr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected *ValidationError, got %T", err)
+	}
+	if valErr.Field != "width" {
+		t.Errorf("Field: got %q, want %q", valErr.Field, "width")
+	}
+}
+
+func TestTextToImageRequest_ValidateStrict(t *testing.T) {
+	valid := &TextToImageRequest{
+		Prompt:         "a (red:1.3) fox, [blurry] <lora:film:0.5>",
+		NegativePrompt: "(worst quality)",
+	}
+	valid.SetDefaults()
+	if err := valid.ValidateStrict(); err != nil {
+		t.Errorf("ValidateStrict() error = %v", err)
+	}
+
+	req := &TextToImageRequest{Prompt: "a fox", NegativePrompt: "blurry, (ugly"}
+	req.SetDefaults()
+	if err := req.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v, want lenient validation", err)
+	}
+	err := req.ValidateStrict()
+	var valErr *ValidationError
+	if !errors.As(err, &valErr) || valErr.Field != "negative_prompt" {
+		t.Fatalf("ValidateStrict() error = %v, want a negative_prompt ValidationError", err)
+	}
+	var syntaxErr *prompt.SyntaxError
+	if !errors.As(err, &syntaxErr) || syntaxErr.Offset != 8 {
+		t.Errorf("ValidateStrict() error = %v, want a SyntaxError at offset 8", err)
+	}
+}
+
+func TestTextToImageRequest_ValidateTokens(t *testing.T) {
+	tok, err := prompt.LoadTokenizer("prompt/testdata/merges.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &TextToImageRequest{Prompt: "(red:1.2) <lora:film:0.5>", NegativePrompt: "hello hello hello"}
+	if err := req.ValidateTokens(tok, 3); err != nil {
+		t.Errorf("ValidateTokens() error = %v", err)
+	}
+	err = req.ValidateTokens(tok, 2)
+	var valErr *ValidationError
+	if !errors.As(err, &valErr) || valErr.Field != "negative_prompt" {
+		t.Fatalf("ValidateTokens() error = %v, want a negative_prompt ValidationError", err)
+	}
+	var limitErr *prompt.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Tokens != 3 || limitErr.Offset != 12 {
+		t.Errorf("ValidateTokens() error = %v, want a LimitError for 3 tokens at offset 12", err)
+	}
+}